@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/pkg/middleware"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type APIKeyHandler struct {
+	service ports.APIKeyService
+}
+
+func NewAPIKeyHandler(service ports.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// Create API Key; the plaintext key is only returned here
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn string   `json:"expires_in"` // e.g. "720h"; empty for no expiry
+	}
+	if err := c.BodyParser(&req); err != nil || req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid expires_in"})
+		}
+		ttl = d
+	}
+
+	userID := middleware.CurrentPrincipal(c).UserID
+	key, secret, err := h.service.Create(c.UserContext(), userID, req.Name, req.Scopes, ttl)
+	if errors.Is(err, ports.ErrInvalidScope) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"key": secret, "api_key": key})
+}
+
+// List API Keys of the current user
+func (h *APIKeyHandler) List(c *fiber.Ctx) error {
+	keys, err := h.service.List(c.UserContext(), middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(keys)
+}
+
+// Revoke API Key
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	err := h.service.Revoke(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"))
+	if errors.Is(err, ports.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
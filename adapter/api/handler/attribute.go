@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AttributeHandler struct {
+	service ports.AttributeService
+}
+
+func NewAttributeHandler(service ports.AttributeService) *AttributeHandler {
+	return &AttributeHandler{service: service}
+}
+
+// List custom attribute definitions
+func (h *AttributeHandler) List(c *fiber.Ctx) error {
+	defs, err := h.service.List(c.UserContext())
+	if err != nil {
+		return attributeError(c, err)
+	}
+	return c.JSON(defs)
+}
+
+// Define (create or replace) the attribute named in the path
+func (h *AttributeHandler) Define(c *fiber.Ctx) error {
+	var def model.AttributeDefinition
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	def.Name = c.Params("name")
+	saved, err := h.service.Define(c.UserContext(), &def)
+	if err != nil {
+		return attributeError(c, err)
+	}
+	return c.JSON(saved)
+}
+
+// Delete the definition and the attribute from every user
+func (h *AttributeHandler) Delete(c *fiber.Ctx) error {
+	if err := h.service.Delete(c.UserContext(), c.Params("name")); err != nil {
+		return attributeError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func attributeError(c *fiber.Ctx, err error) error {
+	var attrErr *ports.AttributeError
+	switch {
+	case errors.As(err, &attrErr):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid attribute definition", "violations": attrErr.Violations})
+	case errors.Is(err, ports.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attribute not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	audit ports.AuditLog
+}
+
+func NewAuditHandler(audit ports.AuditLog) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// List Audit Events (admin); filters: actor, target, action, since, until
+func (h *AuditHandler) List(c *fiber.Ctx) error {
+	filter := ports.AuditFilter{
+		ActorID:  c.Query("actor"),
+		TargetID: c.Query("target"),
+		Action:   c.Query("action"),
+		Limit:    c.QueryInt("limit"),
+		Offset:   c.QueryInt("offset"),
+	}
+	for param, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + param + ", expected RFC 3339"})
+			}
+			*dst = t
+		}
+	}
+
+	events, total, err := h.audit.Query(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"events": events, "total": total})
+}
+
+// Verify the audit hash chain (admin)
+func (h *AuditHandler) Verify(c *fiber.Ctx) error {
+	res, err := h.audit.Verify(c.UserContext())
+	if errors.Is(err, ports.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The audit log can only be verified from the default tenant"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(res)
+}
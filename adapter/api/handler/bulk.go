@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"register/core/ports"
+	"register/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ndjsonType = "application/x-ndjson"
+	csvType    = "text/csv"
+)
+
+// errPeek stops an export after its first user; see Export.
+var errPeek = errors.New("peek")
+
+type BulkHandler struct {
+	users   ports.UserService
+	attrs   ports.AttributeService
+	imports ports.ImportService
+}
+
+func NewBulkHandler(users ports.UserService, attrs ports.AttributeService, imports ports.ImportService) *BulkHandler {
+	return &BulkHandler{users: users, attrs: attrs, imports: imports}
+}
+
+// Import users from a CSV or NDJSON body in a background job, reading the
+// body as it arrives. With ?dry_run=true the rows are only checked. Answers
+// the job to poll at /api/admin/users/import/:id.
+func (h *BulkHandler) Import(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	var next func() (*model.ImportRow, error)
+	var err error
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case csvType:
+		next, err = h.csvRows(ctx, body)
+	case ndjsonType:
+		next = ndjsonRows(body)
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Use " + csvType + " or " + ndjsonType})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Errors reading the body are the caller's; the rest are ours.
+	var readErr error
+	job, err := h.imports.Start(ctx, c.QueryBool("dry_run"), func() (*model.ImportRow, error) {
+		row, err := next()
+		if err != nil && err != io.EOF {
+			readErr = err
+		}
+		return row, err
+	})
+	switch {
+	case readErr != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": readErr.Error()})
+	case errors.Is(err, ports.ErrEmptyImport):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No users to import"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Location("/api/admin/users/import/" + job.ID)
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// ImportStatus shows an import's progress and, so far, its per-row results,
+// read from storage as the response is written. It is NDJSON: the status,
+// then a line per result, and an {"error": ...} line if reading them fails,
+// so a failure part way through never leaves a line malformed.
+func (h *BulkHandler) ImportStatus(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	job, err := h.imports.Get(ctx, c.Params("id"))
+	if errors.Is(err, ports.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Import not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	var report model.ImportReport
+	if err := json.Unmarshal(job.Result, &report); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	status := model.ImportStatus{
+		ID:         job.ID,
+		CreatedBy:  job.CreatedBy,
+		DryRun:     report.DryRun,
+		Status:     model.ImportRunning,
+		JobStatus:  job.Status,
+		Error:      job.Error,
+		Total:      job.Progress.Total,
+		Processed:  job.Progress.Done,
+		Created:    report.Created,
+		Failed:     report.Failed,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Finished() {
+		status.Status = model.ImportFinished
+	}
+	c.Set(fiber.HeaderContentType, ndjsonType)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer w.Flush()
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(status); err != nil {
+			return
+		}
+		err := h.imports.Results(ctx, job, func(result model.ImportResult) error {
+			return enc.Encode(result)
+		})
+		if err != nil {
+			enc.Encode(fiber.Map{"error": err.Error()})
+		}
+	})
+	return nil
+}
+
+// csvRows reads a header of name, email, password, password_hash and
+// attributes.<name> columns, and returns a function reading a user per
+// record after it. Attribute cells are converted to their defined types;
+// empty cells are left out.
+func (h *BulkHandler) csvRows(ctx context.Context, body io.Reader) (func() (*model.ImportRow, error), error) {
+	r := csv.NewReader(body)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return func() (*model.ImportRow, error) { return nil, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(col))
+		header[i] = col
+		switch {
+		case col == "name", col == "email", col == "password", col == "password_hash":
+		case strings.HasPrefix(col, "attributes.") && h.attrs != nil:
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q", col)
+		}
+	}
+
+	return func() (*model.ImportRow, error) {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !(errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount)) {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		row := &model.ImportRow{Line: line}
+		if err != nil {
+			row.Errors = []string{"wrong number of fields"}
+		} else {
+			h.fillRow(ctx, row, header, record)
+		}
+		return row, nil
+	}, nil
+}
+
+func (h *BulkHandler) fillRow(ctx context.Context, row *model.ImportRow, header, record []string) {
+	attributes := map[string]string{}
+	for i, value := range record {
+		switch col := header[i]; col {
+		case "name":
+			row.Name = value
+		case "email":
+			row.Email = value
+		case "password":
+			row.Password = value
+		case "password_hash":
+			row.PasswordHash = value
+		default:
+			if value != "" {
+				attributes[strings.TrimPrefix(col, "attributes.")] = value
+			}
+		}
+	}
+	if len(attributes) == 0 {
+		return
+	}
+	values, err := h.attrs.ParseFilter(ctx, attributes)
+	var attrErr *ports.AttributeError
+	switch {
+	case errors.As(err, &attrErr):
+		row.Errors = attrErr.Violations
+	case err != nil:
+		row.Errors = []string{err.Error()}
+	default:
+		row.Attributes = values
+	}
+}
+
+// ndjsonRows returns a function reading one JSON object per line, with
+// the same fields as a user plus password or password_hash. Blank lines
+// are skipped.
+func ndjsonRows(body io.Reader) func() (*model.ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	return func() (*model.ImportRow, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			var u struct {
+				Name         string                 `json:"name"`
+				Email        string                 `json:"email"`
+				Password     string                 `json:"password"`
+				PasswordHash string                 `json:"password_hash"`
+				Attributes   map[string]interface{} `json:"attributes"`
+			}
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.DisallowUnknownFields()
+			row := &model.ImportRow{Line: line}
+			if err := dec.Decode(&u); err != nil {
+				row.Errors = []string{"invalid JSON: " + err.Error()}
+			} else {
+				row.Name, row.Email, row.Attributes = u.Name, u.Email, u.Attributes
+				row.Password, row.PasswordHash = u.Password, u.PasswordHash
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("invalid NDJSON: %w", err)
+		}
+		return nil, io.EOF
+	}
+}
+
+// Export streams every user as NDJSON, or as CSV with ?format=csv, reading
+// them from a cursor as the response is written. Password hashes are not
+// exported.
+func (h *BulkHandler) Export(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	format := c.Query("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be ndjson or csv"})
+	}
+	// Once streaming starts the status can't change, so find out now
+	// whether the caller may export at all.
+	if err := h.users.ExportUsers(ctx, func(*model.User) error { return errPeek }); err != nil && !errors.Is(err, errPeek) {
+		return userError(c, err)
+	}
+
+	var attributes []string
+	if format == "csv" && h.attrs != nil {
+		defs, err := h.attrs.List(ctx)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		for _, d := range defs {
+			attributes = append(attributes, d.Name)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, ndjsonType)
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, csvType)
+	}
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="users.`+format+`"`)
+	// A failure part way through can only cut the body short.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer w.Flush()
+		if format == "ndjson" {
+			enc := json.NewEncoder(w)
+			h.users.ExportUsers(ctx, func(u *model.User) error { return enc.Encode(u) })
+			return
+		}
+		out := csv.NewWriter(w)
+		header := []string{"id", "name", "email", "role", "disabled", "created_at", "updated_at", "version"}
+		for _, name := range attributes {
+			header = append(header, "attributes."+name)
+		}
+		out.Write(header)
+		h.users.ExportUsers(ctx, func(u *model.User) error {
+			record := []string{
+				u.ID, csvText(u.Name), csvText(u.Email), u.Role, strconv.FormatBool(u.Disabled),
+				u.CreatedAt.UTC().Format(time.RFC3339), u.UpdatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatInt(u.Version, 10),
+			}
+			for _, name := range attributes {
+				record = append(record, formatAttribute(u.Attributes[name]))
+			}
+			out.Write(record)
+			return out.Error()
+		})
+		out.Flush()
+	})
+	return nil
+}
+
+func formatAttribute(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return csvText(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// csvText escapes text that spreadsheets would run as a formula when the
+// export is opened, by prefixing it with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/pkg/middleware"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const federationCookie = "federation_state"
+
+type FederationHandler struct {
+	service ports.FederationService
+}
+
+func NewFederationHandler(service ports.FederationService) *FederationHandler {
+	return &FederationHandler{service: service}
+}
+
+// Login redirects to the upstream identity provider
+func (h *FederationHandler) Login(c *fiber.Ctx) error {
+	authURL, err := h.begin(c, "")
+	if err != nil {
+		return beginError(c, err)
+	}
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Link starts a login at the upstream identity provider that links the
+// account there to the signed-in user. The client sends the user to url.
+func (h *FederationHandler) Link(c *fiber.Ctx) error {
+	authURL, err := h.begin(c, middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		return beginError(c, err)
+	}
+	return c.JSON(fiber.Map{"url": authURL})
+}
+
+// begin sets the state cookie and returns the provider URL.
+func (h *FederationHandler) begin(c *fiber.Ctx, linkUserID string) (string, error) {
+	authURL, blob, err := h.service.Begin(c.UserContext(), c.Params("provider"), linkUserID)
+	if err != nil {
+		return "", err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     federationCookie,
+		Value:    blob,
+		Path:     "/auth/" + c.Params("provider"),
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		// Lax so the cookie comes back on the top-level redirect from the provider.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return authURL, nil
+}
+
+func beginError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ports.ErrUnknownProvider) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+}
+
+// Callback completes the upstream login and returns our own token
+func (h *FederationHandler) Callback(c *fiber.Ctx) error {
+	if errParam := c.Query("error"); errParam != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": errParam})
+	}
+
+	blob := c.Cookies(federationCookie)
+	c.ClearCookie(federationCookie)
+
+	token, err := h.service.Complete(c.UserContext(), c.Params("provider"), c.Query("state"), c.Query("code"), blob, ports.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	})
+	switch {
+	case errors.Is(err, ports.ErrUnknownProvider):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	case errors.Is(err, ports.ErrInvalidToken):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired login state"})
+	case errors.Is(err, ports.ErrConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This identity is linked to another account"})
+	case err != nil:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "External login failed"})
+	}
+	return c.JSON(fiber.Map{"token": token})
+}
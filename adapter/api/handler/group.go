@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type GroupHandler struct {
+	service ports.GroupService
+}
+
+func NewGroupHandler(service ports.GroupService) *GroupHandler {
+	return &GroupHandler{service: service}
+}
+
+type groupRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Roles       []string `json:"roles"`
+}
+
+func (r *groupRequest) group() *model.Group {
+	return &model.Group{Name: strings.TrimSpace(r.Name), Description: r.Description, Roles: r.Roles}
+}
+
+// Create Group
+func (h *GroupHandler) Create(c *fiber.Ctx) error {
+	var req groupRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	group, err := h.service.Create(c.UserContext(), req.group())
+	if err != nil {
+		return groupError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(group)
+}
+
+// List Groups
+func (h *GroupHandler) List(c *fiber.Ctx) error {
+	groups, err := h.service.List(c.UserContext())
+	if err != nil {
+		return groupError(c, err)
+	}
+	return c.JSON(groups)
+}
+
+// Get Group
+func (h *GroupHandler) Get(c *fiber.Ctx) error {
+	group, err := h.service.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return groupError(c, err)
+	}
+	return c.JSON(group)
+}
+
+// Update Group name, description and roles
+func (h *GroupHandler) Update(c *fiber.Ctx) error {
+	var req groupRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	group, err := h.service.Update(c.UserContext(), c.Params("id"), req.group())
+	if err != nil {
+		return groupError(c, err)
+	}
+	return c.JSON(group)
+}
+
+// Delete Group
+func (h *GroupHandler) Delete(c *fiber.Ctx) error {
+	if err := h.service.Delete(c.UserContext(), c.Params("id")); err != nil {
+		return groupError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List Members; ?effective=true lists every user in the group or nested groups
+func (h *GroupHandler) ListMembers(c *fiber.Ctx) error {
+	if c.QueryBool("effective") {
+		users, err := h.service.EffectiveMembers(c.UserContext(), c.Params("id"))
+		if err != nil {
+			return groupError(c, err)
+		}
+		return c.JSON(fiber.Map{"users": users})
+	}
+	group, err := h.service.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return groupError(c, err)
+	}
+	return c.JSON(fiber.Map{"users": group.Users, "groups": group.Groups})
+}
+
+// Add Member, a user or a group
+func (h *GroupHandler) AddMember(c *fiber.Ctx) error {
+	var req struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.ID == "" || !validMemberKind(req.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := h.service.AddMember(c.UserContext(), c.Params("id"), req.Type, req.ID); err != nil {
+		return groupError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Remove Member
+func (h *GroupHandler) RemoveMember(c *fiber.Ctx) error {
+	kind := c.Params("type")
+	if !validMemberKind(kind) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid member type"})
+	}
+	if err := h.service.RemoveMember(c.UserContext(), c.Params("id"), kind, c.Params("memberId")); err != nil {
+		return groupError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func validMemberKind(kind string) bool {
+	return kind == model.GroupMemberUser || kind == model.GroupMemberGroup
+}
+
+func groupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group or member not found"})
+	case errors.Is(err, ports.ErrGroupCycle):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -1,37 +1,79 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
 	"register/core/ports"
+	"register/model"
+	"register/pkg/conditional"
+	"register/pkg/jsonpatch"
+	"register/pkg/middleware"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type UserHandler struct {
 	service ports.UserService
+	cookie  *middleware.CookieConfig
 }
 
-func NewUserHandler(service ports.UserService) *UserHandler {
-	return &UserHandler{service: service}
+type UserHandlerOption func(*UserHandler)
+
+// WithSessionCookie enables cookie mode: POST /login?mode=cookie sets the
+// session and CSRF cookies instead of returning the token.
+func WithSessionCookie(cookie middleware.CookieConfig) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.cookie = &cookie
+	}
+}
+
+func NewUserHandler(service ports.UserService, opts ...UserHandlerOption) *UserHandler {
+	h := &UserHandler{service: service}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Register
 func (h *UserHandler) Register(c *fiber.Ctx) error {
 	var req struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Name       string                 `json:"name"`
+		Email      string                 `json:"email"`
+		Password   string                 `json:"password"`
+		Attributes map[string]interface{} `json:"attributes"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	user, err := h.service.Register(c.Context(), req.Name, req.Email, req.Password)
-	if err != nil {
+	// New and already-registered emails get the same answer; the owner of an
+	// existing address is told by email instead.
+	_, err := h.service.Register(c.UserContext(), req.Name, req.Email, req.Password, req.Attributes)
+	var policyErr *ports.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyResponse(c, policyErr)
+	}
+	var attrErr *ports.AttributeError
+	if errors.As(err, &attrErr) {
+		return attributeResponse(c, attrErr)
+	}
+	if err != nil && !errors.Is(err, ports.ErrEmailTaken) {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(user)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Registration received. If you already have an account, we've emailed you instead."})
 }
 
 // Login
@@ -45,55 +87,397 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	token, err := h.service.Login(c.Context(), req.Email, req.Password)
+	token, err := h.service.Login(c.UserContext(), req.Email, req.Password, ports.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	})
+	var throttled *ports.ThrottledError
+	if errors.As(err, &throttled) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many login attempts, try again later"})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password"})
 	}
 
+	if h.cookie != nil && c.Query("mode") == "cookie" {
+		csrf, err := middleware.SetSessionCookies(c, *h.cookie, token)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"csrf_token": csrf})
+	}
+
 	return c.JSON(fiber.Map{"token": token})
 }
 
-// List Users
-func (h *UserHandler) List(c *fiber.Ctx) error {
-	users, err := h.service.ListUsers(c.Context())
+// Change Password of the authenticated user
+func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if p := middleware.CurrentPrincipal(c); p == nil || p.UserID != id {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	err := h.service.ChangePassword(c.UserContext(), id, req.CurrentPassword, req.NewPassword)
+	var policyErr *ports.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyResponse(c, policyErr)
+	}
+	if errors.Is(err, ports.ErrInvalidCredentials) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Current password is incorrect"})
+	}
+	if errors.Is(err, ports.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Forgot Password
+func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.service.RequestPasswordReset(c.UserContext(), req.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Check your email to continue"})
+}
+
+// Reset Password
+func (h *UserHandler) ResetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	err := h.service.ResetPassword(c.UserContext(), req.Token, req.Password)
+	var policyErr *ports.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyResponse(c, policyErr)
+	}
+	if errors.Is(err, ports.ErrInvalidToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired token"})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func policyResponse(c *fiber.Ctx, err *ports.PolicyError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":      "Password does not meet policy",
+		"violations": err.Violations,
+	})
+}
+
+func attributeResponse(c *fiber.Ctx, err *ports.AttributeError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":      "Invalid attributes",
+		"violations": err.Violations,
+	})
+}
+
+// List Users, filtered by custom attributes with ?attributes.<name>=<value>
+func (h *UserHandler) List(c *fiber.Ctx) error {
+	var filter map[string]string
+	for key, value := range c.Queries() {
+		if name, ok := strings.CutPrefix(key, "attributes."); ok {
+			if filter == nil {
+				filter = map[string]string{}
+			}
+			filter[name] = value
+		}
+	}
+	users, err := h.service.ListUsers(c.UserContext(), filter)
+	if err != nil {
+		return userError(c, err)
+	}
+	var modified time.Time
+	hash := sha256.New()
+	for _, u := range users {
+		fmt.Fprintf(hash, "%s:%d,", u.ID, u.Version)
+		if u.UpdatedAt.After(modified) {
+			modified = u.UpdatedAt
+		}
+	}
+	tag := `W/"` + hex.EncodeToString(hash.Sum(nil)[:8]) + `"`
+	setValidators(c, tag, modified)
+	// Deleting a user doesn't move the list's Last-Modified, so only the
+	// ETag, which covers every ID, can tell a client its copy is current.
+	if fresh(c, tag, time.Time{}) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	return c.JSON(users)
 }
 
 // Get User
 func (h *UserHandler) Get(c *fiber.Ctx) error {
 	id := c.Params("id") // Fiber ดึง param ง่ายๆ แบบนี้เลย
-	user, err := h.service.GetUser(c.Context(), id)
+	user, err := h.service.GetUser(c.UserContext(), id)
+	if errors.Is(err, ports.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	setValidators(c, etag(user), user.UpdatedAt)
+	if fresh(c, etag(user), user.UpdatedAt) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	return c.JSON(user)
 }
 
-// Update User
+// setValidators sends the ETag and Last-Modified of a response. Clients
+// may keep user data but must revalidate it before use, and shared caches
+// must not keep it at all.
+func setValidators(c *fiber.Ctx, tag string, modified time.Time) {
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderETag, tag)
+	if !modified.IsZero() {
+		c.Set(fiber.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// fresh reports whether the client's copy is current, by If-None-Match or,
+// when that is absent, by If-Modified-Since (RFC 9110 section 13.2.2). A
+// zero modified ignores If-Modified-Since. fiber's Ctx.Fresh is not used
+// because it treats any If-Modified-Since on its own as fresh.
+func fresh(c *fiber.Ctx, tag string, modified time.Time) bool {
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		return conditional.Match(header, tag, true)
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	return err == nil && !modified.IsZero() && !modified.Truncate(time.Second).After(since)
+}
+
+// etag is a user's version as a strong entity tag.
+func etag(u *model.User) string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// ifMatch reads the version a write to the user in the path is conditional
+// on from If-Match. It is 0 when the header is missing or "*". When the
+// header lists several tags, the user is loaded and the write is made
+// conditional on its current version if that is listed. Tags that can't
+// match give ErrVersionMismatch.
+func (h *UserHandler) ifMatch(c *fiber.Ctx) (int64, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		user, err := h.service.GetUser(c.UserContext(), c.Params("id"))
+		if err != nil {
+			return 0, err
+		}
+		if !conditional.Match(header, etag(user), false) {
+			return 0, ports.ErrVersionMismatch
+		}
+		return user.Version, nil
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, ports.ErrVersionMismatch
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ports.ErrVersionMismatch
+	}
+	return version, nil
+}
+
+func preconditionFailed(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": "User has been modified"})
+}
+
+// Update User. With If-Match, the update only applies to that version.
 func (h *UserHandler) Update(c *fiber.Ctx) error {
 	id := c.Params("id")
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return userError(c, err)
+	}
 	var req struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
+		Name       string                 `json:"name"`
+		Email      string                 `json:"email"`
+		Attributes map[string]interface{} `json:"attributes"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
-	user, err := h.service.UpdateUser(c.Context(), id, req.Name, req.Email)
+	user, err := h.service.PatchUser(c.UserContext(), id, &model.UserFields{
+		Name:       &req.Name,
+		Email:      &req.Email,
+		Attributes: req.Attributes,
+		Version:    version,
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return userError(c, err)
 	}
+	setValidators(c, etag(user), user.UpdatedAt)
 	return c.JSON(user)
 }
 
-// Delete User
+// Patch User with a JSON merge patch (RFC 7396), or a JSON Patch (RFC 6902)
+// when sent as application/json-patch+json. Only name, email and attributes
+// can change. With If-Match, the patch only applies to that version; without
+// it, a write that lands between reading and patching the user answers 409.
+func (h *UserHandler) Patch(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return userError(c, err)
+	}
+	user, err := h.service.GetUser(ctx, c.Params("id"))
+	if err != nil {
+		return userError(c, err)
+	}
+	if version != 0 && version != user.Version {
+		return preconditionFailed(c)
+	}
+	var doc map[string]interface{}
+	data, _ := json.Marshal(user)
+	json.Unmarshal(data, &doc)
+
+	var patched interface{}
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case jsonpatch.JSONPatchType:
+		var ops []jsonpatch.Operation
+		if err := json.Unmarshal(c.Body(), &ops); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if patched, err = jsonpatch.Apply(doc, ops); errors.Is(err, jsonpatch.ErrTestFailed) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	case jsonpatch.MergePatchType, fiber.MIMEApplicationJSON:
+		var patch interface{}
+		if err := json.Unmarshal(c.Body(), &patch); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		patched = jsonpatch.Merge(doc, patch)
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Use " + jsonpatch.MergePatchType + " or " + jsonpatch.JSONPatchType})
+	}
+
+	fields, err := changedFields(doc, patched)
+	if err != nil {
+		return userError(c, err)
+	}
+	// The patch was applied to this version, so it is only written over it,
+	// If-Match or not.
+	fields.Version = user.Version
+	updated, err := h.service.PatchUser(ctx, user.ID, fields)
+	if errors.Is(err, ports.ErrVersionMismatch) && version == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User was modified during the patch; try again"})
+	}
+	if err != nil {
+		return userError(c, err)
+	}
+	setValidators(c, etag(updated), updated.UpdatedAt)
+	return c.JSON(updated)
+}
+
+// changedFields compares a user document before and after a patch. Changes
+// to anything but name, email and attributes are refused.
+func changedFields(before map[string]interface{}, after interface{}) (*model.UserFields, error) {
+	doc, ok := after.(map[string]interface{})
+	if !ok {
+		return nil, &ports.ValidationError{Violations: []string{"the patched user must be an object"}}
+	}
+	fields := &model.UserFields{}
+	var violations []string
+	keys := make(map[string]bool, len(doc)+len(before))
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range doc {
+		keys[k] = true
+	}
+	for k := range keys {
+		v, present := doc[k]
+		if reflect.DeepEqual(before[k], v) {
+			continue
+		}
+		switch k {
+		case "name", "email":
+			s, ok := v.(string)
+			if !ok {
+				violations = append(violations, k+" must be a string")
+			} else if k == "name" {
+				fields.Name = &s
+			} else {
+				fields.Email = &s
+			}
+		case "attributes":
+			attrs, ok := v.(map[string]interface{})
+			if !present || v == nil {
+				attrs, ok = map[string]interface{}{}, true
+			}
+			if !ok {
+				violations = append(violations, "attributes must be an object")
+			}
+			fields.Attributes = attrs
+		default:
+			violations = append(violations, k+" can't be changed")
+		}
+	}
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return nil, &ports.ValidationError{Violations: violations}
+	}
+	return fields, nil
+}
+
+// Delete User. With If-Match, only that version is deleted.
 func (h *UserHandler) Delete(c *fiber.Ctx) error {
 	id := c.Params("id")
-	if err := h.service.DeleteUser(c.Context(), id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return userError(c, err)
+	}
+	if err := h.service.DeleteUser(c.UserContext(), id, version); err != nil {
+		return userError(c, err)
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+func userError(c *fiber.Ctx, err error) error {
+	var attrErr *ports.AttributeError
+	var validationErr *ports.ValidationError
+	switch {
+	case errors.As(err, &attrErr):
+		return attributeResponse(c, attrErr)
+	case errors.As(err, &validationErr):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user", "violations": validationErr.Violations})
+	case errors.Is(err, ports.ErrEmailTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email already in use"})
+	case errors.Is(err, ports.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	case errors.Is(err, ports.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, ports.ErrVersionMismatch):
+		return preconditionFailed(c)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
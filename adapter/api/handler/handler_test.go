@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"register/core/ports"
 	"register/model"
 	"register/pkg/middleware"
 
@@ -20,13 +24,18 @@ const testSecret = "test-secret"
 
 type mockUserService struct {
 	users map[string]*model.User
+	// afterGet, if set, runs after GetUser, as a concurrent request would.
+	afterGet func()
 }
 
 func newMockService() *mockUserService {
 	return &mockUserService{users: make(map[string]*model.User)}
 }
 
-func (m *mockUserService) Register(ctx context.Context, name, email, password string) (*model.User, error) {
+func (m *mockUserService) Register(ctx context.Context, name, email, password string, attributes map[string]interface{}) (*model.User, error) {
+	if _, ok := m.users[email]; ok {
+		return nil, ports.ErrEmailTaken
+	}
 	id := email // deterministic for tests
 	user := &model.User{
 		ID:        id,
@@ -34,26 +43,91 @@ func (m *mockUserService) Register(ctx context.Context, name, email, password st
 		Email:     email,
 		Password:  password,
 		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Version:   1,
 	}
 	m.users[id] = user
 	return user, nil
 }
 
-func (m *mockUserService) Login(ctx context.Context, email, password string) (string, error) {
+func (m *mockUserService) Login(ctx context.Context, email, password string, client ports.ClientInfo) (string, error) {
 	if u, ok := m.users[email]; ok && u.Password == password {
 		return signToken(u.ID), nil
 	}
 	return "", fiber.ErrUnauthorized
 }
 
-func (m *mockUserService) GetUser(ctx context.Context, id string) (*model.User, error) {
+func (m *mockUserService) Authenticate(ctx context.Context, email, password, ip string) (*model.User, error) {
+	if u, ok := m.users[email]; ok && u.Password == password {
+		return u, nil
+	}
+	return nil, ports.ErrInvalidCredentials
+}
+
+func (m *mockUserService) ChangePassword(ctx context.Context, id, current, password string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	if u.Password != current {
+		return ports.ErrInvalidCredentials
+	}
+	if len(password) < 8 {
+		return &ports.PolicyError{Violations: []string{"must be at least 8 characters"}}
+	}
+	u.Password = password
+	return nil
+}
+
+func (m *mockUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	return nil
+}
+
+func (m *mockUserService) ResetPassword(ctx context.Context, token, password string) error {
+	return ports.ErrInvalidToken
+}
+
+func (m *mockUserService) CreateUser(ctx context.Context, name, email, password string, attributes map[string]interface{}, disabled bool) (*model.User, error) {
+	if _, ok := m.users[email]; ok {
+		return nil, ports.ErrEmailTaken
+	}
+	user := &model.User{ID: email, Name: name, Email: email, Password: password, Disabled: disabled, CreatedAt: time.Now(), Version: 1}
+	m.users[email] = user
+	return user, nil
+}
+
+func (m *mockUserService) SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error) {
 	if u, ok := m.users[id]; ok {
+		u.Disabled = disabled
+		u.Version++
+		u.UpdatedAt = time.Now()
 		return u, nil
 	}
 	return nil, fiber.ErrNotFound
 }
 
-func (m *mockUserService) ListUsers(ctx context.Context) ([]*model.User, error) {
+func (m *mockUserService) GetUser(ctx context.Context, id string) (*model.User, error) {
+	if u, ok := m.users[id]; ok {
+		cp := *u
+		if m.afterGet != nil {
+			m.afterGet()
+		}
+		return &cp, nil
+	}
+	return nil, fiber.ErrNotFound
+}
+
+func (m *mockUserService) FindUsersByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	var res []*model.User
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			res = append(res, u)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockUserService) ListUsers(ctx context.Context, filter map[string]string) ([]*model.User, error) {
 	var res []*model.User
 	for _, u := range m.users {
 		res = append(res, u)
@@ -61,7 +135,7 @@ func (m *mockUserService) ListUsers(ctx context.Context) ([]*model.User, error)
 	return res, nil
 }
 
-func (m *mockUserService) UpdateUser(ctx context.Context, id, name, email string) (*model.User, error) {
+func (m *mockUserService) UpdateUser(ctx context.Context, id, name, email string, attributes map[string]interface{}) (*model.User, error) {
 	if u, ok := m.users[id]; ok {
 		u.Name, u.Email = name, email
 		return u, nil
@@ -69,14 +143,60 @@ func (m *mockUserService) UpdateUser(ctx context.Context, id, name, email string
 	return nil, fiber.ErrNotFound
 }
 
-func (m *mockUserService) DeleteUser(ctx context.Context, id string) error {
-	if _, ok := m.users[id]; !ok {
+func (m *mockUserService) PatchUser(ctx context.Context, id string, fields *model.UserFields) (*model.User, error) {
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	if fields.Version != 0 && fields.Version != u.Version {
+		return nil, ports.ErrVersionMismatch
+	}
+	u.Version++
+	u.UpdatedAt = time.Now()
+	if fields.Name != nil {
+		u.Name = *fields.Name
+	}
+	if fields.Email != nil {
+		u.Email = *fields.Email
+	}
+	if fields.Attributes != nil {
+		u.Attributes = fields.Attributes
+	}
+	return u, nil
+}
+
+func (m *mockUserService) DeleteUser(ctx context.Context, id string, version int64) error {
+	u, ok := m.users[id]
+	if !ok {
 		return fiber.ErrNotFound
 	}
+	if version != 0 && version != u.Version {
+		return ports.ErrVersionMismatch
+	}
 	delete(m.users, id)
 	return nil
 }
 
+func (m *mockUserService) ImportUser(ctx context.Context, row *model.ImportRow, dryRun bool) (*model.User, error) {
+	if _, ok := m.users[row.Email]; ok {
+		return nil, ports.ErrEmailTaken
+	}
+	user := &model.User{ID: row.Email, Name: row.Name, Email: row.Email, Attributes: row.Attributes, Version: 1}
+	if !dryRun {
+		m.users[user.ID] = user
+	}
+	return user, nil
+}
+
+func (m *mockUserService) ExportUsers(ctx context.Context, fn func(*model.User) error) error {
+	for _, u := range m.users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockUserService) CountUsers(ctx context.Context) (int64, error) {
 	return int64(len(m.users)), nil
 }
@@ -99,13 +219,15 @@ func setupApp() *fiber.App {
 	app.Post("/login", h.Login)
 
 	api := app.Group("/api", middleware.Auth(testSecret))
-	api.Get("/users", h.List)
-	api.Get("/users/:id", h.Get)
-	api.Put("/users/:id", h.Update)
+	api.Get("/users", middleware.RequireScope(model.ScopeUsersRead), h.List)
+	api.Get("/users/:id", middleware.RequireScope(model.ScopeUsersRead), h.Get)
+	api.Put("/users/:id", middleware.RequireScope(model.ScopeUsersWrite), h.Update)
+	api.Patch("/users/:id", middleware.RequireScope(model.ScopeUsersWrite), h.Patch)
+	api.Put("/users/:id/password", h.ChangePassword)
 	api.Delete("/users/:id", h.Delete)
 
 	// seed one user for protected routes
-	svc.Register(context.Background(), "Seed", "seed@example.com", "pass")
+	svc.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
 	return app
 }
 
@@ -131,7 +253,7 @@ func TestRegisterAndLogin(t *testing.T) {
 	req := httptest.NewRequest("POST", "/register", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := app.Test(req)
-	if err != nil || resp.StatusCode != 201 {
+	if err != nil || resp.StatusCode != 202 {
 		t.Fatalf("register failed: %v status=%d", err, resp.StatusCode)
 	}
 
@@ -144,6 +266,27 @@ func TestRegisterAndLogin(t *testing.T) {
 	}
 }
 
+func TestRegisterDoesNotRevealExistingEmail(t *testing.T) {
+	app := setupApp()
+	register := func(email string) (int, string) {
+		body, _ := json.Marshal(map[string]string{"name": "X", "email": email, "password": "secret"})
+		req := httptest.NewRequest("POST", "/register", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	newStatus, newBody := register("new@example.com")
+	takenStatus, takenBody := register("seed@example.com")
+	if newStatus != takenStatus || newBody != takenBody {
+		t.Fatalf("responses differ: new=%d %s taken=%d %s", newStatus, newBody, takenStatus, takenBody)
+	}
+}
+
 func TestListAndGet(t *testing.T) {
 	app := setupApp()
 	req := authedReq("GET", "/api/users", nil)
@@ -159,6 +302,55 @@ func TestListAndGet(t *testing.T) {
 	}
 }
 
+func TestConditionalGet(t *testing.T) {
+	app := setupApp()
+	get := func(path string, headers map[string]string) *http.Response {
+		req := authedReq("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("get %s failed: %v", path, err)
+		}
+		return resp
+	}
+
+	resp := get("/api/users/seed@example.com", nil)
+	tag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != 200 || tag == "" || modified == "" || resp.Header.Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("get: status=%d headers=%v", resp.StatusCode, resp.Header)
+	}
+	earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	for _, tc := range []struct {
+		headers map[string]string
+		want    int
+	}{
+		{map[string]string{"If-None-Match": tag}, 304},
+		{map[string]string{"If-None-Match": `"0", W/` + tag}, 304},
+		{map[string]string{"If-Modified-Since": modified}, 304},
+		{map[string]string{"If-Modified-Since": earlier}, 200},
+		{map[string]string{"If-None-Match": `"0"`, "If-Modified-Since": modified}, 200},
+	} {
+		if resp := get("/api/users/seed@example.com", tc.headers); resp.StatusCode != tc.want {
+			t.Errorf("get with %v: status=%d, want %d", tc.headers, resp.StatusCode, tc.want)
+		}
+	}
+
+	resp = get("/api/users", nil)
+	listTag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || listTag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("list: status=%d headers=%v", resp.StatusCode, resp.Header)
+	}
+	if resp := get("/api/users", map[string]string{"If-None-Match": listTag}); resp.StatusCode != 304 {
+		t.Fatalf("unchanged list: status=%d", resp.StatusCode)
+	}
+	app.Test(authedReq("PATCH", "/api/users/seed@example.com", []byte(`{"name":"Renamed"}`)))
+	if resp := get("/api/users", map[string]string{"If-None-Match": listTag}); resp.StatusCode != 200 {
+		t.Fatalf("changed list: status=%d", resp.StatusCode)
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	app := setupApp()
 	body, _ := json.Marshal(map[string]string{"name": "Updated", "email": "updated@example.com"})
@@ -169,6 +361,113 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestPatch(t *testing.T) {
+	app := setupApp()
+	patch := func(contentType, body string) (int, map[string]interface{}) {
+		req := authedReq("PATCH", "/api/users/seed@example.com", []byte(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("patch failed: %v", err)
+		}
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, user := patch("application/merge-patch+json", `{"name":"Only Name","attributes":{"team":"core"}}`)
+	if status != 200 || user["name"] != "Only Name" || user["email"] != "seed@example.com" {
+		t.Fatalf("merge patch: status=%d user=%v", status, user)
+	}
+
+	status, user = patch("application/json-patch+json", `[{"op":"test","path":"/email","value":"seed@example.com"},{"op":"remove","path":"/attributes/team"}]`)
+	if status != 200 || user["attributes"] != nil {
+		t.Fatalf("json patch: status=%d user=%v", status, user)
+	}
+
+	if status, _ := patch("application/json-patch+json", `[{"op":"test","path":"/name","value":"Someone Else"}]`); status != 409 {
+		t.Fatalf("failed test op: status=%d", status)
+	}
+	if status, body := patch("application/merge-patch+json", `{"role":"admin","email":null}`); status != 400 || len(body["violations"].([]interface{})) != 2 {
+		t.Fatalf("read-only fields: status=%d body=%v", status, body)
+	}
+	if status, _ := patch("text/plain", `name=x`); status != 415 {
+		t.Fatalf("unsupported type: status=%d", status)
+	}
+}
+
+func TestPatchConcurrentWrite(t *testing.T) {
+	svc := newMockService()
+	svc.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
+	app := fiber.New()
+	app.Patch("/api/users/:id", middleware.Auth(testSecret), NewUserHandler(svc).Patch)
+
+	svc.afterGet = func() {
+		svc.afterGet = nil
+		name := "Concurrent"
+		svc.PatchUser(context.Background(), "seed@example.com", &model.UserFields{Name: &name})
+	}
+	req := authedReq("PATCH", "/api/users/seed@example.com",
+		[]byte(`[{"op":"test","path":"/name","value":"Seed"},{"op":"replace","path":"/email","value":"new@example.com"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != 409 {
+		t.Fatalf("patch over a concurrent write: %v status=%d", err, resp.StatusCode)
+	}
+	if u := svc.users["seed@example.com"]; u.Name != "Concurrent" || u.Email != "seed@example.com" {
+		t.Fatalf("concurrent write was overwritten: %+v", u)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	app := setupApp()
+	send := func(method, ifMatch, body string) *http.Response {
+		req := authedReq(method, "/api/users/seed@example.com", []byte(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return resp
+	}
+
+	if tag := send("GET", "", "").Header.Get("ETag"); tag != `"1"` {
+		t.Fatalf("get: ETag = %q", tag)
+	}
+	resp := send("PUT", `"1"`, `{"name":"Seed","email":"seed@example.com"}`)
+	if resp.StatusCode != 200 || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("conditional put: status=%d ETag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	for _, tc := range []struct{ method, ifMatch, body string }{
+		{"PUT", `"1"`, `{"name":"Stale","email":"seed@example.com"}`},
+		{"PATCH", `"1"`, `{"name":"Stale"}`},
+		{"PATCH", `W/"2"`, `{"name":"Weak"}`},
+		{"DELETE", `"1"`, ``},
+	} {
+		if resp := send(tc.method, tc.ifMatch, tc.body); resp.StatusCode != 412 {
+			t.Fatalf("%s with If-Match %s: status=%d", tc.method, tc.ifMatch, resp.StatusCode)
+		}
+	}
+	if resp := send("PATCH", `"2"`, `{"name":"Fresh"}`); resp.StatusCode != 200 || resp.Header.Get("ETag") != `"3"` {
+		t.Fatalf("conditional patch: status=%d ETag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	// A list of tags matches if any of them is current.
+	if resp := send("PATCH", `"1", "3"`, `{"name":"Listed"}`); resp.StatusCode != 200 || resp.Header.Get("ETag") != `"4"` {
+		t.Fatalf("patch with a tag list: status=%d ETag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := send("PUT", `"4" , "5"`, `{"name":"Listed","email":"seed@example.com"}`); resp.StatusCode != 200 || resp.Header.Get("ETag") != `"5"` {
+		t.Fatalf("put with a tag list: status=%d ETag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := send("DELETE", `"1", W/"5"`, ""); resp.StatusCode != 412 {
+		t.Fatalf("delete with a stale tag list: status=%d", resp.StatusCode)
+	}
+	if resp := send("DELETE", "*", ""); resp.StatusCode != 204 {
+		t.Fatalf("delete with If-Match *: status=%d", resp.StatusCode)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	app := setupApp()
 	req := authedReq("DELETE", "/api/users/seed@example.com", nil)
@@ -177,3 +476,736 @@ func TestDelete(t *testing.T) {
 		t.Fatalf("delete failed: %v status=%d", err, resp.StatusCode)
 	}
 }
+
+func TestChangePassword(t *testing.T) {
+	app := setupApp()
+
+	weak, _ := json.Marshal(map[string]string{"current_password": "pass", "new_password": "short"})
+	resp, err := app.Test(authedReq("PUT", "/api/users/seed@example.com/password", weak))
+	if err != nil || resp.StatusCode != 400 {
+		t.Fatalf("expected policy rejection: %v status=%d", err, resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(map[string]string{"current_password": "pass", "new_password": "long enough"})
+	resp, err = app.Test(authedReq("PUT", "/api/users/seed@example.com/password", body))
+	if err != nil || resp.StatusCode != 204 {
+		t.Fatalf("change password failed: %v status=%d", err, resp.StatusCode)
+	}
+
+	resp, err = app.Test(authedReq("PUT", "/api/users/someone-else/password", body))
+	if err != nil || resp.StatusCode != 403 {
+		t.Fatalf("expected forbidden for another user: %v status=%d", err, resp.StatusCode)
+	}
+}
+
+func TestServicePrincipal(t *testing.T) {
+	app := setupApp()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":            model.OAuthTokenType,
+		"sub":            "billing",
+		"client_id":      "billing",
+		"principal_type": "service",
+		"scope":          "users:read",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+	signed, _ := token.SignedString([]byte(testSecret))
+
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("service list failed: %v status=%d", err, resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": "X", "email": "x@example.com"})
+	req = httptest.NewRequest("PUT", "/api/users/seed@example.com", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+signed)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != 403 {
+		t.Fatalf("expected write without scope to be forbidden: %v status=%d", err, resp.StatusCode)
+	}
+}
+
+func TestCookieModeWithCSRF(t *testing.T) {
+	cookie := middleware.CookieConfig{Name: "session", CSRFName: "csrf_token", Secure: true, SameSite: "Strict", MaxAge: time.Hour}
+	svc := newMockService()
+	svc.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
+	h := NewUserHandler(svc, WithSessionCookie(cookie))
+	app := fiber.New()
+	app.Post("/login", h.Login)
+	api := app.Group("/api", middleware.Auth(testSecret, middleware.WithCookie(cookie)))
+	api.Get("/users", h.List)
+	api.Put("/users/:id", h.Update)
+
+	req := httptest.NewRequest("POST", "/login?mode=cookie", bytes.NewReader([]byte(`{"email":"seed@example.com","password":"pass"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("cookie login failed: %v status=%d", err, resp.StatusCode)
+	}
+	var out map[string]string
+	json.NewDecoder(resp.Body).Decode(&out)
+	if out["token"] != "" || out["csrf_token"] == "" {
+		t.Fatalf("expected only a csrf token in the body, got %v", out)
+	}
+
+	var session, csrf *http.Cookie
+	for _, c := range resp.Cookies() {
+		switch c.Name {
+		case "session":
+			session = c
+		case "csrf_token":
+			csrf = c
+		}
+	}
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected HttpOnly, Secure, SameSite session cookie, got %+v", session)
+	}
+	if csrf == nil || csrf.HttpOnly || csrf.Value != out["csrf_token"] {
+		t.Fatalf("expected readable csrf cookie, got %+v", csrf)
+	}
+
+	send := func(method, path, csrfHeader string) int {
+		body, _ := json.Marshal(map[string]string{"name": "New", "email": "seed@example.com"})
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(session)
+		req.AddCookie(csrf)
+		if csrfHeader != "" {
+			req.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := send("GET", "/api/users", ""); status != 200 {
+		t.Errorf("expected safe request without csrf header to pass, got %d", status)
+	}
+	if status := send("PUT", "/api/users/seed@example.com", ""); status != 403 {
+		t.Errorf("expected missing csrf header to be rejected, got %d", status)
+	}
+	if status := send("PUT", "/api/users/seed@example.com", "forged"); status != 403 {
+		t.Errorf("expected wrong csrf header to be rejected, got %d", status)
+	}
+	if status := send("PUT", "/api/users/seed@example.com", csrf.Value); status != 200 {
+		t.Errorf("expected matching csrf header to pass, got %d", status)
+	}
+
+	// Bearer tokens don't need a CSRF token even where cookies are accepted.
+	resp, err = app.Test(authedReq("PUT", "/api/users/seed@example.com", []byte(`{"name":"Bearer","email":"seed@example.com"}`)))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected bearer update to pass: %v status=%d", err, resp.StatusCode)
+	}
+}
+
+func TestImpersonatedToken(t *testing.T) {
+	svc := newMockService()
+	svc.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
+	h := NewUserHandler(svc)
+	var recorded []middleware.ImpersonatedRequest
+	app := fiber.New()
+	api := app.Group("/api", middleware.Auth(testSecret), middleware.RecordImpersonation(func(c *fiber.Ctx, r middleware.ImpersonatedRequest) {
+		recorded = append(recorded, r)
+	}))
+	api.Get("/users/:id", h.Get)
+	api.Delete("/users/:id", middleware.DenyImpersonation(), h.Delete)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "seed@example.com",
+		"role":    model.RoleUser,
+		"act":     map[string]string{"sub": "admin-1"},
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	signed, _ := token.SignedString([]byte(testSecret))
+	send := func(method string) int {
+		req := httptest.NewRequest(method, "/api/users/seed@example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := send("GET"); status != 200 {
+		t.Errorf("expected read while impersonating to pass, got %d", status)
+	}
+	if status := send("DELETE"); status != 403 {
+		t.Errorf("expected delete while impersonating to be forbidden, got %d", status)
+	}
+	if len(recorded) != 2 || recorded[0].ActorID != "admin-1" || recorded[1].Status != 403 {
+		t.Errorf("expected both requests to be recorded, got %+v", recorded)
+	}
+
+	// Ordinary tokens are not recorded.
+	app.Test(authedReq("GET", "/api/users/seed@example.com", nil))
+	if len(recorded) != 2 {
+		t.Errorf("expected ordinary request not to be recorded")
+	}
+}
+
+func TestTenantResolution(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.Tenant(middleware.TenantConfig{Header: "X-Tenant-ID", BaseDomain: "register.test", Tenants: []string{"acme", "globex"}}))
+	tenant := func(c *fiber.Ctx) error { return c.SendString(ports.TenantFrom(c.UserContext())) }
+	app.Get("/whoami", tenant)
+	app.Get("/api/whoami", middleware.Auth(testSecret), tenant)
+
+	acmeToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":   "ann",
+		"tenant_id": "acme",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	})
+	signed, _ := acmeToken.SignedString([]byte(testSecret))
+
+	cases := []struct {
+		name, path, host, header, token string
+		status                          int
+		tenant                          string
+	}{
+		{"no tenant named", "/whoami", "register.test", "", "", 200, model.DefaultTenant},
+		{"header", "/whoami", "register.test", "globex", "", 200, "globex"},
+		{"subdomain", "/whoami", "acme.register.test", "", "", 200, "acme"},
+		{"header wins over subdomain", "/whoami", "acme.register.test", "globex", "", 200, "globex"},
+		{"unknown tenant", "/whoami", "register.test", "initech", "", 404, ""},
+		{"invalid tenant", "/whoami", "register.test", "Acme_Corp", "", 400, ""},
+		{"token claim", "/api/whoami", "register.test", "", signed, 200, "acme"},
+		{"token matches host", "/api/whoami", "acme.register.test", "", signed, 200, "acme"},
+		{"token for another tenant", "/api/whoami", "globex.register.test", "", signed, 403, ""},
+		{"legacy token", "/api/whoami", "register.test", "", signToken("seed"), 200, model.DefaultTenant},
+		{"legacy token on tenant host", "/api/whoami", "acme.register.test", "", signToken("seed"), 403, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Host = tc.host
+		if tc.header != "" {
+			req.Header.Set("X-Tenant-ID", tc.header)
+		}
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status || (tc.status == 200 && string(body) != tc.tenant) {
+			t.Errorf("%s: expected %d %q, got %d %q", tc.name, tc.status, tc.tenant, resp.StatusCode, body)
+		}
+	}
+}
+
+type stubGroups struct {
+	ports.GroupService
+	effective map[string]*model.EffectiveGroups
+}
+
+func (s *stubGroups) Effective(ctx context.Context, userID string) (*model.EffectiveGroups, error) {
+	if eff, ok := s.effective[userID]; ok {
+		return eff, nil
+	}
+	return &model.EffectiveGroups{}, nil
+}
+
+func TestGroupRoles(t *testing.T) {
+	groups := &stubGroups{effective: map[string]*model.EffectiveGroups{
+		"ops@example.com": {GroupIDs: []string{"g1"}, Roles: []string{model.RoleAdmin}},
+	}}
+	app := fiber.New()
+	api := app.Group("/api", middleware.Auth(testSecret, middleware.WithGroups(groups)))
+	api.Get("/admin", middleware.RequireRole(model.RoleAdmin), func(c *fiber.Ctx) error {
+		return c.JSON(middleware.CurrentPrincipal(c).Groups)
+	})
+
+	send := func(claims jwt.MapClaims) int {
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		req := httptest.NewRequest("GET", "/api/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := send(jwt.MapClaims{"user_id": "ops@example.com", "role": model.RoleUser}); status != 200 {
+		t.Errorf("expected admin role through group, got %d", status)
+	}
+	if status := send(jwt.MapClaims{"user_id": "dev@example.com", "role": model.RoleUser}); status != 403 {
+		t.Errorf("expected user without group role to be forbidden, got %d", status)
+	}
+	impersonated := jwt.MapClaims{"user_id": "ops@example.com", "role": model.RoleUser, "act": map[string]string{"sub": "admin-1"}}
+	if status := send(impersonated); status != 403 {
+		t.Errorf("expected impersonation not to carry group roles, got %d", status)
+	}
+}
+
+type stubAuthorizer struct {
+	got *model.AccessRequest
+}
+
+func (s *stubAuthorizer) Evaluate(req *model.AccessRequest) *model.PolicyDecision {
+	s.got = req
+	return &model.PolicyDecision{Reason: "no rule allows " + req.Action}
+}
+
+func TestPolicyExplain(t *testing.T) {
+	authz := &stubAuthorizer{}
+	app := fiber.New()
+	app.Post("/api/admin/policy/explain", middleware.Auth(testSecret), NewPolicyHandler(authz, newMockService()).Explain)
+
+	resp, err := app.Test(authedReq("POST", "/api/admin/policy/explain", []byte(`{"action":"user.delete","resource":{"id":"u1"}}`)))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("explain failed: %v status=%d", err, resp.StatusCode)
+	}
+	var d model.PolicyDecision
+	json.NewDecoder(resp.Body).Decode(&d)
+	if d.Allowed || d.Reason != "no rule allows user.delete" {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+	if authz.got.Principal["id"] != "seed@example.com" || authz.got.Resource["id"] != "u1" {
+		t.Errorf("expected the caller as principal, got %+v", authz.got)
+	}
+
+	resp, _ = app.Test(authedReq("POST", "/api/admin/policy/explain", []byte(`{"resource":{}}`)))
+	if resp.StatusCode != 400 {
+		t.Errorf("expected missing action to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+type fakeImports struct {
+	rows       []*model.ImportRow
+	dryRun     bool
+	job        *model.Job
+	results    []model.ImportResult
+	resultsErr error
+}
+
+func (f *fakeImports) Start(ctx context.Context, dryRun bool, next func() (*model.ImportRow, error)) (*model.Job, error) {
+	f.rows, f.dryRun = nil, dryRun
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.rows = append(f.rows, row)
+	}
+	if len(f.rows) == 0 {
+		return nil, ports.ErrEmptyImport
+	}
+	return &model.Job{ID: "job1", Type: model.JobUserImport, Status: model.JobQueued, Progress: model.JobProgress{Total: len(f.rows)}}, nil
+}
+
+func (f *fakeImports) Get(ctx context.Context, id string) (*model.Job, error) {
+	if f.job == nil || f.job.ID != id {
+		return nil, ports.ErrNotFound
+	}
+	return f.job, nil
+}
+
+func (f *fakeImports) Results(ctx context.Context, job *model.Job, fn func(model.ImportResult) error) error {
+	for _, result := range f.results {
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return f.resultsErr
+}
+
+func TestBulkImportAndExport(t *testing.T) {
+	svc := newMockService()
+	svc.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
+	imports := &fakeImports{}
+	h := NewBulkHandler(svc, nil, imports)
+	// Bodies over the limit are streamed to the handler.
+	app := fiber.New(fiber.Config{BodyLimit: 16, StreamRequestBody: true})
+	app.Post("/import", h.Import)
+	app.Get("/import/:id", h.ImportStatus)
+	app.Get("/export", h.Export)
+	upload := func(contentType, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/import?dry_run=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("import failed: %v", err)
+		}
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+
+	status, location := upload("text/csv", "name,email,password\nAnn,ann@example.com,secret\nBen,ben@example.com\n")
+	if status != 202 || location != "/api/admin/users/import/job1" || !imports.dryRun || len(imports.rows) != 2 {
+		t.Fatalf("csv import: status=%d location=%q rows=%d", status, location, len(imports.rows))
+	}
+	if r := imports.rows[0]; r.Line != 2 || r.Name != "Ann" || r.Email != "ann@example.com" || r.Password != "secret" || r.Errors != nil {
+		t.Fatalf("csv row = %+v", r)
+	}
+	if r := imports.rows[1]; r.Line != 3 || len(r.Errors) != 1 || r.Errors[0] != "wrong number of fields" {
+		t.Fatalf("short csv row = %+v", r)
+	}
+
+	status, _ = upload("application/x-ndjson", `{"name":"Ann","email":"ann@example.com","password_hash":"$2a$..."}`+"\n\n{\"nickname\":\"x\"}\n")
+	if status != 202 || len(imports.rows) != 2 || imports.rows[0].PasswordHash != "$2a$..." || imports.rows[1].Line != 3 || len(imports.rows[1].Errors) == 0 {
+		t.Fatalf("ndjson import: status=%d rows=%+v", status, imports.rows)
+	}
+
+	for _, tc := range []struct {
+		contentType, body string
+		want              int
+	}{
+		{"text/csv", "name,email,shoe_size\n", 400},
+		{"text/csv", "", 400},
+		{"text/csv", "email\nann@example.com\n\"unterminated\n", 400},
+		{"application/json", "[]", 415},
+	} {
+		if status, _ := upload(tc.contentType, tc.body); status != tc.want {
+			t.Errorf("import %q as %s: status=%d, want %d", tc.body, tc.contentType, status, tc.want)
+		}
+	}
+
+	finished := time.Now()
+	imports.job = &model.Job{
+		ID: "job1", Type: model.JobUserImport, Status: model.JobSucceeded,
+		Result: []byte(`{"dry_run":true,"created":0,"failed":1}`), Progress: model.JobProgress{Done: 2, Total: 2},
+		FinishedAt: &finished,
+	}
+	imports.results = []model.ImportResult{
+		{Line: 2, Email: "ann@example.com", Status: model.ImportValid},
+		{Line: 3, Status: model.ImportFailed, Errors: []string{"wrong number of fields"}},
+	}
+	resp, err := app.Test(httptest.NewRequest("GET", "/import/job1", nil))
+	if err != nil || resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("import status: %v status=%d", err, resp.StatusCode)
+	}
+	dec := json.NewDecoder(resp.Body)
+	var importStatus model.ImportStatus
+	var results []model.ImportResult
+	if err := dec.Decode(&importStatus); err != nil {
+		t.Fatalf("import status: %v", err)
+	}
+	for dec.More() {
+		var result model.ImportResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("import result: %v", err)
+		}
+		results = append(results, result)
+	}
+	if s := importStatus; s.Status != model.ImportFinished || s.JobStatus != model.JobSucceeded || !s.DryRun ||
+		s.Processed != 2 || s.Failed != 1 || len(results) != 2 || results[1].Errors[0] != "wrong number of fields" {
+		t.Fatalf("import status = %+v %+v", s, results)
+	}
+	// Results that can't be read end the stream with an error line.
+	imports.resultsErr = errors.New("store unreachable")
+	resp, _ = app.Test(httptest.NewRequest("GET", "/import/job1", nil))
+	body, _ := io.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 4 || lines[3] != `{"error":"store unreachable"}` {
+		t.Fatalf("import status with a failure = %q", body)
+	}
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/import/nope", nil)); resp.StatusCode != 404 {
+		t.Fatalf("unknown import: status=%d", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/export?format=csv", nil))
+	if err != nil || resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("csv export: %v status=%d", err, resp.StatusCode)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	lines = strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 || lines[0] != "id,name,email,role,disabled,created_at,updated_at,version" || !strings.HasPrefix(lines[1], "seed@example.com,Seed,seed@example.com,") {
+		t.Fatalf("csv export = %q", body)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/export", nil))
+	var user model.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil || user.Email != "seed@example.com" {
+		t.Fatalf("ndjson export: %+v %v", user, err)
+	}
+}
+
+type fakeJobs struct {
+	jobs map[string]*model.Job
+}
+
+func (f *fakeJobs) Handle(typ string, fn ports.JobFunc) {}
+
+func (f *fakeJobs) OnFinish(typ string, fn func(ctx context.Context, job *model.Job) error) {}
+
+func (f *fakeJobs) Enqueue(ctx context.Context, job *model.Job) error {
+	f.jobs[job.ID] = job
+	return nil
+}
+
+func (f *fakeJobs) Get(ctx context.Context, id string) (*model.Job, error) {
+	job, ok := f.jobs[id]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	return job, nil
+}
+
+func (f *fakeJobs) Cancel(ctx context.Context, id string) (*model.Job, error) {
+	job, err := f.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Finished() {
+		return job, ports.ErrConflict
+	}
+	job.Status = model.JobCanceled
+	return job, nil
+}
+
+func TestJobHandler(t *testing.T) {
+	jobs := &fakeJobs{jobs: map[string]*model.Job{
+		"running": {ID: "running", Type: model.JobUserImport, Status: model.JobRunning, Result: []byte(`{"created":1}`)},
+		"done":    {ID: "done", Status: model.JobSucceeded},
+	}}
+	h := NewJobHandler(jobs)
+	app := fiber.New()
+	app.Get("/jobs/:id", h.Get)
+	app.Post("/jobs/:id/cancel", h.Cancel)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/jobs/running", nil))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("get job: %v status=%d", err, resp.StatusCode)
+	}
+	var got struct {
+		Status string                 `json:"status"`
+		Result map[string]interface{} `json:"result"`
+	}
+	json.NewDecoder(resp.Body).Decode(&got)
+	if got.Status != model.JobRunning || got.Result["created"] != float64(1) {
+		t.Fatalf("job = %+v", got)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/jobs/missing", 404},
+		{"POST", "/jobs/running/cancel", 202},
+		{"POST", "/jobs/done/cancel", 409},
+		{"POST", "/jobs/missing/cancel", 404},
+	} {
+		resp, err := app.Test(httptest.NewRequest(tc.method, tc.path, nil))
+		if err != nil || resp.StatusCode != tc.want {
+			t.Errorf("%s %s: %v status=%d, want %d", tc.method, tc.path, err, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+type fakeAPIKeys struct {
+	ports.APIKeyService
+	keys map[string]*model.Principal
+}
+
+func (f *fakeAPIKeys) Authenticate(ctx context.Context, raw string) (*model.Principal, error) {
+	if p, ok := f.keys[raw]; ok {
+		return p, nil
+	}
+	return nil, ports.ErrInvalidCredentials
+}
+
+type fakeImpersonation struct{}
+
+func (fakeImpersonation) Impersonate(ctx context.Context, admin *model.Principal, targetID string) (string, time.Time, error) {
+	return "token", time.Now().Add(time.Minute), nil
+}
+
+func TestAdminRequiresAdminScope(t *testing.T) {
+	adminKey := func(scopes ...string) *model.Principal {
+		return &model.Principal{Type: model.PrincipalUser, TenantID: model.DefaultTenant, UserID: "admin-1",
+			Role: model.RoleAdmin, Method: model.AuthMethodAPIKey, Scopes: scopes}
+	}
+	keys := &fakeAPIKeys{keys: map[string]*model.Principal{
+		"rk_read":  adminKey(model.ScopeUsersRead),
+		"rk_admin": adminKey(model.ScopeAdmin),
+	}}
+	app := fiber.New()
+	api := app.Group("/api", middleware.Auth(testSecret, middleware.WithAPIKeys(keys)))
+	admin := api.Group("/admin", middleware.RequireAdmin())
+	admin.Post("/impersonate/:id", middleware.RequireInteractive(), NewImpersonationHandler(fakeImpersonation{}).Impersonate)
+	admin.Get("/ping", func(c *fiber.Ctx) error { return c.SendStatus(200) })
+
+	send := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "admin-1",
+		"role":    model.RoleAdmin,
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	signed, _ := token.SignedString([]byte(testSecret))
+
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{"POST", "/api/admin/impersonate/u1", "rk_read", 403},
+		{"GET", "/api/admin/ping", "rk_read", 403},
+		{"GET", "/api/admin/ping", "rk_admin", 200},
+		{"POST", "/api/admin/impersonate/u1", "rk_admin", 403},
+		{"POST", "/api/admin/impersonate/u1", signed, 201},
+	} {
+		if status := send(tc.method, tc.path, tc.token); status != tc.want {
+			t.Errorf("%s %s with %.8s: status=%d, want %d", tc.method, tc.path, tc.token, status, tc.want)
+		}
+	}
+}
+
+type fakeOAuth struct {
+	ports.OAuthService
+	consented bool
+}
+
+func (f *fakeOAuth) ValidateAuthorize(ctx context.Context, req *ports.AuthorizeRequest) (*model.OAuthClient, error) {
+	return &model.OAuthClient{ID: req.ClientID, Name: "Wiki"}, nil
+}
+
+func (f *fakeOAuth) SignIn(ctx context.Context, user *model.User, req *ports.AuthorizeRequest) (string, string, error) {
+	if f.consented {
+		return "code-1", "", nil
+	}
+	return "", "ticket-1", nil
+}
+
+func (f *fakeOAuth) Consent(ctx context.Context, ticket string, req *ports.AuthorizeRequest) (string, error) {
+	if ticket != "ticket-1" {
+		return "", ports.ErrInvalidToken
+	}
+	f.consented = true
+	return "code-1", nil
+}
+
+func TestAuthorizeFormCSRFAndConsent(t *testing.T) {
+	users := newMockService()
+	users.Register(context.Background(), "Seed", "seed@example.com", "pass", nil)
+	oauth := &fakeOAuth{}
+	h := NewOAuthHandler(oauth, users)
+	app := fiber.New()
+	app.Get("/oauth/authorize", h.AuthorizeForm)
+	app.Post("/oauth/authorize", h.Authorize)
+	const query = "client_id=wiki&redirect_uri=https%3A%2F%2Fwiki.example.com%2Fcb"
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/oauth/authorize?"+query, nil))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("authorize form: %v status=%d", err, resp.StatusCode)
+	}
+	var csrf *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == oauthCSRFCookie {
+			csrf = c
+		}
+	}
+	page, _ := io.ReadAll(resp.Body)
+	if csrf == nil || !csrf.HttpOnly || csrf.SameSite != http.SameSiteStrictMode || !strings.Contains(string(page), `value="`+csrf.Value+`"`) {
+		t.Fatalf("expected the form to carry its HttpOnly, SameSite cookie's token, got %+v", csrf)
+	}
+
+	post := func(cookie *http.Cookie, form string) *http.Response {
+		req := httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(query+"&"+form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+	signIn := "action=signin&email=seed%40example.com&password=pass&csrf_token="
+	if resp := post(nil, signIn+csrf.Value); resp.StatusCode != 403 {
+		t.Errorf("expected a post from another site, without the cookie, to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := post(csrf, signIn+"forged"); resp.StatusCode != 403 {
+		t.Errorf("expected a wrong csrf token to be rejected, got %d", resp.StatusCode)
+	}
+
+	resp = post(csrf, signIn+csrf.Value)
+	page, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || !strings.Contains(string(page), `name="ticket" value="ticket-1"`) {
+		t.Fatalf("expected the consent page, got %d %s", resp.StatusCode, page)
+	}
+	resp = post(csrf, "action=allow&ticket=ticket-1&csrf_token="+csrf.Value)
+	if resp.StatusCode != 302 || !strings.Contains(resp.Header.Get("Location"), "code=code-1") {
+		t.Fatalf("expected a redirect with the code after consent, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// With consent given, signing in goes straight back to the client.
+	resp = post(csrf, signIn+csrf.Value)
+	if resp.StatusCode != 302 || !strings.Contains(resp.Header.Get("Location"), "code=code-1") {
+		t.Fatalf("expected no consent page once consent was given, got %d", resp.StatusCode)
+	}
+}
+
+func TestOAuthTokenIsNotAdmin(t *testing.T) {
+	app := fiber.New()
+	api := app.Group("/api", middleware.Auth(testSecret))
+	api.Get("/users", middleware.RequireScope(model.ScopeUsersRead), func(c *fiber.Ctx) error {
+		return c.JSON(middleware.CurrentPrincipal(c))
+	})
+	api.Get("/admin/ping", middleware.RequireAdmin(), func(c *fiber.Ctx) error { return c.SendStatus(200) })
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["user_id"] = "admin-1"
+		claims["role"] = model.RoleAdmin
+		claims["client_id"] = "wiki"
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		return signed
+	}
+	send := func(path, token string) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+	oauth := sign(jwt.MapClaims{"typ": model.OAuthTokenType, "aud": "wiki", "scope": "openid users:read admin"})
+
+	resp := send("/api/users", oauth)
+	var p model.Principal
+	json.NewDecoder(resp.Body).Decode(&p)
+	if resp.StatusCode != 200 || p.Method != model.AuthMethodOAuth || p.Role != "" || p.ClientID != "wiki" {
+		t.Fatalf("oauth principal: status=%d %+v", resp.StatusCode, p)
+	}
+	if resp := send("/api/admin/ping", oauth); resp.StatusCode != 403 {
+		t.Errorf("oauth token on admin route: status=%d, want 403", resp.StatusCode)
+	}
+	// A client token without typ looks like the API's own; it is refused.
+	if resp := send("/api/users", sign(jwt.MapClaims{"scope": "users:read"})); resp.StatusCode != 401 {
+		t.Errorf("untyped client token: status=%d, want 401", resp.StatusCode)
+	}
+}
+
+func TestCSVText(t *testing.T) {
+	for in, want := range map[string]string{
+		"Ann":               "Ann",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1":                "'-1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"":                  "",
+	} {
+		if got := csvText(in); got != want {
+			t.Errorf("csvText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
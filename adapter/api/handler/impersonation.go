@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/pkg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImpersonationHandler struct {
+	service ports.ImpersonationService
+}
+
+func NewImpersonationHandler(service ports.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{service: service}
+}
+
+// Impersonate a user (admin)
+func (h *ImpersonationHandler) Impersonate(c *fiber.Ctx) error {
+	token, expiresAt, err := h.service.Impersonate(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"))
+	if errors.Is(err, ports.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"token": token, "expires_at": expiresAt})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JobHandler struct {
+	service ports.JobService
+}
+
+func NewJobHandler(service ports.JobService) *JobHandler {
+	return &JobHandler{service: service}
+}
+
+// Get Job with its progress and, so far, its result
+func (h *JobHandler) Get(c *fiber.Ctx) error {
+	job, err := h.service.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.JSON(job)
+}
+
+// Cancel Job; a running job stops shortly after, keeping what it has done
+func (h *JobHandler) Cancel(c *fiber.Ctx) error {
+	job, err := h.service.Cancel(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func jobError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Job not found"})
+	case errors.Is(err, ports.ErrConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Job has already finished"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
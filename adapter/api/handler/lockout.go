@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"register/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LockoutHandler struct {
+	guard ports.LoginGuard
+}
+
+func NewLockoutHandler(guard ports.LoginGuard) *LockoutHandler {
+	return &LockoutHandler{guard: guard}
+}
+
+// Unlock clears the failed-login state of an account, and with ?ip= that of
+// a client IP as well.
+func (h *LockoutHandler) Unlock(c *fiber.Ctx) error {
+	email := c.Params("email")
+	if err := h.guard.Unlock(c.UserContext(), email, c.Query("ip")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
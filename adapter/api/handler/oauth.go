@@ -0,0 +1,330 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/url"
+	"register/core/ports"
+	"register/model"
+	"register/pkg/middleware"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OAuthHandler struct {
+	oauth ports.OAuthService
+	users ports.UserService
+}
+
+func NewOAuthHandler(oauth ports.OAuthService, users ports.UserService) *OAuthHandler {
+	return &OAuthHandler{oauth: oauth, users: users}
+}
+
+// oauthCSRFCookie holds the double-submit token of the authorize page. The
+// form echoes it, which another site can't do, so it can't sign a user in
+// or consent for them by posting the form itself.
+const oauthCSRFCookie = "oauth_csrf"
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client.Name}}</title></head>
+<body>
+{{if .Ticket}}<h1>Allow {{.Client.Name}} to access your account?</h1>
+{{else}}<h1>Sign in to continue to {{.Client.Name}}</h1>
+{{end}}{{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+  <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+  <input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+  <input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+  <input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+  <input type="hidden" name="scope" value="{{.Scope}}">
+  <input type="hidden" name="state" value="{{.Request.State}}">
+  <input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+  <input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+  <input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+{{if .Ticket}}  <input type="hidden" name="ticket" value="{{.Ticket}}">
+  <p>{{.Client.Name}} is asking for: {{range .Request.Scopes}}<code>{{.}}</code> {{end}}</p>
+  <button type="submit" name="action" value="allow">Allow</button>
+{{else}}  <p><label>Email <input type="email" name="email" required></label></p>
+  <p><label>Password <input type="password" name="password" required></label></p>
+  <button type="submit" name="action" value="signin">Sign in</button>
+{{end}}  <button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</form>
+</body>
+</html>`))
+
+func authorizeRequest(c *fiber.Ctx) *ports.AuthorizeRequest {
+	// FormValue reads the query string on GET and the form body on POST.
+	return &ports.AuthorizeRequest{
+		ClientID:            c.FormValue("client_id"),
+		RedirectURI:         c.FormValue("redirect_uri"),
+		ResponseType:        c.FormValue("response_type"),
+		Scopes:              strings.Fields(c.FormValue("scope")),
+		State:               c.FormValue("state"),
+		Nonce:               c.FormValue("nonce"),
+		CodeChallenge:       c.FormValue("code_challenge"),
+		CodeChallengeMethod: c.FormValue("code_challenge_method"),
+	}
+}
+
+// Authorize Form; shows the sign-in and consent page
+func (h *OAuthHandler) AuthorizeForm(c *fiber.Ctx) error {
+	req := authorizeRequest(c)
+	client, err := h.oauth.ValidateAuthorize(c.UserContext(), req)
+	if err != nil {
+		return h.authorizeError(c, req, err)
+	}
+	return h.renderAuthorize(c, fiber.StatusOK, client, req, "", "")
+}
+
+// Authorize; signs the user in, then asks for consent unless the user has
+// already given it, and redirects back with a code
+func (h *OAuthHandler) Authorize(c *fiber.Ctx) error {
+	req := authorizeRequest(c)
+	client, err := h.oauth.ValidateAuthorize(c.UserContext(), req)
+	if err != nil {
+		return h.authorizeError(c, req, err)
+	}
+
+	csrf := c.Cookies(oauthCSRFCookie)
+	if csrf == "" || subtle.ConstantTimeCompare([]byte(csrf), []byte(c.FormValue("csrf_token"))) != 1 {
+		return h.renderAuthorize(c, fiber.StatusForbidden, client, req, "", "The page expired, please try again")
+	}
+
+	var code string
+	switch c.FormValue("action") {
+	case "signin":
+		user, err := h.users.Authenticate(c.UserContext(), c.FormValue("email"), c.FormValue("password"), c.IP())
+		var throttled *ports.ThrottledError
+		if errors.As(err, &throttled) {
+			return h.renderAuthorize(c, fiber.StatusTooManyRequests, client, req, "", "Too many login attempts, try again later")
+		}
+		if err != nil {
+			return h.renderAuthorize(c, fiber.StatusUnauthorized, client, req, "", "Invalid email or password")
+		}
+		var ticket string
+		code, ticket, err = h.oauth.SignIn(c.UserContext(), user, req)
+		if err != nil {
+			return redirectWith(c, req.RedirectURI, url.Values{"error": {"server_error"}, "state": {req.State}})
+		}
+		if ticket != "" {
+			return h.renderAuthorize(c, fiber.StatusOK, client, req, ticket, "")
+		}
+	case "allow":
+		code, err = h.oauth.Consent(c.UserContext(), c.FormValue("ticket"), req)
+		if errors.Is(err, ports.ErrInvalidToken) {
+			return h.renderAuthorize(c, fiber.StatusUnauthorized, client, req, "", "Your sign-in expired, please sign in again")
+		}
+		if err != nil {
+			return redirectWith(c, req.RedirectURI, url.Values{"error": {"server_error"}, "state": {req.State}})
+		}
+	default:
+		return redirectWith(c, req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}})
+	}
+	return redirectWith(c, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// renderAuthorize shows the sign-in page, or the consent page when the user
+// has signed in and got a ticket.
+func (h *OAuthHandler) renderAuthorize(c *fiber.Ctx, status int, client *model.OAuthClient, req *ports.AuthorizeRequest, ticket, errMsg string) error {
+	csrf, err := h.csrfToken(c)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	err = authorizePage.Execute(&b, map[string]interface{}{
+		"Client":  client,
+		"Request": req,
+		"Scope":   strings.Join(req.Scopes, " "),
+		"CSRF":    csrf,
+		"Ticket":  ticket,
+		"Error":   errMsg,
+	})
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	return c.Status(status).Type("html").SendString(b.String())
+}
+
+// csrfToken returns the browser's CSRF token for the authorize page, setting
+// a new one if it has none.
+func (h *OAuthHandler) csrfToken(c *fiber.Ctx) (string, error) {
+	if csrf := c.Cookies(oauthCSRFCookie); csrf != "" {
+		return csrf, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	csrf := base64.RawURLEncoding.EncodeToString(b)
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthCSRFCookie,
+		Value:    csrf,
+		Path:     "/oauth/authorize",
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		// Strict: the form posts from this site, and a cross-site post
+		// should not carry the cookie at all.
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+	return csrf, nil
+}
+
+// authorizeError redirects OAuth errors back to the client, but shows
+// anything else locally since the redirect URI is not trusted.
+func (h *OAuthHandler) authorizeError(c *fiber.Ctx, req *ports.AuthorizeRequest, err error) error {
+	var oauthErr *ports.OAuthError
+	if errors.As(err, &oauthErr) {
+		return redirectWith(c, req.RedirectURI, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {req.State},
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+}
+
+func redirectWith(c *fiber.Ctx, redirectURI string, params url.Values) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid redirect_uri"})
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+	return c.Redirect(u.String(), fiber.StatusFound)
+}
+
+// Token endpoint
+func (h *OAuthHandler) Token(c *fiber.Ctx) error {
+	req := &ports.TokenRequest{
+		GrantType:    c.FormValue("grant_type"),
+		ClientID:     c.FormValue("client_id"),
+		ClientSecret: c.FormValue("client_secret"),
+		Code:         c.FormValue("code"),
+		RedirectURI:  c.FormValue("redirect_uri"),
+		CodeVerifier: c.FormValue("code_verifier"),
+		Scope:        c.FormValue("scope"),
+	}
+	if id, secret, ok := basicAuth(c); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	resp, err := h.oauth.Token(c.UserContext(), req)
+	var oauthErr *ports.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := fiber.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = fiber.StatusUnauthorized
+		}
+		return c.Status(status).JSON(oauthErr)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ports.OAuthError{Code: "server_error"})
+	}
+	return c.JSON(resp)
+}
+
+// basicAuth reads client credentials from the Authorization header. Per
+// RFC 6749 section 2.3.1 both parts are form-urlencoded.
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return "", "", false
+	}
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	return id, secret, true
+}
+
+// UserInfo returns claims for the bearer of an access token
+func (h *OAuthHandler) UserInfo(c *fiber.Ctx) error {
+	p := middleware.CurrentPrincipal(c)
+	if !p.HasScope("openid") {
+		return c.Status(fiber.StatusForbidden).JSON(ports.OAuthError{Code: "insufficient_scope"})
+	}
+	claims, err := h.oauth.UserInfo(c.UserContext(), p.UserID, p.Scopes)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.JSON(claims)
+}
+
+// Discovery document
+func (h *OAuthHandler) Discovery(c *fiber.Ctx) error {
+	return c.JSON(h.oauth.Discovery())
+}
+
+// JWKS publishes the ID token signing key
+func (h *OAuthHandler) JWKS(c *fiber.Ctx) error {
+	return c.JSON(h.oauth.JWKS())
+}
+
+// Register Client (admin)
+func (h *OAuthHandler) RegisterClient(c *fiber.Ctx) error {
+	var req struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		GrantTypes   []string `json:"grant_types"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	client, secret, err := h.oauth.RegisterClient(c.UserContext(), &model.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+	})
+	var oauthErr *ports.OAuthError
+	if errors.As(err, &oauthErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(oauthErr)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"client": client, "client_secret": secret})
+}
+
+// List Clients (admin)
+func (h *OAuthHandler) ListClients(c *fiber.Ctx) error {
+	clients, err := h.oauth.ListClients(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(clients)
+}
+
+// Delete Client (admin)
+func (h *OAuthHandler) DeleteClient(c *fiber.Ctx) error {
+	err := h.oauth.DeleteClient(c.UserContext(), c.Params("id"))
+	if errors.Is(err, ports.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Client not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"register/pkg/middleware"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OrganizationHandler struct {
+	service ports.OrganizationService
+}
+
+func NewOrganizationHandler(service ports.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{service: service}
+}
+
+// Create Organization owned by the current user
+func (h *OrganizationHandler) Create(c *fiber.Ctx) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	org, err := h.service.Create(c.UserContext(), middleware.CurrentPrincipal(c).UserID, strings.TrimSpace(req.Name))
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(org)
+}
+
+// List Organizations of the current user
+func (h *OrganizationHandler) List(c *fiber.Ctx) error {
+	orgs, err := h.service.ListForUser(c.UserContext(), middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.JSON(orgs)
+}
+
+// Get Organization
+func (h *OrganizationHandler) Get(c *fiber.Ctx) error {
+	org, err := h.service.Get(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"))
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.JSON(org)
+}
+
+// List Members of an organization
+func (h *OrganizationHandler) ListMembers(c *fiber.Ctx) error {
+	members, err := h.service.ListMembers(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"))
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.JSON(members)
+}
+
+// Update Member role
+func (h *OrganizationHandler) UpdateMember(c *fiber.Ctx) error {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	m, err := h.service.UpdateMember(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"), c.Params("userId"), req.Role)
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.JSON(m)
+}
+
+// Remove Member, or leave when removing yourself
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	err := h.service.RemoveMember(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"), c.Params("userId"))
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Invite someone by email; the link is only sent by email
+func (h *OrganizationHandler) Invite(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Role == "" {
+		req.Role = model.OrgRoleMember
+	}
+	inv, err := h.service.Invite(c.UserContext(), middleware.CurrentPrincipal(c).UserID, c.Params("id"), req.Email, req.Role)
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(inv)
+}
+
+// Accept Invitation; name and password are needed if the invited email has no account
+func (h *OrganizationHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var req struct {
+		Token      string                 `json:"token"`
+		Name       string                 `json:"name"`
+		Password   string                 `json:"password"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	m, err := h.service.AcceptInvitation(c.UserContext(), req.Token, req.Name, req.Password, req.Attributes)
+	var policyErr *ports.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyResponse(c, policyErr)
+	}
+	var attrErr *ports.AttributeError
+	if errors.As(err, &attrErr) {
+		return attributeResponse(c, attrErr)
+	}
+	if errors.Is(err, ports.ErrInvalidToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired invitation"})
+	}
+	if err != nil {
+		return orgError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(m)
+}
+
+func orgError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Organization or member not found"})
+	case errors.Is(err, ports.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	case errors.Is(err, ports.ErrConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already a member"})
+	case errors.Is(err, ports.ErrInvalidRole), errors.Is(err, ports.ErrLastOwner), errors.Is(err, ports.ErrRegistrationRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
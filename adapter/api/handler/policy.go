@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"register/core/ports"
+	"register/model"
+	"register/pkg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PolicyHandler struct {
+	authz ports.Authorizer
+	users ports.UserService
+}
+
+func NewPolicyHandler(authz ports.Authorizer, users ports.UserService) *PolicyHandler {
+	return &PolicyHandler{authz: authz, users: users}
+}
+
+// Explain a policy decision (admin); principal defaults to the caller, with
+// their custom attributes as the user service would see them
+func (h *PolicyHandler) Explain(c *fiber.Ctx) error {
+	var req model.AccessRequest
+	if err := c.BodyParser(&req); err != nil || req.Action == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Principal == nil {
+		p := middleware.CurrentPrincipal(c)
+		req.Principal = p.Attributes()
+		if user, err := h.users.GetUser(c.UserContext(), p.UserID); err == nil && user.Attributes != nil {
+			req.Principal["attributes"] = user.Attributes
+		}
+	}
+	if req.Resource == nil {
+		req.Resource = map[string]interface{}{}
+	}
+	return c.JSON(h.authz.Evaluate(&req))
+}
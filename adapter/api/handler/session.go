@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"register/core/ports"
+	"register/pkg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionHandler struct {
+	service ports.SessionService
+	cookie  *middleware.CookieConfig
+}
+
+// NewSessionHandler takes the cookie settings so Logout can clear them; nil
+// when cookie mode is off.
+func NewSessionHandler(service ports.SessionService, cookie *middleware.CookieConfig) *SessionHandler {
+	return &SessionHandler{service: service, cookie: cookie}
+}
+
+// Logout revokes the caller's session and clears the session cookies
+func (h *SessionHandler) Logout(c *fiber.Ctx) error {
+	p := middleware.CurrentPrincipal(c)
+	if p.SessionID != "" {
+		if err := h.service.RevokeFamily(c.UserContext(), p.UserID, p.SessionID); err != nil && !errors.Is(err, ports.ErrNotFound) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if h.cookie != nil {
+		middleware.ClearSessionCookies(c, *h.cookie)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List Sessions of the current user
+func (h *SessionHandler) List(c *fiber.Ctx) error {
+	return h.list(c, middleware.CurrentPrincipal(c).UserID)
+}
+
+// Revoke Session of the current user
+func (h *SessionHandler) Revoke(c *fiber.Ctx) error {
+	return h.revoke(c, middleware.CurrentPrincipal(c).UserID, c.Params("id"))
+}
+
+// List Sessions of any user (admin)
+func (h *SessionHandler) ListForUser(c *fiber.Ctx) error {
+	return h.list(c, c.Params("id"))
+}
+
+// Revoke Session of any user (admin)
+func (h *SessionHandler) RevokeForUser(c *fiber.Ctx) error {
+	return h.revoke(c, c.Params("id"), c.Params("sid"))
+}
+
+func (h *SessionHandler) list(c *fiber.Ctx, userID string) error {
+	sessions, err := h.service.List(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	current := middleware.CurrentPrincipal(c).SessionID
+	for _, s := range sessions {
+		s.Current = current != "" && s.Family == current
+	}
+	return c.JSON(sessions)
+}
+
+func (h *SessionHandler) revoke(c *fiber.Ctx, userID, id string) error {
+	err := h.service.Revoke(c.UserContext(), userID, id)
+	if errors.Is(err, ports.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package scim
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Description   string      `json:"description,omitempty"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []attribute `json:"subAttributes,omitempty"`
+}
+
+func attr(name, typ, mutability string) attribute {
+	return attribute{Name: name, Type: typ, Mutability: mutability, Returned: "default", Uniqueness: "none"}
+}
+
+// schemas lists the attributes this service stores; others are accepted and
+// ignored.
+func schemas() []fiber.Map {
+	userName := attr("userName", "string", "readWrite")
+	userName.Required = true
+	userName.Uniqueness = "server"
+	userName.Description = "Email address the user signs in with."
+	password := attr("password", "string", "writeOnly")
+	password.Returned = "never"
+	password.Description = "Only used when the user is created."
+
+	email := attr("emails", "complex", "readWrite")
+	email.MultiValued = true
+	email.SubAttributes = []attribute{attr("value", "string", "readWrite"), attr("type", "string", "readWrite"), attr("primary", "boolean", "readWrite")}
+	name := attr("name", "complex", "readWrite")
+	name.SubAttributes = []attribute{attr("formatted", "string", "readWrite"), attr("givenName", "string", "readWrite"), attr("familyName", "string", "readWrite")}
+
+	displayName := attr("displayName", "string", "readWrite")
+	groupName := displayName
+	groupName.Required = true
+	members := attr("members", "complex", "readWrite")
+	members.MultiValued = true
+	members.SubAttributes = []attribute{attr("value", "string", "immutable"), attr("type", "string", "immutable"), attr("$ref", "reference", "immutable")}
+
+	return []fiber.Map{
+		schemaDoc(UserSchema, "User", []attribute{userName, name, displayName, email, attr("active", "boolean", "readWrite"), password}),
+		schemaDoc(GroupSchema, "Group", []attribute{groupName, members}),
+	}
+}
+
+// extensionSchema describes the tenant's custom attributes.
+func (h *Handler) extensionSchema(ctx context.Context) (fiber.Map, error) {
+	attrs := []attribute{}
+	if h.attrs != nil {
+		defs, err := h.attrs.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range defs {
+			a := attr(d.Name, d.Type, "readWrite")
+			a.Description = d.Description
+			a.Required = d.Required
+			a.CaseExact = true
+			if d.Unique {
+				a.Uniqueness = "server"
+			}
+			attrs = append(attrs, a)
+		}
+	}
+	return schemaDoc(ExtensionSchema, "Custom user attributes", attrs), nil
+}
+
+func (h *Handler) allSchemas(c *fiber.Ctx) ([]fiber.Map, error) {
+	ext, err := h.extensionSchema(c.UserContext())
+	if err != nil {
+		return nil, err
+	}
+	return append(schemas(), ext), nil
+}
+
+func schemaDoc(id, name string, attrs []attribute) fiber.Map {
+	return fiber.Map{
+		"schemas":    []string{schemaSchema},
+		"id":         id,
+		"name":       name,
+		"attributes": attrs,
+		"meta":       fiber.Map{"resourceType": "Schema"},
+	}
+}
+
+func (h *Handler) resourceTypes() []fiber.Map {
+	user := h.resourceType("User", "/Users", UserSchema)
+	user["schemaExtensions"] = []fiber.Map{{"schema": ExtensionSchema, "required": false}}
+	return []fiber.Map{user, h.resourceType("Group", "/Groups", GroupSchema)}
+}
+
+func (h *Handler) resourceType(name, endpoint, schema string) fiber.Map {
+	return fiber.Map{
+		"schemas":  []string{resourceTypeSchema},
+		"id":       name,
+		"name":     name,
+		"endpoint": endpoint,
+		"schema":   schema,
+		"meta":     fiber.Map{"resourceType": "ResourceType", "location": h.base + "/ResourceTypes/" + name},
+	}
+}
+
+func (h *Handler) ServiceProviderConfig(c *fiber.Ctx) error {
+	return respond(c, fiber.StatusOK, fiber.Map{
+		"schemas":        []string{serviceConfigSchema},
+		"patch":          fiber.Map{"supported": true},
+		"bulk":           fiber.Map{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         fiber.Map{"supported": true, "maxResults": maxResults},
+		"changePassword": fiber.Map{"supported": false},
+		"sort":           fiber.Map{"supported": false},
+		"etag":           fiber.Map{"supported": true},
+		"authenticationSchemes": []fiber.Map{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "An API key with the scim scope, owned by an admin, sent as Authorization: Bearer rk_...",
+			"primary":     true,
+		}},
+		"meta": fiber.Map{"resourceType": "ServiceProviderConfig", "location": h.base + "/ServiceProviderConfig"},
+	})
+}
+
+func (h *Handler) ResourceTypes(c *fiber.Ctx) error {
+	return discoveryList(c, h.resourceTypes())
+}
+
+func (h *Handler) ResourceType(c *fiber.Ctx) error {
+	return discoveryItem(c, h.resourceTypes(), c.Params("id"))
+}
+
+func (h *Handler) Schemas(c *fiber.Ctx) error {
+	all, err := h.allSchemas(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	return discoveryList(c, all)
+}
+
+func (h *Handler) Schema(c *fiber.Ctx) error {
+	all, err := h.allSchemas(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	return discoveryItem(c, all, c.Params("id"))
+}
+
+func discoveryList(c *fiber.Ctx, items []fiber.Map) error {
+	return respond(c, fiber.StatusOK, fiber.Map{
+		"schemas":      []string{listResponseSchema},
+		"totalResults": len(items),
+		"startIndex":   1,
+		"itemsPerPage": len(items),
+		"Resources":    items,
+	})
+}
+
+func discoveryItem(c *fiber.Ctx, items []fiber.Map, id string) error {
+	for _, item := range items {
+		if item["id"] == id {
+			return respond(c, fiber.StatusOK, item)
+		}
+	}
+	return fail(c, &Error{Status: fiber.StatusNotFound, Detail: "Unknown " + id})
+}
@@ -0,0 +1,405 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filter is a parsed SCIM filter (RFC 7644 section 3.4.2.2), matched against
+// resources in their JSON form. Attribute names and string values compare
+// case-insensitively.
+type filter interface {
+	match(res map[string]interface{}) bool
+}
+
+type logicalFilter struct {
+	and         bool
+	left, right filter
+}
+
+func (f *logicalFilter) match(res map[string]interface{}) bool {
+	if f.and {
+		return f.left.match(res) && f.right.match(res)
+	}
+	return f.left.match(res) || f.right.match(res)
+}
+
+type notFilter struct {
+	inner filter
+}
+
+func (f *notFilter) match(res map[string]interface{}) bool {
+	return !f.inner.match(res)
+}
+
+type compareFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (f *compareFilter) match(res map[string]interface{}) bool {
+	if f.op == "pr" {
+		for _, v := range elements(res, f.path) {
+			if m, ok := v.(map[string]interface{}); (ok && len(m) > 0) || (!ok && v != nil && v != "") {
+				return true
+			}
+		}
+		return false
+	}
+	values := lookup(res, f.path)
+	if f.op == "ne" {
+		// ne holds when no value equals, including when there is none.
+		for _, v := range values {
+			if compare(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuePathFilter matches when an element of a multi-valued attribute
+// matches inner, as in emails[type eq "work"].
+type valuePathFilter struct {
+	path  []string
+	inner filter
+}
+
+func (f *valuePathFilter) match(res map[string]interface{}) bool {
+	for _, v := range elements(res, f.path) {
+		if m, ok := v.(map[string]interface{}); ok && f.inner.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+var compareOps = map[string]bool{"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "gt": true, "ge": true, "lt": true, "le": true}
+
+// splitPath turns an attribute path into its parts, dropping a schema URN
+// prefix: "urn:ietf:params:scim:schemas:core:2.0:User:name.givenName" and
+// "name.givenName" are the same path.
+func splitPath(path string) []string {
+	// Custom attributes live under the extension schema URN.
+	if len(path) >= len(ExtensionSchema) && strings.EqualFold(path[:len(ExtensionSchema)], ExtensionSchema) {
+		rest := strings.TrimPrefix(path[len(ExtensionSchema):], ":")
+		if rest == "" {
+			return []string{ExtensionSchema}
+		}
+		return append([]string{ExtensionSchema}, strings.Split(rest, ".")...)
+	}
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return strings.Split(path, ".")
+}
+
+// get looks key up case-insensitively and returns the key as stored.
+func get(m map[string]interface{}, key string) (interface{}, string, bool) {
+	if v, ok := m[key]; ok {
+		return v, key, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, k, true
+		}
+	}
+	return nil, key, false
+}
+
+// lookup returns every value at path. A complex value stands for its
+// "value" sub-attribute, so emails eq "x" compares the addresses.
+func lookup(res map[string]interface{}, path []string) []interface{} {
+	values := elements(res, path)
+	for i, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			values[i], _, _ = get(m, "value")
+		}
+	}
+	return values
+}
+
+// elements returns every value at path, flattening multi-valued attributes.
+func elements(res map[string]interface{}, path []string) []interface{} {
+	current := []interface{}{res}
+	for _, part := range path {
+		var next []interface{}
+		for _, c := range current {
+			m, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			v, _, ok := get(m, part)
+			if !ok {
+				continue
+			}
+			if list, ok := v.([]interface{}); ok {
+				next = append(next, list...)
+			} else {
+				next = append(next, v)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func compare(v interface{}, op string, want interface{}) bool {
+	switch w := want.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		s, w = strings.ToLower(s), strings.ToLower(w)
+		switch op {
+		case "eq":
+			return s == w
+		case "co":
+			return strings.Contains(s, w)
+		case "sw":
+			return strings.HasPrefix(s, w)
+		case "ew":
+			return strings.HasSuffix(s, w)
+		case "gt":
+			return s > w
+		case "ge":
+			return s >= w
+		case "lt":
+			return s < w
+		case "le":
+			return s <= w
+		}
+	case float64:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return n == w
+		case "gt":
+			return n > w
+		case "ge":
+			return n >= w
+		case "lt":
+			return n < w
+		case "le":
+			return n <= w
+		}
+	case bool:
+		b, ok := v.(bool)
+		return ok && op == "eq" && b == w
+	case nil:
+		return op == "eq" && v == nil
+	}
+	return false
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("bad string %s", src[i:end+1])
+			}
+			tokens = append(tokens, token{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(src) && !strings.ContainsRune(" \t()[]\"", rune(src[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: src[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilter parses filters such as
+//
+//	userName eq "bjensen" and (emails co "@example.com" or not (active eq false))
+func parseFilter(src string) (filter, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return token{}, false
+}
+
+// keyword reports whether the next token is the unquoted word kw and
+// consumes it if so.
+func (p *filterParser) keyword(kw string) bool {
+	if t, ok := p.peek(); ok && !t.quoted && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.keyword(text) {
+		return fmt.Errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (filter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return &notFilter{inner: inner}, p.expect(")")
+	}
+	if p.keyword("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	return p.attrExpr()
+}
+
+func (p *filterParser) attrExpr() (filter, error) {
+	t, ok := p.peek()
+	if !ok || t.quoted || strings.ContainsAny(t.text, "()[]") {
+		return nil, fmt.Errorf("expected attribute path")
+	}
+	p.pos++
+	path := splitPath(t.text)
+
+	if p.keyword("[") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return &valuePathFilter{path: path, inner: inner}, p.expect("]")
+	}
+
+	opTok, ok := p.peek()
+	op := strings.ToLower(opTok.text)
+	if !ok || opTok.quoted || (op != "pr" && !compareOps[op]) {
+		return nil, fmt.Errorf("expected operator after %s", t.text)
+	}
+	p.pos++
+	if op == "pr" {
+		return &compareFilter{path: path, op: op}, nil
+	}
+
+	vt, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected value after %s", op)
+	}
+	p.pos++
+	value, err := literal(vt)
+	if err != nil {
+		return nil, err
+	}
+	return &compareFilter{path: path, op: op, value: value}, nil
+}
+
+func literal(t token) (interface{}, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad value %s", t.text)
+	}
+	return n, nil
+}
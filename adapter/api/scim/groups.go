@@ -0,0 +1,221 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// groupResource maps a group to the core Group schema. Nested groups are
+// members of type "Group". Description and roles are not part of SCIM and
+// are left alone by updates.
+func (h *Handler) groupResource(g *model.Group) (map[string]interface{}, string) {
+	members := []interface{}{}
+	for _, id := range g.Users {
+		members = append(members, map[string]interface{}{"value": id, "type": "User", "$ref": h.base + "/Users/" + id})
+	}
+	for _, id := range g.Groups {
+		members = append(members, map[string]interface{}{"value": id, "type": "Group", "$ref": h.base + "/Groups/" + id})
+	}
+	res := map[string]interface{}{
+		"schemas":     []interface{}{GroupSchema},
+		"id":          g.ID,
+		"displayName": g.Name,
+		"members":     members,
+	}
+	tag := h.withMeta(res, "Group", "/Groups/"+g.ID, g.CreatedAt)
+	return res, tag
+}
+
+type member struct {
+	id, kind string // kind is "" when the client didn't say
+}
+
+func parseGroup(res map[string]interface{}) (string, []member, error) {
+	name := str(res, "displayName")
+	if name == "" {
+		return "", nil, badRequest("invalidValue", "displayName is required")
+	}
+	var members []member
+	for _, v := range elements(res, []string{"members"}) {
+		m, ok := v.(map[string]interface{})
+		if !ok || str(m, "value") == "" {
+			return "", nil, badRequest("invalidValue", "members need a value")
+		}
+		kind := ""
+		switch strings.ToLower(str(m, "type")) {
+		case "user":
+			kind = model.GroupMemberUser
+		case "group":
+			kind = model.GroupMemberGroup
+		}
+		members = append(members, member{id: str(m, "value"), kind: kind})
+	}
+	return name, members, nil
+}
+
+func (h *Handler) ListGroups(c *fiber.Ctx) error {
+	groups, err := h.groups.List(c.UserContext())
+	if err != nil {
+		return fail(c, err)
+	}
+	resources := make([]map[string]interface{}, 0, len(groups))
+	for _, g := range groups {
+		res, _ := h.groupResource(g)
+		resources = append(resources, res)
+	}
+	return list(c, resources)
+}
+
+func (h *Handler) GetGroup(c *fiber.Ctx) error {
+	group, err := h.groups.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return fail(c, err)
+	}
+	res, tag := h.groupResource(group)
+	return sendResource(c, fiber.StatusOK, res, tag)
+}
+
+func (h *Handler) CreateGroup(c *fiber.Ctx) error {
+	var body map[string]interface{}
+	if err := parseBody(c, &body); err != nil {
+		return fail(c, err)
+	}
+	name, members, err := parseGroup(body)
+	if err != nil {
+		return fail(c, err)
+	}
+	ctx := c.UserContext()
+	created, err := h.groups.Create(ctx, &model.Group{Name: name})
+	if err != nil {
+		return fail(c, err)
+	}
+	group, err := h.updateGroup(ctx, created, name, members)
+	if err != nil {
+		// Don't leave a half-provisioned group behind.
+		h.groups.Delete(ctx, created.ID)
+		return fail(c, err)
+	}
+	res, tag := h.groupResource(group)
+	c.Location(h.base + "/Groups/" + group.ID)
+	return sendResource(c, fiber.StatusCreated, res, tag)
+}
+
+func (h *Handler) ReplaceGroup(c *fiber.Ctx) error {
+	group, _, err := h.currentGroup(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	var body map[string]interface{}
+	if err := parseBody(c, &body); err != nil {
+		return fail(c, err)
+	}
+	return h.saveGroup(c, group, body)
+}
+
+func (h *Handler) PatchGroup(c *fiber.Ctx) error {
+	group, res, err := h.currentGroup(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	var req patchRequest
+	if err := parseBody(c, &req); err != nil {
+		return fail(c, err)
+	}
+	if err := applyPatch(res, req.Operations); err != nil {
+		return fail(c, err)
+	}
+	return h.saveGroup(c, group, res)
+}
+
+func (h *Handler) DeleteGroup(c *fiber.Ctx) error {
+	group, _, err := h.currentGroup(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	if err := h.groups.Delete(c.UserContext(), group.ID); err != nil {
+		return fail(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) currentGroup(c *fiber.Ctx) (*model.Group, map[string]interface{}, error) {
+	group, err := h.groups.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	res, tag := h.groupResource(group)
+	if err := checkIfMatch(c, tag); err != nil {
+		return nil, nil, err
+	}
+	return group, res, nil
+}
+
+func (h *Handler) saveGroup(c *fiber.Ctx, group *model.Group, res map[string]interface{}) error {
+	name, members, err := parseGroup(res)
+	if err != nil {
+		return fail(c, err)
+	}
+	if group, err = h.updateGroup(c.UserContext(), group, name, members); err != nil {
+		return fail(c, err)
+	}
+	res, tag := h.groupResource(group)
+	return sendResource(c, fiber.StatusOK, res, tag)
+}
+
+// updateGroup renames the group and adds and removes members until they
+// match. Members without a type are users if such a user exists.
+func (h *Handler) updateGroup(ctx context.Context, group *model.Group, name string, members []member) (*model.Group, error) {
+	if name != group.Name {
+		if _, err := h.groups.Update(ctx, group.ID, &model.Group{Name: name, Description: group.Description, Roles: group.Roles}); err != nil {
+			return group, err
+		}
+	}
+
+	want := map[string][]string{model.GroupMemberUser: {}, model.GroupMemberGroup: {}}
+	for _, m := range members {
+		kind := m.kind
+		switch {
+		case kind != "":
+		case slices.Contains(group.Users, m.id):
+			kind = model.GroupMemberUser
+		case slices.Contains(group.Groups, m.id):
+			kind = model.GroupMemberGroup
+		default:
+			kind = model.GroupMemberGroup
+			if _, err := h.users.GetUser(ctx, m.id); err == nil {
+				kind = model.GroupMemberUser
+			}
+		}
+		want[kind] = append(want[kind], m.id)
+	}
+
+	have := map[string][]string{model.GroupMemberUser: group.Users, model.GroupMemberGroup: group.Groups}
+	for kind, ids := range have {
+		for _, id := range ids {
+			if !slices.Contains(want[kind], id) {
+				if err := h.groups.RemoveMember(ctx, group.ID, kind, id); err != nil {
+					return group, err
+				}
+			}
+		}
+	}
+	for kind, ids := range want {
+		for _, id := range ids {
+			if !slices.Contains(have[kind], id) {
+				if err := h.groups.AddMember(ctx, group.ID, kind, id); err != nil {
+					if errors.Is(err, ports.ErrNotFound) {
+						return group, badRequest("invalidValue", "unknown member "+id)
+					}
+					return group, err
+				}
+			}
+		}
+	}
+	return h.groups.Get(ctx, group.ID)
+}
@@ -0,0 +1,207 @@
+package scim
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+type patchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []patchOp `json:"Operations"`
+}
+
+// applyPatch applies PATCH operations (RFC 7644 section 3.5.2) to a resource
+// in its JSON form. Paths may be "attr", "attr.sub", "attr[filter]" or
+// "attr[filter].sub"; without a path the value is a map of attributes.
+func applyPatch(res map[string]interface{}, ops []patchOp) error {
+	for _, op := range ops {
+		if err := applyOp(res, strings.ToLower(op.Op), op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyOp(res map[string]interface{}, op, path string, value interface{}) error {
+	if op != "add" && op != "replace" && op != "remove" {
+		return badRequest("invalidSyntax", fmt.Sprintf("unknown operation %q", op))
+	}
+	if path == "" {
+		if op == "remove" {
+			return badRequest("noTarget", "remove needs a path")
+		}
+		attrs, ok := value.(map[string]interface{})
+		if !ok {
+			return badRequest("invalidValue", "value must be an object when there is no path")
+		}
+		for k, v := range attrs {
+			if err := applyOp(res, op, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attr, sel, sub, err := parsePatchPath(path)
+	if err != nil {
+		return badRequest("invalidPath", err.Error())
+	}
+	if sel == nil {
+		return setPath(res, op, attr, value)
+	}
+
+	if len(attr) != 1 {
+		return badRequest("invalidPath", "filters are only supported on top-level attributes")
+	}
+	current, key, _ := get(res, attr[0])
+	list, _ := current.([]interface{})
+	kept := make([]interface{}, 0, len(list))
+	matched := false
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok || !sel.match(m) {
+			kept = append(kept, item)
+			continue
+		}
+		matched = true
+		switch {
+		case op == "remove" && sub == "":
+			continue
+		case op == "remove":
+			_, k, _ := get(m, sub)
+			delete(m, k)
+		case sub == "":
+			replacement, ok := value.(map[string]interface{})
+			if !ok {
+				return badRequest("invalidValue", "value must be an object")
+			}
+			for k, v := range replacement {
+				_, stored, _ := get(m, k)
+				m[stored] = v
+			}
+		default:
+			_, k, _ := get(m, sub)
+			m[k] = value
+		}
+		kept = append(kept, m)
+	}
+	if !matched && op != "remove" {
+		return badRequest("noTarget", fmt.Sprintf("no value matches %s", path))
+	}
+	res[key] = kept
+	return nil
+}
+
+// setPath handles a path without a filter. add appends to multi-valued
+// attributes, skipping values already present; replace overwrites.
+func setPath(res map[string]interface{}, op string, attr []string, value interface{}) error {
+	parent := res
+	for _, part := range attr[:len(attr)-1] {
+		v, key, ok := get(parent, part)
+		child, isMap := v.(map[string]interface{})
+		if !ok || !isMap {
+			if op == "remove" {
+				return nil
+			}
+			child = map[string]interface{}{}
+			parent[key] = child
+		}
+		parent = child
+	}
+	current, key, exists := get(parent, attr[len(attr)-1])
+
+	switch {
+	case op == "remove":
+		if list, ok := current.([]interface{}); ok && value != nil {
+			// Some clients name the values to remove instead of using a
+			// filter: {"op":"remove","path":"members","value":[{"value":"id"}]}.
+			parent[key] = without(list, asList(value))
+		} else {
+			delete(parent, key)
+		}
+	case op == "add" && exists:
+		if list, ok := current.([]interface{}); ok {
+			for _, v := range asList(value) {
+				if !containsValue(list, v) {
+					list = append(list, v)
+				}
+			}
+			parent[key] = list
+			return nil
+		}
+		parent[key] = value
+	default:
+		parent[key] = value
+	}
+	return nil
+}
+
+func asList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
+
+// sameValue compares complex values by their "value" sub-attribute, so a
+// member is found whatever else the client sends with it.
+func sameValue(a, b interface{}) bool {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		av, _, aHas := get(am, "value")
+		bv, _, bHas := get(bm, "value")
+		if aHas && bHas {
+			return reflect.DeepEqual(av, bv)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if sameValue(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func without(list, remove []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if !containsValue(remove, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parsePatchPath splits members[value eq "2819c223"].display into the
+// attribute, the filter and the sub-attribute.
+func parsePatchPath(path string) (attr []string, sel filter, sub string, err error) {
+	open := strings.Index(path, "[")
+	if open < 0 {
+		return splitPath(path), nil, "", nil
+	}
+	end := strings.LastIndex(path, "]")
+	if end < open {
+		return nil, nil, "", fmt.Errorf("unbalanced brackets in %s", path)
+	}
+	if sel, err = parseFilter(path[open+1 : end]); err != nil {
+		return nil, nil, "", err
+	}
+	if rest := path[end+1:]; rest != "" {
+		if sub = strings.TrimPrefix(rest, "."); sub == rest || sub == "" {
+			return nil, nil, "", fmt.Errorf("bad sub-attribute in %s", path)
+		}
+	}
+	return splitPath(path[:open]), sel, sub, nil
+}
@@ -0,0 +1,221 @@
+// Package scim serves SCIM 2.0 (RFC 7643, RFC 7644) so identity providers
+// can provision users and groups. It works on top of ports.UserService and
+// ports.GroupService; resources are handled in their JSON form so filters and
+// PATCH paths apply to exactly what clients see.
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"register/core/ports"
+	"register/pkg/conditional"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	UserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	// ExtensionSchema carries the tenant's custom user attributes.
+	ExtensionSchema     = "urn:ietf:params:scim:schemas:extension:register:2.0:User"
+	listResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	patchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	errorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	serviceConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	resourceTypeSchema  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	schemaSchema        = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	ContentType = "application/scim+json"
+
+	// maxResults caps count on list requests.
+	maxResults = 200
+)
+
+type Handler struct {
+	users  ports.UserService
+	groups ports.GroupService
+	attrs  ports.AttributeService
+	base   string
+}
+
+// NewHandler serves SCIM at baseURL, e.g. "https://id.example.com/scim/v2",
+// which is used for meta.location and member $ref values. attrs describes
+// the extension schema and may be nil.
+func NewHandler(users ports.UserService, groups ports.GroupService, attrs ports.AttributeService, baseURL string) *Handler {
+	return &Handler{users: users, groups: groups, attrs: attrs, base: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is a SCIM error response; ScimType is one of the RFC 7644 detail
+// error keywords such as "invalidFilter" or "uniqueness".
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func badRequest(scimType, detail string) *Error {
+	return &Error{Status: fiber.StatusBadRequest, ScimType: scimType, Detail: detail}
+}
+
+func respond(c *fiber.Ctx, status int, body interface{}) error {
+	return c.Status(status).JSON(body, ContentType)
+}
+
+// fail answers err in the SCIM error format.
+func fail(c *fiber.Ctx, err error) error {
+	var scimErr *Error
+	var policyErr *ports.PolicyError
+	var attrErr *ports.AttributeError
+	var validationErr *ports.ValidationError
+	switch {
+	case errors.As(err, &scimErr):
+	case errors.As(err, &policyErr):
+		scimErr = badRequest("invalidValue", "password does not meet policy: "+strings.Join(policyErr.Violations, "; "))
+	case errors.As(err, &attrErr):
+		scimErr = badRequest("invalidValue", attrErr.Error())
+	case errors.As(err, &validationErr):
+		scimErr = badRequest("invalidValue", validationErr.Error())
+	case errors.Is(err, ports.ErrNotFound):
+		scimErr = &Error{Status: fiber.StatusNotFound, Detail: "Resource not found"}
+	case errors.Is(err, ports.ErrForbidden):
+		scimErr = &Error{Status: fiber.StatusForbidden, Detail: "Forbidden"}
+	case errors.Is(err, ports.ErrVersionMismatch):
+		scimErr = &Error{Status: fiber.StatusPreconditionFailed, Detail: "Resource has changed"}
+	case errors.Is(err, ports.ErrEmailTaken), errors.Is(err, ports.ErrConflict):
+		scimErr = &Error{Status: fiber.StatusConflict, ScimType: "uniqueness", Detail: "A resource with this userName already exists"}
+	case errors.Is(err, ports.ErrGroupCycle):
+		scimErr = badRequest("invalidValue", err.Error())
+	default:
+		scimErr = &Error{Status: fiber.StatusInternalServerError, Detail: err.Error()}
+	}
+	body := fiber.Map{"schemas": []string{errorSchema}, "status": strconv.Itoa(scimErr.Status), "detail": scimErr.Detail}
+	if scimErr.ScimType != "" {
+		body["scimType"] = scimErr.ScimType
+	}
+	return respond(c, scimErr.Status, body)
+}
+
+// parseBody decodes a JSON body; clients send application/scim+json, which
+// fiber's BodyParser does not accept.
+func parseBody(c *fiber.Ctx, out interface{}) error {
+	if err := json.Unmarshal(c.Body(), out); err != nil {
+		return badRequest("invalidSyntax", "Invalid JSON body")
+	}
+	return nil
+}
+
+// etag is a weak validator over everything but meta, so any change a client
+// can see changes it.
+func etag(res map[string]interface{}) string {
+	content := make(map[string]interface{}, len(res))
+	for k, v := range res {
+		if k != "meta" {
+			content[k] = v
+		}
+	}
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// withMeta adds meta to a resource and returns its ETag.
+func (h *Handler) withMeta(res map[string]interface{}, resourceType, path string, created time.Time) string {
+	tag := etag(res)
+	res["meta"] = map[string]interface{}{
+		"resourceType": resourceType,
+		"created":      created.UTC().Format(time.RFC3339),
+		"location":     h.base + path,
+		"version":      tag,
+	}
+	return tag
+}
+
+// checkIfMatch fails with 412 when If-Match is sent and names another
+// version.
+func checkIfMatch(c *fiber.Ctx, tag string) error {
+	// Versions are weak tags, which only weak comparison can match.
+	if header := c.Get(fiber.HeaderIfMatch); header != "" && !conditional.Match(header, tag, true) {
+		return &Error{Status: fiber.StatusPreconditionFailed, Detail: "Resource has changed"}
+	}
+	return nil
+}
+
+// sendResource answers a single resource, or 304 when If-None-Match names
+// its current version.
+func sendResource(c *fiber.Ctx, status int, res map[string]interface{}, tag string) error {
+	c.Set(fiber.HeaderETag, tag)
+	if status == fiber.StatusOK && c.Method() == fiber.MethodGet {
+		if header := c.Get(fiber.HeaderIfNoneMatch); header != "" && conditional.Match(header, tag, true) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+	return respond(c, status, res)
+}
+
+// list filters and pages resources for a list request.
+func list(c *fiber.Ctx, resources []map[string]interface{}) error {
+	if expr := c.Query("filter"); expr != "" {
+		f, err := parseFilter(expr)
+		if err != nil {
+			return fail(c, badRequest("invalidFilter", err.Error()))
+		}
+		matched := resources[:0]
+		for _, r := range resources {
+			if f.match(r) {
+				matched = append(matched, r)
+			}
+		}
+		resources = matched
+	}
+
+	start := max(c.QueryInt("startIndex", 1), 1)
+	count := min(max(c.QueryInt("count", maxResults), 0), maxResults)
+	page := []map[string]interface{}{}
+	if start <= len(resources) {
+		page = resources[start-1 : min(start-1+count, len(resources))]
+	}
+	return respond(c, fiber.StatusOK, fiber.Map{
+		"schemas":      []string{listResponseSchema},
+		"totalResults": len(resources),
+		"startIndex":   start,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	})
+}
+
+// str returns the string at path, or "".
+func str(res map[string]interface{}, path ...string) string {
+	values := elements(res, path)
+	if len(values) == 0 {
+		return ""
+	}
+	s, _ := values[0].(string)
+	return strings.TrimSpace(s)
+}
+
+// boolean reads a boolean attribute. Some clients send "True" and "False" as
+// strings.
+func boolean(res map[string]interface{}, name string, def bool) (bool, error) {
+	v, _, ok := get(res, name)
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		if parsed, err := strconv.ParseBool(strings.ToLower(b)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, badRequest("invalidValue", name+" must be a boolean")
+}
@@ -0,0 +1,378 @@
+package scim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type fakeUsers struct {
+	ports.UserService
+	users  map[string]*model.User
+	next   int
+	listed int // calls that loaded every user
+}
+
+func (f *fakeUsers) CreateUser(ctx context.Context, name, email, password string, attributes map[string]interface{}, disabled bool) (*model.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return nil, ports.ErrEmailTaken
+		}
+	}
+	f.next++
+	u := &model.User{ID: fmt.Sprintf("u%d", f.next), Name: name, Email: email, Disabled: disabled, CreatedAt: time.Now(), Attributes: attributes, Version: 1}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, id string) (*model.User, error) {
+	if u, ok := f.users[id]; ok {
+		copy := *u
+		return &copy, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (f *fakeUsers) FindUsersByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	var out []*model.User
+	for _, u := range f.users {
+		if strings.EqualFold(u.Email, email) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeUsers) ListUsers(ctx context.Context, filter map[string]string) ([]*model.User, error) {
+	if filter == nil {
+		f.listed++
+	}
+	var out []*model.User
+	for i := 1; i <= f.next; i++ {
+		if u, ok := f.users[fmt.Sprintf("u%d", i)]; ok {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeUsers) PatchUser(ctx context.Context, id string, fields *model.UserFields) (*model.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	if fields.Version != 0 && fields.Version != u.Version {
+		return nil, ports.ErrVersionMismatch
+	}
+	u.Name, u.Email = *fields.Name, *fields.Email
+	if fields.Attributes != nil {
+		u.Attributes = fields.Attributes
+	}
+	u.Version++
+	return f.GetUser(ctx, id)
+}
+
+func (f *fakeUsers) SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	u.Disabled = disabled
+	u.Version++
+	return f.GetUser(ctx, id)
+}
+
+func (f *fakeUsers) DeleteUser(ctx context.Context, id string, version int64) error {
+	u, ok := f.users[id]
+	if !ok {
+		return ports.ErrNotFound
+	}
+	if version != 0 && version != u.Version {
+		return ports.ErrVersionMismatch
+	}
+	delete(f.users, id)
+	return nil
+}
+
+type fakeGroups struct {
+	ports.GroupService
+	groups map[string]*model.Group
+}
+
+func (f *fakeGroups) Create(ctx context.Context, g *model.Group) (*model.Group, error) {
+	g.ID = fmt.Sprintf("g%d", len(f.groups)+1)
+	f.groups[g.ID] = g
+	return f.Get(ctx, g.ID)
+}
+
+func (f *fakeGroups) Get(ctx context.Context, id string) (*model.Group, error) {
+	if g, ok := f.groups[id]; ok {
+		copy := *g
+		copy.Users = slices.Clone(g.Users)
+		copy.Groups = slices.Clone(g.Groups)
+		return &copy, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (f *fakeGroups) AddMember(ctx context.Context, groupID, kind, memberID string) error {
+	g := f.groups[groupID]
+	if kind == model.GroupMemberUser {
+		g.Users = append(g.Users, memberID)
+	} else {
+		g.Groups = append(g.Groups, memberID)
+	}
+	return nil
+}
+
+func (f *fakeGroups) RemoveMember(ctx context.Context, groupID, kind, memberID string) error {
+	g := f.groups[groupID]
+	g.Users = slices.DeleteFunc(g.Users, func(id string) bool { return id == memberID })
+	g.Groups = slices.DeleteFunc(g.Groups, func(id string) bool { return id == memberID })
+	return nil
+}
+
+func setupSCIM() (*fiber.App, *fakeUsers, *fakeGroups) {
+	users := &fakeUsers{users: map[string]*model.User{}}
+	groups := &fakeGroups{groups: map[string]*model.Group{}}
+	h := NewHandler(users, groups, nil, "https://id.example.com/scim/v2")
+	app := fiber.New()
+	app.Get("/ServiceProviderConfig", h.ServiceProviderConfig)
+	app.Get("/Schemas/:id", h.Schema)
+	app.Get("/Users", h.ListUsers)
+	app.Post("/Users", h.CreateUser)
+	app.Get("/Users/:id", h.GetUser)
+	app.Put("/Users/:id", h.ReplaceUser)
+	app.Patch("/Users/:id", h.PatchUser)
+	app.Delete("/Users/:id", h.DeleteUser)
+	app.Post("/Groups", h.CreateGroup)
+	app.Patch("/Groups/:id", h.PatchGroup)
+	return app, users, groups
+}
+
+func do(t *testing.T, app *fiber.App, method, path, body string, headers ...string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", ContentType)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func TestFilters(t *testing.T) {
+	user := map[string]interface{}{
+		"userName": "Alice@Example.com",
+		"active":   true,
+		"name":     map[string]interface{}{"formatted": "Alice Liddell"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "alice@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "alice@home.example", "type": "home"},
+		},
+	}
+	cases := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "alice@example.com"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "alice@example.com"`, true},
+		{`userName eq "bob@example.com"`, false},
+		{`userName sw "alice" and active eq true`, true},
+		{`userName sw "bob" or name.formatted co "Liddell"`, true},
+		{`not (active eq true)`, false},
+		{`emails[type eq "home" and value ew "home.example"]`, true},
+		{`emails[type eq "other"]`, false},
+		{`emails.value eq "alice@home.example"`, true},
+		{`title pr`, false},
+		{`name pr`, true},
+	}
+	for _, tc := range cases {
+		f, err := parseFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.filter, err)
+		}
+		if got := f.match(user); got != tc.want {
+			t.Errorf("%q = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{`userName`, `userName eq`, `userName xx "a"`, `(userName eq "a"`, `userName eq "a" and`, `emails[type eq "work"`} {
+		if _, err := parseFilter(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	res := map[string]interface{}{
+		"active": true,
+		"members": []interface{}{
+			map[string]interface{}{"value": "u1"},
+			map[string]interface{}{"value": "u2"},
+		},
+	}
+	ops := []patchOp{
+		{Op: "Replace", Value: map[string]interface{}{"active": false}},
+		{Op: "add", Path: "members", Value: []interface{}{map[string]interface{}{"value": "u2"}, map[string]interface{}{"value": "u3"}}},
+		{Op: "remove", Path: `members[value eq "u1"]`},
+		{Op: "replace", Path: "name.givenName", Value: "Alice"},
+	}
+	if err := applyPatch(res, ops); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if res["active"] != false {
+		t.Fatalf("active not replaced: %v", res["active"])
+	}
+	members := res["members"].([]interface{})
+	if len(members) != 2 || !containsValue(members, map[string]interface{}{"value": "u2"}) || !containsValue(members, map[string]interface{}{"value": "u3"}) {
+		t.Fatalf("unexpected members: %v", members)
+	}
+	if str(res, "name", "givenName") != "Alice" {
+		t.Fatalf("sub-attribute not set: %v", res["name"])
+	}
+
+	if err := applyPatch(res, []patchOp{{Op: "replace", Path: `members[value eq "nope"].display`, Value: "x"}}); err == nil {
+		t.Fatal("expected noTarget for a filter matching nothing")
+	}
+	if err := applyPatch(res, []patchOp{{Op: "move", Path: "active"}}); err == nil {
+		t.Fatal("expected unknown operation to fail")
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	app, users, _ := setupSCIM()
+
+	resp, body := do(t, app, "POST", "/Users", `{"schemas":["`+UserSchema+`"],"userName":"alice@example.com","name":{"givenName":"Alice","familyName":"Liddell"},"active":false}`)
+	if resp.StatusCode != 201 || resp.Header.Get("Location") != "https://id.example.com/scim/v2/Users/u1" {
+		t.Fatalf("create: status=%d location=%q body=%v", resp.StatusCode, resp.Header.Get("Location"), body)
+	}
+	// Created disabled, not disabled after the fact.
+	if body["displayName"] != "Alice Liddell" || body["active"] != false || !users.users["u1"].Disabled || users.users["u1"].Version != 1 {
+		t.Fatalf("unexpected resource: %v", body)
+	}
+	tag := resp.Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("no ETag on create")
+	}
+
+	resp, body = do(t, app, "POST", "/Users", `{"userName":"alice@example.com"}`)
+	if resp.StatusCode != 409 || body["scimType"] != "uniqueness" {
+		t.Fatalf("duplicate: status=%d body=%v", resp.StatusCode, body)
+	}
+
+	resp, _ = do(t, app, "GET", "/Users/u1", "", "If-None-Match", tag)
+	if resp.StatusCode != 304 {
+		t.Fatalf("conditional get: status=%d", resp.StatusCode)
+	}
+
+	patch := `{"schemas":["` + patchOpSchema + `"],"Operations":[{"op":"replace","path":"active","value":"True"}]}`
+	resp, body = do(t, app, "PATCH", "/Users/u1", patch, "If-Match", tag)
+	if resp.StatusCode != 200 || body["active"] != true || users.users["u1"].Disabled {
+		t.Fatalf("patch: status=%d body=%v", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") == tag {
+		t.Fatal("ETag did not change")
+	}
+
+	resp, body = do(t, app, "PATCH", "/Users/u1", patch, "If-Match", tag)
+	if resp.StatusCode != 412 {
+		t.Fatalf("stale If-Match: status=%d body=%v", resp.StatusCode, body)
+	}
+
+	do(t, app, "POST", "/Users", `{"userName":"bob@example.com"}`)
+	resp, body = do(t, app, "GET", `/Users?filter=userName+eq+%22Bob@example.com%22`, "")
+	if resp.StatusCode != 200 || body["totalResults"] != float64(1) || users.listed != 0 {
+		t.Fatalf("filter: status=%d body=%v full listings=%d", resp.StatusCode, body, users.listed)
+	}
+	resp, body = do(t, app, "GET", `/Users?filter=userName+zz+1`, "")
+	if resp.StatusCode != 400 || body["scimType"] != "invalidFilter" {
+		t.Fatalf("bad filter: status=%d body=%v", resp.StatusCode, body)
+	}
+	resp, body = do(t, app, "GET", "/Users?startIndex=2&count=1", "")
+	if body["totalResults"] != float64(2) || body["itemsPerPage"] != float64(1) {
+		t.Fatalf("paging: body=%v", body)
+	}
+
+	resp, _ = do(t, app, "DELETE", "/Users/u1", "")
+	if resp.StatusCode != 204 {
+		t.Fatalf("delete: status=%d", resp.StatusCode)
+	}
+	resp, body = do(t, app, "GET", "/Users/u1", "")
+	if resp.StatusCode != 404 || body["status"] != "404" {
+		t.Fatalf("get deleted: status=%d body=%v", resp.StatusCode, body)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	app, users, groups := setupSCIM()
+	users.CreateUser(context.Background(), "Alice", "alice@example.com", "", nil, false)
+	users.CreateUser(context.Background(), "Bob", "bob@example.com", "", nil, false)
+
+	resp, body := do(t, app, "POST", "/Groups", `{"displayName":"Engineering","members":[{"value":"u1"}]}`)
+	if resp.StatusCode != 201 || !slices.Equal(groups.groups["g1"].Users, []string{"u1"}) {
+		t.Fatalf("create: status=%d body=%v", resp.StatusCode, body)
+	}
+
+	patch := `{"Operations":[{"op":"add","path":"members","value":[{"value":"u2","type":"User"}]},{"op":"remove","path":"members[value eq \"u1\"]"}]}`
+	resp, body = do(t, app, "PATCH", "/Groups/g1", patch)
+	if resp.StatusCode != 200 || !slices.Equal(groups.groups["g1"].Users, []string{"u2"}) {
+		t.Fatalf("patch: status=%d body=%v users=%v", resp.StatusCode, body, groups.groups["g1"].Users)
+	}
+	members := body["members"].([]interface{})
+	if len(members) != 1 || members[0].(map[string]interface{})["$ref"] != "https://id.example.com/scim/v2/Users/u2" {
+		t.Fatalf("unexpected members: %v", members)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	app, _, _ := setupSCIM()
+	resp, body := do(t, app, "GET", "/ServiceProviderConfig", "")
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != ContentType {
+		t.Fatalf("config: status=%d type=%q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if body["patch"].(map[string]interface{})["supported"] != true {
+		t.Fatalf("patch not advertised: %v", body)
+	}
+	resp, body = do(t, app, "GET", "/Schemas/"+UserSchema, "")
+	if resp.StatusCode != 200 || body["name"] != "User" {
+		t.Fatalf("schema: status=%d body=%v", resp.StatusCode, body)
+	}
+}
+
+func TestExtensionAttributes(t *testing.T) {
+	app, users, _ := setupSCIM()
+	resp, body := do(t, app, "POST", "/Users", `{"userName":"alice@example.com","`+ExtensionSchema+`":{"department":"eng"}}`)
+	if resp.StatusCode != 201 || users.users["u1"].Attributes["department"] != "eng" {
+		t.Fatalf("create: status=%d body=%v", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, app, "GET", "/Users?filter="+url.QueryEscape(ExtensionSchema+`:department eq "eng"`), "")
+	if resp.StatusCode != 200 || body["totalResults"] != float64(1) {
+		t.Fatalf("filter: status=%d body=%v", resp.StatusCode, body)
+	}
+
+	patch := `{"Operations":[{"op":"replace","path":"` + ExtensionSchema + `:department","value":"sales"}]}`
+	resp, body = do(t, app, "PATCH", "/Users/u1", patch)
+	if resp.StatusCode != 200 || users.users["u1"].Attributes["department"] != "sales" {
+		t.Fatalf("patch: status=%d body=%v", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,261 @@
+package scim
+
+import (
+	"context"
+	"reflect"
+	"register/model"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// userResource maps a user to the core User schema. userName is the email
+// address users sign in with; the name is sent as displayName and
+// name.formatted. Custom attributes go in the extension schema.
+func (h *Handler) userResource(u *model.User) (map[string]interface{}, string) {
+	res := map[string]interface{}{
+		"schemas":     []interface{}{UserSchema},
+		"id":          u.ID,
+		"userName":    u.Email,
+		"displayName": u.Name,
+		"name":        map[string]interface{}{"formatted": u.Name},
+		"emails": []interface{}{
+			map[string]interface{}{"value": u.Email, "type": "work", "primary": true},
+		},
+		"active": !u.Disabled,
+	}
+	if len(u.Attributes) > 0 {
+		attrs := make(map[string]interface{}, len(u.Attributes))
+		for k, v := range u.Attributes {
+			attrs[k] = v
+		}
+		res["schemas"] = []interface{}{UserSchema, ExtensionSchema}
+		res[ExtensionSchema] = attrs
+	}
+	tag := h.withMeta(res, "User", "/Users/"+u.ID, u.CreatedAt)
+	return res, tag
+}
+
+type userFields struct {
+	name, email, password string
+	active                bool
+	// attributes is nil when the extension schema was left out.
+	attributes map[string]interface{}
+}
+
+// parseUser reads the attributes this service stores. userName must be an
+// email address, or the primary email is used.
+func parseUser(res map[string]interface{}) (*userFields, error) {
+	f := &userFields{password: str(res, "password")}
+	email := str(res, "userName")
+	if email == "" {
+		return nil, badRequest("invalidValue", "userName is required")
+	}
+	if !strings.Contains(email, "@") {
+		email = primaryEmail(res)
+	}
+	if email == "" {
+		return nil, badRequest("invalidValue", "userName or a primary email must be an email address")
+	}
+	f.email = email
+
+	f.name = str(res, "displayName")
+	if f.name == "" {
+		f.name = str(res, "name", "formatted")
+	}
+	if f.name == "" {
+		f.name = strings.TrimSpace(str(res, "name", "givenName") + " " + str(res, "name", "familyName"))
+	}
+	if f.name == "" {
+		f.name = email
+	}
+
+	var err error
+	if f.active, err = boolean(res, "active", true); err != nil {
+		return nil, err
+	}
+	if v, _, ok := get(res, ExtensionSchema); ok && v != nil {
+		if f.attributes, ok = v.(map[string]interface{}); !ok {
+			return nil, badRequest("invalidValue", ExtensionSchema+" must be an object")
+		}
+	}
+	return f, nil
+}
+
+func primaryEmail(res map[string]interface{}) string {
+	emails := elements(res, []string{"emails"})
+	for _, e := range emails {
+		if m, ok := e.(map[string]interface{}); ok {
+			if primary, _, _ := get(m, "primary"); primary == true {
+				return str(m, "value")
+			}
+		}
+	}
+	if len(emails) > 0 {
+		if m, ok := emails[0].(map[string]interface{}); ok {
+			return str(m, "value")
+		}
+	}
+	return ""
+}
+
+// ListUsers answers GET /Users with filter, startIndex and count.
+func (h *Handler) ListUsers(c *fiber.Ctx) error {
+	users, err := h.findUsers(c.UserContext(), c.Query("filter"))
+	if err != nil {
+		return fail(c, err)
+	}
+	resources := make([]map[string]interface{}, 0, len(users))
+	for _, u := range users {
+		res, _ := h.userResource(u)
+		resources = append(resources, res)
+	}
+	return list(c, resources)
+}
+
+// findUsers loads the users expr may match. A single eq on userName, as
+// identity providers send to find a user before creating it, is looked up
+// in the store; other filters are matched against every user.
+func (h *Handler) findUsers(ctx context.Context, expr string) ([]*model.User, error) {
+	f, _ := parseFilter(expr) // list reports a malformed filter
+	if eq, ok := f.(*compareFilter); ok && eq.op == "eq" &&
+		(isPath(eq.path, "userName") || isPath(eq.path, "emails") || isPath(eq.path, "emails", "value")) {
+		if email, ok := eq.value.(string); ok {
+			return h.users.FindUsersByEmail(ctx, email)
+		}
+	}
+	return h.users.ListUsers(ctx, nil)
+}
+
+// isPath reports whether path is want, ignoring case.
+func isPath(path []string, want ...string) bool {
+	if len(path) != len(want) {
+		return false
+	}
+	for i := range path {
+		if !strings.EqualFold(path[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) GetUser(c *fiber.Ctx) error {
+	user, err := h.users.GetUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return fail(c, err)
+	}
+	res, tag := h.userResource(user)
+	return sendResource(c, fiber.StatusOK, res, tag)
+}
+
+func (h *Handler) CreateUser(c *fiber.Ctx) error {
+	var body map[string]interface{}
+	if err := parseBody(c, &body); err != nil {
+		return fail(c, err)
+	}
+	f, err := parseUser(body)
+	if err != nil {
+		return fail(c, err)
+	}
+	ctx := c.UserContext()
+	user, err := h.users.CreateUser(ctx, f.name, f.email, f.password, f.attributes, !f.active)
+	if err != nil {
+		return fail(c, err)
+	}
+	res, tag := h.userResource(user)
+	c.Location(h.base + "/Users/" + user.ID)
+	return sendResource(c, fiber.StatusCreated, res, tag)
+}
+
+// ReplaceUser answers PUT /Users/:id. Read-only attributes and password are
+// ignored.
+func (h *Handler) ReplaceUser(c *fiber.Ctx) error {
+	user, _, err := h.currentUser(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	var body map[string]interface{}
+	if err := parseBody(c, &body); err != nil {
+		return fail(c, err)
+	}
+	return h.saveUser(c, user, body)
+}
+
+func (h *Handler) PatchUser(c *fiber.Ctx) error {
+	user, res, err := h.currentUser(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	var req patchRequest
+	if err := parseBody(c, &req); err != nil {
+		return fail(c, err)
+	}
+	if err := applyPatch(res, req.Operations); err != nil {
+		return fail(c, err)
+	}
+	return h.saveUser(c, user, res)
+}
+
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	user, _, err := h.currentUser(c)
+	if err != nil {
+		return fail(c, err)
+	}
+	if err := h.users.DeleteUser(c.UserContext(), user.ID, expectedVersion(c, user)); err != nil {
+		return fail(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// currentUser loads the user in the path and checks If-Match against it.
+func (h *Handler) currentUser(c *fiber.Ctx) (*model.User, map[string]interface{}, error) {
+	user, err := h.users.GetUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	res, tag := h.userResource(user)
+	if err := checkIfMatch(c, tag); err != nil {
+		return nil, nil, err
+	}
+	return user, res, nil
+}
+
+// expectedVersion is the version a write must still find when the client
+// sent If-Match, so a change between currentUser and the write fails too.
+func expectedVersion(c *fiber.Ctx, user *model.User) int64 {
+	if c.Get(fiber.HeaderIfMatch) == "" {
+		return 0
+	}
+	return user.Version
+}
+
+func (h *Handler) saveUser(c *fiber.Ctx, user *model.User, res map[string]interface{}) error {
+	f, err := parseUser(res)
+	if err != nil {
+		return fail(c, err)
+	}
+	if user, err = h.updateUser(c.UserContext(), user, f, expectedVersion(c, user)); err != nil {
+		return fail(c, err)
+	}
+	res, tag := h.userResource(user)
+	return sendResource(c, fiber.StatusOK, res, tag)
+}
+
+func (h *Handler) updateUser(ctx context.Context, user *model.User, f *userFields, version int64) (*model.User, error) {
+	var err error
+	attrsChanged := f.attributes != nil && !reflect.DeepEqual(f.attributes, user.Attributes) &&
+		(len(f.attributes) > 0 || len(user.Attributes) > 0)
+	if f.name != user.Name || f.email != user.Email || attrsChanged {
+		fields := &model.UserFields{Name: &f.name, Email: &f.email, Attributes: f.attributes, Version: version}
+		if user, err = h.users.PatchUser(ctx, user.ID, fields); err != nil {
+			return nil, err
+		}
+	}
+	if f.active == user.Disabled {
+		if user, err = h.users.SetDisabled(ctx, user.ID, !f.active); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,90 @@
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// list checks passwords against a local copy of a breached-password corpus in
+// the SHA-1 "range" format used by Have I Been Pwned, so no request leaves
+// the host. Two layouts are accepted:
+//
+//   - a directory holding one file per 5-character hash prefix (e.g. "5BAA6"),
+//     each line being "SUFFIX:COUNT"; files are read on demand.
+//   - a single file of full hashes, one "HASH[:COUNT]" per line, loaded into
+//     memory grouped by prefix.
+type list struct {
+	dir      string
+	prefixes map[string]map[string]struct{}
+}
+
+func NewFileList(path string) (*list, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &list{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &list{prefixes: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash := hashField(scanner.Text())
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		prefix, suffix := hash[:5], hash[5:]
+		if l.prefixes[prefix] == nil {
+			l.prefixes[prefix] = make(map[string]struct{})
+		}
+		l.prefixes[prefix][suffix] = struct{}{}
+	}
+	return l, scanner.Err()
+}
+
+func (l *list) Contains(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if l.dir == "" {
+		_, ok := l.prefixes[prefix][suffix]
+		return ok, nil
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if hashField(scanner.Text()) == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func hashField(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
@@ -0,0 +1,43 @@
+package breach
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+const passwordHash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+func TestFileList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte(passwordHash+":3861493\n"), 0o600)
+
+	l, err := NewFileList(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	assertContains(t, l, "password", true)
+	assertContains(t, l, "not-in-the-list", false)
+}
+
+func TestRangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, passwordHash[:5]), []byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\n"+passwordHash[5:]+":3861493\n"), 0o600)
+
+	l, err := NewFileList(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	assertContains(t, l, "password", true)
+	assertContains(t, l, "not-in-the-list", false)
+}
+
+func assertContains(t *testing.T, l *list, password string, want bool) {
+	t.Helper()
+	got, err := l.Contains(context.Background(), password)
+	if err != nil || got != want {
+		t.Fatalf("Contains(%q) = %v, %v; want %v", password, got, err, want)
+	}
+}
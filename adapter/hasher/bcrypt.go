@@ -0,0 +1,47 @@
+package hasher
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxBcryptCost bounds the cost of stored hashes, which may come from
+// another system through an import; at cost 31 one login takes days.
+const maxBcryptCost = 18
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *bcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hashed), err
+}
+
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// Recognizes only accepts well-formed hashes with a cost up to the larger of
+// maxBcryptCost and the configured one.
+func (h *bcryptHasher) Recognizes(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost <= max(maxBcryptCost, h.cost)
+}
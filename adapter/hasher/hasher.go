@@ -0,0 +1,57 @@
+package hasher
+
+// Algorithm is one concrete hashing scheme that can tell its own encoded
+// hashes apart from other schemes'.
+type Algorithm interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+	Recognizes(encoded string) bool
+}
+
+// multiHasher hashes with the current algorithm and verifies with whichever
+// algorithm produced the stored hash, so old hashes keep working until they
+// are upgraded on the next login.
+type multiHasher struct {
+	current Algorithm
+	legacy  []Algorithm
+}
+
+func New(current Algorithm, legacy ...Algorithm) *multiHasher {
+	return &multiHasher{current: current, legacy: legacy}
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *multiHasher) Verify(password, encoded string) (bool, error) {
+	alg := h.algorithmFor(encoded)
+	if alg == nil {
+		return false, ErrInvalidHash
+	}
+	return alg.Verify(password, encoded)
+}
+
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	if !h.current.Recognizes(encoded) {
+		return true
+	}
+	return h.current.NeedsRehash(encoded)
+}
+
+func (h *multiHasher) Recognizes(encoded string) bool {
+	return h.algorithmFor(encoded) != nil
+}
+
+func (h *multiHasher) algorithmFor(encoded string) Algorithm {
+	if h.current.Recognizes(encoded) {
+		return h.current
+	}
+	for _, alg := range h.legacy {
+		if alg.Recognizes(encoded) {
+			return alg
+		}
+	}
+	return nil
+}
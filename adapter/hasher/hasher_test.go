@@ -0,0 +1,103 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2 = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := NewArgon2id(testArgon2)
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("hash failed: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected encoding: %s", encoded)
+	}
+
+	if ok, err := h.Verify("correct horse", encoded); err != nil || !ok {
+		t.Fatalf("expected match: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := h.Verify("wrong", encoded); ok {
+		t.Fatal("expected mismatch")
+	}
+	if h.NeedsRehash(encoded) {
+		t.Fatal("fresh hash should not need rehash")
+	}
+
+	stronger := NewArgon2id(Argon2Params{Memory: 2048, Iterations: 1, Parallelism: 1})
+	if !stronger.NeedsRehash(encoded) {
+		t.Fatal("expected rehash when memory cost changes")
+	}
+}
+
+func TestMultiHasherUpgradesLegacyHashes(t *testing.T) {
+	legacy := NewBcrypt(bcrypt.MinCost)
+	old, _ := legacy.Hash("secret")
+
+	h := New(NewArgon2id(testArgon2), legacy)
+	if ok, err := h.Verify("secret", old); err != nil || !ok {
+		t.Fatalf("expected legacy hash to verify: ok=%v err=%v", ok, err)
+	}
+	if !h.NeedsRehash(old) {
+		t.Fatal("expected bcrypt hash to need rehash under argon2id")
+	}
+
+	if _, err := h.Verify("secret", "plaintext"); err != ErrInvalidHash {
+		t.Fatalf("expected ErrInvalidHash, got %v", err)
+	}
+}
+
+func TestBcryptCostChangeNeedsRehash(t *testing.T) {
+	old, _ := NewBcrypt(bcrypt.MinCost).Hash("secret")
+	if !NewBcrypt(bcrypt.MinCost + 1).NeedsRehash(old) {
+		t.Fatal("expected rehash when cost changes")
+	}
+}
+
+func TestArgon2idRejectsUnsafeParameters(t *testing.T) {
+	salt := "c29tZXNhbHRzb21lc2FsdA"                     // 16 bytes
+	key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U" // 32 bytes
+	h := New(NewArgon2id(testArgon2), NewBcrypt(bcrypt.MinCost))
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=65536,t=0,p=0$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=0,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=0$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=300$" + salt + "$" + key,
+		"$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=4,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=100000,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=1$c2FsdA$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=1$" + salt + "$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=1$" + salt + "$" + strings.Repeat("a2V5", 30),
+		"$argon2id$garbage",
+	} {
+		if h.Recognizes(encoded) {
+			t.Errorf("recognized %s", encoded)
+		}
+		if ok, err := h.Verify("x", encoded); ok || err != ErrInvalidHash {
+			t.Errorf("verify %s: ok=%v err=%v", encoded, ok, err)
+		}
+	}
+	if encoded := "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + key; !h.Recognizes(encoded) {
+		t.Errorf("didn't recognize %s", encoded)
+	}
+}
+
+func TestBcryptRejectsUnsafeHashes(t *testing.T) {
+	h := NewBcrypt(bcrypt.MinCost)
+	good, _ := h.Hash("secret")
+	if !h.Recognizes(good) {
+		t.Fatal("expected own hash to be recognized")
+	}
+	slow := "$2a$31$" + good[7:]
+	for _, encoded := range []string{slow, "$2a$10$short", "$2a$"} {
+		if h.Recognizes(encoded) {
+			t.Errorf("recognized %s", encoded)
+		}
+	}
+}
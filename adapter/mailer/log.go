@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// logMailer writes messages to the log instead of sending them. Used in
+// development and when no SMTP server is configured.
+type logMailer struct{}
+
+func NewLogMailer() *logMailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("[Mailer] to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,130 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"register/adapter/signing"
+	"testing"
+	"time"
+)
+
+// stubIdP is a minimal OpenID provider: discovery, JWKS and a token endpoint
+// that issues an ID token with whatever claims the test sets.
+type stubIdP struct {
+	*httptest.Server
+	claims    map[string]interface{}
+	challenge string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	signer, err := signing.LoadOrCreateRSA("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signer.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if id != "register" || secret != "s3cret" || r.FormValue("code") != "good-code" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token, _ := signer.Sign(idp.claims)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (s *stubIdP) provider() *provider {
+	return NewProvider(Config{
+		Name:         "corp",
+		Issuer:       s.URL,
+		ClientID:     "register",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost/auth/corp/callback",
+	}, s.Client())
+}
+
+func (s *stubIdP) validClaims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            s.URL,
+		"aud":            "register",
+		"sub":            "emp-42",
+		"email":          "ada@corp.example",
+		"email_verified": true,
+		"name":           "Ada",
+		"nonce":          nonce,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newStubIdP(t)
+	raw, err := idp.provider().AuthCodeURL(context.Background(), "st", "nn", "ch")
+	if err != nil {
+		t.Fatalf("auth url failed: %v", err)
+	}
+	u, _ := url.Parse(raw)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("state") != "st" || q.Get("nonce") != "nn" ||
+		q.Get("code_challenge") != "ch" || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid profile email" {
+		t.Errorf("unexpected auth url %s", raw)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newStubIdP(t)
+	verifier := "verifier-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	idp.challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+		code   string
+		ok     bool
+	}{
+		{"valid", func(map[string]interface{}) {}, "good-code", true},
+		{"bad code", func(map[string]interface{}) {}, "bad-code", false},
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "other" }, "good-code", false},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }, "good-code", false},
+		{"audience list", func(c map[string]interface{}) { c["aud"] = []string{"x", "register"} }, "good-code", true},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example" }, "good-code", false},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, "good-code", false},
+		{"no subject", func(c map[string]interface{}) { delete(c, "sub") }, "good-code", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = idp.validClaims("nonce-1")
+			tt.modify(idp.claims)
+
+			ext, err := idp.provider().Exchange(context.Background(), tt.code, verifier, "nonce-1")
+			if tt.ok != (err == nil) {
+				t.Fatalf("expected ok=%v, got err %v", tt.ok, err)
+			}
+			if tt.ok && (ext.Subject != "emp-42" || ext.Email != "ada@corp.example" || !ext.EmailVerified || ext.Name != "Ada") {
+				t.Errorf("unexpected claims %+v", ext)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAPIKeys struct {
+	coll *mongo.Collection
+}
+
+func NewMongoAPIKeyRepository(db *mongo.Database) *mongoAPIKeys {
+	return &mongoAPIKeys{coll: db.Collection("api_keys")}
+}
+
+func (r *mongoAPIKeys) EnsureIndexes(ctx context.Context) error {
+	if err := backfillTenant(ctx, r.coll); err != nil {
+		return err
+	}
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+func (r *mongoAPIKeys) Create(ctx context.Context, key *model.APIKey) error {
+	key.ID = primitive.NewObjectID().Hex()
+	key.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, key)
+	return err
+}
+
+// GetByPrefix is not tenant-scoped: it runs before the tenant is known, and
+// the key's TenantID then decides it.
+func (r *mongoAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.coll.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *mongoAPIKeys) ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, bson.M{"user_id": userID}), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []*model.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *mongoAPIKeys) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	res, err := r.coll.UpdateOne(ctx,
+		scoped(ctx, bson.M{"_id": id, "user_id": userID, "revoked_at": bson.M{"$exists": false}}),
+		bson.M{"$set": bson.M{"revoked_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAPIKeys) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
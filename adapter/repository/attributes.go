@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAttributes struct {
+	coll *mongo.Collection
+}
+
+func NewMongoAttributeRepository(db *mongo.Database) *mongoAttributes {
+	return &mongoAttributes{coll: db.Collection("attribute_definitions")}
+}
+
+// EnsureIndexes makes attribute names unique per tenant.
+func (r *mongoAttributes) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *mongoAttributes) List(ctx context.Context) ([]*model.AttributeDefinition, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, nil), options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	defs := []*model.AttributeDefinition{}
+	if err := cursor.All(ctx, &defs); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+func (r *mongoAttributes) Save(ctx context.Context, def *model.AttributeDefinition) error {
+	def.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.UpdateOne(ctx, scoped(ctx, bson.M{"name": def.Name}), bson.M{
+		"$set": bson.M{
+			"type":        def.Type,
+			"description": def.Description,
+			"required":    def.Required,
+			"unique":      def.Unique,
+			"pattern":     def.Pattern,
+			"enum":        def.Enum,
+			"updated_at":  def.UpdatedAt,
+		},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoAttributes) Delete(ctx context.Context, name string) error {
+	res, err := r.coll.DeleteOne(ctx, scoped(ctx, bson.M{"name": name}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"register/core/ports"
+	"register/model"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAuditLog struct {
+	coll        *mongo.Collection
+	checkpoints *mongo.Collection
+}
+
+func NewMongoAuditSink(db *mongo.Database) *mongoAuditLog {
+	// Decode nested documents as maps so changes hash the same after a
+	// round trip as when they were written.
+	opts := options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+	return &mongoAuditLog{
+		coll:        db.Collection("audit_log", opts),
+		checkpoints: db.Collection("audit_checkpoints"),
+	}
+}
+
+func (r *mongoAuditLog) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "seq", Value: 1}},
+			// Unique so two instances can't both append the same Seq.
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"seq": bson.M{"$gt": 0}}),
+		},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+func (r *mongoAuditLog) Write(ctx context.Context, event *model.AuditEvent) error {
+	event.ID = primitive.NewObjectID().Hex()
+	_, err := r.coll.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrConflict
+	}
+	return err
+}
+
+func (r *mongoAuditLog) Last(ctx context.Context) (*model.AuditEvent, error) {
+	var event model.AuditEvent
+	err := r.coll.FindOne(ctx, bson.M{"seq": bson.M{"$gt": 0}}, options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *mongoAuditLog) Scan(ctx context.Context, fn func(*model.AuditEvent) error) error {
+	cursor, err := r.coll.Find(ctx, bson.M{"seq": bson.M{"$gt": 0}}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event model.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoAuditLog) WriteCheckpoint(ctx context.Context, cp *model.AuditCheckpoint) error {
+	cp.ID = primitive.NewObjectID().Hex()
+	_, err := r.checkpoints.InsertOne(ctx, cp)
+	return err
+}
+
+func (r *mongoAuditLog) Checkpoints(ctx context.Context) ([]*model.AuditCheckpoint, error) {
+	cursor, err := r.checkpoints.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	checkpoints := []*model.AuditCheckpoint{}
+	if err := cursor.All(ctx, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func (r *mongoAuditLog) Query(ctx context.Context, filter ports.AuditFilter) ([]*model.AuditEvent, int64, error) {
+	// Events from before multi-tenancy have no tenant_id. They can't be
+	// backfilled without breaking their hashes, so they are matched here.
+	q := bson.M{"tenant_id": ports.TenantFrom(ctx)}
+	if q["tenant_id"] == model.DefaultTenant {
+		q["tenant_id"] = bson.M{"$in": bson.A{model.DefaultTenant, nil}}
+	}
+	if filter.ActorID != "" {
+		q["actor_id"] = filter.ActorID
+	}
+	if filter.TargetID != "" {
+		q["target_id"] = filter.TargetID
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "."); ok {
+		q["action"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix) + `\.`}
+	} else if filter.Action != "" {
+		q["action"] = filter.Action
+	}
+	timeRange := bson.M{}
+	if !filter.Since.IsZero() {
+		timeRange["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		timeRange["$lt"] = filter.Until
+	}
+	if len(timeRange) > 0 {
+		q["time"] = timeRange
+	}
+
+	total, err := r.coll.CountDocuments(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := r.coll.Find(ctx, q, options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*model.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoGroups struct {
+	coll *mongo.Collection
+}
+
+func NewMongoGroupRepository(db *mongo.Database) *mongoGroups {
+	return &mongoGroups{coll: db.Collection("groups")}
+}
+
+// EnsureIndexes creates the indexes used to walk memberships upwards.
+func (r *mongoGroups) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "users", Value: 1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "groups", Value: 1}}},
+	})
+	return err
+}
+
+// memberField maps a model.GroupMember* kind to the array holding it.
+func memberField(kind string) (string, error) {
+	switch kind {
+	case model.GroupMemberUser:
+		return "users", nil
+	case model.GroupMemberGroup:
+		return "groups", nil
+	}
+	return "", ports.ErrNotFound
+}
+
+func (r *mongoGroups) Create(ctx context.Context, group *model.Group) error {
+	group.ID = primitive.NewObjectID().Hex()
+	group.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, group)
+	return err
+}
+
+func (r *mongoGroups) GetByID(ctx context.Context, id string) (*model.Group, error) {
+	var group model.Group
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&group)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *mongoGroups) GetByIDs(ctx context.Context, ids []string) ([]*model.Group, error) {
+	return r.find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (r *mongoGroups) List(ctx context.Context) ([]*model.Group, error) {
+	return r.find(ctx, nil)
+}
+
+func (r *mongoGroups) ListContaining(ctx context.Context, kind string, memberIDs []string) ([]*model.Group, error) {
+	field, err := memberField(kind)
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, bson.M{field: bson.M{"$in": memberIDs}})
+}
+
+func (r *mongoGroups) find(ctx context.Context, filter bson.M) ([]*model.Group, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, filter), options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	groups := []*model.Group{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *mongoGroups) Update(ctx context.Context, group *model.Group) (*model.Group, error) {
+	var updated model.Group
+	err := r.coll.FindOneAndUpdate(ctx, scoped(ctx, bson.M{"_id": group.ID}), bson.M{
+		"$set": bson.M{"name": group.Name, "description": group.Description, "roles": group.Roles},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *mongoGroups) Delete(ctx context.Context, id string) error {
+	res, err := r.coll.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ports.ErrNotFound
+	}
+	_, err = r.coll.UpdateMany(ctx, scoped(ctx, bson.M{"groups": id}), bson.M{"$pull": bson.M{"groups": id}})
+	return err
+}
+
+func (r *mongoGroups) AddMember(ctx context.Context, groupID, kind, memberID string) error {
+	return r.updateMembers(ctx, groupID, kind, "$addToSet", memberID)
+}
+
+func (r *mongoGroups) RemoveMember(ctx context.Context, groupID, kind, memberID string) error {
+	return r.updateMembers(ctx, groupID, kind, "$pull", memberID)
+}
+
+func (r *mongoGroups) updateMembers(ctx context.Context, groupID, kind, op, memberID string) error {
+	field, err := memberField(kind)
+	if err != nil {
+		return err
+	}
+	res, err := r.coll.UpdateOne(ctx, scoped(ctx, bson.M{"_id": groupID}), bson.M{op: bson.M{field: memberID}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
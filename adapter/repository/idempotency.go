@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoIdempotency struct {
+	coll *mongo.Collection
+}
+
+func NewMongoIdempotencyStore(db *mongo.Database) *mongoIdempotency {
+	return &mongoIdempotency{coll: db.Collection("idempotency_keys")}
+}
+
+// EnsureIndexes lets Mongo delete keys once they expire.
+func (r *mongoIdempotency) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *mongoIdempotency) Reserve(ctx context.Context, req *model.IdempotentRequest) (*model.IdempotentRequest, error) {
+	_, err := r.coll.InsertOne(ctx, req)
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	// The TTL monitor only runs once a minute, so take over a key that has
+	// expired but not been deleted yet.
+	res, err := r.coll.ReplaceOne(ctx, bson.M{"_id": req.Key, "expires_at": bson.M{"$lte": time.Now()}}, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount > 0 {
+		return nil, nil
+	}
+	var existing model.IdempotentRequest
+	err = r.coll.FindOne(ctx, bson.M{"_id": req.Key}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Deleted since the insert failed; try once more.
+		_, err = r.coll.InsertOne(ctx, req)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *mongoIdempotency) Complete(ctx context.Context, req *model.IdempotentRequest) error {
+	_, err := r.coll.ReplaceOne(ctx, bson.M{"_id": req.Key}, req)
+	return err
+}
+
+func (r *mongoIdempotency) Release(ctx context.Context, key string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoImportBatches struct {
+	coll *mongo.Collection
+}
+
+func NewMongoImportBatchRepository(db *mongo.Database) *mongoImportBatches {
+	return &mongoImportBatches{coll: db.Collection("import_batches")}
+}
+
+func (r *mongoImportBatches) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func (r *mongoImportBatches) Create(ctx context.Context, batch *model.ImportBatch) error {
+	batch.ID = primitive.NewObjectID().Hex()
+	batch.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, batch)
+	return err
+}
+
+func (r *mongoImportBatches) Get(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error) {
+	var batch model.ImportBatch
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"job_id": jobID, "seq": seq})).Decode(&batch)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (r *mongoImportBatches) Save(ctx context.Context, batch *model.ImportBatch) error {
+	res, err := r.coll.UpdateOne(ctx,
+		scoped(ctx, bson.M{"job_id": batch.JobID, "seq": batch.Seq}),
+		bson.M{"$set": bson.M{"rows": batch.Rows, "results": batch.Results}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoImportBatches) Each(ctx context.Context, jobID string, fn func(*model.ImportBatch) error) error {
+	cur, err := r.coll.Find(ctx,
+		scoped(ctx, bson.M{"job_id": jobID}),
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetProjection(bson.M{"rows": 0}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var batch model.ImportBatch
+		if err := cur.Decode(&batch); err != nil {
+			return err
+		}
+		if err := fn(&batch); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (r *mongoImportBatches) Expire(ctx context.Context, jobID string, expiresAt time.Time) error {
+	_, err := r.coll.UpdateMany(ctx,
+		scoped(ctx, bson.M{"job_id": jobID}),
+		bson.M{"$unset": bson.M{"rows": ""}, "$set": bson.M{"expires_at": expiresAt}},
+	)
+	return err
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoJobs struct {
+	coll *mongo.Collection
+}
+
+func NewMongoJobRepository(db *mongo.Database) *mongoJobs {
+	return &mongoJobs{coll: db.Collection("jobs")}
+}
+
+func (r *mongoJobs) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Claim looks for due queued jobs and expired leases.
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "type", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lease_until", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func (r *mongoJobs) Create(ctx context.Context, job *model.Job) error {
+	if job.ID == "" {
+		job.ID = primitive.NewObjectID().Hex()
+	}
+	job.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, job)
+	return err
+}
+
+func (r *mongoJobs) Get(ctx context.Context, id string) (*model.Job, error) {
+	var job model.Job
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *mongoJobs) RequestCancel(ctx context.Context, id string, now, expiresAt time.Time) (*model.Job, error) {
+	_, err := r.coll.UpdateOne(ctx,
+		scoped(ctx, bson.M{"_id": id, "status": model.JobQueued}),
+		bson.M{
+			"$set":   bson.M{"status": model.JobCanceled, "cancel_requested": true, "finished_at": now, "expires_at": expiresAt, "updated_at": now},
+			"$unset": bson.M{"payload": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.coll.UpdateOne(ctx,
+		scoped(ctx, bson.M{"_id": id, "status": model.JobRunning}),
+		bson.M{"$set": bson.M{"cancel_requested": true, "updated_at": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *mongoJobs) Claim(ctx context.Context, owner string, types []string, now, leaseUntil time.Time) (*model.Job, error) {
+	var job model.Job
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"type": bson.M{"$in": types},
+			"$or": []bson.M{
+				{"status": model.JobQueued, "run_at": bson.M{"$lte": now}},
+				{"status": model.JobRunning, "lease_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"status": model.JobRunning, "owner": owner, "lease_until": leaseUntil, "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "run_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *mongoJobs) Renew(ctx context.Context, id, owner string, leaseUntil time.Time) (bool, error) {
+	var job model.Job
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "owner": owner},
+		bson.M{"$set": bson.M{"lease_until": leaseUntil}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"cancel_requested": 1}),
+	).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, ports.ErrConflict
+	}
+	if err != nil {
+		return false, err
+	}
+	return job.CancelRequested, nil
+}
+
+// Save leaves cancel_requested alone, as a cancel may have come in since
+// the job was claimed.
+func (r *mongoJobs) Save(ctx context.Context, owner string, job *model.Job) error {
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "owner": owner},
+		bson.M{"$set": bson.M{
+			"status":      job.Status,
+			"payload":     job.Payload,
+			"result":      job.Result,
+			"progress":    job.Progress,
+			"attempts":    job.Attempts,
+			"error":       job.Error,
+			"run_at":      job.RunAt,
+			"owner":       job.Owner,
+			"lease_until": job.LeaseUntil,
+			"updated_at":  job.UpdatedAt,
+			"started_at":  job.StartedAt,
+			"finished_at": job.FinishedAt,
+			"expires_at":  job.ExpiresAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrConflict
+	}
+	return nil
+}
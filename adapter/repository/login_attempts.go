@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoLoginAttempts struct {
+	coll *mongo.Collection
+}
+
+func NewMongoLoginAttemptStore(db *mongo.Database) *mongoLoginAttempts {
+	return &mongoLoginAttempts{coll: db.Collection("login_attempts")}
+}
+
+func (r *mongoLoginAttempts) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	var a model.LoginAttempt
+	err := r.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// RecordFailure drops stale failures, then counts this one with a single
+// upserting $inc. The delete only matches a document no failure has touched
+// since forgetBefore, so it can't undo a concurrent failure's count.
+func (r *mongoLoginAttempts) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginAttempt, error) {
+	if !forgetBefore.IsZero() {
+		_, err := r.coll.DeleteOne(ctx, bson.M{
+			"_id":          key,
+			"last_failure": bson.M{"$lt": forgetBefore},
+			"locked_until": bson.M{"$not": bson.M{"$gt": at}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var a model.LoginAttempt
+	err := r.coll.FindOneAndUpdate(ctx, bson.M{"_id": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure": at},
+	}, opts).Decode(&a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *mongoLoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+		"$set": bson.M{"locked_until": until, "failures": 0},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoLoginAttempts) Reset(ctx context.Context, key string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryAuditLog keeps the most recent events in process. It is meant for
+// development and tests; events are lost on restart.
+type memoryAuditLog struct {
+	mu          sync.Mutex
+	events      []*model.AuditEvent
+	checkpoints []*model.AuditCheckpoint
+	max         int
+	seq         int
+}
+
+// NewMemoryAuditSink keeps at most max events; 0 means unbounded.
+func NewMemoryAuditSink(max int) *memoryAuditLog {
+	return &memoryAuditLog{max: max}
+}
+
+func (r *memoryAuditLog) Write(ctx context.Context, event *model.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.events); n > 0 && r.events[n-1].Seq >= event.Seq {
+		return ports.ErrConflict
+	}
+	r.seq++
+	event.ID = strconv.Itoa(r.seq)
+	cp := *event
+	r.events = append(r.events, &cp)
+	if r.max > 0 && len(r.events) > r.max {
+		r.events = r.events[len(r.events)-r.max:]
+	}
+	return nil
+}
+
+func (r *memoryAuditLog) Query(ctx context.Context, filter ports.AuditFilter) ([]*model.AuditEvent, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant := ports.TenantFrom(ctx)
+	matched := []*model.AuditEvent{}
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if e := r.events[i]; e.TenantID == tenant && matchesAudit(e, filter) {
+			cp := *e
+			matched = append(matched, &cp)
+		}
+	}
+	total := int64(len(matched))
+	if filter.Offset >= len(matched) {
+		return []*model.AuditEvent{}, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (r *memoryAuditLog) Last(ctx context.Context) (*model.AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		return nil, nil
+	}
+	cp := *r.events[len(r.events)-1]
+	return &cp, nil
+}
+
+func (r *memoryAuditLog) Scan(ctx context.Context, fn func(*model.AuditEvent) error) error {
+	r.mu.Lock()
+	events := append([]*model.AuditEvent(nil), r.events...)
+	r.mu.Unlock()
+	for _, e := range events {
+		cp := *e
+		if err := fn(&cp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryAuditLog) WriteCheckpoint(ctx context.Context, cp *model.AuditCheckpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp.ID = strconv.Itoa(len(r.checkpoints) + 1)
+	c := *cp
+	r.checkpoints = append(r.checkpoints, &c)
+	return nil
+}
+
+func (r *memoryAuditLog) Checkpoints(ctx context.Context) ([]*model.AuditCheckpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*model.AuditCheckpoint, 0, len(r.checkpoints))
+	for _, c := range r.checkpoints {
+		cp := *c
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func matchesAudit(e *model.AuditEvent, f ports.AuditFilter) bool {
+	if f.ActorID != "" && e.ActorID != f.ActorID {
+		return false
+	}
+	if f.TargetID != "" && e.TargetID != f.TargetID {
+		return false
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		if !strings.HasPrefix(e.Action, f.Action) {
+			return false
+		}
+	} else if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"register/model"
+	"sync"
+	"time"
+)
+
+// memoryIdempotency keeps idempotency keys in process. It is only suitable
+// for a single replica; use the Mongo store when running several.
+type memoryIdempotency struct {
+	mu       sync.Mutex
+	requests map[string]*model.IdempotentRequest
+	now      func() time.Time
+}
+
+func NewMemoryIdempotencyStore() *memoryIdempotency {
+	return &memoryIdempotency{requests: make(map[string]*model.IdempotentRequest), now: time.Now}
+}
+
+func (r *memoryIdempotency) Reserve(ctx context.Context, req *model.IdempotentRequest) (*model.IdempotentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for key, existing := range r.requests {
+		if !existing.ExpiresAt.After(now) {
+			delete(r.requests, key)
+		}
+	}
+	if existing, ok := r.requests[req.Key]; ok {
+		cp := *existing
+		return &cp, nil
+	}
+	cp := *req
+	r.requests[req.Key] = &cp
+	return nil, nil
+}
+
+func (r *memoryIdempotency) Complete(ctx context.Context, req *model.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *req
+	r.requests[req.Key] = &cp
+	return nil
+}
+
+func (r *memoryIdempotency) Release(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.requests, key)
+	return nil
+}
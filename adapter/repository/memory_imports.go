@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryImportBatches keeps import batches in process, next to the memory
+// job store.
+type memoryImportBatches struct {
+	mu      sync.Mutex
+	batches map[string][]*model.ImportBatch // by job, in order
+}
+
+func NewMemoryImportBatchRepository() *memoryImportBatches {
+	return &memoryImportBatches{batches: make(map[string][]*model.ImportBatch)}
+}
+
+func (r *memoryImportBatches) Create(ctx context.Context, batch *model.ImportBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	batch.ID = primitive.NewObjectID().Hex()
+	batch.TenantID = ports.TenantFrom(ctx)
+	cp := *batch
+	r.batches[batch.JobID] = append(r.batches[batch.JobID], &cp)
+	return nil
+}
+
+func (r *memoryImportBatches) Get(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	batch, err := r.find(ctx, jobID, seq)
+	if err != nil {
+		return nil, err
+	}
+	cp := *batch
+	cp.Rows = slices.Clone(batch.Rows)
+	cp.Results = slices.Clone(batch.Results)
+	return &cp, nil
+}
+
+func (r *memoryImportBatches) Save(ctx context.Context, batch *model.ImportBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.find(ctx, batch.JobID, batch.Seq)
+	if err != nil {
+		return err
+	}
+	stored.Rows = slices.Clone(batch.Rows)
+	stored.Results = slices.Clone(batch.Results)
+	return nil
+}
+
+func (r *memoryImportBatches) Each(ctx context.Context, jobID string, fn func(*model.ImportBatch) error) error {
+	r.mu.Lock()
+	r.pruneLocked(time.Now())
+	var batches []model.ImportBatch
+	for _, batch := range r.batches[jobID] {
+		if batch.TenantID == ports.TenantFrom(ctx) {
+			cp := *batch
+			cp.Rows = nil
+			batches = append(batches, cp)
+		}
+	}
+	r.mu.Unlock()
+	for i := range batches {
+		if err := fn(&batches[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryImportBatches) Expire(ctx context.Context, jobID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, batch := range r.batches[jobID] {
+		if batch.TenantID == ports.TenantFrom(ctx) {
+			batch.Rows = nil
+			batch.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+// find returns the stored batch; r.mu must be held.
+func (r *memoryImportBatches) find(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error) {
+	r.pruneLocked(time.Now())
+	for _, batch := range r.batches[jobID] {
+		if batch.Seq == seq && batch.TenantID == ports.TenantFrom(ctx) {
+			return batch, nil
+		}
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (r *memoryImportBatches) pruneLocked(now time.Time) {
+	for jobID, batches := range r.batches {
+		batches = slices.DeleteFunc(batches, func(b *model.ImportBatch) bool {
+			return !b.ExpiresAt.After(now)
+		})
+		if len(batches) == 0 {
+			delete(r.batches, jobID)
+		} else {
+			r.batches[jobID] = batches
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryJobs keeps jobs in process, so they are lost on restart. It is only
+// suitable for tests and a single replica; use the Mongo store otherwise.
+type memoryJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*model.Job
+}
+
+func NewMemoryJobRepository() *memoryJobs {
+	return &memoryJobs{jobs: make(map[string]*model.Job)}
+}
+
+func (r *memoryJobs) Create(ctx context.Context, job *model.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job.ID == "" {
+		job.ID = primitive.NewObjectID().Hex()
+	}
+	job.TenantID = ports.TenantFrom(ctx)
+	cp := *job
+	r.jobs[job.ID] = &cp
+	return nil
+}
+
+func (r *memoryJobs) Get(ctx context.Context, id string) (*model.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, err := r.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cp := *job
+	return &cp, nil
+}
+
+func (r *memoryJobs) RequestCancel(ctx context.Context, id string, now, expiresAt time.Time) (*model.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, err := r.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case model.JobQueued:
+		job.Status = model.JobCanceled
+		job.CancelRequested = true
+		job.Payload = nil
+		job.FinishedAt = &now
+		job.ExpiresAt = &expiresAt
+		job.UpdatedAt = now
+	case model.JobRunning:
+		job.CancelRequested = true
+		job.UpdatedAt = now
+	}
+	cp := *job
+	return &cp, nil
+}
+
+// find returns the stored job; r.mu must be held.
+func (r *memoryJobs) find(ctx context.Context, id string) (*model.Job, error) {
+	r.pruneLocked(time.Now())
+	job, ok := r.jobs[id]
+	if !ok || job.TenantID != ports.TenantFrom(ctx) {
+		return nil, ports.ErrNotFound
+	}
+	return job, nil
+}
+
+func (r *memoryJobs) pruneLocked(now time.Time) {
+	for id, job := range r.jobs {
+		if job.ExpiresAt != nil && !job.ExpiresAt.After(now) {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+func (r *memoryJobs) Claim(ctx context.Context, owner string, types []string, now, leaseUntil time.Time) (*model.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var next *model.Job
+	for _, job := range r.jobs {
+		if !slices.Contains(types, job.Type) {
+			continue
+		}
+		due := job.Status == model.JobQueued && !job.RunAt.After(now) ||
+			job.Status == model.JobRunning && !job.LeaseUntil.After(now)
+		if due && (next == nil || job.RunAt.Before(next.RunAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.Status = model.JobRunning
+	next.Owner = owner
+	next.LeaseUntil = leaseUntil
+	next.Attempts++
+	next.UpdatedAt = now
+	cp := *next
+	return &cp, nil
+}
+
+func (r *memoryJobs) Renew(ctx context.Context, id, owner string, leaseUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.Owner != owner {
+		return false, ports.ErrConflict
+	}
+	job.LeaseUntil = leaseUntil
+	return job.CancelRequested, nil
+}
+
+func (r *memoryJobs) Save(ctx context.Context, owner string, job *model.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.jobs[job.ID]
+	if !ok || stored.Owner != owner {
+		return ports.ErrConflict
+	}
+	cp := *job
+	// A cancel request may have come in since the job was claimed.
+	cp.CancelRequested = cp.CancelRequested || stored.CancelRequested
+	r.jobs[job.ID] = &cp
+	return nil
+}
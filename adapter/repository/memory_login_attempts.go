@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"register/model"
+	"sync"
+	"time"
+)
+
+// memoryLoginAttempts keeps attempt counters in process. It is only suitable
+// for a single replica; use the Mongo store when running several.
+type memoryLoginAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]*model.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *memoryLoginAttempts {
+	return &memoryLoginAttempts{attempts: make(map[string]*model.LoginAttempt)}
+}
+
+func (r *memoryLoginAttempts) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (r *memoryLoginAttempts) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	if ok && a.LastFailure.Before(forgetBefore) && !a.LockedUntil.After(at) {
+		ok = false
+	}
+	if !ok {
+		a = &model.LoginAttempt{Key: key}
+		r.attempts[key] = a
+	}
+	a.Failures++
+	a.LastFailure = at
+	cp := *a
+	return &cp, nil
+}
+
+func (r *memoryLoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	if !ok {
+		a = &model.LoginAttempt{Key: key}
+		r.attempts[key] = a
+	}
+	a.LockedUntil = until
+	a.Failures = 0
+	return nil
+}
+
+func (r *memoryLoginAttempts) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
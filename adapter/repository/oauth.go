@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOAuthClients struct {
+	coll *mongo.Collection
+}
+
+func NewMongoOAuthClientRepository(db *mongo.Database) *mongoOAuthClients {
+	return &mongoOAuthClients{coll: db.Collection("oauth_clients")}
+}
+
+// EnsureIndexes moves clients registered before multi-tenancy into the
+// default tenant.
+func (r *mongoOAuthClients) EnsureIndexes(ctx context.Context) error {
+	return backfillTenant(ctx, r.coll)
+}
+
+func (r *mongoOAuthClients) Create(ctx context.Context, client *model.OAuthClient) error {
+	client.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, client)
+	return err
+}
+
+func (r *mongoOAuthClients) GetByID(ctx context.Context, id string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *mongoOAuthClients) List(ctx context.Context) ([]*model.OAuthClient, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []*model.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *mongoOAuthClients) Delete(ctx context.Context, id string) error {
+	res, err := r.coll.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+type mongoAuthCodes struct {
+	coll *mongo.Collection
+}
+
+func NewMongoAuthorizationCodeRepository(db *mongo.Database) *mongoAuthCodes {
+	return &mongoAuthCodes{coll: db.Collection("oauth_codes")}
+}
+
+// EnsureIndexes lets Mongo purge expired codes on its own.
+func (r *mongoAuthCodes) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *mongoAuthCodes) Save(ctx context.Context, code *model.AuthorizationCode) error {
+	_, err := r.coll.InsertOne(ctx, code)
+	return err
+}
+
+func (r *mongoAuthCodes) Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	var code model.AuthorizationCode
+	err := r.coll.FindOneAndDelete(ctx, bson.M{"_id": codeHash}).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+type mongoConsents struct {
+	coll *mongo.Collection
+}
+
+func NewMongoConsentRepository(db *mongo.Database) *mongoConsents {
+	return &mongoConsents{coll: db.Collection("oauth_consents")}
+}
+
+func (r *mongoConsents) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *mongoConsents) Get(ctx context.Context, userID, clientID string) (*model.Consent, error) {
+	var consent model.Consent
+	err := r.coll.FindOne(ctx, bson.M{"user_id": userID, "client_id": clientID}).Decode(&consent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *mongoConsents) Save(ctx context.Context, consent *model.Consent) error {
+	_, err := r.coll.ReplaceOne(ctx,
+		bson.M{"user_id": consent.UserID, "client_id": consent.ClientID},
+		consent,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
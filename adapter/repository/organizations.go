@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOrganizations struct {
+	coll *mongo.Collection
+}
+
+func NewMongoOrganizationRepository(db *mongo.Database) *mongoOrganizations {
+	return &mongoOrganizations{coll: db.Collection("organizations")}
+}
+
+func (r *mongoOrganizations) Create(ctx context.Context, org *model.Organization) error {
+	org.ID = primitive.NewObjectID().Hex()
+	org.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, org)
+	return err
+}
+
+func (r *mongoOrganizations) GetByID(ctx context.Context, id string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&org)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *mongoOrganizations) ListByIDs(ctx context.Context, ids []string) ([]*model.Organization, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, bson.M{"_id": bson.M{"$in": ids}}),
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orgs := []*model.Organization{}
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+type mongoMemberships struct {
+	coll *mongo.Collection
+}
+
+func NewMongoMembershipRepository(db *mongo.Database) *mongoMemberships {
+	return &mongoMemberships{coll: db.Collection("memberships")}
+}
+
+// EnsureIndexes creates the unique index that backs ErrConflict on Add.
+func (r *mongoMemberships) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "org_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+func (r *mongoMemberships) Add(ctx context.Context, m *model.Membership) error {
+	m.ID = primitive.NewObjectID().Hex()
+	m.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, m)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrConflict
+	}
+	return err
+}
+
+func (r *mongoMemberships) Get(ctx context.Context, orgID, userID string) (*model.Membership, error) {
+	var m model.Membership
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"org_id": orgID, "user_id": userID})).Decode(&m)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *mongoMemberships) ListByOrg(ctx context.Context, orgID string) ([]*model.Membership, error) {
+	return r.list(ctx, bson.M{"org_id": orgID})
+}
+
+func (r *mongoMemberships) ListByUser(ctx context.Context, userID string) ([]*model.Membership, error) {
+	return r.list(ctx, bson.M{"user_id": userID})
+}
+
+func (r *mongoMemberships) list(ctx context.Context, filter bson.M) ([]*model.Membership, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, filter), options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	members := []*model.Membership{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *mongoMemberships) UpdateRole(ctx context.Context, orgID, userID, role string) (*model.Membership, error) {
+	var m model.Membership
+	err := r.coll.FindOneAndUpdate(ctx,
+		scoped(ctx, bson.M{"org_id": orgID, "user_id": userID}),
+		bson.M{"$set": bson.M{"role": role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&m)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *mongoMemberships) Remove(ctx context.Context, orgID, userID string) error {
+	res, err := r.coll.DeleteOne(ctx, scoped(ctx, bson.M{"org_id": orgID, "user_id": userID}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoMemberships) CountByRole(ctx context.Context, orgID, role string) (int64, error) {
+	return r.coll.CountDocuments(ctx, scoped(ctx, bson.M{"org_id": orgID, "role": role}))
+}
+
+type mongoInvitations struct {
+	coll *mongo.Collection
+}
+
+func NewMongoInvitationRepository(db *mongo.Database) *mongoInvitations {
+	return &mongoInvitations{coll: db.Collection("invitations")}
+}
+
+// EnsureIndexes lets Mongo purge invitations once their link has expired.
+func (r *mongoInvitations) EnsureIndexes(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *mongoInvitations) Create(ctx context.Context, inv *model.Invitation) error {
+	inv.ID = primitive.NewObjectID().Hex()
+	inv.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, inv)
+	return err
+}
+
+func (r *mongoInvitations) GetByID(ctx context.Context, id string) (*model.Invitation, error) {
+	var inv model.Invitation
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&inv)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *mongoInvitations) MarkAccepted(ctx context.Context, id string, at time.Time) error {
+	res, err := r.coll.UpdateOne(ctx,
+		scoped(ctx, bson.M{"_id": id, "accepted_at": bson.M{"$exists": false}}),
+		bson.M{"$set": bson.M{"accepted_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
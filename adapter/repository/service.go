@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"register/core/ports"
 	"register/model"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,20 +23,114 @@ func NewMongoRepository(db *mongo.Database) *mongoRepo {
 	return &mongoRepo{coll: db.Collection("users")}
 }
 
+// caseInsensitive compares strings ignoring case and accents, for lookups
+// like SCIM's userName filters.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// EnsureIndexes creates the per-tenant unique email index that backs
+// ports.ErrEmailTaken, a case-insensitive one for FindByEmail, and the index
+// that links external identities to users.
+// It also moves users from before multi-tenancy into the default tenant,
+// gives users from before versioning version 1 and their creation time as
+// updated_at, and drops the old global indexes.
+func (r *mongoRepo) EnsureIndexes(ctx context.Context) error {
+	if err := backfillTenant(ctx, r.coll); err != nil {
+		return err
+	}
+	if _, err := r.coll.UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": int64(1)}},
+	); err != nil {
+		return err
+	}
+	if _, err := r.coll.UpdateMany(ctx,
+		bson.M{"updated_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at"}}}},
+	); err != nil {
+		return err
+	}
+	for _, name := range []string{"email_1", "identities.provider_1_identities.subject_1"} {
+		if err := dropIndex(ctx, r.coll, name); err != nil {
+			return err
+		}
+	}
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}},
+			Options: options.Index().SetName("tenant_id_1_email_1_ci").SetCollation(caseInsensitive),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "identities.provider", Value: 1},
+				{Key: "identities.subject", Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+	})
+	return err
+}
+
 func (r *mongoRepo) Create(ctx context.Context, user *model.User) error {
 	user.ID = primitive.NewObjectID().Hex()
+	user.TenantID = ports.TenantFrom(ctx)
+	user.Version = 1
+	user.UpdatedAt = time.Now()
 	_, err := r.coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return duplicateError(ctx, err)
+	}
 	return err
 }
 
 func (r *mongoRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
 	var user model.User
-	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
-	return &user, err
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func (r *mongoRepo) List(ctx context.Context) ([]*model.User, error) {
-	cursor, err := r.coll.Find(ctx, bson.M{})
+	return r.find(ctx, nil)
+}
+
+// FindByAttributes relies on attribute names having been checked against
+// their definitions, which only allow plain field names.
+func (r *mongoRepo) FindByAttributes(ctx context.Context, attributes map[string]interface{}) ([]*model.User, error) {
+	filter := bson.M{}
+	for name, value := range attributes {
+		filter["attributes."+name] = value
+	}
+	return r.find(ctx, filter)
+}
+
+func (r *mongoRepo) Each(ctx context.Context, fn func(*model.User) error) error {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, nil), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoRepo) find(ctx context.Context, filter bson.M) ([]*model.User, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, filter))
 	if err != nil {
 		return nil, err
 	}
@@ -45,31 +144,216 @@ func (r *mongoRepo) List(ctx context.Context) ([]*model.User, error) {
 }
 
 func (r *mongoRepo) Count(ctx context.Context) (int64, error) {
-	return r.coll.CountDocuments(ctx, bson.M{})
+	return r.coll.CountDocuments(ctx, scoped(ctx, nil))
 }
 
 func (r *mongoRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	var user model.User
-	err := r.coll.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{"email": email})).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *mongoRepo) FindByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	cursor, err := r.coll.Find(ctx, scoped(ctx, bson.M{"email": email}), options.Find().SetCollation(caseInsensitive))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoRepo) GetByIdentity(ctx context.Context, provider, subject string) (*model.User, error) {
+	var user model.User
+	err := r.coll.FindOne(ctx, scoped(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	})).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *mongoRepo) Update(ctx context.Context, id, name, email string) (*model.User, error) {
+func (r *mongoRepo) UpdateFields(ctx context.Context, id string, fields *model.UserFields) (*model.User, error) {
+	set := bson.M{}
+	if fields.Name != nil {
+		set["name"] = *fields.Name
+	}
+	if fields.Email != nil {
+		set["email"] = *fields.Email
+	}
+	update := bson.M{}
+	switch {
+	case fields.Attributes == nil:
+	case len(fields.Attributes) == 0:
+		update["$unset"] = bson.M{"attributes": ""}
+	default:
+		set["attributes"] = fields.Attributes
+	}
+	if len(set) == 0 && len(update) == 0 {
+		user, err := r.GetByID(ctx, id)
+		if err == nil && fields.Version != 0 && user.Version != fields.Version {
+			return nil, ports.ErrVersionMismatch
+		}
+		return user, err
+	}
+	set["updated_at"] = time.Now()
+	update["$set"] = set
+	update["$inc"] = bson.M{"version": 1}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var updated model.User
-	err := r.coll.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{
-		"$set": bson.M{"name": name, "email": email},
-	}, opts).Decode(&updated)
+	err := r.coll.FindOneAndUpdate(ctx, r.filter(ctx, id, fields.Version), update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, r.missing(ctx, id, fields.Version)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, duplicateError(ctx, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &updated, nil
 }
 
-func (r *mongoRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": id})
+func (r *mongoRepo) UnsetAttribute(ctx context.Context, name string) error {
+	field := "attributes." + name
+	_, err := r.coll.UpdateMany(ctx, scoped(ctx, bson.M{field: bson.M{"$exists": true}}), bson.M{
+		"$unset": bson.M{field: ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$inc":   bson.M{"version": 1},
+	})
+	return err
+}
+
+// UniqueAttribute keeps one partial unique index per tenant and attribute,
+// over the users of that tenant that have the attribute.
+func (r *mongoRepo) UniqueAttribute(ctx context.Context, name string, unique bool) error {
+	tenant := ports.TenantFrom(ctx)
+	index := uniqueAttributeIndex(tenant, name)
+	if !unique {
+		return dropIndex(ctx, r.coll, index)
+	}
+	field := "attributes." + name
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(index).SetUnique(true).SetPartialFilterExpression(bson.M{
+			"tenant_id": tenant,
+			field:       bson.M{"$exists": true},
+		}),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return &ports.AttributeError{Violations: []string{name + " has values shared by several users"}}
+	}
 	return err
 }
+
+func uniqueAttributeIndex(tenant, name string) string {
+	return "attr_unique_" + tenant + "_" + name
+}
+
+var duplicateIndex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// duplicateError maps a duplicate key error on a user to the unique custom
+// attribute it repeats, or else to the email.
+func duplicateError(ctx context.Context, err error) error {
+	if m := duplicateIndex.FindStringSubmatch(err.Error()); m != nil {
+		if name, ok := strings.CutPrefix(m[1], uniqueAttributeIndex(ports.TenantFrom(ctx), "")); ok {
+			return &ports.AttributeError{Violations: []string{name + " is already taken"}}
+		}
+	}
+	return ports.ErrEmailTaken
+}
+
+func (r *mongoRepo) SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated model.User
+	err := r.coll.FindOneAndUpdate(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{
+		"$set": bson.M{"disabled": disabled, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *mongoRepo) AddIdentity(ctx context.Context, id string, identity model.ExternalIdentity) error {
+	res, err := r.coll.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{
+		"$addToSet": bson.M{"identities": identity},
+		"$set":      bson.M{"updated_at": time.Now()},
+		"$inc":      bson.M{"version": 1},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoRepo) UpdatePassword(ctx context.Context, id, hash string) error {
+	res, err := r.coll.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{
+		"$set": bson.M{"password": hash, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoRepo) Delete(ctx context.Context, id string, version int64) error {
+	res, err := r.coll.DeleteOne(ctx, r.filter(ctx, id, version))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return r.missing(ctx, id, version)
+	}
+	return nil
+}
+
+// filter matches the user with id, and only at version unless it is 0, so
+// the version check and the write happen in one operation.
+func (r *mongoRepo) filter(ctx context.Context, id string, version int64) bson.M {
+	filter := scoped(ctx, bson.M{"_id": id})
+	if version != 0 {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// missing explains why a write through filter matched nothing: the user is
+// gone, or it is at another version.
+func (r *mongoRepo) missing(ctx context.Context, id string, version int64) error {
+	if version == 0 {
+		return ports.ErrNotFound
+	}
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return ports.ErrVersionMismatch
+}
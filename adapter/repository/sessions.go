@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSessions struct {
+	coll *mongo.Collection
+}
+
+func NewMongoSessionRepository(db *mongo.Database) *mongoSessions {
+	return &mongoSessions{coll: db.Collection("sessions")}
+}
+
+func (r *mongoSessions) EnsureIndexes(ctx context.Context) error {
+	if err := backfillTenant(ctx, r.coll); err != nil {
+		return err
+	}
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "family", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		// A session expires with its tokens, so Mongo can remove it then.
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func (r *mongoSessions) Create(ctx context.Context, session *model.Session) error {
+	session.ID = primitive.NewObjectID().Hex()
+	session.TenantID = ports.TenantFrom(ctx)
+	_, err := r.coll.InsertOne(ctx, session)
+	return err
+}
+
+func (r *mongoSessions) ListByUser(ctx context.Context, userID string) ([]*model.Session, error) {
+	cursor, err := r.coll.Find(ctx,
+		scoped(ctx, bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}}),
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *mongoSessions) Delete(ctx context.Context, userID, id string) (*model.Session, error) {
+	var session model.Session
+	err := r.coll.FindOneAndDelete(ctx, scoped(ctx, bson.M{"_id": id, "user_id": userID})).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch is not tenant-scoped: the family comes from a verified token.
+func (r *mongoSessions) Touch(ctx context.Context, family string, at time.Time) error {
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"family": family, "expires_at": bson.M{"$gt": at}},
+		bson.M{"$set": bson.M{"last_seen_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// scoped restricts filter to the tenant in ctx. Every query on a
+// tenant-owned collection goes through it; a tenant_id already in filter is
+// overwritten so callers can't widen the scope.
+func scoped(ctx context.Context, filter bson.M) bson.M {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["tenant_id"] = ports.TenantFrom(ctx)
+	return filter
+}
+
+// backfillTenant assigns documents written before multi-tenancy to the
+// default tenant, so scoped queries still find them.
+func backfillTenant(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.UpdateMany(ctx,
+		bson.M{"tenant_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tenant_id": model.DefaultTenant}},
+	)
+	return err
+}
+
+// dropIndex removes an index replaced by a tenant-scoped one. A missing
+// index is not an error.
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	_, err := coll.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26) { // IndexNotFound, NamespaceNotFound
+		return nil
+	}
+	return err
+}
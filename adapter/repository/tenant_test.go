@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestScopedFilter(t *testing.T) {
+	acme := ports.WithTenant(context.Background(), "acme")
+
+	if f := scoped(acme, bson.M{"email": "ann@example.com"}); f["tenant_id"] != "acme" || f["email"] != "ann@example.com" {
+		t.Errorf("expected filter scoped to acme, got %v", f)
+	}
+	// A caller can't reach into another tenant by naming it.
+	if f := scoped(acme, bson.M{"tenant_id": "globex"}); f["tenant_id"] != "acme" {
+		t.Errorf("expected tenant_id to be overwritten, got %v", f)
+	}
+	if f := scoped(context.Background(), nil); f["tenant_id"] != model.DefaultTenant {
+		t.Errorf("expected default tenant, got %v", f)
+	}
+}
@@ -0,0 +1,105 @@
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// rsaSigner holds the service's RS256 key pair. Tokens it signs carry a kid
+// header matching the key published by JWKS.
+type rsaSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// LoadOrCreateRSA reads a PEM-encoded RSA private key from path. If the file
+// does not exist a 2048-bit key is generated and written there, so the key
+// survives restarts. An empty path gives an ephemeral key.
+func LoadOrCreateRSA(path string) (*rsaSigner, error) {
+	if path == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return newRSASigner(key), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		block := &pem.Block{Type: "PRIVATE KEY"}
+		if block.Bytes, err = x509.MarshalPKCS8PrivateKey(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return nil, err
+		}
+		return newRSASigner(key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return newRSASigner(key), nil
+}
+
+func newRSASigner(key *rsa.PrivateKey) *rsaSigner {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return &rsaSigner{key: key, kid: base64.RawURLEncoding.EncodeToString(sum[:12])}
+}
+
+func (s *rsaSigner) Sign(claims map[string]interface{}) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+func (s *rsaSigner) Verify(token string) (map[string]interface{}, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return &s.key.PublicKey, nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return parsed.Claims.(jwt.MapClaims), nil
+}
+
+func (s *rsaSigner) PublicKey() *rsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+// JWKS returns the public key as a JSON Web Key Set.
+func (s *rsaSigner) JWKS() map[string]interface{} {
+	pub := s.key.PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]interface{}{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": s.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+}
@@ -2,14 +2,96 @@ package config
 
 import (
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server ServerConfig `mapstructure:"server"`
-	Mongo  MongoConfig  `mapstructure:"mongo"`
-	App    AppConfig    `mapstructure:"app"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Mongo      MongoConfig      `mapstructure:"mongo"`
+	App        AppConfig        `mapstructure:"app"`
+	Mail       MailConfig       `mapstructure:"mail"`
+	Password   PasswordConfig   `mapstructure:"password"`
+	OAuth      OAuthConfig      `mapstructure:"oauth"`
+	Federation FederationConfig `mapstructure:"federation"`
+	Audit      AuditConfig      `mapstructure:"audit"`
+	Jobs       JobsConfig       `mapstructure:"jobs"`
+	Tenancy    TenancyConfig    `mapstructure:"tenancy"`
+	// Authorization is the access policy for user operations. Without rules
+	// nothing beyond authentication and scopes is checked.
+	Authorization AuthorizationConfig `mapstructure:"authorization"`
+}
+
+type AuthorizationConfig struct {
+	Rules []PolicyRuleConfig `mapstructure:"rules"`
+}
+
+// PolicyRuleConfig is one rule; see model.PolicyRule for the condition syntax.
+type PolicyRuleConfig struct {
+	Name       string   `mapstructure:"name"`
+	Effect     string   `mapstructure:"effect"` // "allow" or "deny"
+	Actions    []string `mapstructure:"actions"`
+	Conditions []string `mapstructure:"conditions"`
+}
+
+// TenancyConfig controls how requests are mapped to tenants. Requests that
+// name no tenant belong to the default tenant.
+type TenancyConfig struct {
+	Header     string   `mapstructure:"header"`      // e.g. "X-Tenant-ID"; empty ignores headers
+	BaseDomain string   `mapstructure:"base_domain"` // <tenant>.<base_domain> hosts select the tenant
+	Tenants    []string `mapstructure:"tenants"`     // accepted tenant IDs; empty accepts any
+}
+
+type AuditConfig struct {
+	Store       string `mapstructure:"store"`        // "memory" or "mongo"
+	MemoryLimit int    `mapstructure:"memory_limit"` // events kept by the memory store; 0 for no limit
+	// CheckpointInterval is how often the chain head is signed; 0 disables.
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+}
+
+// JobsConfig controls the background job workers. Zero values get the
+// defaults in services.JobSettings.
+type JobsConfig struct {
+	Store        string           `mapstructure:"store"`   // "memory" or "mongo"; jobs only survive restarts in mongo
+	Workers      int              `mapstructure:"workers"` // jobs this process runs at once
+	Limits       []JobLimitConfig `mapstructure:"limits"`
+	PollInterval time.Duration    `mapstructure:"poll_interval"`
+	Lease        time.Duration    `mapstructure:"lease"`
+	MaxAttempts  int              `mapstructure:"max_attempts"`
+	BaseBackoff  time.Duration    `mapstructure:"base_backoff"`
+	MaxBackoff   time.Duration    `mapstructure:"max_backoff"`
+	Retention    time.Duration    `mapstructure:"retention"`
+	// ShutdownTimeout is how long shutdown waits for running jobs to save
+	// their progress.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+// JobLimitConfig caps the jobs of one type this process runs at once.
+type JobLimitConfig struct {
+	Type    string `mapstructure:"type"`
+	Workers int    `mapstructure:"workers"`
+}
+
+type FederationConfig struct {
+	Providers []IdentityProviderConfig `mapstructure:"providers"`
+}
+
+type IdentityProviderConfig struct {
+	Name         string   `mapstructure:"name"` // used in /auth/:provider/login
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+type OAuthConfig struct {
+	Issuer         string        `mapstructure:"issuer"`
+	SigningKeyFile string        `mapstructure:"signing_key_file"` // RSA PEM; generated if missing
+	AccessTokenTTL time.Duration `mapstructure:"access_token_ttl"`
+	IDTokenTTL     time.Duration `mapstructure:"id_token_ttl"`
+	CodeTTL        time.Duration `mapstructure:"code_ttl"`
 }
 
 type ServerConfig struct {
@@ -21,8 +103,79 @@ type MongoConfig struct {
 	DBName string `mapstructure:"db_name"`
 }
 
+type PasswordConfig struct {
+	Hashing HashingConfig `mapstructure:"hashing"`
+	Policy  PolicyConfig  `mapstructure:"policy"`
+}
+
+type PolicyConfig struct {
+	MinLength        int    `mapstructure:"min_length"`
+	RequireUpper     bool   `mapstructure:"require_upper"`
+	RequireLower     bool   `mapstructure:"require_lower"`
+	RequireDigit     bool   `mapstructure:"require_digit"`
+	RequireSymbol    bool   `mapstructure:"require_symbol"`
+	DisallowUserInfo bool   `mapstructure:"disallow_user_info"`
+	BreachedList     string `mapstructure:"breached_list"` // file or directory in SHA-1 range format; empty disables
+}
+
+type HashingConfig struct {
+	Algorithm  string       `mapstructure:"algorithm"` // "argon2id" or "bcrypt"
+	BcryptCost int          `mapstructure:"bcrypt_cost"`
+	Argon2     Argon2Config `mapstructure:"argon2"`
+}
+
+type Argon2Config struct {
+	MemoryKiB   uint32 `mapstructure:"memory_kib"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+}
+
+type MailConfig struct {
+	Driver   string `mapstructure:"driver"` // "log" or "smtp"
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
 type AppConfig struct {
-	JWTSecret string `mapstructure:"jwt_secret"`
+	JWTSecret   string            `mapstructure:"jwt_secret"`
+	PublicURL   string            `mapstructure:"public_url"`
+	LoginGuard  LoginGuardConfig  `mapstructure:"login_guard"`
+	Cookie      CookieConfig      `mapstructure:"cookie"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	// ImpersonationTTL is the lifetime of tokens from POST /api/admin/impersonate/:id.
+	ImpersonationTTL time.Duration `mapstructure:"impersonation_ttl"`
+	// InviteTTL is how long organization invite links work.
+	InviteTTL time.Duration `mapstructure:"invite_ttl"`
+}
+
+// CookieConfig controls cookie mode for browser clients (POST /login?mode=cookie).
+type CookieConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Name     string        `mapstructure:"name"`
+	CSRFName string        `mapstructure:"csrf_name"`
+	Domain   string        `mapstructure:"domain"`
+	Secure   bool          `mapstructure:"secure"`
+	SameSite string        `mapstructure:"same_site"` // "Strict", "Lax" or "None"
+	MaxAge   time.Duration `mapstructure:"max_age"`
+}
+
+// IdempotencyConfig controls how long responses to POSTs with an
+// Idempotency-Key are kept for retries.
+type IdempotencyConfig struct {
+	Store string        `mapstructure:"store"` // "memory" or "mongo"
+	TTL   time.Duration `mapstructure:"ttl"`
+}
+
+type LoginGuardConfig struct {
+	Store         string        `mapstructure:"store"` // "memory" or "mongo"
+	MaxFailures   int           `mapstructure:"max_failures"`
+	MaxIPFailures int           `mapstructure:"max_ip_failures"`
+	BaseDelay     time.Duration `mapstructure:"base_delay"`
+	MaxDelay      time.Duration `mapstructure:"max_delay"`
+	Lockout       time.Duration `mapstructure:"lockout"`
 }
 
 func LoadConfig(path string) (config *Config, err error) {
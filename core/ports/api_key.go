@@ -0,0 +1,24 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+	ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, userID, id string, at time.Time) error
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+type APIKeyService interface {
+	// Create returns the stored key and the plaintext secret, which is never
+	// retrievable again.
+	Create(ctx context.Context, userID, name string, scopes []string, ttl time.Duration) (*model.APIKey, string, error)
+	List(ctx context.Context, userID string) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, userID, id string) error
+	Authenticate(ctx context.Context, raw string) (*model.Principal, error)
+}
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type AttributeRepository interface {
+	List(ctx context.Context) ([]*model.AttributeDefinition, error)
+	// Save creates the definition or replaces the one with the same name.
+	Save(ctx context.Context, def *model.AttributeDefinition) error
+	Delete(ctx context.Context, name string) error
+}
+
+type AttributeService interface {
+	List(ctx context.Context) ([]*model.AttributeDefinition, error)
+	// Define creates or replaces a definition. Values users already have
+	// are checked against it the next time they are set.
+	Define(ctx context.Context, def *model.AttributeDefinition) (*model.AttributeDefinition, error)
+	// Delete removes the definition and the attribute from every user.
+	Delete(ctx context.Context, name string) error
+	// Validate checks the complete set of custom attributes of user userID
+	// ("" for a new user) and returns them converted to their types, or an
+	// *AttributeError. A nil value leaves the attribute unset.
+	Validate(ctx context.Context, userID string, attributes map[string]interface{}) (map[string]interface{}, error)
+	// ParseFilter converts attribute values from a query string to their
+	// types, or returns an *AttributeError.
+	ParseFilter(ctx context.Context, query map[string]string) (map[string]interface{}, error)
+}
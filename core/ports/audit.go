@@ -0,0 +1,82 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+type AuditFilter struct {
+	ActorID  string
+	TargetID string
+	// Action matches exactly, or by prefix when it ends in "." (e.g. "user.").
+	Action string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// AuditSink stores audit events.
+type AuditSink interface {
+	// Write returns ErrConflict if an event with the same Seq exists, which
+	// happens when another instance appended first.
+	Write(ctx context.Context, event *model.AuditEvent) error
+	// Query returns matching events, newest first, and the total match count.
+	Query(ctx context.Context, filter AuditFilter) ([]*model.AuditEvent, int64, error)
+	// Last returns the event with the highest Seq, or nil if there is none.
+	Last(ctx context.Context) (*model.AuditEvent, error)
+	// Scan calls fn for every chained event in ascending Seq order.
+	Scan(ctx context.Context, fn func(*model.AuditEvent) error) error
+	WriteCheckpoint(ctx context.Context, cp *model.AuditCheckpoint) error
+	Checkpoints(ctx context.Context) ([]*model.AuditCheckpoint, error)
+}
+
+// AuditVerification is the result of walking the hash chain.
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Checked  int64 `json:"checked"`
+	FirstSeq int64 `json:"first_seq,omitempty"`
+	LastSeq  int64 `json:"last_seq,omitempty"`
+	// BrokenSeq is the first event, or checkpoint, that failed.
+	BrokenSeq   int64  `json:"broken_seq,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Checkpoints int    `json:"checkpoints_verified"`
+}
+
+type AuditLog interface {
+	// Record fills in time, actor, IP and request ID from ctx where unset.
+	// It never fails the caller; sink errors are logged.
+	Record(ctx context.Context, event *model.AuditEvent)
+	Query(ctx context.Context, filter AuditFilter) ([]*model.AuditEvent, int64, error)
+	// Verify walks the one chain shared by all tenants. Its counts would
+	// reveal other tenants' activity, so it returns ErrForbidden outside the
+	// default tenant, whose admins operate the service.
+	Verify(ctx context.Context) (*AuditVerification, error)
+	// Checkpoint signs the current chain head. It returns nil when the log
+	// is empty.
+	Checkpoint(ctx context.Context) (*model.AuditCheckpoint, error)
+}
+
+// RequestMeta describes the HTTP request behind a call, for audit events.
+// Handlers pass it down in the request context.
+type RequestMeta struct {
+	RequestID      string
+	IP             string
+	UserAgent      string
+	ActorID        string
+	ActorType      string
+	ImpersonatorID string
+}
+
+type requestMetaKey struct{}
+
+func WithRequestMeta(ctx context.Context, meta *RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+// RequestMetaFrom returns the metadata stored by WithRequestMeta, or nil.
+func RequestMetaFrom(ctx context.Context) *RequestMeta {
+	meta, _ := ctx.Value(requestMetaKey{}).(*RequestMeta)
+	return meta
+}
@@ -0,0 +1,79 @@
+package ports
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrEmailTaken must not be surfaced to clients as-is, or Register can be
+	// used to discover which addresses have accounts.
+	ErrEmailTaken      = errors.New("email already registered")
+	ErrInvalidToken    = errors.New("invalid or expired token")
+	ErrInvalidScope    = errors.New("invalid scope")
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrForbidden       = errors.New("forbidden")
+	ErrConflict        = errors.New("conflict")
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrGroupCycle      = errors.New("group would contain itself")
+	// ErrVersionMismatch is returned when a conditional write finds the
+	// resource at a different version than the caller expected.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrLastOwner is returned when a change would leave an organization
+	// without an owner.
+	ErrLastOwner = errors.New("organization must keep an owner")
+	// ErrRegistrationRequired is returned when accepting an invitation for an
+	// address without an account and no name or password to create one.
+	ErrRegistrationRequired = errors.New("name and password are required to create an account")
+)
+
+// ThrottledError is returned when a login is refused because of too many
+// recent failures. RetryAfter tells the caller when to try again.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many login attempts"
+}
+
+// PolicyError lists the password policy rules a password failed.
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+// AttributeError lists the custom attributes that don't match their
+// definitions, or definitions that are themselves invalid.
+type AttributeError struct {
+	Violations []string
+}
+
+func (e *AttributeError) Error() string {
+	return "invalid attributes: " + strings.Join(e.Violations, "; ")
+}
+
+// ValidationError lists what is wrong with a user's name or email.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid user: " + strings.Join(e.Violations, "; ")
+}
+
+// OAuthError is an RFC 6749 error response.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+// IdentityProvider is an upstream OpenID Connect provider users can sign in with.
+type IdentityProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the code and returns the claims of the validated ID token.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*model.ExternalClaims, error)
+}
+
+type FederationService interface {
+	// Begin returns the provider URL to redirect to and an opaque, signed
+	// state blob the caller must hand back to Complete (e.g. via a cookie).
+	// A non-empty linkUserID links the external identity to that signed-in
+	// user instead of looking one up.
+	Begin(ctx context.Context, provider, linkUserID string) (authURL, stateBlob string, err error)
+	// Complete validates the callback, links or creates the user and returns
+	// an access token.
+	Complete(ctx context.Context, provider, state, code, stateBlob string, client ClientInfo) (string, error)
+}
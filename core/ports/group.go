@@ -0,0 +1,41 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type GroupRepository interface {
+	Create(ctx context.Context, group *model.Group) error
+	GetByID(ctx context.Context, id string) (*model.Group, error)
+	GetByIDs(ctx context.Context, ids []string) ([]*model.Group, error)
+	List(ctx context.Context) ([]*model.Group, error)
+	// Update sets name, description and roles.
+	Update(ctx context.Context, group *model.Group) (*model.Group, error)
+	// Delete also removes the group from groups containing it.
+	Delete(ctx context.Context, id string) error
+	// AddMember and RemoveMember take a model.GroupMember* kind.
+	AddMember(ctx context.Context, groupID, kind, memberID string) error
+	RemoveMember(ctx context.Context, groupID, kind, memberID string) error
+	// ListContaining returns the groups that directly contain any of the
+	// members of the given kind.
+	ListContaining(ctx context.Context, kind string, memberIDs []string) ([]*model.Group, error)
+}
+
+type GroupService interface {
+	Create(ctx context.Context, group *model.Group) (*model.Group, error)
+	Get(ctx context.Context, id string) (*model.Group, error)
+	List(ctx context.Context) ([]*model.Group, error)
+	Update(ctx context.Context, id string, group *model.Group) (*model.Group, error)
+	Delete(ctx context.Context, id string) error
+	// AddMember returns ErrGroupCycle if a group would end up containing itself.
+	AddMember(ctx context.Context, groupID, kind, memberID string) error
+	RemoveMember(ctx context.Context, groupID, kind, memberID string) error
+	// EffectiveMembers returns the IDs of all users in the group, directly or
+	// through nested groups.
+	EffectiveMembers(ctx context.Context, groupID string) ([]string, error)
+	// Effective returns the groups userID is in, directly or through nested
+	// groups, and the roles they grant. middleware.Auth calls it on every
+	// request, so results may be cached briefly.
+	Effective(ctx context.Context, userID string) (*model.EffectiveGroups, error)
+}
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type IdempotencyStore interface {
+	// Reserve stores req if its key is free and returns nil. If the key is
+	// taken by a request that hasn't expired, it returns that request
+	// instead.
+	Reserve(ctx context.Context, req *model.IdempotentRequest) (*model.IdempotentRequest, error)
+	// Complete saves the response of a reserved request.
+	Complete(ctx context.Context, req *model.IdempotentRequest) error
+	// Release frees a reserved key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
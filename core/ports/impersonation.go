@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+type ImpersonationService interface {
+	// Impersonate returns a short-lived token that acts as the target user
+	// and names the admin in its "act" claim.
+	Impersonate(ctx context.Context, admin *model.Principal, targetID string) (string, time.Time, error)
+}
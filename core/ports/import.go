@@ -0,0 +1,40 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"register/model"
+	"time"
+)
+
+// ErrEmptyImport is returned for an import without rows.
+var ErrEmptyImport = errors.New("no users to import")
+
+// ImportService runs bulk user imports as background jobs.
+type ImportService interface {
+	// Start stores the rows next returns, until io.EOF, and queues a job
+	// that imports them, or with dryRun only checks them. Rows are stored
+	// in batches as they are read, so imports of any size fit in memory.
+	// An error from next is returned as is, and nothing is queued.
+	Start(ctx context.Context, dryRun bool, next func() (*model.ImportRow, error)) (*model.Job, error)
+	// Get returns an import job to its creator or an admin.
+	Get(ctx context.Context, id string) (*model.Job, error)
+	// Results calls fn with the results of an import's rows so far, in
+	// file order.
+	Results(ctx context.Context, job *model.Job, fn func(model.ImportResult) error) error
+}
+
+// ImportBatchRepository keeps import rows and their results outside the
+// jobs, in batches. It is scoped to ctx's tenant.
+type ImportBatchRepository interface {
+	Create(ctx context.Context, batch *model.ImportBatch) error
+	// Get returns a job's batch by its sequence number.
+	Get(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error)
+	// Save replaces a batch's rows and results.
+	Save(ctx context.Context, batch *model.ImportBatch) error
+	// Each calls fn with a job's batches in order, without their rows.
+	Each(ctx context.Context, jobID string, fn func(*model.ImportBatch) error) error
+	// Expire drops the rows left in a job's batches, and deletes the
+	// batches at expiresAt.
+	Expire(ctx context.Context, jobID string, expiresAt time.Time) error
+}
@@ -0,0 +1,60 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"register/model"
+	"time"
+)
+
+// ErrJobCanceled is the cause of a job's context when the job was canceled
+// through JobService.Cancel.
+var ErrJobCanceled = errors.New("job canceled")
+
+// JobRepository stores jobs for the workers. Create, Get and RequestCancel
+// are scoped to ctx's tenant; the worker methods work across tenants.
+type JobRepository interface {
+	Create(ctx context.Context, job *model.Job) error
+	Get(ctx context.Context, id string) (*model.Job, error)
+	// RequestCancel cancels a queued job at once, dropping its payload, to
+	// be deleted at expiresAt, and marks a running one to be stopped by its
+	// worker.
+	// Finished jobs are returned unchanged.
+	RequestCancel(ctx context.Context, id string, now, expiresAt time.Time) (*model.Job, error)
+
+	// Claim leases the job of one of types that has waited longest to
+	// owner until leaseUntil, counting an attempt. It takes queued jobs
+	// whose RunAt has passed, and running jobs whose lease has expired
+	// because their worker died. It returns nil when there is none.
+	Claim(ctx context.Context, owner string, types []string, now, leaseUntil time.Time) (*model.Job, error)
+	// Renew extends owner's lease on a job and reports whether a cancel
+	// has been requested. ErrConflict means owner no longer holds it.
+	Renew(ctx context.Context, id, owner string, leaseUntil time.Time) (cancelRequested bool, err error)
+	// Save writes a claimed job's state as long as owner still holds it;
+	// otherwise it returns ErrConflict.
+	Save(ctx context.Context, owner string, job *model.Job) error
+}
+
+// JobFunc does the work of one type of job. It runs as the principal that
+// enqueued the job, and must return soon after ctx is done. Progress and
+// Result changes are kept when it returns, and written early by checkpoint,
+// so work picked up again after a retry or restart starts from there.
+type JobFunc func(ctx context.Context, job *model.Job, checkpoint func() error) error
+
+// JobService queues long-running work for background workers.
+type JobService interface {
+	// Handle registers fn to run jobs of type typ.
+	Handle(typ string, fn JobFunc)
+	// OnFinish registers fn to be called once a job of type typ has
+	// finished, however it finished, to drop what the job keeps outside
+	// itself.
+	OnFinish(typ string, fn func(ctx context.Context, job *model.Job) error)
+	// Enqueue stores job, with its Type, Payload and Progress.Total set by
+	// the caller, to run as the caller in ctx. Callers that need the ID
+	// beforehand may set it too.
+	Enqueue(ctx context.Context, job *model.Job) error
+	// Get returns a job to its creator or an admin.
+	Get(ctx context.Context, id string) (*model.Job, error)
+	// Cancel stops a job; ErrConflict means it has already finished.
+	Cancel(ctx context.Context, id string) (*model.Job, error)
+}
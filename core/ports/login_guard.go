@@ -0,0 +1,27 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+type LoginAttemptStore interface {
+	// Get returns nil, nil when the key has no recorded failures.
+	Get(ctx context.Context, key string) (*model.LoginAttempt, error)
+	// RecordFailure counts a failure at at in one atomic step, so concurrent
+	// failures are all counted. A key that isn't locked at at and whose last
+	// failure was before forgetBefore starts counting again from one.
+	RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, email, ip string) error
+	Failure(ctx context.Context, email, ip string) error
+	Success(ctx context.Context, email, ip string) error
+	// Unlock clears the account's failures and lock, and those of ip unless
+	// it is empty.
+	Unlock(ctx context.Context, email, ip string) error
+}
@@ -0,0 +1,85 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *model.OAuthClient) error
+	GetByID(ctx context.Context, id string) (*model.OAuthClient, error)
+	List(ctx context.Context) ([]*model.OAuthClient, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type AuthorizationCodeRepository interface {
+	Save(ctx context.Context, code *model.AuthorizationCode) error
+	// Consume returns and deletes the code in one step so it can only be
+	// redeemed once.
+	Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error)
+}
+
+type ConsentRepository interface {
+	Get(ctx context.Context, userID, clientID string) (*model.Consent, error)
+	Save(ctx context.Context, consent *model.Consent) error
+}
+
+// AuthorizeRequest holds the parameters of an /authorize call.
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scopes              []string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest holds the parameters of a /token call after client
+// authentication has been extracted from the request.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	Scope        string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+type OAuthService interface {
+	RegisterClient(ctx context.Context, client *model.OAuthClient) (*model.OAuthClient, string, error)
+	ListClients(ctx context.Context) ([]*model.OAuthClient, error)
+	DeleteClient(ctx context.Context, id string) error
+
+	// ValidateAuthorize checks the client, redirect URI and PKCE parameters.
+	// Errors that are not *OAuthError mean the redirect URI can't be trusted
+	// and must not be redirected to.
+	ValidateAuthorize(ctx context.Context, req *AuthorizeRequest) (*model.OAuthClient, error)
+	// SignIn answers req for a user who has just signed in. If the user has
+	// already consented to every scope asked for it returns the code to
+	// redirect back with; otherwise a short-lived ticket for Consent, so
+	// the consent page can be sent without the password.
+	SignIn(ctx context.Context, user *model.User, req *AuthorizeRequest) (code, ticket string, err error)
+	// Consent records the consent of the user ticket was issued to and
+	// returns the code. ErrInvalidToken means the ticket has expired or was
+	// issued for another request.
+	Consent(ctx context.Context, ticket string, req *AuthorizeRequest) (string, error)
+	// IssueCode records consent and returns the code to redirect back with.
+	IssueCode(ctx context.Context, user *model.User, req *AuthorizeRequest) (string, error)
+	Token(ctx context.Context, req *TokenRequest) (*TokenResponse, error)
+	// UserInfo returns the claims visible with scopes; nil scopes means all.
+	UserInfo(ctx context.Context, userID string, scopes []string) (map[string]interface{}, error)
+
+	Discovery() map[string]interface{}
+	JWKS() map[string]interface{}
+}
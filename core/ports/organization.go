@@ -0,0 +1,51 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *model.Organization) error
+	GetByID(ctx context.Context, id string) (*model.Organization, error)
+	ListByIDs(ctx context.Context, ids []string) ([]*model.Organization, error)
+}
+
+type MembershipRepository interface {
+	// Add returns ErrConflict if the user is already a member.
+	Add(ctx context.Context, m *model.Membership) error
+	Get(ctx context.Context, orgID, userID string) (*model.Membership, error)
+	ListByOrg(ctx context.Context, orgID string) ([]*model.Membership, error)
+	ListByUser(ctx context.Context, userID string) ([]*model.Membership, error)
+	UpdateRole(ctx context.Context, orgID, userID, role string) (*model.Membership, error)
+	Remove(ctx context.Context, orgID, userID string) error
+	CountByRole(ctx context.Context, orgID, role string) (int64, error)
+}
+
+type InvitationRepository interface {
+	Create(ctx context.Context, inv *model.Invitation) error
+	GetByID(ctx context.Context, id string) (*model.Invitation, error)
+	// MarkAccepted returns ErrNotFound if the invitation was already used.
+	MarkAccepted(ctx context.Context, id string, at time.Time) error
+}
+
+// OrganizationService acts on behalf of userID and checks their role in the
+// organization. Organizations the caller isn't a member of are reported as
+// ErrNotFound.
+type OrganizationService interface {
+	// Create makes userID the owner of a new organization.
+	Create(ctx context.Context, userID, name string) (*model.Organization, error)
+	Get(ctx context.Context, userID, orgID string) (*model.Organization, error)
+	ListForUser(ctx context.Context, userID string) ([]*model.Organization, error)
+	ListMembers(ctx context.Context, userID, orgID string) ([]*model.Membership, error)
+	UpdateMember(ctx context.Context, userID, orgID, memberID, role string) (*model.Membership, error)
+	// RemoveMember also lets members leave by removing themselves.
+	RemoveMember(ctx context.Context, userID, orgID, memberID string) error
+	// Invite emails a signed link to join the organization with role.
+	Invite(ctx context.Context, userID, orgID, email, role string) (*model.Invitation, error)
+	// AcceptInvitation adds the account with the invited email to the
+	// organization, registering it with name, password and custom
+	// attributes if there is none.
+	AcceptInvitation(ctx context.Context, token, name, password string, attributes map[string]interface{}) (*model.Membership, error)
+}
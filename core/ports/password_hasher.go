@@ -0,0 +1,13 @@
+package ports
+
+// PasswordHasher produces self-describing encoded hashes, so a stored value
+// records the algorithm and parameters it was created with.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with an algorithm or
+	// parameters other than the current ones.
+	NeedsRehash(encoded string) bool
+	// Recognizes reports whether encoded is a hash Verify can check.
+	Recognizes(encoded string) bool
+}
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type PasswordPolicy interface {
+	// Validate returns a *PolicyError listing every rule the password breaks.
+	// user may be a not-yet-created account carrying just name and email.
+	Validate(ctx context.Context, password string, user *model.User) error
+}
+
+// BreachedPasswords reports whether a password appears in a known breach corpus.
+type BreachedPasswords interface {
+	Contains(ctx context.Context, password string) (bool, error)
+}
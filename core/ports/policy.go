@@ -0,0 +1,27 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+// Authorizer decides access requests against a policy.
+type Authorizer interface {
+	// Evaluate never fails; requests no rule allows are denied.
+	Evaluate(req *model.AccessRequest) *model.PolicyDecision
+}
+
+type principalKey struct{}
+
+// WithPrincipal stores the authenticated caller so services can authorize
+// what it does.
+func WithPrincipal(ctx context.Context, p *model.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller stored by WithPrincipal, or nil for work
+// not done on behalf of an API caller, such as registration and jobs.
+func PrincipalFrom(ctx context.Context) *model.Principal {
+	p, _ := ctx.Value(principalKey{}).(*model.Principal)
+	return p
+}
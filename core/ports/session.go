@@ -0,0 +1,33 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+	"time"
+)
+
+// ClientInfo describes where a login came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	ListByUser(ctx context.Context, userID string) ([]*model.Session, error)
+	// Delete returns the removed session.
+	Delete(ctx context.Context, userID, id string) (*model.Session, error)
+	// Touch sets LastSeenAt and returns ErrNotFound once the session is gone.
+	Touch(ctx context.Context, family string, at time.Time) error
+}
+
+type SessionService interface {
+	Start(ctx context.Context, userID string, client ClientInfo, ttl time.Duration) (*model.Session, error)
+	List(ctx context.Context, userID string) ([]*model.Session, error)
+	Revoke(ctx context.Context, userID, id string) error
+	// RevokeFamily revokes the session a token belongs to, by its sid claim.
+	RevokeFamily(ctx context.Context, userID, family string) error
+	// Touch is called on every authenticated request and fails for revoked
+	// sessions.
+	Touch(ctx context.Context, family string) error
+}
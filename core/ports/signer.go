@@ -0,0 +1,10 @@
+package ports
+
+// TokenSigner signs JWTs with the service's asymmetric key so third parties
+// can verify them against the published JWKS.
+type TokenSigner interface {
+	Sign(claims map[string]interface{}) (string, error)
+	JWKS() map[string]interface{}
+	// Verify checks a token made by Sign and returns its claims.
+	Verify(token string) (map[string]interface{}, error)
+}
@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"context"
+	"register/model"
+)
+
+type tenantKey struct{}
+
+// WithTenant scopes everything done with ctx to one tenant. Repositories read
+// it on every query, so services never filter by tenant themselves.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant set by WithTenant, or model.DefaultTenant.
+func TenantFrom(ctx context.Context) string {
+	if id, _ := ctx.Value(tenantKey{}).(string); id != "" {
+		return id
+	}
+	return model.DefaultTenant
+}
@@ -5,12 +5,41 @@ import (
 	"register/model"
 )
 
+// UserRepository stores users. Every write increments the user's Version;
+// conditional writes fail with ErrVersionMismatch when the user has moved on.
+// Lookups and writes of a user that doesn't exist fail with ErrNotFound;
+// other errors mean the store couldn't answer.
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// FindByEmail returns the users whose email is email, ignoring case.
+	FindByEmail(ctx context.Context, email string) ([]*model.User, error)
 	GetByID(ctx context.Context, id string) (*model.User, error)
+	GetByIdentity(ctx context.Context, provider, subject string) (*model.User, error)
 	List(ctx context.Context) ([]*model.User, error)
-	Update(ctx context.Context, id, name, email string) (*model.User, error)
-	Delete(ctx context.Context, id string) error
+	// Each calls fn with every user in turn, reading them from a cursor,
+	// and stops at the first error.
+	Each(ctx context.Context, fn func(*model.User) error) error
+	// FindByAttributes returns the users whose custom attributes have all
+	// of the given values.
+	FindByAttributes(ctx context.Context, attributes map[string]interface{}) ([]*model.User, error)
+	// UpdateFields changes only the fields that are set and returns the
+	// updated user. A non-zero fields.Version makes the update conditional.
+	UpdateFields(ctx context.Context, id string, fields *model.UserFields) (*model.User, error)
+	// UnsetAttribute removes a custom attribute from every user.
+	UnsetAttribute(ctx context.Context, name string) error
+	// UniqueAttribute makes the values of a custom attribute unique among
+	// the tenant's users, or stops doing so. Writes that would repeat a
+	// value then fail with an *AttributeError, and so does making it unique
+	// while users share a value.
+	UniqueAttribute(ctx context.Context, name string, unique bool) error
+	UpdatePassword(ctx context.Context, id, hash string) error
+	SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error)
+	// AddIdentity links an external identity to the user. It returns
+	// ErrConflict if the identity belongs to another user.
+	AddIdentity(ctx context.Context, id string, identity model.ExternalIdentity) error
+	// Delete removes the user if it is at version, or at any version when
+	// version is 0.
+	Delete(ctx context.Context, id string, version int64) error
 	Count(ctx context.Context) (int64, error)
 }
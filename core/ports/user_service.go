@@ -5,12 +5,46 @@ import (
 	"register/model"
 )
 
+// Methods taking attributes check them against the tenant's custom attribute
+// definitions and fail with an *AttributeError.
 type UserService interface {
-	Register(ctx context.Context, name, email, password string) (*model.User, error)
-	Login(ctx context.Context, email, password string) (string, error)
+	Register(ctx context.Context, name, email, password string, attributes map[string]interface{}) (*model.User, error)
+	Login(ctx context.Context, email, password string, client ClientInfo) (string, error)
+	Authenticate(ctx context.Context, email, password, ip string) (*model.User, error)
+	ChangePassword(ctx context.Context, id, current, password string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	// CreateUser adds an account for an administrator or provisioning
+	// client, disabled from the start if disabled is set. Unlike Register it
+	// reports ErrEmailTaken, and password may be empty for users who sign in
+	// through federation or a reset link.
+	CreateUser(ctx context.Context, name, email, password string, attributes map[string]interface{}, disabled bool) (*model.User, error)
 	GetUser(ctx context.Context, id string) (*model.User, error)
-	ListUsers(ctx context.Context) ([]*model.User, error)
-	UpdateUser(ctx context.Context, id, name, email string) (*model.User, error)
-	DeleteUser(ctx context.Context, id string) error
+	// FindUsersByEmail returns the users whose email is email, ignoring
+	// case, that the caller may read, provided it may list users at all.
+	FindUsersByEmail(ctx context.Context, email string) ([]*model.User, error)
+	// ListUsers returns the users whose custom attributes have the values in
+	// filter, given as query strings; a nil filter lists everyone.
+	ListUsers(ctx context.Context, filter map[string]string) ([]*model.User, error)
+	// UpdateUser replaces all custom attributes, or keeps them when
+	// attributes is nil.
+	UpdateUser(ctx context.Context, id, name, email string, attributes map[string]interface{}) (*model.User, error)
+	// PatchUser changes only the fields that are set. Names and emails that
+	// are empty or malformed fail with a *ValidationError, and a stale
+	// fields.Version with ErrVersionMismatch.
+	PatchUser(ctx context.Context, id string, fields *model.UserFields) (*model.User, error)
+	// DeleteUser deletes the user if it is at version, or at any version
+	// when version is 0.
+	DeleteUser(ctx context.Context, id string, version int64) error
+	// SetDisabled disables or re-enables an account. Disabling signs the
+	// user out everywhere.
+	SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error)
 	CountUsers(ctx context.Context) (int64, error)
+	// ImportUser creates a user from a bulk import row. A plain password is
+	// checked against the policy and hashed; a PasswordHash must be one the
+	// hasher recognizes. With dryRun the row is only checked.
+	ImportUser(ctx context.Context, row *model.ImportRow, dryRun bool) (*model.User, error)
+	// ExportUsers calls fn with every user the caller may read, one at a
+	// time, without loading them all.
+	ExportUsers(ctx context.Context, fn func(*model.User) error) error
 }
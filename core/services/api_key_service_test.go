@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+)
+
+type mockAPIKeyRepo struct {
+	keys map[string]*model.APIKey
+}
+
+func newMockAPIKeyRepo() *mockAPIKeyRepo {
+	return &mockAPIKeyRepo{keys: make(map[string]*model.APIKey)}
+}
+
+func (m *mockAPIKeyRepo) Create(ctx context.Context, key *model.APIKey) error {
+	key.ID = key.Prefix
+	key.TenantID = ports.TenantFrom(ctx)
+	cp := *key
+	m.keys[key.ID] = &cp
+	return nil
+}
+
+func (m *mockAPIKeyRepo) GetByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	if k, ok := m.keys[prefix]; ok {
+		cp := *k
+		return &cp, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockAPIKeyRepo) ListByUser(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	var res []*model.APIKey
+	for _, k := range m.keys {
+		if k.UserID == userID && k.TenantID == ports.TenantFrom(ctx) {
+			cp := *k
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	k, ok := m.keys[id]
+	if !ok || k.UserID != userID {
+		return ports.ErrNotFound
+	}
+	k.RevokedAt = &at
+	return nil
+}
+
+func (m *mockAPIKeyRepo) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	m.keys[id].LastUsedAt = &at
+	return nil
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	users.Create(ctx, &model.User{Name: "CI", Email: "ci@example.com", Role: model.RoleUser})
+	var userID string
+	for id := range users.users {
+		userID = id
+	}
+
+	keys := newMockAPIKeyRepo()
+	svc := NewAPIKeyService(keys, users, nil)
+
+	key, raw, err := svc.Create(ctx, userID, "ci", []string{model.ScopeUsersRead}, time.Hour)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !strings.HasPrefix(raw, key.Prefix+"_") || strings.Contains(key.Hash, raw) {
+		t.Fatalf("unexpected key material: raw=%s prefix=%s", raw, key.Prefix)
+	}
+
+	p, err := svc.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if p.UserID != userID || p.Method != model.AuthMethodAPIKey || !p.HasScope(model.ScopeUsersRead) || p.HasScope(model.ScopeUsersWrite) {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+	if keys.keys[key.ID].LastUsedAt == nil {
+		t.Fatal("expected last used to be recorded")
+	}
+
+	if _, err := svc.Authenticate(ctx, key.Prefix+"_wrong"); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Fatalf("expected wrong secret to fail, got %v", err)
+	}
+
+	if err := svc.Revoke(ctx, "someone-else", key.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Fatalf("expected revoke by another user to fail, got %v", err)
+	}
+	if err := svc.Revoke(ctx, userID, key.ID); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, raw); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Fatalf("expected revoked key to fail, got %v", err)
+	}
+}
+
+func TestAPIKeyExpiryAndScopes(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	user := &model.User{Name: "CI", Email: "ci@example.com"}
+	users.Create(ctx, user)
+
+	svc := NewAPIKeyService(newMockAPIKeyRepo(), users, nil).(*apiKeyService)
+
+	if _, _, err := svc.Create(ctx, user.ID, "bad", []string{"root"}, 0); !errors.Is(err, ports.ErrInvalidScope) {
+		t.Fatalf("expected invalid scope, got %v", err)
+	}
+
+	_, raw, err := svc.Create(ctx, user.ID, "short-lived", nil, time.Minute)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	svc.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := svc.Authenticate(ctx, raw); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Fatalf("expected expired key to fail, got %v", err)
+	}
+}
+
+func TestAPIKeyKeepsItsTenant(t *testing.T) {
+	acme := ports.WithTenant(context.Background(), "acme")
+	users := newMockRepo()
+	owner := &model.User{Name: "CI", Email: "ci@example.com"}
+	users.Create(acme, owner)
+	svc := NewAPIKeyService(newMockAPIKeyRepo(), users, nil)
+
+	_, raw, err := svc.Create(acme, owner.ID, "ci", nil, 0)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	// Keys are looked up before the tenant is known; the key decides it.
+	p, err := svc.Authenticate(context.Background(), raw)
+	if err != nil || p.TenantID != "acme" || p.UserID != owner.ID {
+		t.Fatalf("expected acme principal, got %+v, %v", p, err)
+	}
+	if keys, _ := svc.List(context.Background(), owner.ID); len(keys) != 0 {
+		t.Errorf("expected no keys visible from the default tenant, got %d", len(keys))
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// attributeName keeps names usable as Mongo field names and query keys.
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+type attributeService struct {
+	defs  ports.AttributeRepository
+	users ports.UserRepository
+	audit ports.AuditLog
+	now   func() time.Time
+}
+
+func NewAttributeService(defs ports.AttributeRepository, users ports.UserRepository, audit ports.AuditLog) ports.AttributeService {
+	return &attributeService{defs: defs, users: users, audit: audit, now: time.Now}
+}
+
+func (s *attributeService) List(ctx context.Context) ([]*model.AttributeDefinition, error) {
+	return s.defs.List(ctx)
+}
+
+func (s *attributeService) Define(ctx context.Context, def *model.AttributeDefinition) (*model.AttributeDefinition, error) {
+	d := &model.AttributeDefinition{
+		Name:        def.Name,
+		Type:        def.Type,
+		Description: def.Description,
+		Required:    def.Required,
+		Unique:      def.Unique,
+		Pattern:     def.Pattern,
+		Enum:        def.Enum,
+		UpdatedAt:   s.now(),
+	}
+	if violations := checkDefinition(d); len(violations) > 0 {
+		return nil, &ports.AttributeError{Violations: violations}
+	}
+	before, _ := s.find(ctx, d.Name)
+	// The index, not just the check in Validate, keeps concurrent writes
+	// from sharing a value.
+	if d.Unique || (before != nil && before.Unique) {
+		if err := s.users.UniqueAttribute(ctx, d.Name, d.Unique); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.defs.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditAttributeDefine,
+		TargetType: "attribute",
+		TargetID:   d.Name,
+		Changes:    changes(before, d),
+	})
+	return d, nil
+}
+
+func checkDefinition(d *model.AttributeDefinition) []string {
+	var violations []string
+	if !attributeName.MatchString(d.Name) {
+		violations = append(violations, "name must be lowercase letters, digits and _, starting with a letter")
+	}
+	switch d.Type {
+	case model.AttributeString:
+	case model.AttributeNumber, model.AttributeBoolean:
+		if d.Pattern != "" || len(d.Enum) > 0 {
+			violations = append(violations, "pattern and enum only apply to strings")
+		}
+		if d.Unique && d.Type == model.AttributeBoolean {
+			violations = append(violations, "booleans can't be unique")
+		}
+	default:
+		violations = append(violations, "type must be string, number or boolean")
+	}
+	if d.Pattern != "" {
+		if _, err := regexp.Compile(d.Pattern); err != nil {
+			violations = append(violations, "pattern is not a valid regular expression")
+		}
+	}
+	if slices.Contains(d.Enum, "") {
+		violations = append(violations, "enum values can't be empty")
+	}
+	return violations
+}
+
+func (s *attributeService) definitions(ctx context.Context) ([]*model.AttributeDefinition, map[string]*model.AttributeDefinition, error) {
+	defs, err := s.defs.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byName := make(map[string]*model.AttributeDefinition, len(defs))
+	for _, d := range defs {
+		byName[d.Name] = d
+	}
+	return defs, byName, nil
+}
+
+func (s *attributeService) find(ctx context.Context, name string) (*model.AttributeDefinition, error) {
+	_, byName, err := s.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := byName[name]; ok {
+		return d, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (s *attributeService) Delete(ctx context.Context, name string) error {
+	before, err := s.find(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.defs.Delete(ctx, name); err != nil {
+		return err
+	}
+	if err := s.users.UnsetAttribute(ctx, name); err != nil {
+		return err
+	}
+	if before.Unique {
+		if err := s.users.UniqueAttribute(ctx, name, false); err != nil {
+			return err
+		}
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditAttributeDelete,
+		TargetType: "attribute",
+		TargetID:   name,
+		Changes:    changes(before, nil),
+	})
+	return nil
+}
+
+func (s *attributeService) Validate(ctx context.Context, userID string, attributes map[string]interface{}) (map[string]interface{}, error) {
+	defs, byName, err := s.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	values := map[string]interface{}{}
+	invalid := map[string]bool{}
+	for name, raw := range attributes {
+		def, ok := byName[name]
+		if !ok {
+			violations = append(violations, name+" is not a defined attribute")
+			continue
+		}
+		if raw == nil {
+			continue
+		}
+		v, problem := convertAttribute(def, raw)
+		if problem != "" {
+			violations = append(violations, name+" "+problem)
+			invalid[name] = true
+			continue
+		}
+		values[name] = v
+	}
+
+	for _, def := range defs {
+		v, ok := values[def.Name]
+		if def.Required && !invalid[def.Name] && (!ok || v == "") {
+			violations = append(violations, def.Name+" is required")
+		}
+		if !def.Unique || !ok {
+			continue
+		}
+		owners, err := s.users.FindByAttributes(ctx, map[string]interface{}{def.Name: v})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range owners {
+			if u.ID != userID {
+				violations = append(violations, def.Name+" is already taken")
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return nil, &ports.AttributeError{Violations: violations}
+	}
+	return values, nil
+}
+
+// convertAttribute checks a value from a JSON body against its definition
+// and returns it as stored, or what is wrong with it.
+func convertAttribute(def *model.AttributeDefinition, raw interface{}) (interface{}, string) {
+	switch def.Type {
+	case model.AttributeString:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, "must be a string"
+		}
+		if len(def.Enum) > 0 && v != "" && !slices.Contains(def.Enum, v) {
+			return nil, fmt.Sprintf("must be one of %v", def.Enum)
+		}
+		if def.Pattern != "" && v != "" {
+			if matched, _ := regexp.MatchString(def.Pattern, v); !matched {
+				return nil, "must match " + def.Pattern
+			}
+		}
+		return v, ""
+	case model.AttributeNumber:
+		switch v := raw.(type) {
+		case float64:
+			return v, ""
+		case int:
+			return float64(v), ""
+		case int64:
+			return float64(v), ""
+		}
+		return nil, "must be a number"
+	case model.AttributeBoolean:
+		if v, ok := raw.(bool); ok {
+			return v, ""
+		}
+		return nil, "must be a boolean"
+	}
+	return nil, "has an unknown type"
+}
+
+func (s *attributeService) ParseFilter(ctx context.Context, query map[string]string) (map[string]interface{}, error) {
+	_, byName, err := s.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	values := make(map[string]interface{}, len(query))
+	for name, raw := range query {
+		def, ok := byName[name]
+		if !ok {
+			violations = append(violations, name+" is not a defined attribute")
+			continue
+		}
+		switch def.Type {
+		case model.AttributeNumber:
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				violations = append(violations, name+" must be a number")
+				continue
+			}
+			values[name] = v
+		case model.AttributeBoolean:
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				violations = append(violations, name+" must be a boolean")
+				continue
+			}
+			values[name] = v
+		default:
+			values[name] = raw
+		}
+	}
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return nil, &ports.AttributeError{Violations: violations}
+	}
+	return values, nil
+}
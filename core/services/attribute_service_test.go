@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"testing"
+)
+
+type mockAttributeRepo struct {
+	defs []*model.AttributeDefinition
+}
+
+func (m *mockAttributeRepo) List(ctx context.Context) ([]*model.AttributeDefinition, error) {
+	return m.defs, nil
+}
+
+func (m *mockAttributeRepo) Save(ctx context.Context, def *model.AttributeDefinition) error {
+	m.defs = slices.DeleteFunc(m.defs, func(d *model.AttributeDefinition) bool { return d.Name == def.Name })
+	m.defs = append(m.defs, def)
+	return nil
+}
+
+func (m *mockAttributeRepo) Delete(ctx context.Context, name string) error {
+	m.defs = slices.DeleteFunc(m.defs, func(d *model.AttributeDefinition) bool { return d.Name == name })
+	return nil
+}
+
+func newAttributeFixture(t *testing.T) (ports.AttributeService, ports.UserService, *mockUserRepo) {
+	t.Helper()
+	repo := newMockRepo()
+	attrs := NewAttributeService(&mockAttributeRepo{}, repo, nil)
+	for _, def := range []*model.AttributeDefinition{
+		{Name: "department", Type: model.AttributeString, Required: true, Enum: []string{"eng", "sales"}},
+		{Name: "employee_id", Type: model.AttributeString, Unique: true, Pattern: `^E[0-9]{4}$`},
+		{Name: "level", Type: model.AttributeNumber},
+		{Name: "contractor", Type: model.AttributeBoolean},
+	} {
+		if _, err := attrs.Define(context.Background(), def); err != nil {
+			t.Fatalf("define %s: %v", def.Name, err)
+		}
+	}
+	return attrs, NewUserService(repo, mockHasher{}, "secret", WithAttributes(attrs)), repo
+}
+
+func violations(err error) []string {
+	var attrErr *ports.AttributeError
+	if errors.As(err, &attrErr) {
+		return attrErr.Violations
+	}
+	return nil
+}
+
+func TestAttributeDefinitions(t *testing.T) {
+	attrs, _, _ := newAttributeFixture(t)
+	for _, bad := range []*model.AttributeDefinition{
+		{Name: "Department", Type: model.AttributeString},
+		{Name: "a.b", Type: model.AttributeString},
+		{Name: "size", Type: "date"},
+		{Name: "size", Type: model.AttributeNumber, Enum: []string{"1"}},
+		{Name: "flag", Type: model.AttributeBoolean, Unique: true},
+		{Name: "code", Type: model.AttributeString, Pattern: "("},
+	} {
+		if _, err := attrs.Define(context.Background(), bad); violations(err) == nil {
+			t.Errorf("expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestAttributeValidation(t *testing.T) {
+	_, svc, _ := newAttributeFixture(t)
+	ctx := context.Background()
+
+	_, err := svc.Register(ctx, "Ann", "ann@example.com", "password", map[string]interface{}{
+		"department": "marketing", "employee_id": "123", "level": "3", "contractor": "no", "shoe_size": 42.0,
+	})
+	want := []string{
+		"contractor must be a boolean",
+		"department must be one of [eng sales]",
+		"employee_id must match ^E[0-9]{4}$",
+		"level must be a number",
+		"shoe_size is not a defined attribute",
+	}
+	if got := violations(err); !slices.Equal(got, want) {
+		t.Fatalf("violations = %q, want %q", got, want)
+	}
+	if _, err := svc.Register(ctx, "Ann", "ann@example.com", "password", nil); !slices.Equal(violations(err), []string{"department is required"}) {
+		t.Fatalf("expected department to be required, got %v", err)
+	}
+
+	ann, err := svc.Register(ctx, "Ann", "ann@example.com", "password", map[string]interface{}{"department": "eng", "employee_id": "E0001", "level": 3})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if ann.Attributes["level"] != 3.0 {
+		t.Fatalf("level not stored as a number: %#v", ann.Attributes["level"])
+	}
+	if _, err := svc.CreateUser(ctx, "Ben", "ben@example.com", "", map[string]interface{}{"department": "eng", "employee_id": "E0001"}, false); !slices.Equal(violations(err), []string{"employee_id is already taken"}) {
+		t.Fatalf("expected employee_id to be unique, got %v", err)
+	}
+
+	// Keeping the same unique value is not a conflict with oneself, and nil
+	// attributes leave them as they are.
+	if _, err := svc.UpdateUser(ctx, ann.ID, "Ann", "ann@example.com", map[string]interface{}{"department": "sales", "employee_id": "E0001"}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	updated, err := svc.UpdateUser(ctx, ann.ID, "Ann B", "ann@example.com", nil)
+	if err != nil || updated.Attributes["department"] != "sales" || updated.Attributes["level"] != nil {
+		t.Fatalf("unexpected attributes after update: %v %v", updated, err)
+	}
+}
+
+func TestUniqueAttributeIndex(t *testing.T) {
+	attrs, svc, repo := newAttributeFixture(t)
+	ctx := context.Background()
+	index := func(name string) bool { return repo.unique[ports.TenantFrom(ctx)+"/"+name] }
+	if !index("employee_id") {
+		t.Fatal("expected a unique index for employee_id")
+	}
+
+	// A write that gets past Validate, as a concurrent one can, is still
+	// refused by the index.
+	if _, err := svc.Register(ctx, "Ann", "ann@example.com", "password", map[string]interface{}{"department": "eng", "employee_id": "E0001"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	err := repo.Create(ctx, &model.User{Email: "ben@example.com", Attributes: map[string]interface{}{"employee_id": "E0001"}})
+	if !slices.Equal(violations(err), []string{"employee_id is already taken"}) {
+		t.Fatalf("duplicate write = %v", err)
+	}
+
+	// Values can't be made unique while users share them.
+	repo.Create(ctx, &model.User{Email: "cy@example.com", Attributes: map[string]interface{}{"department": "eng"}})
+	if _, err := attrs.Define(ctx, &model.AttributeDefinition{Name: "department", Type: model.AttributeString, Unique: true}); violations(err) == nil {
+		t.Fatalf("expected shared values to block unique, got %v", err)
+	}
+	if index("department") {
+		t.Fatal("index kept after refusing the definition")
+	}
+
+	if err := attrs.Delete(ctx, "employee_id"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if index("employee_id") {
+		t.Fatal("index kept after deleting the definition")
+	}
+}
+
+func TestListUsersByAttribute(t *testing.T) {
+	attrs, svc, repo := newAttributeFixture(t)
+	ctx := context.Background()
+	svc.Register(ctx, "Ann", "ann@example.com", "password", map[string]interface{}{"department": "eng", "level": 2.0})
+	svc.Register(ctx, "Ben", "ben@example.com", "password", map[string]interface{}{"department": "sales", "level": 2.0})
+	svc.Register(ctx, "Cy", "cy@example.com", "password", map[string]interface{}{"department": "eng", "level": 3.0})
+
+	users, err := svc.ListUsers(ctx, map[string]string{"department": "eng", "level": "2"})
+	if err != nil || len(users) != 1 || users[0].Name != "Ann" {
+		t.Fatalf("filter returned %v, %v", users, err)
+	}
+	if _, err := svc.ListUsers(ctx, map[string]string{"level": "high"}); !slices.Equal(violations(err), []string{"level must be a number"}) {
+		t.Fatalf("expected bad filter value to be rejected, got %v", err)
+	}
+
+	if err := attrs.Delete(ctx, "level"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	for _, u := range repo.users {
+		if _, ok := u.Attributes["level"]; ok {
+			t.Fatalf("level left on %s", u.Name)
+		}
+	}
+	if err := attrs.Delete(ctx, "level"); !errors.Is(err, ports.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are redacted wherever they appear in a change, matched as
+// substrings of the lowercased field name.
+var sensitiveFields = []string{"password", "secret", "hash", "token"}
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// appendRetries bounds how often Record retries after another instance
+// appended the same Seq first.
+const appendRetries = 5
+
+const checkpointPurpose = "audit_checkpoint"
+
+type auditLog struct {
+	sink   ports.AuditSink
+	signer ports.TokenSigner
+	now    func() time.Time
+
+	// mu serializes appends from this instance; head is the last event it
+	// knows of, loaded from the sink on first use.
+	mu   sync.Mutex
+	head *model.AuditEvent
+}
+
+// NewAuditLog signs checkpoints with signer; without one, Checkpoint fails
+// and Verify only checks the chain.
+func NewAuditLog(sink ports.AuditSink, signer ports.TokenSigner) ports.AuditLog {
+	return &auditLog{sink: sink, signer: signer, now: time.Now}
+}
+
+func (a *auditLog) Record(ctx context.Context, event *model.AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = a.now()
+	}
+	// Stores keep milliseconds in UTC; hash what will be read back.
+	event.Time = event.Time.UTC().Truncate(time.Millisecond)
+	if event.TenantID == "" {
+		event.TenantID = ports.TenantFrom(ctx)
+	}
+	if meta := ports.RequestMetaFrom(ctx); meta != nil {
+		if event.ActorID == "" {
+			event.ActorID = meta.ActorID
+			event.ActorType = meta.ActorType
+			event.ImpersonatorID = meta.ImpersonatorID
+		}
+		if event.IP == "" {
+			event.IP = meta.IP
+		}
+		event.RequestID = meta.RequestID
+	}
+	for k := range event.Details {
+		if isSensitive(k) {
+			event.Details[k] = redacted
+		}
+	}
+	if err := a.append(ctx, event); err != nil {
+		log.Printf("[Audit] write %s: %v", event.Action, err)
+	}
+}
+
+func (a *auditLog) append(ctx context.Context, event *model.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := 0; i < appendRetries; i++ {
+		if a.head == nil {
+			last, err := a.sink.Last(ctx)
+			if err != nil {
+				return err
+			}
+			a.head = last
+			if a.head == nil {
+				a.head = &model.AuditEvent{}
+			}
+		}
+
+		event.Seq = a.head.Seq + 1
+		event.PrevHash = a.head.Hash
+		event.Hash = hashAuditEvent(event)
+		err := a.sink.Write(ctx, event)
+		if errors.Is(err, ports.ErrConflict) {
+			a.head = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		a.head = event
+		return nil
+	}
+	return fmt.Errorf("append after %d conflicts: %w", appendRetries, ports.ErrConflict)
+}
+
+// hashAuditEvent hashes everything but ID and Hash itself. Fields are listed
+// explicitly so the hash doesn't change when fields are added to the model.
+func hashAuditEvent(e *model.AuditEvent) string {
+	data, _ := json.Marshal(struct {
+		Seq            int64                        `json:"seq"`
+		TenantID       string                       `json:"tenant_id,omitempty"`
+		Time           string                       `json:"time"`
+		Action         string                       `json:"action"`
+		ActorID        string                       `json:"actor_id,omitempty"`
+		ActorType      string                       `json:"actor_type,omitempty"`
+		ImpersonatorID string                       `json:"impersonator_id,omitempty"`
+		TargetType     string                       `json:"target_type,omitempty"`
+		TargetID       string                       `json:"target_id,omitempty"`
+		Changes        map[string]model.AuditChange `json:"changes,omitempty"`
+		Details        map[string]string            `json:"details,omitempty"`
+		IP             string                       `json:"ip,omitempty"`
+		RequestID      string                       `json:"request_id,omitempty"`
+		PrevHash       string                       `json:"prev_hash"`
+	}{
+		e.Seq, e.TenantID, e.Time.UTC().Format(time.RFC3339Nano), e.Action, e.ActorID, e.ActorType, e.ImpersonatorID,
+		e.TargetType, e.TargetID, e.Changes, e.Details, e.IP, e.RequestID, e.PrevHash,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify walks the chain from the oldest stored event. If older events were
+// pruned, the first remaining one is trusted as the anchor. Checkpoints are
+// then checked against their signature and the event they pin.
+func (a *auditLog) Verify(ctx context.Context) (*ports.AuditVerification, error) {
+	if ports.TenantFrom(ctx) != model.DefaultTenant {
+		return nil, ports.ErrForbidden
+	}
+	res := &ports.AuditVerification{Valid: true}
+	pinned := map[int64]string{}
+	checkpoints, err := a.sink.Checkpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range checkpoints {
+		pinned[cp.Seq] = cp.Hash
+	}
+
+	var prev *model.AuditEvent
+	errBroken := errors.New("broken")
+	err = a.sink.Scan(ctx, func(e *model.AuditEvent) error {
+		fail := func(reason string) error {
+			res.Valid, res.BrokenSeq, res.Reason = false, e.Seq, reason
+			return errBroken
+		}
+		switch {
+		case prev != nil && e.Seq != prev.Seq+1:
+			return fail(fmt.Sprintf("events %d to %d are missing", prev.Seq+1, e.Seq-1))
+		case prev != nil && e.PrevHash != prev.Hash:
+			return fail("prev_hash does not match the previous event")
+		case e.Hash != hashAuditEvent(e):
+			return fail("event content does not match its hash")
+		}
+		if hash, ok := pinned[e.Seq]; ok && hash != e.Hash {
+			return fail("event does not match a signed checkpoint")
+		}
+		if prev == nil {
+			res.FirstSeq = e.Seq
+		}
+		res.Checked++
+		res.LastSeq = e.Seq
+		prev = e
+		return nil
+	})
+	if errors.Is(err, errBroken) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cp := range checkpoints {
+		if cp.Seq > res.LastSeq {
+			res.Valid, res.BrokenSeq, res.Reason = false, cp.Seq, "events after a signed checkpoint were removed"
+			return res, nil
+		}
+		if a.signer == nil {
+			continue
+		}
+		claims, err := a.signer.Verify(cp.Signature)
+		if err != nil || claims["purpose"] != checkpointPurpose || claims["hash"] != cp.Hash || claims["seq"] != float64(cp.Seq) {
+			res.Valid, res.BrokenSeq, res.Reason = false, cp.Seq, "checkpoint signature is invalid"
+			return res, nil
+		}
+		res.Checkpoints++
+	}
+	return res, nil
+}
+
+func (a *auditLog) Checkpoint(ctx context.Context) (*model.AuditCheckpoint, error) {
+	if a.signer == nil {
+		return nil, errors.New("audit checkpoints need a signing key")
+	}
+	last, err := a.sink.Last(ctx)
+	if err != nil || last == nil {
+		return nil, err
+	}
+	now := a.now().UTC().Truncate(time.Millisecond)
+	sig, err := a.signer.Sign(map[string]interface{}{
+		"purpose": checkpointPurpose,
+		"seq":     last.Seq,
+		"hash":    last.Hash,
+		"iat":     now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := &model.AuditCheckpoint{Seq: last.Seq, Hash: last.Hash, Time: now, Signature: sig}
+	if err := a.sink.WriteCheckpoint(ctx, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (a *auditLog) Query(ctx context.Context, filter ports.AuditFilter) ([]*model.AuditEvent, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return a.sink.Query(ctx, filter)
+}
+
+// recordAudit is a no-op when the service has no audit log configured.
+func recordAudit(ctx context.Context, audit ports.AuditLog, event *model.AuditEvent) {
+	if audit != nil {
+		audit.Record(ctx, event)
+	}
+}
+
+// changes compares the JSON forms of before and after and returns the fields
+// that differ. Either side may be nil for creations and deletions. Sensitive
+// fields are kept, so the change is visible, but their values are redacted.
+func changes(before, after interface{}) map[string]model.AuditChange {
+	b, a := toFields(before), toFields(after)
+	out := make(map[string]model.AuditChange)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(bv, av) {
+			out[k] = model.AuditChange{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = model.AuditChange{After: av}
+		}
+	}
+	// version and updated_at only record that a write happened, not what
+	// it changed.
+	delete(out, "version")
+	delete(out, "updated_at")
+	for k, c := range out {
+		if isSensitive(k) {
+			out[k] = model.AuditChange{Before: redactValue(c.Before), After: redactValue(c.After)}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func toFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if rv := reflect.ValueOf(v); !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+func isSensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range sensitiveFields {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return redacted
+}
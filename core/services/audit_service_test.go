@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"register/core/ports"
+	"register/model"
+)
+
+type mockAuditSink struct {
+	events      []*model.AuditEvent
+	checkpoints []*model.AuditCheckpoint
+}
+
+func (m *mockAuditSink) Write(ctx context.Context, event *model.AuditEvent) error {
+	if last, _ := m.Last(ctx); last != nil && last.Seq >= event.Seq {
+		return ports.ErrConflict
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockAuditSink) Query(ctx context.Context, filter ports.AuditFilter) ([]*model.AuditEvent, int64, error) {
+	return m.events, int64(len(m.events)), nil
+}
+
+func (m *mockAuditSink) Last(ctx context.Context) (*model.AuditEvent, error) {
+	if len(m.events) == 0 {
+		return nil, nil
+	}
+	return m.events[len(m.events)-1], nil
+}
+
+func (m *mockAuditSink) Scan(ctx context.Context, fn func(*model.AuditEvent) error) error {
+	for _, e := range m.events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockAuditSink) WriteCheckpoint(ctx context.Context, cp *model.AuditCheckpoint) error {
+	m.checkpoints = append(m.checkpoints, cp)
+	return nil
+}
+
+func (m *mockAuditSink) Checkpoints(ctx context.Context) ([]*model.AuditCheckpoint, error) {
+	return m.checkpoints, nil
+}
+
+func (m *mockAuditSink) actions() []string {
+	var out []string
+	for _, e := range m.events {
+		out = append(out, e.Action)
+	}
+	return out
+}
+
+func TestChangesRedactsSecrets(t *testing.T) {
+	before := map[string]interface{}{"name": "Ann", "email": "a@example.com", "client_secret": "old", "role": "user"}
+	after := map[string]interface{}{"name": "Anna", "email": "a@example.com", "client_secret": "new", "role": "user", "Token": "t"}
+
+	got := changes(before, after)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 changed fields, got %v", got)
+	}
+	if got["name"].Before != "Ann" || got["name"].After != "Anna" {
+		t.Errorf("unexpected name change %+v", got["name"])
+	}
+	if got["client_secret"].Before != redacted || got["client_secret"].After != redacted {
+		t.Errorf("expected secret to be redacted, got %+v", got["client_secret"])
+	}
+	if got["Token"].Before != nil || got["Token"].After != redacted {
+		t.Errorf("expected new token field to be redacted, got %+v", got["Token"])
+	}
+	if changes(before, before) != nil {
+		t.Error("expected no changes for equal values")
+	}
+}
+
+func TestUserServiceAudit(t *testing.T) {
+	sink := &mockAuditSink{}
+	svc := NewUserService(newMockRepo(), mockHasher{}, "secret", WithAuditLog(NewAuditLog(sink, nil)))
+	ctx := ports.WithRequestMeta(context.Background(), &ports.RequestMeta{RequestID: "req-1", IP: "10.0.0.9"})
+
+	user, _ := svc.Register(ctx, "Ivy", "ivy@example.com", "password", nil)
+	svc.Login(ctx, "ivy@example.com", "wrong", ports.ClientInfo{IP: "10.0.0.9"})
+	svc.Login(ctx, "ivy@example.com", "password", ports.ClientInfo{IP: "10.0.0.9"})
+
+	adminCtx := ports.WithRequestMeta(context.Background(), &ports.RequestMeta{RequestID: "req-2", ActorID: "admin-1", ActorType: model.PrincipalUser})
+	svc.UpdateUser(adminCtx, user.ID, "Ivy B", "ivy@example.com", nil)
+	svc.DeleteUser(adminCtx, user.ID, 0)
+
+	want := []string{model.AuditUserRegister, model.AuditLoginFailed, model.AuditLogin, model.AuditUserUpdate, model.AuditUserDelete}
+	got := sink.actions()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	register, failed, login, update, del := sink.events[0], sink.events[1], sink.events[2], sink.events[3], sink.events[4]
+	if register.RequestID != "req-1" || register.IP != "10.0.0.9" || register.ActorID != "" || register.TargetID != user.ID {
+		t.Errorf("unexpected register event %+v", register)
+	}
+	if _, ok := register.Changes["password"]; ok {
+		t.Error("password hash must never appear in changes")
+	}
+	if failed.Details["email"] != "ivy@example.com" || login.ActorID != user.ID {
+		t.Errorf("unexpected login events %+v %+v", failed, login)
+	}
+	if update.ActorID != "admin-1" || update.Changes["name"].Before != "Ivy" || update.Changes["name"].After != "Ivy B" || len(update.Changes) != 1 {
+		t.Errorf("unexpected update event %+v", update)
+	}
+	if del.Changes["email"].Before != "ivy@example.com" || del.Changes["email"].After != nil {
+		t.Errorf("expected delete to record the removed user, got %+v", del.Changes)
+	}
+}
+
+func TestAuditHashChain(t *testing.T) {
+	ctx := context.Background()
+	sink := &mockAuditSink{}
+	audit := NewAuditLog(sink, mockSigner{key: []byte("signing key")})
+	for _, id := range []string{"u1", "u2", "u3", "u4"} {
+		audit.Record(ctx, &model.AuditEvent{Action: model.AuditUserUpdate, TargetID: id, Details: map[string]string{"note": id}})
+	}
+	if _, err := audit.Checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint failed: %v", err)
+	}
+
+	for i, e := range sink.events {
+		if e.Seq != int64(i+1) || (i > 0 && e.PrevHash != sink.events[i-1].Hash) || e.Hash == "" {
+			t.Fatalf("event %d not chained: %+v", i, e)
+		}
+	}
+	res, _ := audit.Verify(ctx)
+	if !res.Valid || res.Checked != 4 || res.Checkpoints != 1 {
+		t.Fatalf("expected intact chain, got %+v", res)
+	}
+	// The chain spans tenants, so other tenants' admins can't walk it.
+	if _, err := audit.Verify(ports.WithTenant(ctx, "acme")); !errors.Is(err, ports.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden in another tenant, got %v", err)
+	}
+
+	// Another instance appending first makes this one reload the head.
+	other := NewAuditLog(sink, nil)
+	other.Record(ctx, &model.AuditEvent{Action: model.AuditLogin})
+	audit.Record(ctx, &model.AuditEvent{Action: model.AuditLogin})
+	if res, _ := audit.Verify(ctx); !res.Valid || res.LastSeq != 6 {
+		t.Fatalf("expected chain to survive concurrent appends, got %+v", res)
+	}
+
+	sink.events[1].Details["note"] = "edited"
+	if res, _ := audit.Verify(ctx); res.Valid || res.BrokenSeq != 2 {
+		t.Errorf("expected edit to break seq 2, got %+v", res)
+	}
+	sink.events[1].Details["note"] = "u2"
+
+	sink.events = append(sink.events[:2], sink.events[3:]...)
+	if res, _ := audit.Verify(ctx); res.Valid || res.BrokenSeq != 4 {
+		t.Errorf("expected deletion to be reported at seq 4, got %+v", res)
+	}
+
+	// Rewriting the tail consistently still contradicts the signed checkpoint.
+	sink.events = sink.events[:2]
+	if res, _ := audit.Verify(ctx); res.Valid || res.BrokenSeq != 4 {
+		t.Errorf("expected truncation below the checkpoint to be reported, got %+v", res)
+	}
+}
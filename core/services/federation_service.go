@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const federationStatePurpose = "federation_state"
+
+// federationStateTTL bounds how long a user may take at the upstream provider.
+const federationStateTTL = 10 * time.Minute
+
+var (
+	errNoEmail = errors.New("identity provider returned no email")
+	// errNoAccount covers the reasons a new external identity gets no
+	// account, so callers can't tell a taken email from an unverified one.
+	errNoAccount = errors.New("external identity can't sign in here")
+)
+
+type federationService struct {
+	users     ports.UserRepository
+	providers map[string]ports.IdentityProvider
+	jwtSecret []byte
+	sessions  ports.SessionService
+	audit     ports.AuditLog
+}
+
+// NewFederationService records a session per login when sessions is non-nil,
+// and audit events when audit is.
+func NewFederationService(users ports.UserRepository, providers []ports.IdentityProvider, secret string, sessions ports.SessionService, audit ports.AuditLog) ports.FederationService {
+	byName := make(map[string]ports.IdentityProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &federationService{users: users, providers: byName, jwtSecret: []byte(secret), sessions: sessions, audit: audit}
+}
+
+// Begin generates state, nonce and a PKCE verifier. They travel in a signed
+// blob held by the browser rather than in server-side storage, as does the
+// user an identity is being linked to.
+func (s *federationService) Begin(ctx context.Context, provider, linkUserID string) (string, string, error) {
+	idp, ok := s.providers[provider]
+	if !ok {
+		return "", "", ports.ErrUnknownProvider
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+
+	authURL, err := idp.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	claims := jwt.MapClaims{
+		"provider": provider,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(federationStateTTL).Unix(),
+	}
+	if linkUserID != "" {
+		claims["link"] = linkUserID
+	}
+	blob, err := signPurposeToken(s.jwtSecret, federationStatePurpose, claims)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, blob, nil
+}
+
+func (s *federationService) Complete(ctx context.Context, provider, state, code, stateBlob string, client ports.ClientInfo) (string, error) {
+	idp, ok := s.providers[provider]
+	if !ok {
+		return "", ports.ErrUnknownProvider
+	}
+
+	claims, err := parsePurposeToken(s.jwtSecret, federationStatePurpose, stateBlob)
+	if err != nil {
+		return "", err
+	}
+	if claims["provider"] != provider || claims["state"] != state || state == "" {
+		return "", ports.ErrInvalidToken
+	}
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+
+	ext, err := idp.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	var user *model.User
+	if linkUserID, _ := claims["link"].(string); linkUserID != "" {
+		user, err = s.linkUser(ctx, provider, linkUserID, ext)
+	} else {
+		user, err = s.resolveUser(ctx, provider, ext)
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled {
+		return "", ports.ErrInvalidCredentials
+	}
+
+	event := &model.AuditEvent{
+		Action:     model.AuditLogin,
+		ActorID:    user.ID,
+		ActorType:  model.PrincipalUser,
+		TargetType: "user",
+		TargetID:   user.ID,
+		IP:         client.IP,
+		Details:    map[string]string{"provider": provider},
+	}
+	var extra jwt.MapClaims
+	if s.sessions != nil {
+		session, err := s.sessions.Start(ctx, user.ID, client, loginTokenTTL)
+		if err != nil {
+			return "", err
+		}
+		extra = jwt.MapClaims{"sid": session.Family}
+		event.Details["session_id"] = session.ID
+	}
+	recordAudit(ctx, s.audit, event)
+	return signUserToken(s.jwtSecret, user, loginTokenTTL, extra)
+}
+
+// resolveUser finds the user linked to the external subject, creating one on
+// first login if the provider verified the email. An existing local account
+// with the same email is not linked automatically, since that would let the
+// upstream provider take it over; its owner links it with linkUser instead.
+func (s *federationService) resolveUser(ctx context.Context, provider string, ext *model.ExternalClaims) (*model.User, error) {
+	user, err := s.users.GetByIdentity(ctx, provider, ext.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+
+	if ext.Email == "" {
+		return nil, errNoEmail
+	}
+	if !ext.EmailVerified {
+		return nil, errNoAccount
+	}
+	if _, err := s.users.GetByEmail(ctx, ext.Email); err == nil {
+		return nil, errNoAccount
+	} else if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+
+	name := ext.Name
+	if name == "" {
+		name = ext.Email
+	}
+	user = &model.User{
+		Name:       name,
+		Email:      ext.Email,
+		Role:       model.RoleUser,
+		CreatedAt:  time.Now(),
+		Identities: []model.ExternalIdentity{{Provider: provider, Subject: ext.Subject}},
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserCreate,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    changes(nil, user),
+		Details:    map[string]string{"provider": provider},
+	})
+	return user, nil
+}
+
+// linkUser adds the external identity to the user who started the login
+// while signed in. The email need not match or be verified: the user has
+// proven control of both accounts.
+func (s *federationService) linkUser(ctx context.Context, provider, userID string, ext *model.ExternalClaims) (*model.User, error) {
+	identity := model.ExternalIdentity{Provider: provider, Subject: ext.Subject}
+	if err := s.users.AddIdentity(ctx, userID, identity); err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditIdentityLink,
+		ActorID:    user.ID,
+		ActorType:  model.PrincipalUser,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    map[string]string{"provider": provider, "subject": ext.Subject},
+	})
+	return user, nil
+}
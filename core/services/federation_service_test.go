@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"register/core/ports"
+	"register/model"
+	"testing"
+)
+
+// fakeIdP hands back fixed claims for the code "ok", and checks that the
+// nonce from Begin arrives at Exchange.
+type fakeIdP struct {
+	claims model.ExternalClaims
+	nonce  string
+}
+
+func (f *fakeIdP) Name() string { return "corp" }
+
+func (f *fakeIdP) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	f.nonce = nonce
+	return "https://idp.example/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (f *fakeIdP) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*model.ExternalClaims, error) {
+	if code != "ok" || nonce != f.nonce || codeVerifier == "" {
+		return nil, errors.New("exchange failed")
+	}
+	claims := f.claims
+	return &claims, nil
+}
+
+func beginLogin(t *testing.T, svc ports.FederationService, linkUserID string) (state, blob string) {
+	authURL, blob, err := svc.Begin(context.Background(), "corp", linkUserID)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	return u.Query().Get("state"), blob
+}
+
+func TestFederatedLoginCreatesAndLinksUser(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	idp := &fakeIdP{claims: model.ExternalClaims{Subject: "emp-42", Email: "ada@corp.example", EmailVerified: true, Name: "Ada"}}
+	svc := NewFederationService(repo, []ports.IdentityProvider{idp}, "secret", nil, nil)
+
+	state, blob := beginLogin(t, svc, "")
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); err != nil {
+		t.Fatalf("first login failed: %v", err)
+	}
+	user, err := repo.GetByIdentity(ctx, "corp", "emp-42")
+	if err != nil || user.Email != "ada@corp.example" || user.Role != model.RoleUser {
+		t.Fatalf("expected just-in-time user, got %+v, %v", user, err)
+	}
+
+	// A changed email upstream still resolves to the same account.
+	idp.claims.Email = "ada.lovelace@corp.example"
+	state, blob = beginLogin(t, svc, "")
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); err != nil {
+		t.Fatalf("second login failed: %v", err)
+	}
+	if count, _ := repo.Count(ctx); count != 1 {
+		t.Errorf("expected 1 user, got %d", count)
+	}
+}
+
+func TestFederatedLoginRejects(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	repo.Create(ctx, &model.User{Name: "Local", Email: "taken@corp.example"})
+	idp := &fakeIdP{claims: model.ExternalClaims{Subject: "emp-7", Email: "taken@corp.example", EmailVerified: true}}
+	svc := NewFederationService(repo, []ports.IdentityProvider{idp}, "secret", nil, nil)
+
+	if _, _, err := svc.Begin(ctx, "other", ""); !errors.Is(err, ports.ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+
+	state, blob := beginLogin(t, svc, "")
+	if _, err := svc.Complete(ctx, "corp", "wrong-state", "ok", blob, ports.ClientInfo{}); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for mismatched state, got %v", err)
+	}
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob+"x", ports.ClientInfo{}); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for tampered blob, got %v", err)
+	}
+	// An existing local account is not taken over by the external identity.
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); !errors.Is(err, errNoAccount) {
+		t.Errorf("expected errNoAccount, got %v", err)
+	}
+	// Nor is an account created for an email the provider hasn't verified.
+	idp.claims = model.ExternalClaims{Subject: "emp-8", Email: "new@corp.example"}
+	state, blob = beginLogin(t, svc, "")
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); !errors.Is(err, errNoAccount) {
+		t.Errorf("expected errNoAccount for unverified email, got %v", err)
+	}
+	if _, err := repo.GetByEmail(ctx, "new@corp.example"); err == nil {
+		t.Errorf("account created for unverified email")
+	}
+}
+
+func TestFederatedLoginLinksSignedInUser(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	local := &model.User{Name: "Local", Email: "ada@example.com"}
+	repo.Create(ctx, local)
+	other := &model.User{Name: "Other", Email: "other@example.com"}
+	repo.Create(ctx, other)
+	idp := &fakeIdP{claims: model.ExternalClaims{Subject: "emp-42", Email: "ada@corp.example"}}
+	svc := NewFederationService(repo, []ports.IdentityProvider{idp}, "secret", nil, nil)
+
+	state, blob := beginLogin(t, svc, local.ID)
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	// Plain logins with the identity now reach the linked account.
+	state, blob = beginLogin(t, svc, "")
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); err != nil {
+		t.Fatalf("login after link failed: %v", err)
+	}
+	if user, err := repo.GetByIdentity(ctx, "corp", "emp-42"); err != nil || user.ID != local.ID {
+		t.Fatalf("identity linked to %+v, %v", user, err)
+	}
+	if count, _ := repo.Count(ctx); count != 2 {
+		t.Errorf("expected 2 users, got %d", count)
+	}
+
+	state, blob = beginLogin(t, svc, other.ID)
+	if _, err := svc.Complete(ctx, "corp", state, "ok", blob, ports.ClientInfo{}); !errors.Is(err, ports.ErrConflict) {
+		t.Errorf("expected ErrConflict linking an identity of another user, got %v", err)
+	}
+}
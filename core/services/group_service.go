@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// effectiveGroupsTTL is how long a user's effective groups are cached. It is
+// also how long a change made on another instance may take to apply here.
+const effectiveGroupsTTL = 30 * time.Second
+
+// maxEffectiveEntries bounds the cache; it is cleared when full.
+const maxEffectiveEntries = 10000
+
+type cachedGroups struct {
+	groups *model.EffectiveGroups
+	at     time.Time
+}
+
+type groupService struct {
+	groups ports.GroupRepository
+	users  ports.UserRepository
+	audit  ports.AuditLog
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedGroups
+}
+
+func NewGroupService(groups ports.GroupRepository, users ports.UserRepository, audit ports.AuditLog) ports.GroupService {
+	return &groupService{groups: groups, users: users, audit: audit, now: time.Now, cache: make(map[string]cachedGroups)}
+}
+
+func (s *groupService) Create(ctx context.Context, group *model.Group) (*model.Group, error) {
+	g := &model.Group{
+		Name:        group.Name,
+		Description: group.Description,
+		Roles:       cleanRoles(group.Roles),
+		Users:       []string{},
+		Groups:      []string{},
+		CreatedAt:   s.now(),
+	}
+	if err := s.groups.Create(ctx, g); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditGroupCreate,
+		TargetType: "group",
+		TargetID:   g.ID,
+		Changes:    changes(nil, g),
+	})
+	return g, nil
+}
+
+func (s *groupService) Get(ctx context.Context, id string) (*model.Group, error) {
+	return s.groups.GetByID(ctx, id)
+}
+
+func (s *groupService) List(ctx context.Context) ([]*model.Group, error) {
+	return s.groups.List(ctx)
+}
+
+func (s *groupService) Update(ctx context.Context, id string, group *model.Group) (*model.Group, error) {
+	before, err := s.groups.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.groups.Update(ctx, &model.Group{
+		ID:          id,
+		Name:        group.Name,
+		Description: group.Description,
+		Roles:       cleanRoles(group.Roles),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditGroupUpdate,
+		TargetType: "group",
+		TargetID:   id,
+		Changes:    changes(before, updated),
+	})
+	return updated, nil
+}
+
+func (s *groupService) Delete(ctx context.Context, id string) error {
+	before, err := s.groups.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.groups.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditGroupDelete,
+		TargetType: "group",
+		TargetID:   id,
+		Changes:    changes(before, nil),
+	})
+	return nil
+}
+
+func (s *groupService) AddMember(ctx context.Context, groupID, kind, memberID string) error {
+	if _, err := s.groups.GetByID(ctx, groupID); err != nil {
+		return err
+	}
+	switch kind {
+	case model.GroupMemberUser:
+		if _, err := s.users.GetByID(ctx, memberID); err != nil {
+			return ports.ErrNotFound
+		}
+	case model.GroupMemberGroup:
+		if _, err := s.groups.GetByID(ctx, memberID); err != nil {
+			return err
+		}
+		// groupID must not be memberID or nested inside it.
+		ancestors, err := s.ancestors(ctx, []string{groupID})
+		if err != nil {
+			return err
+		}
+		if memberID == groupID || slices.Contains(ancestors, memberID) {
+			return ports.ErrGroupCycle
+		}
+	default:
+		return ports.ErrNotFound
+	}
+
+	if err := s.groups.AddMember(ctx, groupID, kind, memberID); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditGroupMemberAdd,
+		TargetType: "group",
+		TargetID:   groupID,
+		Details:    map[string]string{"kind": kind, "member_id": memberID},
+	})
+	return nil
+}
+
+func (s *groupService) RemoveMember(ctx context.Context, groupID, kind, memberID string) error {
+	if err := s.groups.RemoveMember(ctx, groupID, kind, memberID); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditGroupMemberRemove,
+		TargetType: "group",
+		TargetID:   groupID,
+		Details:    map[string]string{"kind": kind, "member_id": memberID},
+	})
+	return nil
+}
+
+func (s *groupService) EffectiveMembers(ctx context.Context, groupID string) ([]string, error) {
+	root, err := s.groups.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{root.ID: true}
+	users := map[string]bool{}
+	level := []*model.Group{root}
+	for len(level) > 0 {
+		var next []string
+		for _, g := range level {
+			for _, u := range g.Users {
+				users[u] = true
+			}
+			for _, child := range g.Groups {
+				if !seen[child] {
+					seen[child] = true
+					next = append(next, child)
+				}
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		if level, err = s.groups.GetByIDs(ctx, next); err != nil {
+			return nil, err
+		}
+	}
+	return sortedKeys(users), nil
+}
+
+func (s *groupService) Effective(ctx context.Context, userID string) (*model.EffectiveGroups, error) {
+	key := ports.TenantFrom(ctx) + "/" + userID
+	now := s.now()
+	s.mu.Lock()
+	if c, ok := s.cache[key]; ok && now.Sub(c.at) < effectiveGroupsTTL {
+		s.mu.Unlock()
+		return c.groups, nil
+	}
+	s.mu.Unlock()
+
+	direct, err := s.groups.ListContaining(ctx, model.GroupMemberUser, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(direct))
+	roles := map[string]bool{}
+	for _, g := range direct {
+		ids = append(ids, g.ID)
+		for _, r := range g.Roles {
+			roles[r] = true
+		}
+	}
+	ancestors, err := s.ancestorGroups(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]bool{}
+	for _, id := range ids {
+		all[id] = true
+	}
+	for _, g := range ancestors {
+		all[g.ID] = true
+		for _, r := range g.Roles {
+			roles[r] = true
+		}
+	}
+	eff := &model.EffectiveGroups{GroupIDs: sortedKeys(all), Roles: sortedKeys(roles)}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxEffectiveEntries {
+		s.cache = make(map[string]cachedGroups)
+	}
+	s.cache[key] = cachedGroups{groups: eff, at: now}
+	s.mu.Unlock()
+	return eff, nil
+}
+
+// ancestors returns the IDs of all groups containing any of ids, directly or
+// through nesting.
+func (s *groupService) ancestors(ctx context.Context, ids []string) ([]string, error) {
+	groups, err := s.ancestorGroups(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g.ID)
+	}
+	return out, nil
+}
+
+// ancestorGroups walks up one level per query. The seen set also stops it on
+// cycles, should one exist in stored data.
+func (s *groupService) ancestorGroups(ctx context.Context, ids []string) ([]*model.Group, error) {
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	var out []*model.Group
+	for len(ids) > 0 {
+		parents, err := s.groups.ListContaining(ctx, model.GroupMemberGroup, ids)
+		if err != nil {
+			return nil, err
+		}
+		ids = nil
+		for _, g := range parents {
+			if !seen[g.ID] {
+				seen[g.ID] = true
+				out = append(out, g)
+				ids = append(ids, g.ID)
+			}
+		}
+	}
+	return out, nil
+}
+
+// invalidate drops all cached memberships; a change to one group can affect
+// users anywhere below it.
+func (s *groupService) invalidate() {
+	s.mu.Lock()
+	s.cache = make(map[string]cachedGroups)
+	s.mu.Unlock()
+}
+
+func cleanRoles(roles []string) []string {
+	out := []string{}
+	for _, r := range roles {
+		if r = strings.TrimSpace(r); r != "" && !slices.Contains(out, r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
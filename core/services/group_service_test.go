@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"testing"
+)
+
+type mockGroupRepo struct {
+	groups map[string]*model.Group
+	n      int
+}
+
+func (m *mockGroupRepo) Create(ctx context.Context, group *model.Group) error {
+	m.n++
+	group.ID = fmt.Sprintf("group-%d", m.n)
+	cp := *group
+	m.groups[group.ID] = &cp
+	return nil
+}
+
+func (m *mockGroupRepo) GetByID(ctx context.Context, id string) (*model.Group, error) {
+	if g, ok := m.groups[id]; ok {
+		cp := *g
+		return &cp, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockGroupRepo) GetByIDs(ctx context.Context, ids []string) ([]*model.Group, error) {
+	res := []*model.Group{}
+	for _, id := range ids {
+		if g, ok := m.groups[id]; ok {
+			cp := *g
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockGroupRepo) List(ctx context.Context) ([]*model.Group, error) {
+	res := []*model.Group{}
+	for _, g := range m.groups {
+		cp := *g
+		res = append(res, &cp)
+	}
+	return res, nil
+}
+
+func (m *mockGroupRepo) ListContaining(ctx context.Context, kind string, memberIDs []string) ([]*model.Group, error) {
+	res := []*model.Group{}
+	for _, g := range m.groups {
+		members := g.Users
+		if kind == model.GroupMemberGroup {
+			members = g.Groups
+		}
+		for _, id := range memberIDs {
+			if slices.Contains(members, id) {
+				cp := *g
+				res = append(res, &cp)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *mockGroupRepo) Update(ctx context.Context, group *model.Group) (*model.Group, error) {
+	g, ok := m.groups[group.ID]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	g.Name, g.Description, g.Roles = group.Name, group.Description, group.Roles
+	cp := *g
+	return &cp, nil
+}
+
+func (m *mockGroupRepo) Delete(ctx context.Context, id string) error {
+	if _, ok := m.groups[id]; !ok {
+		return ports.ErrNotFound
+	}
+	delete(m.groups, id)
+	for _, g := range m.groups {
+		g.Groups = slices.DeleteFunc(g.Groups, func(s string) bool { return s == id })
+	}
+	return nil
+}
+
+func (m *mockGroupRepo) AddMember(ctx context.Context, groupID, kind, memberID string) error {
+	g, ok := m.groups[groupID]
+	if !ok {
+		return ports.ErrNotFound
+	}
+	if kind == model.GroupMemberGroup {
+		if !slices.Contains(g.Groups, memberID) {
+			g.Groups = append(g.Groups, memberID)
+		}
+	} else if !slices.Contains(g.Users, memberID) {
+		g.Users = append(g.Users, memberID)
+	}
+	return nil
+}
+
+func (m *mockGroupRepo) RemoveMember(ctx context.Context, groupID, kind, memberID string) error {
+	g, ok := m.groups[groupID]
+	if !ok {
+		return ports.ErrNotFound
+	}
+	drop := func(s string) bool { return s == memberID }
+	if kind == model.GroupMemberGroup {
+		g.Groups = slices.DeleteFunc(g.Groups, drop)
+	} else {
+		g.Users = slices.DeleteFunc(g.Users, drop)
+	}
+	return nil
+}
+
+func TestGroupEffectiveMembership(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	svc := NewGroupService(&mockGroupRepo{groups: map[string]*model.Group{}}, users, nil)
+
+	alice := &model.User{Name: "Alice", Email: "alice@example.com"}
+	users.Create(ctx, alice)
+	staff, _ := svc.Create(ctx, &model.Group{Name: "staff", Roles: []string{"reader"}})
+	eng, _ := svc.Create(ctx, &model.Group{Name: "engineering", Roles: []string{"deployer", " ", "deployer"}})
+	ops, _ := svc.Create(ctx, &model.Group{Name: "ops", Roles: []string{model.RoleAdmin}})
+	if len(eng.Roles) != 1 {
+		t.Errorf("expected roles to be cleaned, got %v", eng.Roles)
+	}
+
+	// alice -> ops -> engineering -> staff
+	svc.AddMember(ctx, staff.ID, model.GroupMemberGroup, eng.ID)
+	svc.AddMember(ctx, eng.ID, model.GroupMemberGroup, ops.ID)
+	if err := svc.AddMember(ctx, ops.ID, model.GroupMemberUser, alice.ID); err != nil {
+		t.Fatalf("add user failed: %v", err)
+	}
+	if err := svc.AddMember(ctx, ops.ID, model.GroupMemberUser, "ghost"); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("expected unknown user to fail, got %v", err)
+	}
+
+	eff, err := svc.Effective(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("effective failed: %v", err)
+	}
+	if !slices.Equal(eff.GroupIDs, []string{staff.ID, eng.ID, ops.ID}) {
+		t.Errorf("unexpected groups: %v", eff.GroupIDs)
+	}
+	if !slices.Equal(eff.Roles, []string{model.RoleAdmin, "deployer", "reader"}) {
+		t.Errorf("unexpected roles: %v", eff.Roles)
+	}
+	if members, _ := svc.EffectiveMembers(ctx, staff.ID); !slices.Equal(members, []string{alice.ID}) {
+		t.Errorf("expected alice to be an effective member of staff, got %v", members)
+	}
+
+	// Changes apply at once rather than after the cache expires.
+	svc.RemoveMember(ctx, eng.ID, model.GroupMemberGroup, ops.ID)
+	eff, _ = svc.Effective(ctx, alice.ID)
+	if !slices.Equal(eff.GroupIDs, []string{ops.ID}) || !slices.Equal(eff.Roles, []string{model.RoleAdmin}) {
+		t.Errorf("expected only ops after removal, got %+v", eff)
+	}
+	svc.Delete(ctx, ops.ID)
+	if eff, _ = svc.Effective(ctx, alice.ID); len(eff.GroupIDs) != 0 || len(eff.Roles) != 0 {
+		t.Errorf("expected no groups after delete, got %+v", eff)
+	}
+}
+
+func TestGroupCycles(t *testing.T) {
+	ctx := context.Background()
+	svc := NewGroupService(&mockGroupRepo{groups: map[string]*model.Group{}}, newMockRepo(), nil)
+	a, _ := svc.Create(ctx, &model.Group{Name: "a"})
+	b, _ := svc.Create(ctx, &model.Group{Name: "b"})
+	c, _ := svc.Create(ctx, &model.Group{Name: "c"})
+
+	if err := svc.AddMember(ctx, a.ID, model.GroupMemberGroup, a.ID); !errors.Is(err, ports.ErrGroupCycle) {
+		t.Errorf("expected self membership to fail, got %v", err)
+	}
+	if err := svc.AddMember(ctx, a.ID, model.GroupMemberGroup, b.ID); err != nil {
+		t.Fatalf("nest b in a failed: %v", err)
+	}
+	if err := svc.AddMember(ctx, b.ID, model.GroupMemberGroup, c.ID); err != nil {
+		t.Fatalf("nest c in b failed: %v", err)
+	}
+	if err := svc.AddMember(ctx, b.ID, model.GroupMemberGroup, a.ID); !errors.Is(err, ports.ErrGroupCycle) {
+		t.Errorf("expected direct cycle to fail, got %v", err)
+	}
+	if err := svc.AddMember(ctx, c.ID, model.GroupMemberGroup, a.ID); !errors.Is(err, ports.ErrGroupCycle) {
+		t.Errorf("expected indirect cycle to fail, got %v", err)
+	}
+	// A diamond is not a cycle.
+	if err := svc.AddMember(ctx, a.ID, model.GroupMemberGroup, c.ID); err != nil {
+		t.Errorf("expected diamond to be allowed, got %v", err)
+	}
+	if err := svc.AddMember(ctx, a.ID, model.GroupMemberGroup, "missing"); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("expected unknown group to fail, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ImpersonationEvent is emitted whenever an admin starts impersonating a user.
+type ImpersonationEvent struct {
+	ActorID   string
+	TargetID  string
+	ExpiresAt time.Time
+}
+
+type impersonationService struct {
+	users     ports.UserRepository
+	jwtSecret []byte
+	ttl       time.Duration
+	onEvent   func(ctx context.Context, e ImpersonationEvent)
+}
+
+func NewImpersonationService(users ports.UserRepository, secret string, ttl time.Duration, onEvent func(ctx context.Context, e ImpersonationEvent)) ports.ImpersonationService {
+	if onEvent == nil {
+		onEvent = func(context.Context, ImpersonationEvent) {}
+	}
+	return &impersonationService{users: users, jwtSecret: []byte(secret), ttl: ttl, onEvent: onEvent}
+}
+
+// Impersonate refuses other admins as targets, since the token carries the
+// target's role, and refuses chaining from an impersonated token.
+func (s *impersonationService) Impersonate(ctx context.Context, admin *model.Principal, targetID string) (string, time.Time, error) {
+	if !admin.IsAdmin() || admin.IsImpersonated() || admin.UserID == targetID {
+		return "", time.Time{}, ports.ErrForbidden
+	}
+	target, err := s.users.GetByID(ctx, targetID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if target.Role == model.RoleAdmin {
+		return "", time.Time{}, fmt.Errorf("%w: cannot impersonate an admin", ports.ErrForbidden)
+	}
+
+	expiresAt := time.Now().Add(s.ttl)
+	token, err := signUserToken(s.jwtSecret, target, s.ttl, jwt.MapClaims{
+		"act": map[string]interface{}{"sub": admin.UserID},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.onEvent(ctx, ImpersonationEvent{ActorID: admin.UserID, TargetID: target.ID, ExpiresAt: expiresAt})
+	return token, expiresAt, nil
+}
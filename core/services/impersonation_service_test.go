@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestImpersonate(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	admin := &model.User{Name: "Admin", Email: "admin@example.com", Role: model.RoleAdmin}
+	other := &model.User{Name: "Other Admin", Email: "other@example.com", Role: model.RoleAdmin}
+	target := &model.User{Name: "Hank", Email: "hank@example.com", Role: model.RoleUser}
+	repo.Create(ctx, admin)
+	repo.Create(ctx, other)
+	repo.Create(ctx, target)
+
+	var events []ImpersonationEvent
+	svc := NewImpersonationService(repo, "secret", 15*time.Minute, func(ctx context.Context, e ImpersonationEvent) {
+		events = append(events, e)
+	})
+	actor := &model.Principal{Type: model.PrincipalUser, UserID: admin.ID, Role: model.RoleAdmin}
+
+	token, expiresAt, err := svc.Impersonate(ctx, actor, target.ID)
+	if err != nil {
+		t.Fatalf("impersonate failed: %v", err)
+	}
+	if d := time.Until(expiresAt); d <= 0 || d > 15*time.Minute {
+		t.Errorf("unexpected expiry %v", expiresAt)
+	}
+	parsed, _ := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	claims := parsed.Claims.(jwt.MapClaims)
+	act, _ := claims["act"].(map[string]interface{})
+	if claims["user_id"] != target.ID || claims["role"] != model.RoleUser || act["sub"] != admin.ID {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if len(events) != 1 || events[0].ActorID != admin.ID || events[0].TargetID != target.ID {
+		t.Errorf("expected one impersonation event, got %+v", events)
+	}
+
+	impersonated := &model.Principal{Type: model.PrincipalUser, UserID: target.ID, Role: model.RoleAdmin, ActorID: admin.ID}
+	for name, tc := range map[string]struct {
+		actor  *model.Principal
+		target string
+	}{
+		"admin target": {actor, other.ID},
+		"self":         {actor, admin.ID},
+		"non-admin":    {&model.Principal{UserID: target.ID, Role: model.RoleUser}, other.ID},
+		"chained":      {impersonated, other.ID},
+	} {
+		if _, _, err := svc.Impersonate(ctx, tc.actor, tc.target); !errors.Is(err, ports.ErrForbidden) {
+			t.Errorf("%s: expected ErrForbidden, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"register/core/ports"
+	"register/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// importCheckpoint is how often an import saves its progress, bounding
+	// the rows redone if its process dies.
+	importCheckpoint = time.Second
+	// importBatchSize is the number of rows stored, and held in memory, at
+	// a time.
+	importBatchSize = 1000
+	// importBatchTTL is how long an import's batches are kept, so those of
+	// an upload cut short don't stay forever. Finished imports keep their
+	// results as long as the job.
+	importBatchTTL = 7 * 24 * time.Hour
+	// importPasswordPurpose derives the key plain passwords are encrypted
+	// with while their rows are stored.
+	importPasswordPurpose = "import_password"
+)
+
+// importService runs imports as jobs, which save their results as they go
+// and resume from them after a retry or restart.
+type importService struct {
+	users   ports.UserService
+	jobs    ports.JobService
+	batches ports.ImportBatchRepository
+	secret  []byte
+	now     func() time.Time
+}
+
+// importPayload is the payload of an import job.
+type importPayload struct {
+	DryRun  bool `json:"dry_run"`
+	Batches int  `json:"batches"`
+}
+
+func NewImportService(users ports.UserService, jobs ports.JobService, batches ports.ImportBatchRepository, secret string) ports.ImportService {
+	s := &importService{users: users, jobs: jobs, batches: batches, secret: []byte(secret), now: time.Now}
+	jobs.Handle(model.JobUserImport, s.run)
+	jobs.OnFinish(model.JobUserImport, s.finish)
+	return s
+}
+
+func (s *importService) Start(ctx context.Context, dryRun bool, next func() (*model.ImportRow, error)) (*model.Job, error) {
+	id, err := randomString(12)
+	if err != nil {
+		return nil, err
+	}
+	job := &model.Job{ID: id, Type: model.JobUserImport}
+	payload := importPayload{DryRun: dryRun}
+	expires := s.now().Add(importBatchTTL)
+	for {
+		rows, err := readBatch(next)
+		if err != nil && err != io.EOF {
+			return nil, s.abort(ctx, job, err)
+		}
+		if len(rows) > 0 {
+			if err := s.seal(job.ID, rows); err != nil {
+				return nil, s.abort(ctx, job, err)
+			}
+			batch := &model.ImportBatch{JobID: job.ID, Seq: payload.Batches, Rows: rows, ExpiresAt: expires}
+			if err := s.batches.Create(ctx, batch); err != nil {
+				return nil, s.abort(ctx, job, err)
+			}
+			payload.Batches++
+			job.Progress.Total += len(rows)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if job.Progress.Total == 0 {
+		return nil, ports.ErrEmptyImport
+	}
+
+	if job.Payload, err = json.Marshal(payload); err != nil {
+		return nil, s.abort(ctx, job, err)
+	}
+	if job.Result, err = json.Marshal(model.ImportReport{DryRun: dryRun}); err != nil {
+		return nil, s.abort(ctx, job, err)
+	}
+	if err := s.jobs.Enqueue(ctx, job); err != nil {
+		return nil, s.abort(ctx, job, err)
+	}
+	return job, nil
+}
+
+// finish drops the rows an import left unimported, and has its results
+// deleted with the job.
+func (s *importService) finish(ctx context.Context, job *model.Job) error {
+	expires := s.now()
+	if job.ExpiresAt != nil {
+		expires = *job.ExpiresAt
+	}
+	return s.batches.Expire(ctx, job.ID, expires)
+}
+
+// readBatch returns up to importBatchSize rows from next, and the error
+// that stopped it short, if any.
+func readBatch(next func() (*model.ImportRow, error)) ([]*model.ImportRow, error) {
+	var rows []*model.ImportRow
+	for len(rows) < importBatchSize {
+		row, err := next()
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// seal encrypts the plain passwords of rows, so they are never stored in
+// the clear. They are bound to the job, and opened only to import the row.
+func (s *importService) seal(jobID string, rows []*model.ImportRow) error {
+	aead, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		row.SealedPassword = nil
+		if row.Password == "" {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(row.Password)+aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		row.SealedPassword = aead.Seal(nonce, nonce, []byte(row.Password), []byte(jobID))
+		row.Password = ""
+	}
+	return nil
+}
+
+// open decrypts a row's password from seal.
+func (s *importService) open(aead cipher.AEAD, jobID string, row *model.ImportRow) error {
+	if len(row.SealedPassword) < aead.NonceSize() {
+		return errors.New("sealed password is truncated")
+	}
+	nonce, sealed := row.SealedPassword[:aead.NonceSize()], row.SealedPassword[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(jobID))
+	if err != nil {
+		return err
+	}
+	row.Password = string(plain)
+	return nil
+}
+
+func (s *importService) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(purposeKey(s.secret, importPasswordPurpose))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// abort deletes the batches stored for an import that won't be queued, and
+// returns err.
+func (s *importService) abort(ctx context.Context, job *model.Job, err error) error {
+	s.batches.Expire(context.WithoutCancel(ctx), job.ID, s.now())
+	return err
+}
+
+func (s *importService) Get(ctx context.Context, id string) (*model.Job, error) {
+	job, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Type != model.JobUserImport {
+		return nil, ports.ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *importService) Results(ctx context.Context, job *model.Job, fn func(model.ImportResult) error) error {
+	return s.batches.Each(ctx, job.ID, func(batch *model.ImportBatch) error {
+		for _, result := range batch.Results {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run imports the rows of the job's batches that have no result yet. The
+// batches are saved before the job, so they are what says how far an
+// earlier run got; the report is counted again from their results.
+func (s *importService) run(ctx context.Context, job *model.Job, checkpoint func() error) error {
+	var payload importPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	report := model.ImportReport{DryRun: payload.DryRun}
+	seen := make(map[string]int)
+	done := 0
+	tally := func(result model.ImportResult) {
+		done++
+		switch result.Status {
+		case model.ImportCreated:
+			report.Created++
+		case model.ImportFailed:
+			report.Failed++
+			return
+		}
+		seen[strings.ToLower(result.Email)] = result.Line
+	}
+	update := func() (err error) {
+		job.Progress.Done = done
+		job.Result, err = json.Marshal(report)
+		return err
+	}
+	save := func(batch *model.ImportBatch) error {
+		// The job's context may be done; finish the write regardless.
+		if err := s.batches.Save(context.WithoutCancel(ctx), batch); err != nil {
+			return err
+		}
+		return update()
+	}
+
+	aead, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	saved := s.now()
+	for seq := 0; seq < payload.Batches; seq++ {
+		batch, err := s.batches.Get(ctx, job.ID, seq)
+		if err != nil {
+			return fmt.Errorf("import batch %d: %w", seq, err)
+		}
+		for _, result := range batch.Results {
+			tally(result)
+		}
+		if len(batch.Results) >= len(batch.Rows) {
+			continue
+		}
+		for _, row := range batch.Rows[len(batch.Results):] {
+			if ctx.Err() != nil {
+				// The job itself is saved by the runner when we return.
+				if err := save(batch); err != nil {
+					return err
+				}
+				return context.Cause(ctx)
+			}
+			// A row that has started is finished even if the job is
+			// stopped, so it isn't half done when the job resumes.
+			if row.SealedPassword != nil && len(row.Errors) == 0 {
+				// Opened in a copy, so the plain password isn't saved.
+				opened := *row
+				if err := s.open(aead, job.ID, &opened); err != nil {
+					opened.Errors = []string{"password could not be decrypted"}
+				}
+				row = &opened
+			}
+			result := s.importRow(context.WithoutCancel(ctx), row, payload.DryRun, seen)
+			batch.Results = append(batch.Results, result)
+			tally(result)
+			if s.now().Sub(saved) >= importCheckpoint {
+				if err := save(batch); err != nil {
+					return err
+				}
+				if err := checkpoint(); err != nil {
+					return err
+				}
+				saved = s.now()
+			}
+		}
+		batch.Rows = nil
+		if err := save(batch); err != nil {
+			return err
+		}
+	}
+	return update()
+}
+
+// importRow imports one row. seen maps the emails of earlier rows to their
+// lines, so a dry run also catches duplicates within the file.
+func (s *importService) importRow(ctx context.Context, row *model.ImportRow, dryRun bool, seen map[string]int) model.ImportResult {
+	result := model.ImportResult{Line: row.Line, Email: row.Email, Status: model.ImportFailed}
+	if len(row.Errors) > 0 {
+		result.Errors = row.Errors
+		return result
+	}
+	email := strings.ToLower(row.Email)
+	if line, ok := seen[email]; ok {
+		result.Errors = []string{"email is already on line " + strconv.Itoa(line)}
+		return result
+	}
+	user, err := s.users.ImportUser(ctx, row, dryRun)
+	if err != nil {
+		result.Errors = importErrors(err)
+		return result
+	}
+	result.Status = model.ImportValid
+	if !dryRun {
+		result.Status = model.ImportCreated
+		result.UserID = user.ID
+	}
+	return result
+}
+
+func importErrors(err error) []string {
+	var policyErr *ports.PolicyError
+	var attrErr *ports.AttributeError
+	var validationErr *ports.ValidationError
+	switch {
+	case errors.As(err, &policyErr):
+		return prefixed("password ", policyErr.Violations)
+	case errors.As(err, &attrErr):
+		return attrErr.Violations
+	case errors.As(err, &validationErr):
+		return validationErr.Violations
+	case errors.Is(err, ports.ErrEmailTaken):
+		return []string{"email is already registered"}
+	case errors.Is(err, ports.ErrForbidden):
+		return []string{"not allowed to create this user"}
+	}
+	return []string{err.Error()}
+}
+
+func prefixed(prefix string, violations []string) []string {
+	out := make([]string, len(violations))
+	for i, v := range violations {
+		out[i] = prefix + v
+	}
+	return out
+}
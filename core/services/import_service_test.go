@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockImportBatchRepo keeps import batches in memory, in order by job.
+// Batches past their ExpiresAt are gone, as with the TTL index.
+type mockImportBatchRepo struct {
+	mu      sync.Mutex
+	batches map[string][]*model.ImportBatch
+	seq     int
+}
+
+func newMockImportBatchRepo() *mockImportBatchRepo {
+	return &mockImportBatchRepo{batches: make(map[string][]*model.ImportBatch)}
+}
+
+func (m *mockImportBatchRepo) Create(ctx context.Context, batch *model.ImportBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	batch.ID = fmt.Sprintf("batch%d", m.seq)
+	batch.TenantID = ports.TenantFrom(ctx)
+	cp := *batch
+	m.batches[batch.JobID] = append(m.batches[batch.JobID], &cp)
+	return nil
+}
+
+func (m *mockImportBatchRepo) Get(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batch, err := m.find(ctx, jobID, seq)
+	if err != nil {
+		return nil, err
+	}
+	cp := *batch
+	cp.Rows = slices.Clone(batch.Rows)
+	cp.Results = slices.Clone(batch.Results)
+	return &cp, nil
+}
+
+func (m *mockImportBatchRepo) Save(ctx context.Context, batch *model.ImportBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, err := m.find(ctx, batch.JobID, batch.Seq)
+	if err != nil {
+		return err
+	}
+	stored.Rows = slices.Clone(batch.Rows)
+	stored.Results = slices.Clone(batch.Results)
+	return nil
+}
+
+func (m *mockImportBatchRepo) Each(ctx context.Context, jobID string, fn func(*model.ImportBatch) error) error {
+	m.mu.Lock()
+	var batches []model.ImportBatch
+	for _, batch := range m.batches[jobID] {
+		if m.live(ctx, batch) {
+			cp := *batch
+			cp.Rows = nil
+			batches = append(batches, cp)
+		}
+	}
+	m.mu.Unlock()
+	for i := range batches {
+		if err := fn(&batches[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockImportBatchRepo) Expire(ctx context.Context, jobID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, batch := range m.batches[jobID] {
+		if batch.TenantID == ports.TenantFrom(ctx) {
+			batch.Rows = nil
+			batch.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *mockImportBatchRepo) find(ctx context.Context, jobID string, seq int) (*model.ImportBatch, error) {
+	for _, batch := range m.batches[jobID] {
+		if batch.Seq == seq && m.live(ctx, batch) {
+			return batch, nil
+		}
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockImportBatchRepo) live(ctx context.Context, batch *model.ImportBatch) bool {
+	return batch.TenantID == ports.TenantFrom(ctx) && batch.ExpiresAt.After(time.Now())
+}
+
+// importReport waits for an import job to finish and returns its report
+// and results.
+func importReport(t *testing.T, imports ports.ImportService, jobs ports.JobService, id string) (*model.Job, model.ImportReport, []model.ImportResult) {
+	t.Helper()
+	job := waitForJob(t, jobs, id, model.JobSucceeded, model.JobFailed, model.JobCanceled)
+	var report model.ImportReport
+	if err := json.Unmarshal(job.Result, &report); err != nil {
+		t.Fatalf("import report: %v", err)
+	}
+	var results []model.ImportResult
+	err := imports.Results(context.Background(), job, func(result model.ImportResult) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("import results: %v", err)
+	}
+	return job, report, results
+}
+
+// rowsOf reads rows as an upload would.
+func rowsOf(rows []*model.ImportRow) func() (*model.ImportRow, error) {
+	return func() (*model.ImportRow, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret")
+	jobs := NewJobRunner(newMockJobRepo(), testJobSettings())
+	imports := NewImportService(svc, jobs, newMockImportBatchRepo(), "secret")
+	jobs.Start()
+	defer jobs.Shutdown(context.Background())
+	ctx := context.Background()
+	svc.Register(ctx, "Old", "old@example.com", "password", nil)
+	hash, _ := mockHasher{}.Hash("imported")
+
+	rows := []*model.ImportRow{
+		{Line: 2, Name: "Ann", Email: "ann@example.com", Password: "password"},
+		{Line: 3, Name: "Ben", Email: "ben@example.com", PasswordHash: hash},
+		{Line: 4, Name: "Ann again", Email: "ANN@example.com"},
+		{Line: 5, Name: "Old", Email: "old@example.com"},
+		{Line: 6, Name: "Cy", Email: "not an email", PasswordHash: "md5:abc"},
+		{Line: 7, Errors: []string{"wrong number of fields"}},
+	}
+	want := []model.ImportResult{
+		{Line: 2, Email: "ann@example.com", Status: model.ImportValid},
+		{Line: 3, Email: "ben@example.com", Status: model.ImportValid},
+		{Line: 4, Email: "ANN@example.com", Status: model.ImportFailed, Errors: []string{"email is already on line 2"}},
+		{Line: 5, Email: "old@example.com", Status: model.ImportFailed, Errors: []string{"email is already registered"}},
+		{Line: 6, Email: "not an email", Status: model.ImportFailed, Errors: []string{"email must be a plain email address"}},
+		{Line: 7, Status: model.ImportFailed, Errors: []string{"wrong number of fields"}},
+	}
+
+	started, err := imports.Start(ctx, true, rowsOf(rows))
+	if err != nil || started.Progress.Total != 6 || started.Type != model.JobUserImport {
+		t.Fatalf("start dry run: %+v %v", started, err)
+	}
+	job, report, results := importReport(t, imports, jobs, started.ID)
+	if job.Status != model.JobSucceeded || job.Progress.Done != 6 || !report.DryRun || report.Failed != 4 {
+		t.Fatalf("dry run = %+v %+v", job, report)
+	}
+	if !slices.EqualFunc(results, want, sameResult) {
+		t.Fatalf("dry run results = %+v", results)
+	}
+	if len(repo.users) != 1 {
+		t.Fatalf("dry run created users: %d", len(repo.users))
+	}
+
+	started, _ = imports.Start(ctx, false, rowsOf(rows[:2]))
+	_, report, results = importReport(t, imports, jobs, started.ID)
+	if report.Created != 2 || report.Failed != 0 || results[0].UserID == "" {
+		t.Fatalf("import: %+v %+v", report, results)
+	}
+	ben, _ := repo.GetByEmail(ctx, "ben@example.com")
+	if ben.Password != hash {
+		t.Fatalf("pre-hashed password was not kept")
+	}
+	if _, err := svc.Login(ctx, "ben@example.com", "imported", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login with imported hash failed: %v", err)
+	}
+}
+
+func TestImportInBatches(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret")
+	jobs := NewJobRunner(newMockJobRepo(), testJobSettings())
+	batches := newMockImportBatchRepo()
+	imports := NewImportService(svc, jobs, batches, "secret")
+	jobs.Start()
+	defer jobs.Shutdown(context.Background())
+	ctx := context.Background()
+
+	var rows []*model.ImportRow
+	for i := 0; i < 2*importBatchSize+1; i++ {
+		rows = append(rows, &model.ImportRow{Line: i + 2, Name: "User", Email: fmt.Sprintf("user%d@example.com", i)})
+	}
+	rows[importBatchSize].Email = "user0@example.com"
+	started, err := imports.Start(ctx, true, rowsOf(rows))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job, report, results := importReport(t, imports, jobs, started.ID)
+	if job.Progress.Done != len(rows) || report.Failed != 1 || len(results) != len(rows) {
+		t.Fatalf("import = %+v %+v, %d results", job.Progress, report, len(results))
+	}
+	// Duplicates are caught across batches.
+	if r := results[importBatchSize]; r.Line != importBatchSize+2 || r.Status != model.ImportFailed || r.Errors[0] != "email is already on line 2" {
+		t.Fatalf("duplicate in a later batch = %+v", r)
+	}
+	stored := 0
+	batches.Each(ctx, started.ID, func(*model.ImportBatch) error {
+		stored++
+		return nil
+	})
+	if stored != 3 {
+		t.Fatalf("stored %d batches", stored)
+	}
+
+	if _, err := imports.Start(ctx, false, rowsOf(nil)); !errors.Is(err, ports.ErrEmptyImport) {
+		t.Fatalf("empty import: %v", err)
+	}
+	bad := errors.New("bad upload")
+	_, err = imports.Start(ctx, false, func() (*model.ImportRow, error) { return nil, bad })
+	if !errors.Is(err, bad) {
+		t.Fatalf("failed upload: %v", err)
+	}
+}
+
+func TestImportSealsPasswords(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret", WithPasswordPolicy(NewPasswordPolicy(PasswordRules{MinLength: 10}, nil)))
+	jobs := NewJobRunner(newMockJobRepo(), testJobSettings())
+	batches := newMockImportBatchRepo()
+	imports := NewImportService(svc, jobs, batches, "secret").(*importService)
+	ctx := context.Background()
+
+	rows := []*model.ImportRow{
+		{Line: 2, Name: "Ann", Email: "ann@example.com", Password: "Correct-Horse-Battery-9"},
+		{Line: 3, Name: "Ben", Email: "ben@example.com", Password: "short"},
+		{Line: 4, Name: "Cy", Email: "cy@example.com", Password: "Correct-Horse-Battery-9", Errors: []string{"wrong number of fields"}},
+	}
+	job, err := imports.Start(ctx, false, rowsOf(rows))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	batch, _ := batches.Get(ctx, job.ID, 0)
+	for _, row := range batch.Rows {
+		if row.Password != "" || len(row.SealedPassword) == 0 || strings.Contains(string(row.SealedPassword), "Correct-Horse") {
+			t.Fatalf("stored password on line %d = %q, %q", row.Line, row.Password, row.SealedPassword)
+		}
+	}
+
+	if err := imports.run(ctx, job, func() error { return nil }); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, err := svc.Login(ctx, "ann@example.com", "Correct-Horse-Battery-9", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login with imported password: %v", err)
+	}
+	if len(repo.users) != 1 {
+		t.Fatalf("users = %d, want only Ann", len(repo.users))
+	}
+	var results []model.ImportResult
+	imports.Results(ctx, job, func(r model.ImportResult) error {
+		results = append(results, r)
+		return nil
+	})
+	if len(results) != 3 || !slices.Equal(results[1].Errors, []string{"password must be at least 10 characters"}) {
+		t.Fatalf("results = %+v", results)
+	}
+	if batch, _ := batches.Get(ctx, job.ID, 0); len(batch.Rows) != 0 {
+		t.Fatalf("rows kept after import: %+v", batch.Rows)
+	}
+
+	// Canceled before it ran: its rows are dropped at once.
+	queued, _ := imports.Start(ctx, false, rowsOf([]*model.ImportRow{{Line: 2, Name: "Di", Email: "di@example.com"}}))
+	if _, err := jobs.Cancel(ctx, queued.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if batch, _ := batches.Get(ctx, queued.ID, 0); len(batch.Rows) != 0 {
+		t.Fatalf("rows kept after the import was canceled: %+v", batch.Rows)
+	}
+}
+
+func sameResult(a, b model.ImportResult) bool {
+	return a.Line == b.Line && a.Email == b.Email && a.Status == b.Status && slices.Equal(a.Errors, b.Errors)
+}
+
+func TestImportResumes(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret")
+	jobs := NewJobRunner(newMockJobRepo(), testJobSettings())
+	batches := newMockImportBatchRepo()
+	imports := NewImportService(svc, jobs, batches, "secret").(*importService)
+	ctx := context.Background()
+
+	rows := []*model.ImportRow{
+		{Line: 2, Name: "Ann", Email: "ann@example.com", Password: "password"},
+		{Line: 3, Name: "Ben", Email: "ben@example.com", Password: "password"},
+		{Line: 4, Name: "Ann again", Email: "ann@example.com", Password: "password"},
+	}
+	job, err := imports.Start(ctx, false, rowsOf(rows))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// As saved by an earlier run that stopped after the first row, before
+	// it could checkpoint the job.
+	svc.Register(ctx, "Ann", "ann@example.com", "password", nil)
+	batch, _ := batches.Get(ctx, job.ID, 0)
+	batch.Results = []model.ImportResult{{Line: 2, Email: "ann@example.com", Status: model.ImportCreated, UserID: "u1"}}
+	batches.Save(ctx, batch)
+
+	if err := imports.run(ctx, job, func() error { return nil }); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	var report model.ImportReport
+	json.Unmarshal(job.Result, &report)
+	var results []model.ImportResult
+	imports.Results(ctx, job, func(result model.ImportResult) error {
+		results = append(results, result)
+		return nil
+	})
+	want := []model.ImportResult{
+		{Line: 2, Email: "ann@example.com", Status: model.ImportCreated},
+		{Line: 3, Email: "ben@example.com", Status: model.ImportCreated},
+		{Line: 4, Email: "ann@example.com", Status: model.ImportFailed, Errors: []string{"email is already on line 2"}},
+	}
+	if job.Progress.Done != 3 || report.Created != 2 || report.Failed != 1 || !slices.EqualFunc(results, want, sameResult) {
+		t.Fatalf("resumed import = %d %+v %+v", job.Progress.Done, report, results)
+	}
+	if len(repo.users) != 2 {
+		t.Fatalf("users after resume: %d", len(repo.users))
+	}
+	if batch, _ := batches.Get(ctx, job.ID, 0); len(batch.Rows) != 0 {
+		t.Fatalf("rows kept after the batch was imported")
+	}
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"register/core/ports"
+	"register/model"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobWorkers      = 4
+	defaultJobPollInterval = time.Second
+	defaultJobLease        = time.Minute
+	defaultJobMaxAttempts  = 3
+	defaultJobBaseBackoff  = 10 * time.Second
+	defaultJobMaxBackoff   = 10 * time.Minute
+	defaultJobRetention    = 7 * 24 * time.Hour
+)
+
+// errShutdown stops the jobs running when the runner shuts down. They are
+// put back in the queue for the next process to resume.
+var errShutdown = errors.New("shutting down")
+
+// errLeaseLost stops a job whose worker took too long to renew its lease,
+// since another worker may already have taken it over.
+var errLeaseLost = errors.New("lease lost")
+
+// JobSettings tunes the workers. Zero values get defaults.
+type JobSettings struct {
+	Workers int            // jobs this process runs at once
+	Limits  map[string]int // jobs of a type this process runs at once, within Workers
+	// PollInterval is how often idle workers look for jobs enqueued by
+	// other processes or due for a retry.
+	PollInterval time.Duration
+	// Lease is how long a job stays with a worker that stops renewing it,
+	// e.g. because its process died, before another worker takes it over.
+	Lease       time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration // wait before the first retry, doubled for each further one
+	MaxBackoff  time.Duration
+	Retention   time.Duration // how long finished jobs are kept
+}
+
+// JobRunner queues jobs in a JobRepository and runs them in the background
+// with a pool of workers. Several processes may share the repository; each
+// job is leased to one worker at a time.
+type JobRunner struct {
+	repo     ports.JobRepository
+	settings JobSettings
+	id       string
+	now      func() time.Time
+
+	mu        sync.Mutex
+	handlers  map[string]ports.JobFunc
+	finishers map[string]func(context.Context, *model.Job) error
+	running   map[string]int
+	active    int
+	claims    int
+
+	wake    chan struct{}
+	stop    context.CancelCauseFunc
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewJobRunner(repo ports.JobRepository, settings JobSettings) *JobRunner {
+	if settings.Workers <= 0 {
+		settings.Workers = defaultJobWorkers
+	}
+	if settings.PollInterval <= 0 {
+		settings.PollInterval = defaultJobPollInterval
+	}
+	if settings.Lease <= 0 {
+		settings.Lease = defaultJobLease
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = defaultJobMaxAttempts
+	}
+	if settings.BaseBackoff <= 0 {
+		settings.BaseBackoff = defaultJobBaseBackoff
+	}
+	if settings.MaxBackoff <= 0 {
+		settings.MaxBackoff = defaultJobMaxBackoff
+	}
+	if settings.Retention <= 0 {
+		settings.Retention = defaultJobRetention
+	}
+	id, err := randomString(12)
+	if err != nil {
+		panic(err)
+	}
+	return &JobRunner{
+		repo:      repo,
+		settings:  settings,
+		id:        id,
+		now:       time.Now,
+		handlers:  make(map[string]ports.JobFunc),
+		finishers: make(map[string]func(context.Context, *model.Job) error),
+		running:   make(map[string]int),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+func (r *JobRunner) Handle(typ string, fn ports.JobFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[typ] = fn
+}
+
+func (r *JobRunner) OnFinish(typ string, fn func(ctx context.Context, job *model.Job) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finishers[typ] = fn
+}
+
+func (r *JobRunner) Enqueue(ctx context.Context, job *model.Job) error {
+	now := r.now()
+	job.Status = model.JobQueued
+	job.MaxAttempts = r.settings.MaxAttempts
+	job.RunAt = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.Origin = model.JobOrigin{Principal: ports.PrincipalFrom(ctx)}
+	if job.Origin.Principal != nil {
+		job.CreatedBy = job.Origin.Principal.UserID
+	}
+	if meta := ports.RequestMetaFrom(ctx); meta != nil {
+		job.Origin.RequestID = meta.RequestID
+		job.Origin.IP = meta.IP
+		job.Origin.UserAgent = meta.UserAgent
+		job.Origin.ActorID = meta.ActorID
+		job.Origin.ActorType = meta.ActorType
+		job.Origin.ImpersonatorID = meta.ImpersonatorID
+	}
+	if err := r.repo.Create(ctx, job); err != nil {
+		return err
+	}
+	r.poke()
+	return nil
+}
+
+// Get and Cancel hide other callers' jobs from everyone but admins.
+// Without a principal in ctx the caller is trusted.
+func (r *JobRunner) Get(ctx context.Context, id string) (*model.Job, error) {
+	job, err := r.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p := ports.PrincipalFrom(ctx); p != nil && !p.IsAdmin() && (p.UserID == "" || p.UserID != job.CreatedBy) {
+		return nil, ports.ErrNotFound
+	}
+	return job, nil
+}
+
+func (r *JobRunner) Cancel(ctx context.Context, id string) (*model.Job, error) {
+	before, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := r.now()
+	job, err := r.repo.RequestCancel(ctx, id, now, now.Add(r.settings.Retention))
+	if err != nil {
+		return nil, err
+	}
+	// A queued job is canceled here, without a worker to finish it.
+	if before.Status == model.JobQueued && job.Status == model.JobCanceled {
+		r.finished(context.WithoutCancel(ctx), job)
+	}
+	if job.Status != model.JobCanceled && job.Finished() {
+		return job, ports.ErrConflict
+	}
+	return job, nil
+}
+
+// Start runs the workers until Shutdown. Jobs left running by a process
+// that stopped without Shutdown are taken over once their leases expire.
+func (r *JobRunner) Start() {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	r.stop = cancel
+	r.stopped = make(chan struct{})
+	go r.loop(ctx)
+}
+
+// Shutdown stops claiming jobs and interrupts the running ones, which are
+// saved as they are and queued again, so the next process resumes them
+// without counting an attempt. It waits for them until ctx is done; jobs
+// still running then are taken over when their leases expire.
+func (r *JobRunner) Shutdown(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	r.stop(errShutdown)
+	done := make(chan struct{})
+	go func() {
+		<-r.stopped
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poke wakes the claim loop early, e.g. for a job just enqueued.
+func (r *JobRunner) poke() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *JobRunner) loop(ctx context.Context) {
+	defer close(r.stopped)
+	ticker := time.NewTicker(r.settings.PollInterval)
+	defer ticker.Stop()
+	for {
+		r.claim(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// claim starts jobs until the workers are busy or none are due.
+func (r *JobRunner) claim(ctx context.Context) {
+	for ctx.Err() == nil {
+		types, owner := r.free()
+		if len(types) == 0 {
+			return
+		}
+		now := r.now()
+		job, err := r.repo.Claim(ctx, owner, types, now, now.Add(r.settings.Lease))
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[Jobs] claim: %v", err)
+			}
+			return
+		}
+		if job == nil {
+			return
+		}
+		r.mu.Lock()
+		r.running[job.Type]++
+		r.active++
+		fn := r.handlers[job.Type]
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go r.run(ctx, owner, job, fn)
+	}
+}
+
+// free returns the handled types with a worker to spare, and the owner to
+// claim a job as. Each claim gets its own owner, so a job this runner takes
+// over from itself after its lease expired isn't saved by both workers.
+func (r *JobRunner) free() ([]string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active >= r.settings.Workers {
+		return nil, ""
+	}
+	var types []string
+	for typ := range r.handlers {
+		if limit := r.settings.Limits[typ]; limit <= 0 || r.running[typ] < limit {
+			types = append(types, typ)
+		}
+	}
+	r.claims++
+	return types, r.id + "-" + strconv.Itoa(r.claims)
+}
+
+func (r *JobRunner) run(stop context.Context, owner string, job *model.Job, fn ports.JobFunc) {
+	defer func() {
+		r.mu.Lock()
+		r.running[job.Type]--
+		r.active--
+		r.mu.Unlock()
+		r.wg.Done()
+		r.poke()
+	}()
+
+	now := r.now()
+	if job.StartedAt == nil {
+		job.StartedAt = &now
+	}
+	if job.CancelRequested {
+		r.finish(owner, job, model.JobCanceled, "")
+		return
+	}
+	if job.Attempts > job.MaxAttempts {
+		// The last attempt's worker died without saving it.
+		reason := fmt.Sprintf("gave up after %d attempts", job.MaxAttempts)
+		if job.Error != "" {
+			reason += ": " + job.Error
+		}
+		r.finish(owner, job, model.JobFailed, reason)
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(r.jobContext(stop, job))
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		r.renew(ctx, cancel, owner, job)
+	}()
+	err := r.call(ctx, owner, job, fn)
+	cause := context.Cause(ctx)
+	cancel(nil)
+	<-renewed
+
+	switch {
+	case err == nil:
+		r.finish(owner, job, model.JobSucceeded, "")
+	case errors.Is(cause, ports.ErrJobCanceled):
+		r.finish(owner, job, model.JobCanceled, "")
+	case errors.Is(cause, errLeaseLost):
+		log.Printf("[Jobs] %s %s: lost its lease, left to its new worker", job.Type, job.ID)
+	case errors.Is(cause, errShutdown):
+		job.Attempts--
+		r.requeue(owner, job, r.now())
+	case job.Attempts >= job.MaxAttempts:
+		r.finish(owner, job, model.JobFailed, err.Error())
+	default:
+		job.Error = err.Error()
+		r.requeue(owner, job, r.now().Add(r.backoff(job.Attempts)))
+	}
+}
+
+// call runs fn, turning a panic into an error so one bad job can't take
+// the process down.
+func (r *JobRunner) call(ctx context.Context, owner string, job *model.Job, fn ports.JobFunc) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return fn(ctx, job, func() error {
+		// The saved lease replaces the one renew keeps extending.
+		job.UpdatedAt = r.now()
+		job.LeaseUntil = job.UpdatedAt.Add(r.settings.Lease)
+		if err := r.repo.Save(context.WithoutCancel(ctx), owner, job); err != nil {
+			return err
+		}
+		return context.Cause(ctx)
+	})
+}
+
+// jobContext restores the tenant, caller and request metadata the job was
+// enqueued with, under stop.
+func (r *JobRunner) jobContext(stop context.Context, job *model.Job) context.Context {
+	ctx := ports.WithTenant(stop, job.TenantID)
+	if job.Origin.Principal != nil {
+		ctx = ports.WithPrincipal(ctx, job.Origin.Principal)
+	}
+	return ports.WithRequestMeta(ctx, &ports.RequestMeta{
+		RequestID:      job.Origin.RequestID,
+		IP:             job.Origin.IP,
+		UserAgent:      job.Origin.UserAgent,
+		ActorID:        job.Origin.ActorID,
+		ActorType:      job.Origin.ActorType,
+		ImpersonatorID: job.Origin.ImpersonatorID,
+	})
+}
+
+// renew extends the job's lease a few times per lease period until ctx is
+// done, and cancels ctx when the job is canceled or the lease is lost.
+func (r *JobRunner) renew(ctx context.Context, cancel context.CancelCauseFunc, owner string, job *model.Job) {
+	ticker := time.NewTicker(r.settings.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		canceled, err := r.repo.Renew(context.WithoutCancel(ctx), job.ID, owner, r.now().Add(r.settings.Lease))
+		switch {
+		case errors.Is(err, ports.ErrConflict):
+			cancel(errLeaseLost)
+		case err != nil:
+			log.Printf("[Jobs] renew %s %s: %v", job.Type, job.ID, err)
+		case canceled:
+			cancel(ports.ErrJobCanceled)
+		}
+	}
+}
+
+func (r *JobRunner) backoff(attempt int) time.Duration {
+	delay := r.settings.BaseBackoff
+	for i := 1; i < attempt && delay < r.settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.settings.MaxBackoff)
+}
+
+func (r *JobRunner) requeue(owner string, job *model.Job, at time.Time) {
+	job.Status = model.JobQueued
+	job.RunAt = at
+	job.Owner = ""
+	job.LeaseUntil = time.Time{}
+	r.save(owner, job)
+}
+
+// finish ends the job for good. Its payload, and through its type's
+// OnFinish function anything kept outside it, is dropped, since it may hold
+// secrets such as imported password hashes and won't be needed again.
+func (r *JobRunner) finish(owner string, job *model.Job, status, reason string) {
+	now := r.now()
+	expires := now.Add(r.settings.Retention)
+	job.Status = status
+	if reason != "" {
+		job.Error = reason
+	} else if status != model.JobFailed {
+		job.Error = ""
+	}
+	job.Payload = nil
+	job.Owner = ""
+	job.LeaseUntil = time.Time{}
+	job.FinishedAt = &now
+	job.ExpiresAt = &expires
+	r.save(owner, job)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r.finished(r.jobContext(ctx, job), job)
+}
+
+// finished calls the OnFinish function of the job's type, if any.
+func (r *JobRunner) finished(ctx context.Context, job *model.Job) {
+	r.mu.Lock()
+	fn := r.finishers[job.Type]
+	r.mu.Unlock()
+	if fn == nil {
+		return
+	}
+	if err := fn(ctx, job); err != nil {
+		log.Printf("[Jobs] finish %s %s: %v", job.Type, job.ID, err)
+	}
+}
+
+// save writes the job under the runner's lease. It doesn't use the job's
+// context, which is usually done by now.
+func (r *JobRunner) save(owner string, job *model.Job) {
+	job.UpdatedAt = r.now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.repo.Save(ctx, owner, job); err != nil {
+		log.Printf("[Jobs] save %s %s: %v", job.Type, job.ID, err)
+	}
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockJobRepo keeps jobs in memory with the claim and lease rules of the
+// real stores. Jobs past their ExpiresAt are gone, as with the TTL index.
+type mockJobRepo struct {
+	mu   sync.Mutex
+	jobs map[string]*model.Job
+	seq  int
+}
+
+func newMockJobRepo() *mockJobRepo {
+	return &mockJobRepo{jobs: make(map[string]*model.Job)}
+}
+
+func (m *mockJobRepo) Create(ctx context.Context, job *model.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job.ID == "" {
+		m.seq++
+		job.ID = fmt.Sprintf("job%d", m.seq)
+	}
+	job.TenantID = ports.TenantFrom(ctx)
+	cp := *job
+	m.jobs[job.ID] = &cp
+	return nil
+}
+
+func (m *mockJobRepo) Get(ctx context.Context, id string) (*model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cp := *job
+	return &cp, nil
+}
+
+func (m *mockJobRepo) RequestCancel(ctx context.Context, id string, now, expiresAt time.Time) (*model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case model.JobQueued:
+		job.Status = model.JobCanceled
+		job.CancelRequested = true
+		job.Payload = nil
+		job.FinishedAt = &now
+		job.ExpiresAt = &expiresAt
+		job.UpdatedAt = now
+	case model.JobRunning:
+		job.CancelRequested = true
+		job.UpdatedAt = now
+	}
+	cp := *job
+	return &cp, nil
+}
+
+func (m *mockJobRepo) find(ctx context.Context, id string) (*model.Job, error) {
+	job, ok := m.jobs[id]
+	if !ok || job.TenantID != ports.TenantFrom(ctx) || job.ExpiresAt != nil && !job.ExpiresAt.After(time.Now()) {
+		return nil, ports.ErrNotFound
+	}
+	return job, nil
+}
+
+func (m *mockJobRepo) Claim(ctx context.Context, owner string, types []string, now, leaseUntil time.Time) (*model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *model.Job
+	for _, job := range m.jobs {
+		if !slices.Contains(types, job.Type) {
+			continue
+		}
+		due := job.Status == model.JobQueued && !job.RunAt.After(now) ||
+			job.Status == model.JobRunning && !job.LeaseUntil.After(now)
+		if due && (next == nil || job.RunAt.Before(next.RunAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.Status = model.JobRunning
+	next.Owner = owner
+	next.LeaseUntil = leaseUntil
+	next.Attempts++
+	next.UpdatedAt = now
+	cp := *next
+	return &cp, nil
+}
+
+func (m *mockJobRepo) Renew(ctx context.Context, id, owner string, leaseUntil time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.Owner != owner {
+		return false, ports.ErrConflict
+	}
+	job.LeaseUntil = leaseUntil
+	return job.CancelRequested, nil
+}
+
+func (m *mockJobRepo) Save(ctx context.Context, owner string, job *model.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.jobs[job.ID]
+	if !ok || stored.Owner != owner {
+		return ports.ErrConflict
+	}
+	cp := *job
+	cp.CancelRequested = cp.CancelRequested || stored.CancelRequested
+	m.jobs[job.ID] = &cp
+	return nil
+}
+
+func testJobSettings() JobSettings {
+	return JobSettings{
+		PollInterval: 5 * time.Millisecond,
+		Lease:        100 * time.Millisecond,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	}
+}
+
+// waitForJob polls until the job is in one of statuses.
+func waitForJob(t *testing.T, jobs ports.JobService, id string, statuses ...string) *model.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobs.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("job: %v", err)
+		}
+		for _, s := range statuses {
+			if job.Status == s {
+				return job
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatalf("job %s never got to %v", id, statuses)
+	return nil
+}
+
+func TestJobRunnerRetries(t *testing.T) {
+	runner := NewJobRunner(newMockJobRepo(), testJobSettings())
+	runner.Handle("flaky", func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+		if job.Attempts == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	runner.Handle("broken", func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+		return errors.New("boom")
+	})
+	runner.Handle("panics", func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+		panic("oops")
+	})
+	runner.Start()
+	defer runner.Shutdown(context.Background())
+	ctx := context.Background()
+
+	flaky := &model.Job{Type: "flaky", Payload: []byte(`{}`)}
+	broken := &model.Job{Type: "broken"}
+	panics := &model.Job{Type: "panics"}
+	for _, job := range []*model.Job{flaky, broken, panics} {
+		if err := runner.Enqueue(ctx, job); err != nil || job.ID == "" || job.Status != model.JobQueued {
+			t.Fatalf("enqueue: %+v %v", job, err)
+		}
+	}
+
+	job := waitForJob(t, runner, flaky.ID, model.JobSucceeded, model.JobFailed)
+	if job.Status != model.JobSucceeded || job.Attempts != 2 || job.Error != "" || job.FinishedAt == nil || job.Payload != nil {
+		t.Fatalf("flaky job = %+v", job)
+	}
+	job = waitForJob(t, runner, broken.ID, model.JobSucceeded, model.JobFailed)
+	if job.Status != model.JobFailed || job.Attempts != 3 || job.Error != "boom" {
+		t.Fatalf("broken job = %+v", job)
+	}
+	job = waitForJob(t, runner, panics.ID, model.JobSucceeded, model.JobFailed)
+	if job.Status != model.JobFailed || job.Error != "panic: oops" {
+		t.Fatalf("panicking job = %+v", job)
+	}
+}
+
+func TestJobRunnerBackoff(t *testing.T) {
+	runner := NewJobRunner(nil, JobSettings{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for attempt, want := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if want == 0 {
+			continue
+		}
+		if got := runner.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestJobRunnerCancel(t *testing.T) {
+	runner := NewJobRunner(newMockJobRepo(), testJobSettings())
+	runner.Handle("loop", func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+		for {
+			job.Progress.Done++
+			if err := checkpoint(); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	finished := make(chan string, 2)
+	runner.OnFinish("loop", func(ctx context.Context, job *model.Job) error {
+		finished <- job.ID
+		return nil
+	})
+	ctx := context.Background()
+
+	queued := &model.Job{Type: "loop", Payload: []byte(`{"secret":true}`)}
+	runner.Enqueue(ctx, queued)
+	job, err := runner.Cancel(ctx, queued.ID)
+	if err != nil || job.Status != model.JobCanceled || job.Payload != nil {
+		t.Fatalf("cancel queued job: %+v %v", job, err)
+	}
+	if id := <-finished; id != queued.ID {
+		t.Fatalf("finished %q, want the queued job", id)
+	}
+
+	runner.Start()
+	defer runner.Shutdown(context.Background())
+	running := &model.Job{Type: "loop"}
+	runner.Enqueue(ctx, running)
+	waitForJob(t, runner, running.ID, model.JobRunning)
+	if _, err := runner.Cancel(ctx, running.ID); err != nil {
+		t.Fatalf("cancel running job: %v", err)
+	}
+	job = waitForJob(t, runner, running.ID, model.JobCanceled, model.JobFailed, model.JobSucceeded)
+	if job.Status != model.JobCanceled || job.Progress.Done == 0 {
+		t.Fatalf("canceled job = %+v", job)
+	}
+	select {
+	case id := <-finished:
+		if id != running.ID {
+			t.Fatalf("finished %q, want the running job", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnFinish was not called for the canceled running job")
+	}
+	if _, err := runner.Cancel(ctx, running.ID); err != nil {
+		t.Fatalf("cancel canceled job: %v", err)
+	}
+
+	runner.Handle("quick", func(context.Context, *model.Job, func() error) error { return nil })
+	quick := &model.Job{Type: "quick"}
+	runner.Enqueue(ctx, quick)
+	waitForJob(t, runner, quick.ID, model.JobSucceeded)
+	if _, err := runner.Cancel(ctx, quick.ID); !errors.Is(err, ports.ErrConflict) {
+		t.Fatalf("cancel finished job: %v", err)
+	}
+}
+
+func TestJobRunnerShutdownResumes(t *testing.T) {
+	repo := newMockJobRepo()
+	// count runs until ctx is done, from where the last run stopped.
+	count := func(starts chan<- int) ports.JobFunc {
+		return func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+			starts <- job.Progress.Done
+			for job.Progress.Done < job.Progress.Total {
+				if ctx.Err() != nil {
+					return context.Cause(ctx)
+				}
+				job.Progress.Done++
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		}
+	}
+	ctx := context.Background()
+
+	first := NewJobRunner(repo, testJobSettings())
+	starts := make(chan int, 1)
+	first.Handle("count", count(starts))
+	first.Start()
+	job := &model.Job{Type: "count", Progress: model.JobProgress{Total: 1000}}
+	first.Enqueue(ctx, job)
+	<-starts
+	time.Sleep(20 * time.Millisecond)
+	if err := first.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	stopped, _ := first.Get(ctx, job.ID)
+	if stopped.Status != model.JobQueued || stopped.Attempts != 0 || stopped.Progress.Done == 0 || stopped.Owner != "" {
+		t.Fatalf("job after shutdown = %+v", stopped)
+	}
+
+	second := NewJobRunner(repo, testJobSettings())
+	starts = make(chan int, 1)
+	second.Handle("count", count(starts))
+	second.Start()
+	defer second.Shutdown(context.Background())
+	if from := <-starts; from != stopped.Progress.Done {
+		t.Fatalf("resumed from %d, want %d", from, stopped.Progress.Done)
+	}
+	done := waitForJob(t, second, job.ID, model.JobSucceeded, model.JobFailed)
+	if done.Status != model.JobSucceeded || done.Progress.Done != 1000 || done.Attempts != 1 {
+		t.Fatalf("resumed job = %+v", done)
+	}
+}
+
+func TestJobRunnerTakesOverExpiredLease(t *testing.T) {
+	repo := newMockJobRepo()
+	ctx := context.Background()
+	runner := NewJobRunner(repo, testJobSettings())
+	job := &model.Job{Type: "work"}
+	runner.Enqueue(ctx, job)
+	// A worker that died right after claiming the job.
+	now := time.Now()
+	if claimed, err := repo.Claim(ctx, "dead", []string{"work"}, now, now.Add(10*time.Millisecond)); err != nil || claimed == nil {
+		t.Fatalf("claim: %+v %v", claimed, err)
+	}
+
+	runner.Handle("work", func(context.Context, *model.Job, func() error) error { return nil })
+	runner.Start()
+	defer runner.Shutdown(context.Background())
+	done := waitForJob(t, runner, job.ID, model.JobSucceeded, model.JobFailed)
+	if done.Status != model.JobSucceeded || done.Attempts != 2 {
+		t.Fatalf("taken over job = %+v", done)
+	}
+}
+
+func TestJobRunnerLimits(t *testing.T) {
+	settings := testJobSettings()
+	settings.Limits = map[string]int{"slow": 1}
+	runner := NewJobRunner(newMockJobRepo(), settings)
+	var mu sync.Mutex
+	running, most := 0, 0
+	runner.Handle("slow", func(ctx context.Context, job *model.Job, checkpoint func() error) error {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	ctx := context.Background()
+	var jobs []*model.Job
+	for range 3 {
+		job := &model.Job{Type: "slow"}
+		runner.Enqueue(ctx, job)
+		jobs = append(jobs, job)
+	}
+	runner.Start()
+	defer runner.Shutdown(context.Background())
+	for _, job := range jobs {
+		waitForJob(t, runner, job.ID, model.JobSucceeded)
+	}
+	if most != 1 {
+		t.Fatalf("%d slow jobs ran at once, limit is 1", most)
+	}
+}
+
+func TestJobVisibility(t *testing.T) {
+	runner := NewJobRunner(newMockJobRepo(), testJobSettings())
+	owner := &model.Principal{Type: model.PrincipalUser, UserID: "u1", Role: model.RoleUser}
+	ctx := ports.WithPrincipal(context.Background(), owner)
+	job := &model.Job{Type: "work"}
+	if err := runner.Enqueue(ctx, job); err != nil || job.CreatedBy != "u1" || job.Origin.Principal != owner {
+		t.Fatalf("enqueue: %+v %v", job, err)
+	}
+
+	other := ports.WithPrincipal(context.Background(), &model.Principal{Type: model.PrincipalUser, UserID: "u2", Role: model.RoleUser})
+	admin := ports.WithPrincipal(context.Background(), &model.Principal{Type: model.PrincipalUser, UserID: "a1", Role: model.RoleAdmin})
+	if _, err := runner.Get(ctx, job.ID); err != nil {
+		t.Fatalf("creator can't see job: %v", err)
+	}
+	if _, err := runner.Get(admin, job.ID); err != nil {
+		t.Fatalf("admin can't see job: %v", err)
+	}
+	if _, err := runner.Get(other, job.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Fatalf("other user sees job: %v", err)
+	}
+	if _, err := runner.Cancel(other, job.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Fatalf("other user canceled job: %v", err)
+	}
+	if _, err := runner.Get(ports.WithTenant(admin, "other"), job.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Fatalf("job visible in another tenant: %v", err)
+	}
+}
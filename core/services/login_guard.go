@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"time"
+)
+
+type LoginGuardPolicy struct {
+	MaxFailures   int           // failures per account before it is locked
+	MaxIPFailures int           // failures per client IP before it is locked
+	BaseDelay     time.Duration // backoff after the first failure, doubled for each further one
+	MaxDelay      time.Duration
+	Lockout       time.Duration // how long a lock lasts; also the window after which failures are forgotten
+}
+
+type loginGuard struct {
+	store  ports.LoginAttemptStore
+	policy LoginGuardPolicy
+	audit  ports.AuditLog
+	now    func() time.Time
+}
+
+// NewLoginGuard records every lock and unlock of a key in audit.
+func NewLoginGuard(store ports.LoginAttemptStore, policy LoginGuardPolicy, audit ports.AuditLog) ports.LoginGuard {
+	return &loginGuard{
+		store:  store,
+		policy: policy,
+		audit:  audit,
+		now:    time.Now,
+	}
+}
+
+// emailKey is per tenant, as the same address may have an account in each.
+func emailKey(ctx context.Context, email string) string {
+	return "email:" + ports.TenantFrom(ctx) + ":" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (g *loginGuard) keys(ctx context.Context, email, ip string) map[string]int {
+	keys := map[string]int{emailKey(ctx, email): g.policy.MaxFailures}
+	if ip != "" {
+		keys[ipKey(ip)] = g.policy.MaxIPFailures
+	}
+	return keys
+}
+
+// Check refuses the attempt while any key is locked or still inside its backoff window.
+func (g *loginGuard) Check(ctx context.Context, email, ip string) error {
+	now := g.now()
+	var wait time.Duration
+	for key := range g.keys(ctx, email, ip) {
+		a, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			continue
+		}
+		if d := a.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+		if a.Failures > 0 && !g.expired(a, now) {
+			if d := a.LastFailure.Add(g.delay(a.Failures)).Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return &ports.ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Failure counts a failed login against each key, forgetting failures older
+// than the lockout, and locks the keys that reach their limit.
+func (g *loginGuard) Failure(ctx context.Context, email, ip string) error {
+	now := g.now()
+	var forgetBefore time.Time
+	if g.policy.Lockout > 0 {
+		forgetBefore = now.Add(-g.policy.Lockout)
+	}
+	for key, limit := range g.keys(ctx, email, ip) {
+		a, err := g.store.RecordFailure(ctx, key, now, forgetBefore)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && a.Failures >= limit {
+			until := now.Add(g.policy.Lockout)
+			if err := g.store.Lock(ctx, key, until); err != nil {
+				return err
+			}
+			recordAudit(ctx, g.audit, &model.AuditEvent{
+				Action:   model.AuditLockout,
+				TargetID: key,
+				Details:  map[string]string{"until": until.Format(time.RFC3339)},
+			})
+		}
+	}
+	return nil
+}
+
+// Success clears the account counter only. The IP counter is left alone so an
+// attacker cannot reset it by interleaving logins to an account they own.
+func (g *loginGuard) Success(ctx context.Context, email, ip string) error {
+	return g.store.Reset(ctx, emailKey(ctx, email))
+}
+
+// Unlock clears the account and, if given, the IP. IPs are not cleared along
+// with the account as their failures may come from guessing at many
+// accounts; the admin names the user's IP to let them back in from it.
+func (g *loginGuard) Unlock(ctx context.Context, email, ip string) error {
+	keys := []string{emailKey(ctx, email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return err
+		}
+		recordAudit(ctx, g.audit, &model.AuditEvent{Action: model.AuditUnlock, TargetID: key})
+	}
+	return nil
+}
+
+func (g *loginGuard) delay(failures int) time.Duration {
+	d := g.policy.BaseDelay
+	for i := 1; i < failures && d < g.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if g.policy.MaxDelay > 0 && d > g.policy.MaxDelay {
+		d = g.policy.MaxDelay
+	}
+	return d
+}
+
+func (g *loginGuard) expired(a *model.LoginAttempt, now time.Time) bool {
+	return g.policy.Lockout > 0 && now.Sub(a.LastFailure) > g.policy.Lockout && !now.Before(a.LockedUntil)
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+)
+
+type mockLoginAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]*model.LoginAttempt
+}
+
+func newMockLoginAttempts() *mockLoginAttempts {
+	return &mockLoginAttempts{attempts: make(map[string]*model.LoginAttempt)}
+}
+
+func (m *mockLoginAttempts) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (m *mockLoginAttempts) RecordFailure(ctx context.Context, key string, at, forgetBefore time.Time) (*model.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a, ok := m.attempts[key]; ok && a.LastFailure.Before(forgetBefore) && !a.LockedUntil.After(at) {
+		delete(m.attempts, key)
+	}
+	a := m.attempt(key)
+	a.Failures++
+	a.LastFailure = at
+	cp := *a
+	return &cp, nil
+}
+
+func (m *mockLoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.attempt(key)
+	a.LockedUntil = until
+	a.Failures = 0
+	return nil
+}
+
+func (m *mockLoginAttempts) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *mockLoginAttempts) attempt(key string) *model.LoginAttempt {
+	a, ok := m.attempts[key]
+	if !ok {
+		a = &model.LoginAttempt{Key: key}
+		m.attempts[key] = a
+	}
+	return a
+}
+
+func newTestGuard(sink *mockAuditSink) (*loginGuard, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewLoginGuard(newMockLoginAttempts(), LoginGuardPolicy{
+		MaxFailures:   3,
+		MaxIPFailures: 10,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+		Lockout:       15 * time.Minute,
+	}, NewAuditLog(sink, nil)).(*loginGuard)
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	sink := &mockAuditSink{}
+	g, now := newTestGuard(sink)
+
+	if err := g.Check(ctx, "alice@example.com", "1.2.3.4"); err != nil {
+		t.Fatalf("expected first attempt to be allowed: %v", err)
+	}
+
+	g.Failure(ctx, "alice@example.com", "1.2.3.4")
+	var throttled *ports.ThrottledError
+	if err := g.Check(ctx, "alice@example.com", "1.2.3.4"); !errors.As(err, &throttled) || throttled.RetryAfter != time.Second {
+		t.Fatalf("expected 1s backoff, got %v", err)
+	}
+
+	*now = now.Add(time.Second)
+	g.Failure(ctx, "alice@example.com", "1.2.3.4")
+	if err := g.Check(ctx, "alice@example.com", "1.2.3.4"); !errors.As(err, &throttled) || throttled.RetryAfter != 2*time.Second {
+		t.Fatalf("expected 2s backoff, got %v", err)
+	}
+
+	*now = now.Add(2 * time.Second)
+	g.Failure(ctx, "alice@example.com", "1.2.3.4")
+	if len(sink.events) != 1 || sink.events[0].Action != model.AuditLockout {
+		t.Fatalf("expected a lockout event, got %+v", sink.events)
+	}
+	if err := g.Check(ctx, "ALICE@example.com", "5.6.7.8"); !errors.As(err, &throttled) || throttled.RetryAfter != 15*time.Minute {
+		t.Fatalf("expected account lock from another IP, got %v", err)
+	}
+
+	*now = now.Add(15 * time.Minute)
+	if err := g.Check(ctx, "alice@example.com", "5.6.7.8"); err != nil {
+		t.Fatalf("expected lock to expire: %v", err)
+	}
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	ctx := context.Background()
+	sink := &mockAuditSink{}
+	g, _ := newTestGuard(sink)
+
+	for i := 0; i < 3; i++ {
+		g.Failure(ctx, "bob@example.com", "")
+	}
+	for i := 0; i < 10; i++ {
+		g.Failure(ctx, fmt.Sprintf("user%d@example.com", i), "1.2.3.4")
+	}
+	if err := g.Check(ctx, "bob@example.com", ""); err == nil {
+		t.Fatal("expected account to be locked")
+	}
+
+	if err := g.Unlock(ctx, "bob@example.com", ""); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if err := g.Check(ctx, "bob@example.com", ""); err != nil {
+		t.Fatalf("expected account to be unlocked: %v", err)
+	}
+	if err := g.Check(ctx, "bob@example.com", "1.2.3.4"); err == nil {
+		t.Fatal("expected the IP to stay locked")
+	}
+	if err := g.Unlock(ctx, "bob@example.com", "1.2.3.4"); err != nil {
+		t.Fatalf("unlock with IP failed: %v", err)
+	}
+	if err := g.Check(ctx, "bob@example.com", "1.2.3.4"); err != nil {
+		t.Fatalf("expected account and IP to be unlocked: %v", err)
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.Action != model.AuditUnlock || last.TargetID != "ip:1.2.3.4" {
+		t.Fatalf("expected an unlock event for the IP, got %+v", last)
+	}
+}
+
+func TestLoginGuardConcurrentFailures(t *testing.T) {
+	ctx := context.Background()
+	sink := &mockAuditSink{}
+	g, _ := newTestGuard(sink)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Failure(ctx, "dan@example.com", "")
+		}()
+	}
+	wg.Wait()
+	var throttled *ports.ThrottledError
+	if err := g.Check(ctx, "dan@example.com", ""); !errors.As(err, &throttled) || throttled.RetryAfter != 15*time.Minute {
+		t.Fatalf("expected concurrent failures to lock the account, got %v", err)
+	}
+}
+
+func TestLoginLockedAccountIsRejected(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	g, _ := newTestGuard(&mockAuditSink{})
+	svc := NewUserService(repo, mockHasher{}, "secret", WithLoginGuard(g))
+
+	if _, err := svc.Register(ctx, "Carol", "carol@example.com", "password", nil); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, err := svc.Login(ctx, "carol@example.com", "wrong", ports.ClientInfo{IP: "1.2.3.4"}); !errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	var throttled *ports.ThrottledError
+	if _, err := svc.Login(ctx, "carol@example.com", "password", ports.ClientInfo{IP: "1.2.3.4"}); !errors.As(err, &throttled) {
+		t.Fatalf("expected login inside backoff window to be throttled, got %v", err)
+	}
+}
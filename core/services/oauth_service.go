@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var defaultClientScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// supportedScopes are the scopes a client may be registered with: the OIDC
+// identity scopes plus the API scopes, which service clients use. Admin
+// routes are never open to clients.
+var supportedScopes = append(slices.Clone(defaultClientScopes), model.ScopeUsersRead, model.ScopeUsersWrite, model.ScopeSCIM)
+
+var supportedGrants = []string{model.GrantAuthorizationCode, model.GrantClientCredentials}
+
+const consentTicketPurpose = "oauth_consent"
+
+// consentTicketTTL bounds how long a user may take on the consent page.
+const consentTicketTTL = 10 * time.Minute
+
+var (
+	errUnknownClient   = errors.New("unknown client")
+	errInvalidRedirect = errors.New("redirect_uri is not registered for this client")
+)
+
+type OAuthSettings struct {
+	Issuer         string
+	AccessTokenTTL time.Duration
+	IDTokenTTL     time.Duration
+	CodeTTL        time.Duration
+}
+
+type oauthService struct {
+	clients   ports.OAuthClientRepository
+	codes     ports.AuthorizationCodeRepository
+	consents  ports.ConsentRepository
+	users     ports.UserRepository
+	signer    ports.TokenSigner
+	jwtSecret []byte
+	settings  OAuthSettings
+	audit     ports.AuditLog
+	now       func() time.Time
+}
+
+func NewOAuthService(
+	clients ports.OAuthClientRepository,
+	codes ports.AuthorizationCodeRepository,
+	consents ports.ConsentRepository,
+	users ports.UserRepository,
+	signer ports.TokenSigner,
+	secret string,
+	settings OAuthSettings,
+	audit ports.AuditLog,
+) ports.OAuthService {
+	settings.Issuer = strings.TrimSuffix(settings.Issuer, "/")
+	return &oauthService{
+		clients:   clients,
+		codes:     codes,
+		consents:  consents,
+		users:     users,
+		signer:    signer,
+		jwtSecret: []byte(secret),
+		settings:  settings,
+		audit:     audit,
+		now:       time.Now,
+	}
+}
+
+// RegisterClient stores a new client and returns its secret in clear. Public
+// clients get no secret.
+func (s *oauthService) RegisterClient(ctx context.Context, client *model.OAuthClient) (*model.OAuthClient, string, error) {
+	id, err := randomString(12)
+	if err != nil {
+		return nil, "", err
+	}
+	client.ID = id
+	client.CreatedAt = s.now()
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{model.GrantAuthorizationCode}
+	}
+	if len(client.Scopes) == 0 {
+		client.Scopes = defaultClientScopes
+	}
+	if err := validateClient(client); err != nil {
+		return nil, "", err
+	}
+
+	var secret string
+	if !client.Public {
+		if secret, err = randomString(32); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.clients.Create(ctx, client); err != nil {
+		return nil, "", err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOAuthClientRegister,
+		TargetType: "oauth_client",
+		TargetID:   client.ID,
+		Changes:    changes(nil, client),
+	})
+	return client, secret, nil
+}
+
+func validateClient(client *model.OAuthClient) error {
+	for _, grant := range client.GrantTypes {
+		if !slices.Contains(supportedGrants, grant) {
+			return &ports.OAuthError{Code: "invalid_client_metadata", Description: "unsupported grant type " + grant}
+		}
+	}
+	for _, scope := range client.Scopes {
+		if !slices.Contains(supportedScopes, scope) {
+			return &ports.OAuthError{Code: "invalid_client_metadata", Description: "unsupported scope " + scope}
+		}
+	}
+	if client.Public && client.AllowsGrant(model.GrantClientCredentials) {
+		return &ports.OAuthError{Code: "invalid_client_metadata", Description: "public clients cannot use client_credentials"}
+	}
+	if client.AllowsGrant(model.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return &ports.OAuthError{Code: "invalid_redirect_uri", Description: "authorization_code clients need a redirect URI"}
+	}
+	return nil
+}
+
+func (s *oauthService) ListClients(ctx context.Context) ([]*model.OAuthClient, error) {
+	return s.clients.List(ctx)
+}
+
+func (s *oauthService) DeleteClient(ctx context.Context, id string) error {
+	if err := s.clients.Delete(ctx, id); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{Action: model.AuditOAuthClientDelete, TargetType: "oauth_client", TargetID: id})
+	return nil
+}
+
+func (s *oauthService) ValidateAuthorize(ctx context.Context, req *ports.AuthorizeRequest) (*model.OAuthClient, error) {
+	client, err := s.clients.GetByID(ctx, req.ClientID)
+	if err != nil {
+		return nil, errUnknownClient
+	}
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return nil, errInvalidRedirect
+	}
+
+	// From here on errors are reported to the client via the redirect URI.
+	if req.ResponseType != "code" {
+		return nil, &ports.OAuthError{Code: "unsupported_response_type", Description: "only response_type=code is supported"}
+	}
+	if !client.AllowsGrant(model.GrantAuthorizationCode) {
+		return nil, &ports.OAuthError{Code: "unauthorized_client"}
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = client.Scopes
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, &ports.OAuthError{Code: "invalid_scope", Description: scope}
+		}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, &ports.OAuthError{Code: "invalid_request", Description: "PKCE with code_challenge_method=S256 is required"}
+	}
+	return client, nil
+}
+
+// SignIn skips the consent page when the stored consent covers the scopes.
+func (s *oauthService) SignIn(ctx context.Context, user *model.User, req *ports.AuthorizeRequest) (string, string, error) {
+	consent, err := s.consents.Get(ctx, user.ID, req.ClientID)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return "", "", err
+	}
+	if consent != nil && !slices.ContainsFunc(req.Scopes, func(scope string) bool { return !slices.Contains(consent.Scopes, scope) }) {
+		code, err := s.IssueCode(ctx, user, req)
+		return code, "", err
+	}
+	ticket, err := signPurposeToken(s.jwtSecret, consentTicketPurpose, jwt.MapClaims{
+		"sub":       user.ID,
+		"tenant_id": ports.TenantFrom(ctx),
+		"req":       authorizeRequestHash(req),
+		"exp":       s.now().Add(consentTicketTTL).Unix(),
+	})
+	return "", ticket, err
+}
+
+func (s *oauthService) Consent(ctx context.Context, ticket string, req *ports.AuthorizeRequest) (string, error) {
+	claims, err := parsePurposeToken(s.jwtSecret, consentTicketPurpose, ticket)
+	if err != nil {
+		return "", err
+	}
+	if claims["tenant_id"] != ports.TenantFrom(ctx) || claims["req"] != authorizeRequestHash(req) {
+		return "", ports.ErrInvalidToken
+	}
+	userID, _ := claims["sub"].(string)
+	user, err := s.users.GetByID(ctx, userID)
+	if errors.Is(err, ports.ErrNotFound) {
+		return "", ports.ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Disabled {
+		return "", ports.ErrInvalidToken
+	}
+	return s.IssueCode(ctx, user, req)
+}
+
+// authorizeRequestHash binds a consent ticket to the request it was issued
+// for, so it can't be used to consent to other scopes or another client.
+func authorizeRequestHash(req *ports.AuthorizeRequest) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		req.ClientID, req.RedirectURI, strings.Join(req.Scopes, " "), req.Nonce, req.CodeChallenge,
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *oauthService) IssueCode(ctx context.Context, user *model.User, req *ports.AuthorizeRequest) (string, error) {
+	now := s.now()
+	consent := &model.Consent{UserID: user.ID, ClientID: req.ClientID, Scopes: req.Scopes, GrantedAt: now}
+	if existing, err := s.consents.Get(ctx, user.ID, req.ClientID); err == nil {
+		for _, scope := range existing.Scopes {
+			if !slices.Contains(consent.Scopes, scope) {
+				consent.Scopes = append(consent.Scopes, scope)
+			}
+		}
+	}
+	if err := s.consents.Save(ctx, consent); err != nil {
+		return "", err
+	}
+
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.codes.Save(ctx, &model.AuthorizationCode{
+		CodeHash:      hashSecret(code),
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.settings.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (s *oauthService) Token(ctx context.Context, req *ports.TokenRequest) (*ports.TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, &ports.OAuthError{Code: "unauthorized_client"}
+	}
+
+	switch req.GrantType {
+	case model.GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case model.GrantClientCredentials:
+		return s.clientCredentials(client, req)
+	default:
+		return nil, &ports.OAuthError{Code: "unsupported_grant_type"}
+	}
+}
+
+func (s *oauthService) authenticateClient(ctx context.Context, id, secret string) (*model.OAuthClient, error) {
+	client, err := s.clients.GetByID(ctx, id)
+	if err != nil {
+		return nil, &ports.OAuthError{Code: "invalid_client"}
+	}
+	if client.Public {
+		if secret != "" {
+			return nil, &ports.OAuthError{Code: "invalid_client"}
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashSecret(secret))) != 1 {
+		return nil, &ports.OAuthError{Code: "invalid_client"}
+	}
+	return client, nil
+}
+
+func (s *oauthService) exchangeCode(ctx context.Context, client *model.OAuthClient, req *ports.TokenRequest) (*ports.TokenResponse, error) {
+	invalidGrant := &ports.OAuthError{Code: "invalid_grant"}
+
+	code, err := s.codes.Consume(ctx, hashSecret(req.Code))
+	if err != nil {
+		return nil, invalidGrant
+	}
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI || s.now().After(code.ExpiresAt) {
+		return nil, invalidGrant
+	}
+	if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return nil, &ports.OAuthError{Code: "invalid_grant", Description: "code_verifier does not match"}
+	}
+
+	user, err := s.users.GetByID(ctx, code.UserID)
+	if err != nil || user.Disabled {
+		return nil, invalidGrant
+	}
+
+	scope := strings.Join(code.Scopes, " ")
+	access, err := signOAuthToken(s.jwtSecret, user, client, scope, s.settings.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ports.TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.settings.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	if slices.Contains(code.Scopes, ScopeOpenID) {
+		now := s.now()
+		claims := s.profileClaims(user, code.Scopes)
+		claims["iss"] = s.settings.Issuer
+		claims["aud"] = client.ID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(s.settings.IDTokenTTL).Unix()
+		claims["auth_time"] = code.AuthTime.Unix()
+		if code.Nonce != "" {
+			claims["nonce"] = code.Nonce
+		}
+		if resp.IDToken, err = s.signer.Sign(claims); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// clientCredentials issues a token for the client itself. The requested scope
+// must be a subset of the client's registered scopes and defaults to all of them.
+func (s *oauthService) clientCredentials(client *model.OAuthClient, req *ports.TokenRequest) (*ports.TokenResponse, error) {
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, &ports.OAuthError{Code: "invalid_scope", Description: scope}
+		}
+	}
+
+	scope := strings.Join(scopes, " ")
+	access, err := signServiceToken(s.jwtSecret, client, scope, s.settings.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &ports.TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.settings.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func (s *oauthService) UserInfo(ctx context.Context, userID string, scopes []string) (map[string]interface{}, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if scopes == nil {
+		scopes = defaultClientScopes
+	}
+	return s.profileClaims(user, scopes), nil
+}
+
+func (s *oauthService) profileClaims(user *model.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = user.Name
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+	}
+	return claims
+}
+
+func (s *oauthService) Discovery() map[string]interface{} {
+	iss := s.settings.Issuer
+	return map[string]interface{}{
+		"issuer":                                iss,
+		"authorization_endpoint":                iss + "/oauth/authorize",
+		"token_endpoint":                        iss + "/oauth/token",
+		"userinfo_endpoint":                     iss + "/oauth/userinfo",
+		"jwks_uri":                              iss + "/oauth/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 supportedGrants,
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      defaultClientScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "name", "email"},
+	}
+}
+
+func (s *oauthService) JWKS() map[string]interface{} {
+	return s.signer.JWKS()
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
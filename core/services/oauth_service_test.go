@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type mockOAuthStore struct {
+	clients  map[string]*model.OAuthClient
+	codes    map[string]*model.AuthorizationCode
+	consents map[string]*model.Consent
+}
+
+func newMockOAuthStore() *mockOAuthStore {
+	return &mockOAuthStore{
+		clients:  make(map[string]*model.OAuthClient),
+		codes:    make(map[string]*model.AuthorizationCode),
+		consents: make(map[string]*model.Consent),
+	}
+}
+
+type mockClients struct{ *mockOAuthStore }
+
+func (m mockClients) Create(ctx context.Context, c *model.OAuthClient) error {
+	m.clients[c.ID] = c
+	return nil
+}
+
+func (m mockClients) GetByID(ctx context.Context, id string) (*model.OAuthClient, error) {
+	if c, ok := m.clients[id]; ok {
+		return c, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m mockClients) List(ctx context.Context) ([]*model.OAuthClient, error) {
+	var res []*model.OAuthClient
+	for _, c := range m.clients {
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (m mockClients) Delete(ctx context.Context, id string) error {
+	delete(m.clients, id)
+	return nil
+}
+
+type mockCodes struct{ *mockOAuthStore }
+
+func (m mockCodes) Save(ctx context.Context, c *model.AuthorizationCode) error {
+	m.codes[c.CodeHash] = c
+	return nil
+}
+
+func (m mockCodes) Consume(ctx context.Context, hash string) (*model.AuthorizationCode, error) {
+	c, ok := m.codes[hash]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	delete(m.codes, hash)
+	return c, nil
+}
+
+type mockConsents struct{ *mockOAuthStore }
+
+func (m mockConsents) Get(ctx context.Context, userID, clientID string) (*model.Consent, error) {
+	if c, ok := m.consents[userID+"/"+clientID]; ok {
+		return c, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m mockConsents) Save(ctx context.Context, c *model.Consent) error {
+	m.consents[c.UserID+"/"+c.ClientID] = c
+	return nil
+}
+
+// mockSigner signs with HMAC instead of the RSA key of the real signer;
+// the services only need tokens they can verify again.
+type mockSigner struct {
+	key []byte
+}
+
+func (m mockSigner) Sign(claims map[string]interface{}) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claims)).SignedString(m.key)
+}
+
+func (m mockSigner) JWKS() map[string]interface{} {
+	return map[string]interface{}{"keys": []interface{}{}}
+}
+
+func (m mockSigner) Verify(token string) (map[string]interface{}, error) {
+	parsed, err := jwt.Parse(token, m.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Claims.(jwt.MapClaims), nil
+}
+
+func (m mockSigner) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	return m.key, nil
+}
+
+func newTestOAuthService(t *testing.T, users ports.UserRepository) (ports.OAuthService, *mockOAuthStore, *jwt.Parser, func(*jwt.Token) (interface{}, error)) {
+	t.Helper()
+	signer := mockSigner{key: []byte("signing key")}
+	store := newMockOAuthStore()
+	svc := NewOAuthService(mockClients{store}, mockCodes{store}, mockConsents{store}, users, signer, "secret", OAuthSettings{
+		Issuer:         "https://id.example.com",
+		AccessTokenTTL: time.Hour,
+		IDTokenTTL:     time.Hour,
+		CodeTTL:        time.Minute,
+	}, nil)
+	return svc, store, &jwt.Parser{}, signer.keyFunc
+}
+
+func pkcePair() (verifier, challenge string) {
+	verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	user := &model.User{Name: "Alice", Email: "alice@example.com", Role: model.RoleUser}
+	users.Create(ctx, user)
+
+	svc, store, parser, keyFunc := newTestOAuthService(t, users)
+	client, secret, err := svc.RegisterClient(ctx, &model.OAuthClient{Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/cb"}})
+	if err != nil || secret == "" {
+		t.Fatalf("register client failed: %v", err)
+	}
+
+	verifier, challenge := pkcePair()
+	req := &ports.AuthorizeRequest{
+		ClientID:            client.ID,
+		RedirectURI:         "https://wiki.example.com/cb",
+		ResponseType:        "code",
+		Scopes:              []string{"openid", "email"},
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+	if _, err := svc.ValidateAuthorize(ctx, req); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	code, err := svc.IssueCode(ctx, user, req)
+	if err != nil {
+		t.Fatalf("issue code failed: %v", err)
+	}
+	if c := store.consents[user.ID+"/"+client.ID]; c == nil || len(c.Scopes) != 2 {
+		t.Fatalf("expected consent to be recorded, got %+v", c)
+	}
+
+	tokenReq := &ports.TokenRequest{
+		GrantType:    model.GrantAuthorizationCode,
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  "https://wiki.example.com/cb",
+		CodeVerifier: verifier,
+	}
+	resp, err := svc.Token(ctx, tokenReq)
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+
+	access, _ := jwt.Parse(resp.AccessToken, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	if claims := access.Claims.(jwt.MapClaims); claims["typ"] != model.OAuthTokenType || claims["aud"] != client.ID || claims["role"] != nil {
+		t.Fatalf("unexpected access token claims: %v", claims)
+	}
+
+	idToken, err := parser.Parse(resp.IDToken, keyFunc)
+	if err != nil || !idToken.Valid {
+		t.Fatalf("invalid id token: %v", err)
+	}
+	claims := idToken.Claims.(jwt.MapClaims)
+	if claims["sub"] != user.ID || claims["aud"] != client.ID || claims["iss"] != "https://id.example.com" ||
+		claims["nonce"] != "n-0S6_WzA2Mj" || claims["email"] != user.Email || claims["name"] != nil {
+		t.Fatalf("unexpected id token claims: %v", claims)
+	}
+
+	var oauthErr *ports.OAuthError
+	if _, err := svc.Token(ctx, tokenReq); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected code reuse to fail with invalid_grant, got %v", err)
+	}
+}
+
+func TestSignInAsksForConsentOnce(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	user := &model.User{Name: "Alice", Email: "alice@example.com", Role: model.RoleUser}
+	users.Create(ctx, user)
+
+	svc, store, _, _ := newTestOAuthService(t, users)
+	client, _, _ := svc.RegisterClient(ctx, &model.OAuthClient{Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/cb"}})
+	_, challenge := pkcePair()
+	req := &ports.AuthorizeRequest{
+		ClientID:            client.ID,
+		RedirectURI:         "https://wiki.example.com/cb",
+		Scopes:              []string{"openid"},
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	code, ticket, err := svc.SignIn(ctx, user, req)
+	if err != nil || code != "" || ticket == "" {
+		t.Fatalf("first sign-in = %q, %q, %v; want a consent ticket", code, ticket, err)
+	}
+	if len(store.consents) != 0 {
+		t.Fatalf("consent recorded before it was given: %+v", store.consents)
+	}
+	other := *req
+	other.Scopes = []string{"openid", "email"}
+	if _, err := svc.Consent(ctx, ticket, &other); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Fatalf("ticket used for other scopes: %v", err)
+	}
+	if code, err := svc.Consent(ctx, ticket, req); err != nil || code == "" {
+		t.Fatalf("consent = %q, %v", code, err)
+	}
+
+	if code, ticket, err := svc.SignIn(ctx, user, req); err != nil || code == "" || ticket != "" {
+		t.Fatalf("sign-in after consent = %q, %q, %v; want a code", code, ticket, err)
+	}
+	// A scope not consented to yet asks again.
+	if code, ticket, _ := svc.SignIn(ctx, user, &other); code != "" || ticket == "" {
+		t.Fatalf("sign-in for a new scope = %q, %q; want a consent ticket", code, ticket)
+	}
+}
+
+func TestDisabledUserCannotExchangeCode(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	user := &model.User{Name: "Alice", Email: "alice@example.com", Role: model.RoleUser}
+	users.Create(ctx, user)
+
+	svc, _, _, _ := newTestOAuthService(t, users)
+	client, secret, _ := svc.RegisterClient(ctx, &model.OAuthClient{Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/cb"}})
+	verifier, challenge := pkcePair()
+	code, err := svc.IssueCode(ctx, user, &ports.AuthorizeRequest{
+		ClientID:            client.ID,
+		RedirectURI:         "https://wiki.example.com/cb",
+		Scopes:              []string{"openid"},
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	})
+	if err != nil {
+		t.Fatalf("issue code failed: %v", err)
+	}
+	users.users[user.ID].Disabled = true
+
+	var oauthErr *ports.OAuthError
+	_, err = svc.Token(ctx, &ports.TokenRequest{
+		GrantType:    model.GrantAuthorizationCode,
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  "https://wiki.example.com/cb",
+		CodeVerifier: verifier,
+	})
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for a disabled user, got %v", err)
+	}
+}
+
+func TestAuthorizeRejectsBadRequests(t *testing.T) {
+	ctx := context.Background()
+	users := newMockRepo()
+	user := &model.User{Name: "Alice", Email: "alice@example.com"}
+	users.Create(ctx, user)
+	svc, _, _, _ := newTestOAuthService(t, users)
+	client, _, _ := svc.RegisterClient(ctx, &model.OAuthClient{Name: "SPA", Public: true, RedirectURIs: []string{"https://spa.example.com/cb"}})
+
+	_, challenge := pkcePair()
+	base := ports.AuthorizeRequest{ClientID: client.ID, RedirectURI: "https://spa.example.com/cb", ResponseType: "code", CodeChallenge: challenge, CodeChallengeMethod: "S256"}
+
+	bad := base
+	bad.RedirectURI = "https://evil.example.com/cb"
+	if _, err := svc.ValidateAuthorize(ctx, &bad); err == nil || errors.As(err, new(*ports.OAuthError)) {
+		t.Fatalf("unregistered redirect must fail without redirecting, got %v", err)
+	}
+
+	bad = base
+	bad.CodeChallenge = ""
+	if _, err := svc.ValidateAuthorize(ctx, &bad); !errors.As(err, new(*ports.OAuthError)) {
+		t.Fatalf("expected PKCE to be required, got %v", err)
+	}
+
+	req := base
+	if _, err := svc.ValidateAuthorize(ctx, &req); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	code, _ := svc.IssueCode(ctx, user, &req)
+	_, err := svc.Token(ctx, &ports.TokenRequest{
+		GrantType:    model.GrantAuthorizationCode,
+		ClientID:     client.ID,
+		Code:         code,
+		RedirectURI:  req.RedirectURI,
+		CodeVerifier: "wrong-verifier",
+	})
+	var oauthErr *ports.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected wrong verifier to fail, got %v", err)
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _, _ := newTestOAuthService(t, newMockRepo())
+
+	client, secret, err := svc.RegisterClient(ctx, &model.OAuthClient{
+		Name:       "billing",
+		GrantTypes: []string{model.GrantClientCredentials},
+		Scopes:     []string{model.ScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatalf("register client failed: %v", err)
+	}
+
+	resp, err := svc.Token(ctx, &ports.TokenRequest{GrantType: model.GrantClientCredentials, ClientID: client.ID, ClientSecret: secret})
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+	if resp.IDToken != "" || resp.Scope != model.ScopeUsersRead {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	token, _ := jwt.Parse(resp.AccessToken, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["principal_type"] != model.PrincipalService || claims["user_id"] != nil || claims["sub"] != client.ID {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	var oauthErr *ports.OAuthError
+	if _, err := svc.Token(ctx, &ports.TokenRequest{GrantType: model.GrantClientCredentials, ClientID: client.ID, ClientSecret: "nope"}); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+		t.Fatalf("expected invalid_client, got %v", err)
+	}
+	if _, err := svc.Token(ctx, &ports.TokenRequest{GrantType: model.GrantClientCredentials, ClientID: client.ID, ClientSecret: secret, Scope: model.ScopeUsersWrite}); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_scope" {
+		t.Fatalf("expected invalid_scope, got %v", err)
+	}
+	if _, err := svc.Token(ctx, &ports.TokenRequest{GrantType: model.GrantAuthorizationCode, ClientID: client.ID, ClientSecret: secret}); !errors.As(err, &oauthErr) || oauthErr.Code != "unauthorized_client" {
+		t.Fatalf("expected unauthorized_client, got %v", err)
+	}
+
+	if _, _, err := svc.RegisterClient(ctx, &model.OAuthClient{Name: "spa", Public: true, GrantTypes: []string{model.GrantClientCredentials}}); !errors.As(err, &oauthErr) {
+		t.Fatalf("expected public client_credentials client to be rejected, got %v", err)
+	}
+}
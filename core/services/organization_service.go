@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const inviteTokenPurpose = "org_invite"
+
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+type OrganizationSettings struct {
+	PublicURL string        // base for invite links
+	InviteTTL time.Duration // how long an invite link works; a week if zero
+}
+
+type organizationService struct {
+	orgs        ports.OrganizationRepository
+	members     ports.MembershipRepository
+	invitations ports.InvitationRepository
+	users       ports.UserRepository
+	accounts    ports.UserService
+	mailer      ports.Mailer
+	jwtSecret   []byte
+	settings    OrganizationSettings
+	audit       ports.AuditLog
+	now         func() time.Time
+}
+
+// NewOrganizationService registers invited users through accounts, so they
+// get the same password policy and hashing as POST /register. Invite emails
+// are skipped when mailer is nil.
+func NewOrganizationService(
+	orgs ports.OrganizationRepository,
+	members ports.MembershipRepository,
+	invitations ports.InvitationRepository,
+	users ports.UserRepository,
+	accounts ports.UserService,
+	mailer ports.Mailer,
+	secret string,
+	settings OrganizationSettings,
+	audit ports.AuditLog,
+) ports.OrganizationService {
+	if settings.InviteTTL <= 0 {
+		settings.InviteTTL = defaultInviteTTL
+	}
+	return &organizationService{
+		orgs:        orgs,
+		members:     members,
+		invitations: invitations,
+		users:       users,
+		accounts:    accounts,
+		mailer:      mailer,
+		jwtSecret:   []byte(secret),
+		settings:    settings,
+		audit:       audit,
+		now:         time.Now,
+	}
+}
+
+func (s *organizationService) Create(ctx context.Context, userID, name string) (*model.Organization, error) {
+	org := &model.Organization{Name: name, CreatedBy: userID, CreatedAt: s.now()}
+	if err := s.orgs.Create(ctx, org); err != nil {
+		return nil, err
+	}
+	if err := s.members.Add(ctx, &model.Membership{
+		OrgID:     org.ID,
+		UserID:    userID,
+		Role:      model.OrgRoleOwner,
+		CreatedAt: org.CreatedAt,
+	}); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOrgCreate,
+		TargetType: "organization",
+		TargetID:   org.ID,
+		Changes:    changes(nil, org),
+	})
+	org.Role = model.OrgRoleOwner
+	return org, nil
+}
+
+func (s *organizationService) Get(ctx context.Context, userID, orgID string) (*model.Organization, error) {
+	m, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.orgs.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	org.Role = m.Role
+	return org, nil
+}
+
+func (s *organizationService) ListForUser(ctx context.Context, userID string) ([]*model.Organization, error) {
+	memberships, err := s.members.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]string, len(memberships))
+	ids := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.OrgID] = m.Role
+		ids = append(ids, m.OrgID)
+	}
+	orgs, err := s.orgs.ListByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		org.Role = roles[org.ID]
+	}
+	return orgs, nil
+}
+
+func (s *organizationService) ListMembers(ctx context.Context, userID, orgID string) ([]*model.Membership, error) {
+	if _, err := s.membership(ctx, orgID, userID); err != nil {
+		return nil, err
+	}
+	members, err := s.members.ListByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if u, err := s.users.GetByID(ctx, m.UserID); err == nil {
+			m.Name, m.Email = u.Name, u.Email
+		}
+	}
+	return members, nil
+}
+
+// UpdateMember needs an owner or admin. Only owners may grant or take away
+// the owner role, and the last owner can't be demoted.
+func (s *organizationService) UpdateMember(ctx context.Context, userID, orgID, memberID, role string) (*model.Membership, error) {
+	if !slices.Contains(model.OrgRoles, role) {
+		return nil, ports.ErrInvalidRole
+	}
+	actor, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.membership(ctx, orgID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, target) || (role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner) {
+		return nil, ports.ErrForbidden
+	}
+	if target.Role == model.OrgRoleOwner && role != model.OrgRoleOwner {
+		if err := s.keepOwner(ctx, orgID); err != nil {
+			return nil, err
+		}
+	}
+	updated, err := s.members.UpdateRole(ctx, orgID, memberID, role)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOrgMemberUpdate,
+		TargetType: "user",
+		TargetID:   memberID,
+		Changes:    changes(target, updated),
+		Details:    map[string]string{"org_id": orgID},
+	})
+	return updated, nil
+}
+
+// RemoveMember needs an owner or admin, except for members leaving.
+func (s *organizationService) RemoveMember(ctx context.Context, userID, orgID, memberID string) error {
+	actor, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	target, err := s.membership(ctx, orgID, memberID)
+	if err != nil {
+		return err
+	}
+	if userID != memberID && !canManage(actor, target) {
+		return ports.ErrForbidden
+	}
+	if target.Role == model.OrgRoleOwner {
+		if err := s.keepOwner(ctx, orgID); err != nil {
+			return err
+		}
+	}
+	if err := s.members.Remove(ctx, orgID, memberID); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOrgMemberRemove,
+		TargetType: "user",
+		TargetID:   memberID,
+		Changes:    changes(target, nil),
+		Details:    map[string]string{"org_id": orgID},
+	})
+	return nil
+}
+
+func (s *organizationService) Invite(ctx context.Context, userID, orgID, email, role string) (*model.Invitation, error) {
+	if !slices.Contains(model.OrgRoles, role) {
+		return nil, ports.ErrInvalidRole
+	}
+	actor, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role == model.OrgRoleMember || (role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner) {
+		return nil, ports.ErrForbidden
+	}
+	org, err := s.orgs.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	email = strings.TrimSpace(email)
+	if u, err := s.users.GetByEmail(ctx, email); err == nil {
+		if _, err := s.members.Get(ctx, orgID, u.ID); err == nil {
+			return nil, ports.ErrConflict
+		}
+	} else if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+
+	now := s.now()
+	inv := &model.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.settings.InviteTTL),
+	}
+	if err := s.invitations.Create(ctx, inv); err != nil {
+		return nil, err
+	}
+	token, err := signPurposeToken(s.jwtSecret, inviteTokenPurpose, jwt.MapClaims{
+		"invitation_id": inv.ID,
+		"tenant_id":     ports.TenantFrom(ctx),
+		"exp":           inv.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOrgInvite,
+		TargetType: "organization",
+		TargetID:   orgID,
+		Details:    map[string]string{"email": email, "role": role},
+	})
+
+	if s.mailer != nil {
+		if err := s.mailer.Send(ctx, email, "You're invited to "+org.Name,
+			"You have been invited to join "+org.Name+" as "+role+". Accept within "+
+				s.settings.InviteTTL.String()+":\n"+
+				s.settings.PublicURL+"/invitations/accept?token="+token+
+				"\n\nIf you don't have an account yet, you can create one from the link."); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// AcceptInvitation trusts the link as proof of owning the invited address.
+// The token names its tenant, like password reset links.
+func (s *organizationService) AcceptInvitation(ctx context.Context, token, name, password string, attributes map[string]interface{}) (*model.Membership, error) {
+	claims, err := parsePurposeToken(s.jwtSecret, inviteTokenPurpose, token)
+	if err != nil {
+		return nil, err
+	}
+	tenant, _ := claims["tenant_id"].(string)
+	ctx = ports.WithTenant(ctx, tenant)
+	id, _ := claims["invitation_id"].(string)
+
+	inv, err := s.invitations.GetByID(ctx, id)
+	if err != nil || inv.AcceptedAt != nil || !s.now().Before(inv.ExpiresAt) {
+		return nil, ports.ErrInvalidToken
+	}
+
+	user, err := s.users.GetByEmail(ctx, inv.Email)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		if name == "" || password == "" {
+			return nil, ports.ErrRegistrationRequired
+		}
+		if user, err = s.accounts.Register(ctx, name, inv.Email, password, attributes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.invitations.MarkAccepted(ctx, inv.ID, s.now()); err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			return nil, ports.ErrInvalidToken
+		}
+		return nil, err
+	}
+	m := &model.Membership{OrgID: inv.OrgID, UserID: user.ID, Role: inv.Role, CreatedAt: s.now()}
+	if err := s.members.Add(ctx, m); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditOrgMemberAdd,
+		ActorID:    user.ID,
+		ActorType:  model.PrincipalUser,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    changes(nil, m),
+		Details:    map[string]string{"org_id": inv.OrgID, "invited_by": inv.InvitedBy},
+	})
+	return m, nil
+}
+
+// membership returns ErrNotFound for non-members so organizations can't be
+// probed.
+func (s *organizationService) membership(ctx context.Context, orgID, userID string) (*model.Membership, error) {
+	m, err := s.members.Get(ctx, orgID, userID)
+	if err != nil {
+		return nil, ports.ErrNotFound
+	}
+	return m, nil
+}
+
+// keepOwner fails if orgID has only one owner left.
+func (s *organizationService) keepOwner(ctx context.Context, orgID string) error {
+	owners, err := s.members.CountByRole(ctx, orgID, model.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ports.ErrLastOwner
+	}
+	return nil
+}
+
+// canManage reports whether actor may change target's membership. Admins
+// manage admins and members; owners manage everyone.
+func canManage(actor, target *model.Membership) bool {
+	switch actor.Role {
+	case model.OrgRoleOwner:
+		return true
+	case model.OrgRoleAdmin:
+		return target.Role != model.OrgRoleOwner
+	}
+	return false
+}
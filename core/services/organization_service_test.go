@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockOrgRepo struct {
+	orgs map[string]*model.Organization
+}
+
+func (m *mockOrgRepo) Create(ctx context.Context, org *model.Organization) error {
+	org.ID = fmt.Sprintf("org-%d", len(m.orgs)+1)
+	cp := *org
+	m.orgs[org.ID] = &cp
+	return nil
+}
+
+func (m *mockOrgRepo) GetByID(ctx context.Context, id string) (*model.Organization, error) {
+	if o, ok := m.orgs[id]; ok {
+		cp := *o
+		return &cp, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockOrgRepo) ListByIDs(ctx context.Context, ids []string) ([]*model.Organization, error) {
+	res := []*model.Organization{}
+	for _, id := range ids {
+		if o, ok := m.orgs[id]; ok {
+			cp := *o
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+type mockMembershipRepo struct {
+	members []*model.Membership
+}
+
+func (m *mockMembershipRepo) find(orgID, userID string) int {
+	for i, mb := range m.members {
+		if mb.OrgID == orgID && mb.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *mockMembershipRepo) Add(ctx context.Context, mb *model.Membership) error {
+	if m.find(mb.OrgID, mb.UserID) >= 0 {
+		return ports.ErrConflict
+	}
+	cp := *mb
+	m.members = append(m.members, &cp)
+	return nil
+}
+
+func (m *mockMembershipRepo) Get(ctx context.Context, orgID, userID string) (*model.Membership, error) {
+	if i := m.find(orgID, userID); i >= 0 {
+		cp := *m.members[i]
+		return &cp, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockMembershipRepo) ListByOrg(ctx context.Context, orgID string) ([]*model.Membership, error) {
+	res := []*model.Membership{}
+	for _, mb := range m.members {
+		if mb.OrgID == orgID {
+			cp := *mb
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockMembershipRepo) ListByUser(ctx context.Context, userID string) ([]*model.Membership, error) {
+	res := []*model.Membership{}
+	for _, mb := range m.members {
+		if mb.UserID == userID {
+			cp := *mb
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockMembershipRepo) UpdateRole(ctx context.Context, orgID, userID, role string) (*model.Membership, error) {
+	i := m.find(orgID, userID)
+	if i < 0 {
+		return nil, ports.ErrNotFound
+	}
+	m.members[i].Role = role
+	cp := *m.members[i]
+	return &cp, nil
+}
+
+func (m *mockMembershipRepo) Remove(ctx context.Context, orgID, userID string) error {
+	i := m.find(orgID, userID)
+	if i < 0 {
+		return ports.ErrNotFound
+	}
+	m.members = append(m.members[:i], m.members[i+1:]...)
+	return nil
+}
+
+func (m *mockMembershipRepo) CountByRole(ctx context.Context, orgID, role string) (int64, error) {
+	var n int64
+	for _, mb := range m.members {
+		if mb.OrgID == orgID && mb.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type mockInvitationRepo struct {
+	invitations map[string]*model.Invitation
+}
+
+func (m *mockInvitationRepo) Create(ctx context.Context, inv *model.Invitation) error {
+	inv.ID = fmt.Sprintf("inv-%d", len(m.invitations)+1)
+	cp := *inv
+	m.invitations[inv.ID] = &cp
+	return nil
+}
+
+func (m *mockInvitationRepo) GetByID(ctx context.Context, id string) (*model.Invitation, error) {
+	if inv, ok := m.invitations[id]; ok {
+		cp := *inv
+		return &cp, nil
+	}
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockInvitationRepo) MarkAccepted(ctx context.Context, id string, at time.Time) error {
+	inv, ok := m.invitations[id]
+	if !ok || inv.AcceptedAt != nil {
+		return ports.ErrNotFound
+	}
+	inv.AcceptedAt = &at
+	return nil
+}
+
+type orgFixture struct {
+	svc   ports.OrganizationService
+	users *mockUserRepo
+	links map[string]string // invite link token by recipient
+}
+
+func newOrgFixture() *orgFixture {
+	f := &orgFixture{users: newMockRepo(), links: map[string]string{}}
+	mail := mailerTo(func(to, body string) {
+		if _, rest, ok := strings.Cut(body, "/invitations/accept?token="); ok {
+			f.links[to], _, _ = strings.Cut(rest, "\n")
+		}
+	})
+	f.svc = NewOrganizationService(
+		&mockOrgRepo{orgs: map[string]*model.Organization{}},
+		&mockMembershipRepo{},
+		&mockInvitationRepo{invitations: map[string]*model.Invitation{}},
+		f.users,
+		NewUserService(f.users, mockHasher{}, "secret"),
+		mail,
+		"secret",
+		OrganizationSettings{PublicURL: "https://register.example"},
+		nil,
+	)
+	return f
+}
+
+func (f *orgFixture) user(name string) string {
+	u := &model.User{Name: name, Email: strings.ToLower(name) + "@example.com"}
+	f.users.Create(context.Background(), u)
+	return u.ID
+}
+
+func TestOrganizationInvitations(t *testing.T) {
+	ctx := context.Background()
+	f := newOrgFixture()
+	owner := f.user("Olga")
+	existing := f.user("Erin")
+
+	org, err := f.svc.Create(ctx, owner, "Acme")
+	if err != nil || org.Role != model.OrgRoleOwner {
+		t.Fatalf("create failed: %+v, %v", org, err)
+	}
+
+	// An existing account is attached as is.
+	if _, err := f.svc.Invite(ctx, owner, org.ID, "erin@example.com", model.OrgRoleAdmin); err != nil {
+		t.Fatalf("invite failed: %v", err)
+	}
+	m, err := f.svc.AcceptInvitation(ctx, f.links["erin@example.com"], "", "", nil)
+	if err != nil || m.UserID != existing || m.Role != model.OrgRoleAdmin {
+		t.Fatalf("accept failed: %+v, %v", m, err)
+	}
+	if _, err := f.svc.AcceptInvitation(ctx, f.links["erin@example.com"], "", "", nil); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Errorf("expected a used link to fail, got %v", err)
+	}
+	if _, err := f.svc.Invite(ctx, owner, org.ID, "erin@example.com", model.OrgRoleMember); !errors.Is(err, ports.ErrConflict) {
+		t.Errorf("expected inviting a member to conflict, got %v", err)
+	}
+
+	// A new address registers through the link.
+	if _, err := f.svc.Invite(ctx, existing, org.ID, "nina@example.com", model.OrgRoleMember); err != nil {
+		t.Fatalf("invite by admin failed: %v", err)
+	}
+	link := f.links["nina@example.com"]
+	if _, err := f.svc.AcceptInvitation(ctx, link, "", "", nil); !errors.Is(err, ports.ErrRegistrationRequired) {
+		t.Errorf("expected name and password to be required, got %v", err)
+	}
+	m, err = f.svc.AcceptInvitation(ctx, link, "Nina", "password", nil)
+	if err != nil {
+		t.Fatalf("accept with registration failed: %v", err)
+	}
+	nina, err := f.users.GetByEmail(ctx, "nina@example.com")
+	if err != nil || m.UserID != nina.ID || m.Role != model.OrgRoleMember {
+		t.Fatalf("expected nina to be registered and added, got %+v, %v", m, err)
+	}
+
+	members, _ := f.svc.ListMembers(ctx, nina.ID, org.ID)
+	if len(members) != 3 || members[0].Email != "olga@example.com" {
+		t.Errorf("unexpected members: %+v", members)
+	}
+	if _, err := f.svc.AcceptInvitation(ctx, link+"x", "", "", nil); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Errorf("expected tampered link to fail, got %v", err)
+	}
+}
+
+func TestOrganizationRoles(t *testing.T) {
+	ctx := context.Background()
+	f := newOrgFixture()
+	owner, admin, member, outsider := f.user("Olga"), f.user("Ada"), f.user("Max"), f.user("Otto")
+	org, _ := f.svc.Create(ctx, owner, "Acme")
+	f.svc.Invite(ctx, owner, org.ID, "ada@example.com", model.OrgRoleAdmin)
+	f.svc.Invite(ctx, owner, org.ID, "max@example.com", model.OrgRoleMember)
+	f.svc.AcceptInvitation(ctx, f.links["ada@example.com"], "", "", nil)
+	f.svc.AcceptInvitation(ctx, f.links["max@example.com"], "", "", nil)
+
+	if _, err := f.svc.Get(ctx, outsider, org.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("expected outsiders not to see the organization, got %v", err)
+	}
+	if _, err := f.svc.Invite(ctx, member, org.ID, "x@example.com", model.OrgRoleMember); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected members not to invite, got %v", err)
+	}
+	if _, err := f.svc.Invite(ctx, admin, org.ID, "x@example.com", model.OrgRoleOwner); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected admins not to invite owners, got %v", err)
+	}
+	if _, err := f.svc.UpdateMember(ctx, admin, org.ID, owner, model.OrgRoleMember); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected admins not to demote owners, got %v", err)
+	}
+	if _, err := f.svc.UpdateMember(ctx, admin, org.ID, member, "boss"); !errors.Is(err, ports.ErrInvalidRole) {
+		t.Errorf("expected unknown role to fail, got %v", err)
+	}
+	if m, err := f.svc.UpdateMember(ctx, admin, org.ID, member, model.OrgRoleAdmin); err != nil || m.Role != model.OrgRoleAdmin {
+		t.Errorf("expected admin to promote member, got %+v, %v", m, err)
+	}
+
+	if err := f.svc.RemoveMember(ctx, owner, org.ID, owner); !errors.Is(err, ports.ErrLastOwner) {
+		t.Errorf("expected last owner not to leave, got %v", err)
+	}
+	if _, err := f.svc.UpdateMember(ctx, owner, org.ID, owner, model.OrgRoleAdmin); !errors.Is(err, ports.ErrLastOwner) {
+		t.Errorf("expected last owner not to step down, got %v", err)
+	}
+	if _, err := f.svc.UpdateMember(ctx, owner, org.ID, admin, model.OrgRoleOwner); err != nil {
+		t.Fatalf("expected owner to add an owner: %v", err)
+	}
+	if err := f.svc.RemoveMember(ctx, owner, org.ID, owner); err != nil {
+		t.Errorf("expected owner to leave once another owner exists: %v", err)
+	}
+	if err := f.svc.RemoveMember(ctx, member, org.ID, member); err != nil {
+		t.Errorf("expected member to leave: %v", err)
+	}
+	if orgs, _ := f.svc.ListForUser(ctx, admin); len(orgs) != 1 || orgs[0].Role != model.OrgRoleOwner {
+		t.Errorf("expected admin to now own the organization, got %+v", orgs)
+	}
+}
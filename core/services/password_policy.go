@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"unicode"
+)
+
+type PasswordRules struct {
+	MinLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool // reject passwords containing the user's name or email
+}
+
+type passwordPolicy struct {
+	rules    PasswordRules
+	breached ports.BreachedPasswords
+}
+
+// NewPasswordPolicy builds a policy from rules. breached may be nil to skip
+// the breached-password check.
+func NewPasswordPolicy(rules PasswordRules, breached ports.BreachedPasswords) ports.PasswordPolicy {
+	return &passwordPolicy{rules: rules, breached: breached}
+}
+
+func (p *passwordPolicy) Validate(ctx context.Context, password string, user *model.User) error {
+	var violations []string
+
+	if n := len([]rune(password)); n < p.rules.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.rules.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.rules.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.rules.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.rules.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.rules.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.rules.DisallowUserInfo && user != nil && containsUserInfo(password, user) {
+		violations = append(violations, "must not contain your name or email")
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(ctx, password)
+		if err != nil {
+			return err
+		}
+		if found {
+			violations = append(violations, "has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ports.PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsUserInfo checks for the email's local part and each name part,
+// ignoring fragments under three characters to avoid false positives.
+func containsUserInfo(password string, user *model.User) bool {
+	lowered := strings.ToLower(password)
+	parts := strings.Fields(user.Name)
+	if local, _, ok := strings.Cut(user.Email, "@"); ok {
+		parts = append(parts, local)
+	}
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
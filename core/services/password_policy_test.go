@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"register/core/ports"
+	"register/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type breachedSet map[string]bool
+
+func (b breachedSet) Contains(ctx context.Context, password string) (bool, error) {
+	return b[password], nil
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(PasswordRules{
+		MinLength:        12,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		DisallowUserInfo: true,
+	}, breachedSet{"Tr0ub4dor&3xyz": true})
+	user := &model.User{Name: "Alice Smith", Email: "alice.s@example.com"}
+
+	tests := []struct {
+		password   string
+		violations int
+	}{
+		{"Correct-Horse-9", 0},
+		{"secret", 3},
+		{"alllowercase12", 1},
+		{"Smith-Family-2024", 1},
+		{"Alice.S@2024xyz", 1},
+		{"Tr0ub4dor&3xyz", 1},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(context.Background(), tt.password, user)
+		var policyErr *ports.PolicyError
+		switch {
+		case tt.violations == 0 && err != nil:
+			t.Errorf("%q: unexpected error %v", tt.password, err)
+		case tt.violations > 0 && (!errors.As(err, &policyErr) || len(policyErr.Violations) != tt.violations):
+			t.Errorf("%q: expected %d violations, got %v", tt.password, tt.violations, err)
+		}
+	}
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepo()
+	mail := &tokenMailer{}
+	svc := NewUserService(repo, mockHasher{}, "secret",
+		WithMailer(mail),
+		WithPasswordPolicy(NewPasswordPolicy(PasswordRules{MinLength: 10}, nil)),
+	)
+
+	if _, err := svc.Register(ctx, "Frank", "frank@example.com", "original-password", nil); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := svc.RequestPasswordReset(ctx, "frank@example.com"); err != nil {
+		t.Fatalf("request reset failed: %v", err)
+	}
+	if mail.token == "" {
+		t.Fatal("expected reset token to be mailed")
+	}
+	if _, err := jwt.Parse(mail.token, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil }); err == nil {
+		t.Fatal("reset token must not verify as an access token")
+	}
+
+	var policyErr *ports.PolicyError
+	if err := svc.ResetPassword(ctx, mail.token, "short"); !errors.As(err, &policyErr) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if err := svc.ResetPassword(ctx, mail.token, "brand-new-password"); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if _, err := svc.Login(ctx, "frank@example.com", "brand-new-password", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login with new password failed: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, mail.token, "another-password"); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Fatalf("expected token to be single-use, got %v", err)
+	}
+
+	if err := svc.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("unknown email should not error: %v", err)
+	}
+}
+
+// tokenMailer captures the token from the last reset link it was asked to send.
+type tokenMailer struct {
+	token string
+}
+
+func (m *tokenMailer) Send(ctx context.Context, to, subject, body string) error {
+	if _, after, ok := strings.Cut(body, "token="); ok {
+		m.token, _, _ = strings.Cut(after, "\n")
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"register/core/ports"
+	"register/model"
+	"strconv"
+	"strings"
+)
+
+// policyOps are the condition operators. contains tests list membership, or
+// substrings when both sides are strings.
+var policyOps = map[string]bool{"==": true, "!=": true, "in": true, "contains": true}
+
+type operand struct {
+	path    []string // e.g. ["principal", "roles"]; nil for literals
+	literal interface{}
+}
+
+type condition struct {
+	src         string
+	left, right operand
+	op          string
+}
+
+type compiledRule struct {
+	model.PolicyRule
+	conditions []condition
+}
+
+type policyEngine struct {
+	rules []compiledRule
+}
+
+// NewPolicyEngine checks and compiles rules. A matching deny rule wins over
+// any allow rule, and requests no rule allows are denied.
+func NewPolicyEngine(rules []model.PolicyRule) (ports.Authorizer, error) {
+	e := &policyEngine{}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if r.Effect != model.PolicyAllow && r.Effect != model.PolicyDeny {
+			return nil, fmt.Errorf("policy %s: effect must be %q or %q", r.Name, model.PolicyAllow, model.PolicyDeny)
+		}
+		if len(r.Actions) == 0 {
+			return nil, fmt.Errorf("policy %s: no actions", r.Name)
+		}
+		cr := compiledRule{PolicyRule: r}
+		for _, src := range r.Conditions {
+			c, err := parseCondition(src)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", r.Name, err)
+			}
+			cr.conditions = append(cr.conditions, c)
+		}
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+func (e *policyEngine) Evaluate(req *model.AccessRequest) *model.PolicyDecision {
+	d := &model.PolicyDecision{Trace: []model.RuleTrace{}}
+	var allowedBy, deniedBy string
+	for _, r := range e.rules {
+		t := r.evaluate(req)
+		d.Trace = append(d.Trace, t)
+		if !t.Matched {
+			continue
+		}
+		if r.Effect == model.PolicyDeny && deniedBy == "" {
+			deniedBy = r.Name
+		}
+		if r.Effect == model.PolicyAllow && allowedBy == "" {
+			allowedBy = r.Name
+		}
+	}
+	switch {
+	case deniedBy != "":
+		d.Rule, d.Reason = deniedBy, "denied by "+deniedBy
+	case allowedBy != "":
+		d.Allowed, d.Rule, d.Reason = true, allowedBy, "allowed by "+allowedBy
+	default:
+		d.Reason = "no rule allows " + req.Action
+	}
+	return d
+}
+
+func (r *compiledRule) evaluate(req *model.AccessRequest) model.RuleTrace {
+	t := model.RuleTrace{Rule: r.Name, Effect: r.Effect}
+	for _, a := range r.Actions {
+		if matchAction(a, req.Action) {
+			t.ActionMatched = true
+			break
+		}
+	}
+	if !t.ActionMatched {
+		return t
+	}
+	t.Matched = true
+	for _, c := range r.conditions {
+		ct := c.evaluate(req)
+		t.Conditions = append(t.Conditions, ct)
+		t.Matched = t.Matched && ct.Result
+	}
+	return t
+}
+
+func matchAction(pattern, action string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(action, prefix)
+	}
+	return pattern == action
+}
+
+// evaluate is false whenever an attribute is missing, so two absent values
+// never compare equal.
+func (c *condition) evaluate(req *model.AccessRequest) model.ConditionTrace {
+	l, lok := c.left.resolve(req)
+	r, rok := c.right.resolve(req)
+	t := model.ConditionTrace{Condition: c.src, Left: l, Right: r}
+	if !lok || !rok {
+		return t
+	}
+	switch c.op {
+	case "==":
+		t.Result = reflect.DeepEqual(l, r)
+	case "!=":
+		t.Result = !reflect.DeepEqual(l, r)
+	case "in":
+		t.Result = listContains(r, l)
+	case "contains":
+		ls, lstr := l.(string)
+		rs, rstr := r.(string)
+		t.Result = listContains(l, r) || (lstr && rstr && strings.Contains(ls, rs))
+	}
+	return t
+}
+
+func listContains(list, v interface{}) bool {
+	items, ok := list.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o operand) resolve(req *model.AccessRequest) (interface{}, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	var cur interface{}
+	switch o.path[0] {
+	case "action":
+		cur = req.Action
+	case "principal":
+		cur = req.Principal
+	case "resource":
+		cur = req.Resource
+	}
+	for _, key := range o.path[1:] {
+		var ok bool
+		switch m := cur.(type) {
+		case map[string]interface{}:
+			cur, ok = m[key]
+		case map[string]string:
+			cur, ok = m[key]
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	cur = normalize(cur)
+	return cur, cur != nil
+}
+
+// normalize converts values to the types JSON decoding produces, so
+// attributes from Go code and literals from rules compare equal.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		out := make([]interface{}, len(x))
+		for i, s := range x {
+			out[i] = s
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, s := range x {
+			out[i] = normalize(s)
+		}
+		return out
+	case map[string]interface{}:
+		if x == nil {
+			return nil
+		}
+	case map[string]string:
+		if x == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+func parseCondition(src string) (condition, error) {
+	tokens, err := splitCondition(src)
+	if err != nil {
+		return condition{}, err
+	}
+	if len(tokens) != 3 || !policyOps[tokens[1]] {
+		return condition{}, fmt.Errorf("condition %q: want \"<left> <op> <right>\" with op ==, !=, in or contains", src)
+	}
+	c := condition{src: src, op: tokens[1]}
+	if c.left, err = parseOperand(tokens[0]); err != nil {
+		return condition{}, fmt.Errorf("condition %q: %w", src, err)
+	}
+	if c.right, err = parseOperand(tokens[2]); err != nil {
+		return condition{}, fmt.Errorf("condition %q: %w", src, err)
+	}
+	return c, nil
+}
+
+// splitCondition splits on spaces outside quotes and brackets.
+func splitCondition(src string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	var quote rune
+	depth := 0
+	for _, r := range src {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == ' ' || r == '\t':
+			if depth == 0 {
+				if cur.Len() > 0 {
+					tokens = append(tokens, cur.String())
+					cur.Reset()
+				}
+				continue
+			}
+		}
+		cur.WriteRune(r)
+	}
+	if quote != 0 || depth != 0 {
+		return nil, fmt.Errorf("condition %q: unbalanced quotes or brackets", src)
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+func parseOperand(tok string) (operand, error) {
+	switch {
+	case tok == "action":
+		return operand{path: []string{"action"}}, nil
+	case strings.HasPrefix(tok, "principal.") || strings.HasPrefix(tok, "resource."):
+		return operand{path: strings.Split(tok, ".")}, nil
+	case tok == "true" || tok == "false":
+		return operand{literal: tok == "true"}, nil
+	case strings.HasPrefix(tok, "'") && strings.HasSuffix(tok, "'") && len(tok) >= 2:
+		return operand{literal: tok[1 : len(tok)-1]}, nil
+	case strings.HasPrefix(tok, `"`), strings.HasPrefix(tok, "["):
+		// Lists may use single quotes inside, as YAML makes double quotes awkward.
+		if strings.HasPrefix(tok, "[") {
+			tok = strings.ReplaceAll(tok, "'", `"`)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(tok), &v); err != nil {
+			return operand{}, fmt.Errorf("bad literal %s", tok)
+		}
+		return operand{literal: v}, nil
+	}
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		return operand{literal: n}, nil
+	}
+	return operand{}, fmt.Errorf("unknown operand %s; attributes start with principal. or resource.", tok)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"testing"
+)
+
+var supportPolicy = []model.PolicyRule{
+	{Name: "admins", Effect: model.PolicyAllow, Actions: []string{"user.*"}, Conditions: []string{`principal.roles contains "admin"`}},
+	{Name: "support-reads-region", Effect: model.PolicyAllow, Actions: []string{model.ActionUserRead, model.ActionUserList}, Conditions: []string{
+		`principal.roles contains 'support'`,
+		"principal.region == resource.region",
+	}},
+	{Name: "support-never-deletes", Effect: model.PolicyDeny, Actions: []string{model.ActionUserDelete}, Conditions: []string{`principal.roles contains "support"`}},
+	{Name: "own-account", Effect: model.PolicyAllow, Actions: []string{"user.*"}, Conditions: []string{"principal.id == resource.id"}},
+	{Name: "known-tiers", Effect: model.PolicyDeny, Actions: []string{"*"}, Conditions: []string{"resource.tier in ['gold', 'silver']", "principal.level != 2"}},
+}
+
+func TestPolicyDecisions(t *testing.T) {
+	engine, err := NewPolicyEngine(supportPolicy)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	support := map[string]interface{}{"id": "s1", "roles": []string{"user", "support"}, "region": "eu", "level": 2}
+	cases := []struct {
+		name      string
+		principal map[string]interface{}
+		action    string
+		resource  map[string]interface{}
+		allowed   bool
+		rule      string
+	}{
+		{"support reads own region", support, model.ActionUserRead, map[string]interface{}{"id": "u1", "region": "eu"}, true, "support-reads-region"},
+		{"support reads other region", support, model.ActionUserRead, map[string]interface{}{"id": "u1", "region": "us"}, false, ""},
+		{"missing attributes never match", map[string]interface{}{"roles": []string{"support"}}, model.ActionUserRead, map[string]interface{}{"id": "u1"}, false, ""},
+		{"deny wins over allow", support, model.ActionUserDelete, map[string]interface{}{"id": "s1", "region": "eu"}, false, "support-never-deletes"},
+		{"admin via wildcard", map[string]interface{}{"roles": []interface{}{"admin"}}, model.ActionUserDelete, map[string]interface{}{"id": "u1"}, true, "admins"},
+		{"self service", map[string]interface{}{"id": "u1", "roles": []string{}}, model.ActionUserUpdate, map[string]interface{}{"id": "u1"}, true, "own-account"},
+		{"list literal and numbers", map[string]interface{}{"id": "u1", "level": 1}, model.ActionUserRead, map[string]interface{}{"id": "u1", "tier": "gold"}, false, "known-tiers"},
+		{"list literal no match", map[string]interface{}{"id": "u1", "level": 2}, model.ActionUserRead, map[string]interface{}{"id": "u1", "tier": "gold"}, true, "own-account"},
+	}
+	for _, tc := range cases {
+		d := engine.Evaluate(&model.AccessRequest{Principal: tc.principal, Action: tc.action, Resource: tc.resource})
+		if d.Allowed != tc.allowed || d.Rule != tc.rule {
+			t.Errorf("%s: expected allowed=%v by %q, got %+v", tc.name, tc.allowed, tc.rule, d)
+		}
+		if len(d.Trace) != len(supportPolicy) {
+			t.Errorf("%s: expected a trace entry per rule, got %d", tc.name, len(d.Trace))
+		}
+	}
+
+	d := engine.Evaluate(&model.AccessRequest{Principal: support, Action: model.ActionUserRead, Resource: map[string]interface{}{"region": "us"}})
+	cond := d.Trace[1].Conditions[1]
+	if cond.Left != "eu" || cond.Right != "us" || cond.Result {
+		t.Errorf("expected trace to show compared values, got %+v", cond)
+	}
+	if d.Trace[2].ActionMatched {
+		t.Errorf("expected delete rule not to match a read")
+	}
+}
+
+func TestPolicyRejectsBadRules(t *testing.T) {
+	bad := []model.PolicyRule{
+		{Name: "effect", Effect: "maybe", Actions: []string{"*"}},
+		{Name: "actions", Effect: model.PolicyAllow},
+		{Name: "operator", Effect: model.PolicyAllow, Actions: []string{"*"}, Conditions: []string{"principal.id ~ resource.id"}},
+		{Name: "operand", Effect: model.PolicyAllow, Actions: []string{"*"}, Conditions: []string{"user.id == resource.id"}},
+		{Name: "quotes", Effect: model.PolicyAllow, Actions: []string{"*"}, Conditions: []string{`principal.role == "admin`}},
+		{Name: "arity", Effect: model.PolicyAllow, Actions: []string{"*"}, Conditions: []string{"principal.role =="}},
+	}
+	for _, r := range bad {
+		if _, err := NewPolicyEngine([]model.PolicyRule{r}); err == nil {
+			t.Errorf("%s: expected rule to be rejected", r.Name)
+		}
+	}
+}
+
+func TestUserServiceAuthorization(t *testing.T) {
+	repo := newMockRepo()
+	engine, _ := NewPolicyEngine([]model.PolicyRule{
+		{Name: "admins", Effect: model.PolicyAllow, Actions: []string{"user.*"}, Conditions: []string{`principal.roles contains "admin"`}},
+		{Name: "own-account", Effect: model.PolicyAllow, Actions: []string{"user.*"}, Conditions: []string{"principal.id == resource.id"}},
+		{Name: "list", Effect: model.PolicyAllow, Actions: []string{model.ActionUserList}},
+	})
+	svc := NewUserService(repo, mockHasher{}, "secret", WithAuthorizer(engine))
+	bg := context.Background()
+	alice := &model.User{Name: "Alice", Email: "alice@example.com"}
+	bob := &model.User{Name: "Bob", Email: "bob@example.com"}
+	repo.Create(bg, alice)
+	repo.Create(bg, bob)
+
+	asAlice := ports.WithPrincipal(bg, &model.Principal{Type: model.PrincipalUser, UserID: alice.ID, Role: model.RoleUser})
+	if _, err := svc.GetUser(asAlice, bob.ID); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected reading another user to be forbidden, got %v", err)
+	}
+	if _, err := svc.UpdateUser(asAlice, alice.ID, "Alicia", alice.Email, nil); err != nil {
+		t.Errorf("expected self update to pass: %v", err)
+	}
+	if err := svc.DeleteUser(asAlice, bob.ID, 0); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected deleting another user to be forbidden, got %v", err)
+	}
+	if users, err := svc.ListUsers(asAlice, nil); err != nil || len(users) != 1 || users[0].ID != alice.ID {
+		t.Errorf("expected list filtered to alice, got %v, %v", users, err)
+	}
+
+	// Group roles count, and calls without a principal are not API requests.
+	asOps := ports.WithPrincipal(bg, &model.Principal{Type: model.PrincipalUser, UserID: "ops", Role: model.RoleUser, Roles: []string{model.RoleAdmin}})
+	if _, err := svc.GetUser(asOps, bob.ID); err != nil {
+		t.Errorf("expected group admin to read: %v", err)
+	}
+	if err := svc.DeleteUser(bg, bob.ID, 0); err != nil {
+		t.Errorf("expected internal call to pass: %v", err)
+	}
+}
+
+func TestUserServiceAuthorizationByAttributes(t *testing.T) {
+	repo := newMockRepo()
+	engine, err := NewPolicyEngine([]model.PolicyRule{
+		{Name: "support-reads-region", Effect: model.PolicyAllow, Actions: []string{model.ActionUserRead}, Conditions: []string{
+			`principal.roles contains "support"`,
+			"principal.attributes.region == resource.attributes.region",
+		}},
+		{Name: "list", Effect: model.PolicyAllow, Actions: []string{model.ActionUserList}},
+	})
+	if err != nil {
+		t.Fatalf("policy: %v", err)
+	}
+	svc := NewUserService(repo, mockHasher{}, "secret", WithAuthorizer(engine))
+	bg := context.Background()
+	agent := &model.User{Name: "Agent", Email: "agent@example.com", Attributes: map[string]interface{}{"region": "eu"}}
+	paris := &model.User{Name: "Paris", Email: "paris@example.com", Attributes: map[string]interface{}{"region": "eu"}}
+	ohio := &model.User{Name: "Ohio", Email: "ohio@example.com", Attributes: map[string]interface{}{"region": "us"}}
+	for _, u := range []*model.User{agent, paris, ohio} {
+		repo.Create(bg, u)
+	}
+
+	asAgent := ports.WithPrincipal(bg, &model.Principal{Type: model.PrincipalUser, UserID: agent.ID, Role: model.RoleUser, Roles: []string{"support"}})
+	if _, err := svc.GetUser(asAgent, paris.ID); err != nil {
+		t.Errorf("expected reading a user in the same region to pass: %v", err)
+	}
+	if _, err := svc.GetUser(asAgent, ohio.ID); !errors.Is(err, ports.ErrForbidden) {
+		t.Errorf("expected reading a user in another region to be forbidden, got %v", err)
+	}
+	if users, err := svc.ListUsers(asAgent, nil); err != nil || len(users) != 2 {
+		t.Errorf("expected list filtered to the eu region, got %v, %v", users, err)
+	}
+
+	// The attributes are read from the account, not taken from the token.
+	repo.users[agent.ID].Attributes = map[string]interface{}{"region": "us"}
+	if _, err := svc.GetUser(asAgent, ohio.ID); err != nil {
+		t.Errorf("expected a region change to apply at once: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"register/core/ports"
+	"register/model"
+	"sync"
+	"time"
+)
+
+// lastSeenResolution limits how often Touch writes LastSeenAt. It is also how
+// long a session revoked on another instance may keep working here.
+const lastSeenResolution = time.Minute
+
+// maxSeenEntries bounds the last-seen cache; older entries are pruned when
+// it is reached.
+const maxSeenEntries = 10000
+
+type sessionService struct {
+	sessions ports.SessionRepository
+	audit    ports.AuditLog
+	now      func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewSessionService records revocations when audit is non-nil.
+func NewSessionService(sessions ports.SessionRepository, audit ports.AuditLog) ports.SessionService {
+	return &sessionService{sessions: sessions, audit: audit, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+func (s *sessionService) Start(ctx context.Context, userID string, client ports.ClientInfo, ttl time.Duration) (*model.Session, error) {
+	family, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	session := &model.Session{
+		UserID:     userID,
+		Family:     family,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *sessionService) List(ctx context.Context, userID string) ([]*model.Session, error) {
+	return s.sessions.ListByUser(ctx, userID)
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userID, id string) error {
+	session, err := s.sessions.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.seen, session.Family)
+	s.mu.Unlock()
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditSessionRevoke,
+		TargetType: "session",
+		TargetID:   session.ID,
+		Details:    map[string]string{"user_id": userID},
+	})
+	return nil
+}
+
+func (s *sessionService) RevokeFamily(ctx context.Context, userID, family string) error {
+	sessions, err := s.sessions.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.Family == family {
+			return s.Revoke(ctx, userID, session.ID)
+		}
+	}
+	return ports.ErrNotFound
+}
+
+// Touch only goes to the repository once per lastSeenResolution for each
+// session; in between, a recent successful touch is trusted.
+func (s *sessionService) Touch(ctx context.Context, family string) error {
+	now := s.now()
+	s.mu.Lock()
+	last, ok := s.seen[family]
+	s.mu.Unlock()
+	if ok && now.Sub(last) < lastSeenResolution {
+		return nil
+	}
+
+	if err := s.sessions.Touch(ctx, family, now); err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			return ports.ErrInvalidToken
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seen) >= maxSeenEntries {
+		for f, t := range s.seen {
+			if now.Sub(t) >= lastSeenResolution {
+				delete(s.seen, f)
+			}
+		}
+	}
+	s.seen[family] = now
+	return nil
+}
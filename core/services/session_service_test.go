@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"register/core/ports"
+	"register/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type mockSessionRepo struct {
+	sessions map[string]*model.Session
+	touches  int
+}
+
+func newMockSessionRepo() *mockSessionRepo {
+	return &mockSessionRepo{sessions: make(map[string]*model.Session)}
+}
+
+func (m *mockSessionRepo) Create(ctx context.Context, session *model.Session) error {
+	session.ID = "s-" + session.Family
+	cp := *session
+	m.sessions[session.ID] = &cp
+	return nil
+}
+
+func (m *mockSessionRepo) ListByUser(ctx context.Context, userID string) ([]*model.Session, error) {
+	var res []*model.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			cp := *s
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockSessionRepo) Delete(ctx context.Context, userID, id string) (*model.Session, error) {
+	s, ok := m.sessions[id]
+	if !ok || s.UserID != userID {
+		return nil, ports.ErrNotFound
+	}
+	delete(m.sessions, id)
+	return s, nil
+}
+
+func (m *mockSessionRepo) Touch(ctx context.Context, family string, at time.Time) error {
+	m.touches++
+	for _, s := range m.sessions {
+		if s.Family == family {
+			s.LastSeenAt = at
+			return nil
+		}
+	}
+	return ports.ErrNotFound
+}
+
+func TestLoginRecordsSession(t *testing.T) {
+	ctx := context.Background()
+	sessions := NewSessionService(newMockSessionRepo(), nil)
+	svc := NewUserService(newMockRepo(), mockHasher{}, "secret", WithSessions(sessions))
+
+	user, _ := svc.Register(ctx, "Gina", "gina@example.com", "password", nil)
+	token, err := svc.Login(ctx, "gina@example.com", "password", ports.ClientInfo{IP: "10.0.0.1", UserAgent: "curl/8.0"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	list, _ := sessions.List(ctx, user.ID)
+	if len(list) != 1 || list[0].IP != "10.0.0.1" || list[0].UserAgent != "curl/8.0" {
+		t.Fatalf("expected one recorded session, got %+v", list)
+	}
+	parsed, _ := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	if sid := parsed.Claims.(jwt.MapClaims)["sid"]; sid != list[0].Family {
+		t.Errorf("expected token sid %q, got %v", list[0].Family, sid)
+	}
+}
+
+func TestSessionTouchAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockSessionRepo()
+	svc := NewSessionService(repo, nil).(*sessionService)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	session, _ := svc.Start(ctx, "u1", ports.ClientInfo{}, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.Touch(ctx, session.Family); err != nil {
+			t.Fatalf("touch failed: %v", err)
+		}
+	}
+	if repo.touches != 1 {
+		t.Errorf("expected 1 repository write within the resolution, got %d", repo.touches)
+	}
+	now = now.Add(2 * lastSeenResolution)
+	svc.Touch(ctx, session.Family)
+	if repo.touches != 2 || !repo.sessions[session.ID].LastSeenAt.Equal(now) {
+		t.Errorf("expected last seen to be updated after the resolution")
+	}
+
+	if err := svc.Revoke(ctx, "someone-else", session.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking another user's session, got %v", err)
+	}
+	if err := svc.Revoke(ctx, "u1", session.ID); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if err := svc.Touch(ctx, session.Family); !errors.Is(err, ports.ErrInvalidToken) {
+		t.Errorf("expected revoked session to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"register/core/ports"
+	"register/model"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const loginTokenTTL = 72 * time.Hour
+
+// signUserToken issues the HS256 access token accepted by middleware.Auth.
+// extra claims are merged in and may override the defaults.
+func signUserToken(secret []byte, user *model.User, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"role":      user.Role,
+		"exp":       time.Now().Add(ttl).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// signOAuthToken issues the access token a client gets for a signed-in user.
+// It is addressed to the client and has no role, so the client can do only
+// what its scopes allow and never what the user could do as an admin.
+func signOAuthToken(secret []byte, user *model.User, client *model.OAuthClient, scope string, ttl time.Duration) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":       model.OAuthTokenType,
+		"aud":       client.ID,
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"client_id": client.ID,
+		"scope":     scope,
+		"exp":       time.Now().Add(ttl).Unix(),
+	}).SignedString(secret)
+}
+
+// signServiceToken issues an access token for an OAuth client acting as
+// itself. It has no user_id; middleware.Auth turns it into a service principal.
+func signServiceToken(secret []byte, client *model.OAuthClient, scope string, ttl time.Duration) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":            model.OAuthTokenType,
+		"aud":            client.ID,
+		"sub":            client.ID,
+		"client_id":      client.ID,
+		"tenant_id":      client.TenantID,
+		"principal_type": model.PrincipalService,
+		"scope":          scope,
+		"exp":            time.Now().Add(ttl).Unix(),
+	}).SignedString(secret)
+}
+
+// signPurposeToken issues a single-purpose token, such as a password reset
+// link. It is signed with a key derived from secret for its purpose alone, so
+// it never verifies as an access token, or as a token for another purpose.
+func signPurposeToken(secret []byte, purpose string, claims jwt.MapClaims) (string, error) {
+	claims["purpose"] = purpose
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(purposeKey(secret, purpose))
+}
+
+// parsePurposeToken verifies a token from signPurposeToken and returns its
+// claims, or ports.ErrInvalidToken.
+func parsePurposeToken(secret []byte, purpose, token string) (jwt.MapClaims, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ports.ErrInvalidToken
+		}
+		return purposeKey(secret, purpose), nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, ports.ErrInvalidToken
+	}
+	claims, _ := parsed.Claims.(jwt.MapClaims)
+	if claims["purpose"] != purpose {
+		return nil, ports.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func purposeKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("purpose:" + purpose))
+	return mac.Sum(nil)
+}
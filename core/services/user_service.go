@@ -2,79 +2,761 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"log"
+	"net/mail"
 	"register/core/ports"
 	"register/model"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type userService struct {
 	repo      ports.UserRepository
 	jwtSecret []byte
+	guard     ports.LoginGuard
+	mailer    ports.Mailer
+	hasher    ports.PasswordHasher
+	policy    ports.PasswordPolicy
+	publicURL string
+	sessions  ports.SessionService
+	audit     ports.AuditLog
+	authz     ports.Authorizer
+	attrs     ports.AttributeService
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+type Option func(*userService)
+
+// WithLoginGuard enables brute-force protection on Login.
+func WithLoginGuard(guard ports.LoginGuard) Option {
+	return func(s *userService) {
+		s.guard = guard
+	}
+}
+
+// WithMailer lets Register notify the address owner instead of telling the
+// caller whether the email is already in use.
+func WithMailer(mailer ports.Mailer) Option {
+	return func(s *userService) {
+		s.mailer = mailer
+	}
 }
 
-func NewUserService(repo ports.UserRepository, secret string) ports.UserService {
-	return &userService{
+// WithPasswordPolicy checks new passwords on register, change and reset.
+func WithPasswordPolicy(policy ports.PasswordPolicy) Option {
+	return func(s *userService) {
+		s.policy = policy
+	}
+}
+
+// WithPublicURL sets the base URL used for links in emails.
+func WithPublicURL(url string) Option {
+	return func(s *userService) {
+		s.publicURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithSessions records a session for every login and ties the issued token
+// to it, so the user can see and revoke their logins.
+func WithSessions(sessions ports.SessionService) Option {
+	return func(s *userService) {
+		s.sessions = sessions
+	}
+}
+
+// WithAuditLog records registrations, logins, profile and password changes
+// and deletions.
+func WithAuditLog(audit ports.AuditLog) Option {
+	return func(s *userService) {
+		s.audit = audit
+	}
+}
+
+// WithAuthorizer checks every read, update, delete and password change made
+// on behalf of an API caller against the policy.
+func WithAuthorizer(authz ports.Authorizer) Option {
+	return func(s *userService) {
+		s.authz = authz
+	}
+}
+
+// WithAttributes checks custom user attributes against the definitions
+// managed by attrs. Without it users can't have custom attributes.
+func WithAttributes(attrs ports.AttributeService) Option {
+	return func(s *userService) {
+		s.attrs = attrs
+	}
+}
+
+// NewUserService hashes passwords with hasher. Hashes made by an older
+// algorithm or with outdated parameters are upgraded on login.
+func NewUserService(repo ports.UserRepository, hasher ports.PasswordHasher, secret string, opts ...Option) ports.UserService {
+	s := &userService{
 		repo:      repo,
+		hasher:    hasher,
 		jwtSecret: []byte(secret),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *userService) Register(ctx context.Context, name, email, password string) (*model.User, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Register hashes the password before looking up the email so that new and
+// existing addresses take the same time. For an existing address it mails the
+// owner and returns ports.ErrEmailTaken, which handlers must answer with the
+// same generic response as a successful registration.
+func (s *userService) Register(ctx context.Context, name, email, password string, attributes map[string]interface{}) (*model.User, error) {
+	if err := s.checkPolicy(ctx, password, &model.User{Name: name, Email: email}); err != nil {
+		return nil, err
+	}
+	attributes, err := s.checkAttributes(ctx, "", attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
 
+	existing, err := s.repo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		// Mail failures are only logged, so the answer doesn't depend on
+		// whether the address is registered.
+		if err := s.notify(ctx, existing.Email, "You already have an account",
+			"Someone tried to register a new account with this email address. "+
+				"You already have an account; if you forgot your password, you can reset it."); err != nil {
+			log.Printf("[UserService] mail existing account notice: %v", err)
+		}
+		return nil, ports.ErrEmailTaken
+	}
+
 	user := &model.User{
 		Name:      name,
 		Email:     email,
-		Password:  string(hashed),
+		Password:  hashed,
+		Role:      model.RoleUser,
 		CreatedAt: time.Now(),
 	}
+	if len(attributes) > 0 {
+		user.Attributes = attributes
+	}
 
 	if err := s.repo.Create(ctx, user); err != nil {
 		return nil, err
 	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserRegister,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    changes(nil, user),
+	})
+
+	// The account exists either way; failing here would only make a retry
+	// look like an existing address.
+	if err := s.notify(ctx, user.Email, "Welcome", "Hi "+user.Name+", your account has been created."); err != nil {
+		log.Printf("[UserService] mail welcome to %s: %v", user.ID, err)
+	}
 
 	return user, nil
 }
 
-func (s *userService) Login(ctx context.Context, email, password string) (string, error) {
+// checkAttributes validates the custom attributes of user id ("" for a new
+// user). Without WithAttributes only an empty set is valid.
+func (s *userService) checkAttributes(ctx context.Context, id string, attributes map[string]interface{}) (map[string]interface{}, error) {
+	if s.attrs == nil {
+		if len(attributes) > 0 {
+			return nil, &ports.AttributeError{Violations: []string{"custom attributes are not enabled"}}
+		}
+		return map[string]interface{}{}, nil
+	}
+	return s.attrs.Validate(ctx, id, attributes)
+}
+
+func (s *userService) notify(ctx context.Context, to, subject, body string) error {
+	if s.mailer == nil {
+		return nil
+	}
+	return s.mailer.Send(ctx, to, subject, body)
+}
+
+func (s *userService) Login(ctx context.Context, email, password string, client ports.ClientInfo) (string, error) {
+	user, err := s.Authenticate(ctx, email, password, client.IP)
+	if err != nil {
+		return "", err
+	}
+
+	event := &model.AuditEvent{
+		Action:     model.AuditLogin,
+		ActorID:    user.ID,
+		ActorType:  model.PrincipalUser,
+		TargetType: "user",
+		TargetID:   user.ID,
+		IP:         client.IP,
+	}
+	var extra jwt.MapClaims
+	if s.sessions != nil {
+		session, err := s.sessions.Start(ctx, user.ID, client, loginTokenTTL)
+		if err != nil {
+			return "", err
+		}
+		extra = jwt.MapClaims{"sid": session.Family}
+		event.Details = map[string]string{"session_id": session.ID}
+	}
+	recordAudit(ctx, s.audit, event)
+	return signUserToken(s.jwtSecret, user, loginTokenTTL, extra)
+}
+
+// Authenticate checks credentials with the same brute-force protection and
+// hash upgrades as Login, for flows that issue their own tokens.
+func (s *userService) Authenticate(ctx context.Context, email, password, ip string) (*model.User, error) {
+	if s.guard != nil {
+		if err := s.guard.Check(ctx, email, ip); err != nil {
+			return nil, err
+		}
+	}
+
 	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		// Burn the same hashing work as a real comparison so unknown emails
+		// can't be told apart by response time.
+		s.hasher.Verify(password, s.dummyHash())
+		return nil, s.loginFailed(ctx, email, ip)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+	if ok, _ := s.hasher.Verify(password, user.Password); !ok || user.Disabled {
+		return nil, s.loginFailed(ctx, email, ip)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+	if s.hasher.NeedsRehash(user.Password) {
+		s.rehash(ctx, user.ID, password)
+	}
+
+	if s.guard != nil {
+		if err := s.guard.Success(ctx, email, ip); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// dummyHash is compared against when the user does not exist. It is made by
+// the current hasher so both paths do equivalent work.
+func (s *userService) dummyHash() string {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = s.hasher.Hash("dummy-password-for-timing")
 	})
+	return s.dummy
+}
+
+// rehash upgrades a stored hash after a successful login. Failures are only
+// logged; the old hash still works and the upgrade is retried next time.
+func (s *userService) rehash(ctx context.Context, id, password string) {
+	hashed, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePassword(ctx, id, hashed)
+	}
+	if err != nil {
+		log.Printf("[UserService] rehash password for %s: %v", id, err)
+	}
+}
 
-	return token.SignedString(s.jwtSecret)
+func (s *userService) loginFailed(ctx context.Context, email, ip string) error {
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:  model.AuditLoginFailed,
+		IP:      ip,
+		Details: map[string]string{"email": email},
+	})
+	if s.guard != nil {
+		if err := s.guard.Failure(ctx, email, ip); err != nil {
+			return err
+		}
+	}
+	return ports.ErrInvalidCredentials
+}
+
+func (s *userService) ChangePassword(ctx context.Context, id, current, password string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, model.ActionUserChangePassword, user); err != nil {
+		return err
+	}
+	if ok, _ := s.hasher.Verify(current, user.Password); !ok {
+		return ports.ErrInvalidCredentials
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{Action: model.AuditPasswordChange, TargetType: "user", TargetID: user.ID})
+	return nil
+}
+
+const resetTokenPurpose = "password_reset"
+
+// RequestPasswordReset mails a reset link when the email belongs to a user.
+// Unknown emails are ignored so callers can't probe for accounts.
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, ports.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return nil
+	}
+
+	token, err := signPurposeToken(s.jwtSecret, resetTokenPurpose, jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": ports.TenantFrom(ctx),
+		"pwh":       passwordFingerprint(user.Password),
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{Action: model.AuditPasswordResetRequest, TargetType: "user", TargetID: user.ID})
+
+	return s.notify(ctx, user.Email, "Reset your password",
+		"Use this link within one hour to choose a new password:\n"+
+			s.publicURL+"/password/reset?token="+token+
+			"\n\nIf you didn't ask for this, you can ignore this email.")
+}
+
+// ResetPassword accepts a token from RequestPasswordReset. The token carries a
+// fingerprint of the password hash it was issued for, so it stops working
+// once the password has changed, and names the tenant so the emailed link
+// works without the tenant's host or header.
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	claims, err := parsePurposeToken(s.jwtSecret, resetTokenPurpose, token)
+	if err != nil {
+		return err
+	}
+	id, _ := claims["user_id"].(string)
+	tenant, _ := claims["tenant_id"].(string)
+	ctx = ports.WithTenant(ctx, tenant)
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil || claims["pwh"] != passwordFingerprint(user.Password) {
+		return ports.ErrInvalidToken
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{Action: model.AuditPasswordReset, TargetType: "user", TargetID: user.ID})
+	return nil
+}
+
+func (s *userService) setPassword(ctx context.Context, user *model.User, password string) error {
+	if err := s.checkPolicy(ctx, password, user); err != nil {
+		return err
+	}
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(ctx, user.ID, hashed)
+}
+
+func (s *userService) checkPolicy(ctx context.Context, password string, user *model.User) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.policy.Validate(ctx, password, user)
+}
+
+func passwordFingerprint(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *userService) CreateUser(ctx context.Context, name, email, password string, attributes map[string]interface{}, disabled bool) (*model.User, error) {
+	user := &model.User{
+		Name:       name,
+		Email:      email,
+		Role:       model.RoleUser,
+		Disabled:   disabled,
+		CreatedAt:  time.Now(),
+		Attributes: attributes,
+	}
+	if err := s.authorize(ctx, model.ActionUserCreate, user); err != nil {
+		return nil, err
+	}
+	attributes, err := s.checkAttributes(ctx, "", attributes)
+	if err != nil {
+		return nil, err
+	}
+	user.Attributes = nil
+	if len(attributes) > 0 {
+		user.Attributes = attributes
+	}
+	if password != "" {
+		if err := s.checkPolicy(ctx, password, user); err != nil {
+			return nil, err
+		}
+		hashed, err := s.hasher.Hash(password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hashed
+	}
+	if _, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return nil, ports.ErrEmailTaken
+	} else if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserCreate,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    changes(nil, user),
+	})
+	return user, nil
+}
+
+func (s *userService) ImportUser(ctx context.Context, row *model.ImportRow, dryRun bool) (*model.User, error) {
+	user := &model.User{
+		Name:       row.Name,
+		Email:      row.Email,
+		Role:       model.RoleUser,
+		CreatedAt:  time.Now(),
+		Attributes: row.Attributes,
+	}
+	if err := s.authorize(ctx, model.ActionUserCreate, user); err != nil {
+		return nil, err
+	}
+	if err := validateFields(&model.UserFields{Name: &row.Name, Email: &row.Email}); err != nil {
+		return nil, err
+	}
+	switch {
+	case row.Password != "" && row.PasswordHash != "":
+		return nil, &ports.ValidationError{Violations: []string{"send a password or a password_hash, not both"}}
+	case row.PasswordHash != "":
+		if !s.hasher.Recognizes(row.PasswordHash) {
+			return nil, &ports.ValidationError{Violations: []string{"password_hash is not in a supported format"}}
+		}
+		user.Password = row.PasswordHash
+	case row.Password != "":
+		if err := s.checkPolicy(ctx, row.Password, user); err != nil {
+			return nil, err
+		}
+	}
+	attributes, err := s.checkAttributes(ctx, "", row.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	user.Attributes = nil
+	if len(attributes) > 0 {
+		user.Attributes = attributes
+	}
+	if _, err := s.repo.GetByEmail(ctx, row.Email); err == nil {
+		return nil, ports.ErrEmailTaken
+	} else if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+	if dryRun {
+		return user, nil
+	}
+	// Hashing is the slow part, so it waits until the row is known to be
+	// good.
+	if row.Password != "" {
+		if user.Password, err = s.hasher.Hash(row.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserCreate,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    changes(nil, user),
+		Details:    map[string]string{"source": "import"},
+	})
+	return user, nil
+}
+
+func (s *userService) ExportUsers(ctx context.Context, fn func(*model.User) error) error {
+	caller := s.caller(ctx)
+	if err := s.check(caller, model.ActionUserList, nil); err != nil {
+		return err
+	}
+	return s.repo.Each(ctx, func(u *model.User) error {
+		if s.check(caller, model.ActionUserRead, u) != nil {
+			return nil
+		}
+		return fn(u)
+	})
 }
 
 func (s *userService) GetUser(ctx context.Context, id string) (*model.User, error) {
-	return s.repo.GetByID(ctx, id)
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, model.ActionUserRead, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) FindUsersByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	caller := s.caller(ctx)
+	if err := s.check(caller, model.ActionUserList, nil); err != nil {
+		return nil, err
+	}
+	users, err := s.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]*model.User, 0, len(users))
+	for _, u := range users {
+		if s.check(caller, model.ActionUserRead, u) == nil {
+			visible = append(visible, u)
+		}
+	}
+	return visible, nil
+}
+
+// ListUsers returns the users the caller may read, provided it may list
+// users at all.
+func (s *userService) ListUsers(ctx context.Context, filter map[string]string) ([]*model.User, error) {
+	caller := s.caller(ctx)
+	if err := s.check(caller, model.ActionUserList, nil); err != nil {
+		return nil, err
+	}
+	users, err := s.findUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]*model.User, 0, len(users))
+	for _, u := range users {
+		if s.check(caller, model.ActionUserRead, u) == nil {
+			visible = append(visible, u)
+		}
+	}
+	return visible, nil
+}
+
+func (s *userService) findUsers(ctx context.Context, filter map[string]string) ([]*model.User, error) {
+	if len(filter) == 0 {
+		return s.repo.List(ctx)
+	}
+	if s.attrs == nil {
+		return nil, &ports.AttributeError{Violations: []string{"custom attributes are not enabled"}}
+	}
+	values, err := s.attrs.ParseFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByAttributes(ctx, values)
+}
+
+func (s *userService) UpdateUser(ctx context.Context, id, name, email string, attributes map[string]interface{}) (*model.User, error) {
+	return s.PatchUser(ctx, id, &model.UserFields{Name: &name, Email: &email, Attributes: attributes})
 }
 
-func (s *userService) ListUsers(ctx context.Context) ([]*model.User, error) {
-	return s.repo.List(ctx)
+func (s *userService) PatchUser(ctx context.Context, id string, fields *model.UserFields) (*model.User, error) {
+	before, err := s.existing(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, model.ActionUserUpdate, before); err != nil {
+		return nil, err
+	}
+	if err := validateFields(fields); err != nil {
+		return nil, err
+	}
+	update := *fields
+	if update.Attributes != nil {
+		if update.Attributes, err = s.checkAttributes(ctx, id, update.Attributes); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.repo.UpdateFields(ctx, id, &update)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserUpdate,
+		TargetType: "user",
+		TargetID:   id,
+		Changes:    changes(before, user),
+	})
+	return user, nil
 }
 
-func (s *userService) UpdateUser(ctx context.Context, id, name, email string) (*model.User, error) {
-	return s.repo.Update(ctx, id, name, email)
+func validateFields(fields *model.UserFields) error {
+	var violations []string
+	if fields.Name != nil && strings.TrimSpace(*fields.Name) == "" {
+		violations = append(violations, "name is required")
+	}
+	if fields.Email != nil {
+		if addr, err := mail.ParseAddress(*fields.Email); err != nil || addr.Address != *fields.Email {
+			violations = append(violations, "email must be a plain email address")
+		}
+	}
+	if len(violations) > 0 {
+		return &ports.ValidationError{Violations: violations}
+	}
+	return nil
 }
 
-func (s *userService) DeleteUser(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+func (s *userService) DeleteUser(ctx context.Context, id string, version int64) error {
+	before, err := s.existing(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, model.ActionUserDelete, before); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		return err
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     model.AuditUserDelete,
+		TargetType: "user",
+		TargetID:   id,
+		Changes:    changes(before, nil),
+	})
+	return nil
+}
+
+func (s *userService) SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error) {
+	before, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, model.ActionUserDisable, before); err != nil {
+		return nil, err
+	}
+	if before.Disabled == disabled {
+		return before, nil
+	}
+	user, err := s.repo.SetDisabled(ctx, id, disabled)
+	if err != nil {
+		return nil, err
+	}
+	action := model.AuditUserEnable
+	if disabled {
+		action = model.AuditUserDisable
+		s.signOut(ctx, id)
+	}
+	recordAudit(ctx, s.audit, &model.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   id,
+		Changes:    changes(before, user),
+	})
+	return user, nil
+}
+
+// signOut revokes all sessions of a user. Failures are logged; tokens of a
+// session that survives still expire with it.
+func (s *userService) signOut(ctx context.Context, id string) {
+	if s.sessions == nil {
+		return
+	}
+	sessions, err := s.sessions.List(ctx, id)
+	if err != nil {
+		log.Printf("listing sessions of disabled user %s: %v", id, err)
+		return
+	}
+	for _, session := range sessions {
+		if err := s.sessions.Revoke(ctx, id, session.ID); err != nil {
+			log.Printf("revoking session %s of disabled user %s: %v", session.ID, id, err)
+		}
+	}
+}
+
+// existing loads the user an update or delete applies to, when the audit log
+// or the policy needs it.
+func (s *userService) existing(ctx context.Context, id string) (*model.User, error) {
+	if s.audit == nil && s.authz == nil {
+		return nil, nil
+	}
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil && s.authz != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// authorize checks the caller in ctx against the policy. Calls without a
+// caller, such as registration or background jobs, are not checked. target
+// is nil for actions on the whole collection.
+func (s *userService) authorize(ctx context.Context, action string, target *model.User) error {
+	return s.check(s.caller(ctx), action, target)
+}
+
+// caller describes the caller in ctx to the policy, or returns nil if there
+// is no policy or no caller. A user's own custom attributes are added as
+// principal.attributes; if their account can't be read they are left out,
+// like any other missing attribute.
+func (s *userService) caller(ctx context.Context) map[string]interface{} {
+	p := ports.PrincipalFrom(ctx)
+	if s.authz == nil || p == nil {
+		return nil
+	}
+	attrs := p.Attributes()
+	if p.Type == model.PrincipalUser && p.UserID != "" {
+		if u, err := s.repo.GetByID(ctx, p.UserID); err == nil && u.Attributes != nil {
+			attrs["attributes"] = u.Attributes
+		}
+	}
+	return attrs
+}
+
+// check evaluates the policy for a caller from s.caller; nil is let through.
+func (s *userService) check(caller map[string]interface{}, action string, target *model.User) error {
+	if caller == nil {
+		return nil
+	}
+	d := s.authz.Evaluate(&model.AccessRequest{
+		Principal: caller,
+		Action:    action,
+		Resource:  userResource(target),
+	})
+	if !d.Allowed {
+		return ports.ErrForbidden
+	}
+	return nil
+}
+
+func userResource(u *model.User) map[string]interface{} {
+	res := map[string]interface{}{"type": "user"}
+	if u != nil {
+		res["id"] = u.ID
+		res["tenant"] = u.TenantID
+		res["email"] = u.Email
+		res["role"] = u.Role
+		if u.Attributes != nil {
+			res["attributes"] = u.Attributes
+		}
+	}
+	return res
 }
 
 func (s *userService) CountUsers(ctx context.Context) (int64, error) {
@@ -3,20 +3,29 @@ package services
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"register/core/ports"
 	"register/model"
+
+	"github.com/golang-jwt/jwt"
 )
 
+// mockUserRepo scopes every lookup to the tenant in ctx, like the Mongo
+// repository, so services can be tested for tenant isolation.
 type mockUserRepo struct {
-	users map[string]*model.User
-	seq   int
+	users  map[string]*model.User
+	seq    int
+	unique map[string]bool // by tenant and attribute name, like the indexes
+	// lookupErr, if set, fails lookups by email as an unreachable store would.
+	lookupErr error
 }
 
 func newMockRepo() *mockUserRepo {
-	return &mockUserRepo{users: make(map[string]*model.User)}
+	return &mockUserRepo{users: make(map[string]*model.User), unique: make(map[string]bool)}
 }
 
 func (m *mockUserRepo) nextID() string {
@@ -24,68 +33,370 @@ func (m *mockUserRepo) nextID() string {
 	return strings.TrimSpace(time.Now().Format("150405")) + "-" + string(rune('a'+m.seq-1))
 }
 
+// inTenant returns the stored user with id if it belongs to ctx's tenant.
+func (m *mockUserRepo) inTenant(ctx context.Context, id string) (*model.User, bool) {
+	u, ok := m.users[id]
+	if !ok || u.TenantID != ports.TenantFrom(ctx) {
+		return nil, false
+	}
+	return u, true
+}
+
+func (m *mockUserRepo) scoped(ctx context.Context) []*model.User {
+	var res []*model.User
+	for _, u := range m.users {
+		if u.TenantID == ports.TenantFrom(ctx) {
+			res = append(res, u)
+		}
+	}
+	return res
+}
+
 func (m *mockUserRepo) Create(ctx context.Context, user *model.User) error {
+	for _, u := range m.scoped(ctx) {
+		if u.Email == user.Email {
+			return ports.ErrEmailTaken
+		}
+	}
+	if err := m.duplicate(ctx, "", user.Attributes); err != nil {
+		return err
+	}
 	user.ID = m.nextID()
+	user.TenantID = ports.TenantFrom(ctx)
+	user.Version = 1
+	user.UpdatedAt = time.Now()
 	cp := *user
 	m.users[user.ID] = &cp
 	return nil
 }
 
 func (m *mockUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
-	for _, u := range m.users {
+	if m.lookupErr != nil {
+		return nil, m.lookupErr
+	}
+	for _, u := range m.scoped(ctx) {
 		if u.Email == email {
 			cp := *u
 			return &cp, nil
 		}
 	}
-	return nil, errors.New("not found")
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockUserRepo) FindByEmail(ctx context.Context, email string) ([]*model.User, error) {
+	var res []*model.User
+	for _, u := range m.scoped(ctx) {
+		if strings.EqualFold(u.Email, email) {
+			cp := *u
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
 }
 
 func (m *mockUserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
-	if u, ok := m.users[id]; ok {
+	if u, ok := m.inTenant(ctx, id); ok {
 		cp := *u
 		return &cp, nil
 	}
-	return nil, errors.New("not found")
+	return nil, ports.ErrNotFound
+}
+
+func (m *mockUserRepo) GetByIdentity(ctx context.Context, provider, subject string) (*model.User, error) {
+	for _, u := range m.scoped(ctx) {
+		for _, id := range u.Identities {
+			if id.Provider == provider && id.Subject == subject {
+				cp := *u
+				return &cp, nil
+			}
+		}
+	}
+	return nil, ports.ErrNotFound
 }
 
 func (m *mockUserRepo) List(ctx context.Context) ([]*model.User, error) {
-	res := make([]*model.User, 0, len(m.users))
-	for _, u := range m.users {
+	res := []*model.User{}
+	for _, u := range m.scoped(ctx) {
 		cp := *u
 		res = append(res, &cp)
 	}
 	return res, nil
 }
 
-func (m *mockUserRepo) Update(ctx context.Context, id, name, email string) (*model.User, error) {
-	u, ok := m.users[id]
+func (m *mockUserRepo) Each(ctx context.Context, fn func(*model.User) error) error {
+	users, _ := m.List(ctx)
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepo) FindByAttributes(ctx context.Context, attributes map[string]interface{}) ([]*model.User, error) {
+	var res []*model.User
+	for _, u := range m.scoped(ctx) {
+		matches := true
+		for name, value := range attributes {
+			if v, ok := u.Attributes[name]; !ok || v != value {
+				matches = false
+			}
+		}
+		if matches {
+			res = append(res, u)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockUserRepo) UpdateFields(ctx context.Context, id string, fields *model.UserFields) (*model.User, error) {
+	u, ok := m.inTenant(ctx, id)
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	if fields.Version != 0 && fields.Version != u.Version {
+		return nil, ports.ErrVersionMismatch
+	}
+	if err := m.duplicate(ctx, id, fields.Attributes); err != nil {
+		return nil, err
+	}
+	u.Version++
+	u.UpdatedAt = time.Now()
+	if fields.Name != nil {
+		u.Name = *fields.Name
+	}
+	if fields.Email != nil {
+		u.Email = *fields.Email
+	}
+	if fields.Attributes != nil {
+		u.Attributes = fields.Attributes
+		if len(fields.Attributes) == 0 {
+			u.Attributes = nil
+		}
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (m *mockUserRepo) UpdatePassword(ctx context.Context, id, hash string) error {
+	u, ok := m.inTenant(ctx, id)
+	if !ok {
+		return ports.ErrNotFound
+	}
+	u.Password = hash
+	u.Version++
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *mockUserRepo) UnsetAttribute(ctx context.Context, name string) error {
+	for _, u := range m.scoped(ctx) {
+		if _, ok := u.Attributes[name]; ok {
+			delete(u.Attributes, name)
+			u.Version++
+			u.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepo) UniqueAttribute(ctx context.Context, name string, unique bool) error {
+	key := ports.TenantFrom(ctx) + "/" + name
+	if !unique {
+		delete(m.unique, key)
+		return nil
+	}
+	seen := map[interface{}]bool{}
+	for _, u := range m.scoped(ctx) {
+		if v, ok := u.Attributes[name]; ok {
+			if seen[v] {
+				return &ports.AttributeError{Violations: []string{name + " has values shared by several users"}}
+			}
+			seen[v] = true
+		}
+	}
+	m.unique[key] = true
+	return nil
+}
+
+// duplicate fails a write of attributes by user id that repeats the value
+// of a unique attribute.
+func (m *mockUserRepo) duplicate(ctx context.Context, id string, attributes map[string]interface{}) error {
+	for name, v := range attributes {
+		if !m.unique[ports.TenantFrom(ctx)+"/"+name] {
+			continue
+		}
+		for _, u := range m.scoped(ctx) {
+			if u.ID != id && u.Attributes[name] == v {
+				return &ports.AttributeError{Violations: []string{name + " is already taken"}}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepo) SetDisabled(ctx context.Context, id string, disabled bool) (*model.User, error) {
+	u, ok := m.inTenant(ctx, id)
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, ports.ErrNotFound
 	}
-	u.Name = name
-	u.Email = email
+	u.Disabled = disabled
+	u.Version++
+	u.UpdatedAt = time.Now()
 	cp := *u
 	return &cp, nil
 }
 
-func (m *mockUserRepo) Delete(ctx context.Context, id string) error {
-	if _, ok := m.users[id]; !ok {
-		return errors.New("not found")
+func (m *mockUserRepo) AddIdentity(ctx context.Context, id string, identity model.ExternalIdentity) error {
+	if other, err := m.GetByIdentity(ctx, identity.Provider, identity.Subject); err == nil && other.ID != id {
+		return ports.ErrConflict
+	}
+	u, ok := m.inTenant(ctx, id)
+	if !ok {
+		return ports.ErrNotFound
+	}
+	if !slices.Contains(u.Identities, identity) {
+		u.Identities = append(u.Identities, identity)
+	}
+	u.Version++
+	return nil
+}
+
+func (m *mockUserRepo) Delete(ctx context.Context, id string, version int64) error {
+	u, ok := m.inTenant(ctx, id)
+	if !ok {
+		return ports.ErrNotFound
+	}
+	if version != 0 && version != u.Version {
+		return ports.ErrVersionMismatch
 	}
 	delete(m.users, id)
 	return nil
 }
 
 func (m *mockUserRepo) Count(ctx context.Context) (int64, error) {
-	return int64(len(m.users)), nil
+	return int64(len(m.scoped(ctx))), nil
+}
+
+// mockHasher keeps passwords readable behind a version prefix, so tests can
+// tell which hasher made a hash without paying for a real one.
+type mockHasher struct {
+	version string
+}
+
+func (m mockHasher) Hash(password string) (string, error) {
+	return m.version + "$" + password, nil
+}
+
+func (m mockHasher) Verify(password, encoded string) (bool, error) {
+	_, stored, ok := strings.Cut(encoded, "$")
+	return ok && stored == password, nil
+}
+
+func (m mockHasher) NeedsRehash(encoded string) bool {
+	return !strings.HasPrefix(encoded, m.version+"$")
+}
+
+func (m mockHasher) Recognizes(encoded string) bool {
+	return strings.Contains(encoded, "$")
+}
+
+type mockMailer struct {
+	sent []string
+	err  error
+}
+
+func (m *mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.sent = append(m.sent, to+": "+subject)
+	return m.err
+}
+
+func TestRegisterExistingEmailSendsNotice(t *testing.T) {
+	repo := newMockRepo()
+	mail := &mockMailer{}
+	svc := NewUserService(repo, mockHasher{}, "secret", WithMailer(mail))
+
+	if _, err := svc.Register(context.Background(), "Dana", "dana@example.com", "password", nil); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, err := svc.Register(context.Background(), "Mallory", "dana@example.com", "other", nil); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+	if len(repo.users) != 1 {
+		t.Fatalf("expected no second account, got %d", len(repo.users))
+	}
+	if len(mail.sent) != 2 || mail.sent[1] != "dana@example.com: You already have an account" {
+		t.Fatalf("unexpected mails: %v", mail.sent)
+	}
+}
+
+func TestRegisterIgnoresMailFailures(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret", WithMailer(&mockMailer{err: errors.New("smtp down")}))
+
+	if _, err := svc.Register(context.Background(), "Dana", "dana@example.com", "password", nil); err != nil {
+		t.Fatalf("register with failing mail: %v", err)
+	}
+	if _, err := svc.Register(context.Background(), "Mallory", "dana@example.com", "other", nil); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Fatalf("existing email with failing mail: %v", err)
+	}
+}
+
+func TestLookupErrorsAreNotMissingUsers(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret")
+	ctx := context.Background()
+	down := errors.New("store unreachable")
+	repo.lookupErr = down
+
+	if _, err := svc.Register(ctx, "Dana", "dana@example.com", "password", nil); !errors.Is(err, down) {
+		t.Fatalf("register = %v, want the store error", err)
+	}
+	if _, err := svc.CreateUser(ctx, "Dana", "dana@example.com", "", nil, false); !errors.Is(err, down) {
+		t.Fatalf("create = %v, want the store error", err)
+	}
+	if err := svc.RequestPasswordReset(ctx, "dana@example.com"); !errors.Is(err, down) {
+		t.Fatalf("reset = %v, want the store error", err)
+	}
+	if len(repo.users) != 0 {
+		t.Fatalf("created users while the store was down: %d", len(repo.users))
+	}
+}
+
+func TestLoginUnknownEmail(t *testing.T) {
+	svc := NewUserService(newMockRepo(), mockHasher{}, "secret")
+	if _, err := svc.Login(context.Background(), "nobody@example.com", "password", ports.ClientInfo{}); !errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+}
+
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	repo := newMockRepo()
+	old := NewUserService(repo, mockHasher{}, "secret")
+	user, err := old.Register(context.Background(), "Erin", "erin@example.com", "password", nil)
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	svc := NewUserService(repo, mockHasher{version: "v2"}, "secret")
+	if _, err := svc.Login(context.Background(), "erin@example.com", "password", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	stored := repo.users[user.ID].Password
+	if stored != "v2$password" {
+		t.Fatalf("expected password to be rehashed with the current hasher, got %s", stored)
+	}
+	if _, err := svc.Login(context.Background(), "erin@example.com", "password", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login with rehashed password failed: %v", err)
+	}
 }
 
 func TestRegisterAndLogin(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewUserService(repo, "secret")
+	svc := NewUserService(repo, mockHasher{}, "secret")
 
-	user, err := svc.Register(context.Background(), "Alice", "alice@example.com", "password")
+	user, err := svc.Register(context.Background(), "Alice", "alice@example.com", "password", nil)
 	if err != nil {
 		t.Fatalf("register failed: %v", err)
 	}
@@ -99,7 +410,7 @@ func TestRegisterAndLogin(t *testing.T) {
 		t.Fatal("expected CreatedAt to be set")
 	}
 
-	token, err := svc.Login(context.Background(), "alice@example.com", "password")
+	token, err := svc.Login(context.Background(), "alice@example.com", "password", ports.ClientInfo{IP: "127.0.0.1"})
 	if err != nil {
 		t.Fatalf("login failed: %v", err)
 	}
@@ -107,16 +418,16 @@ func TestRegisterAndLogin(t *testing.T) {
 		t.Fatal("expected token")
 	}
 
-	if _, err := svc.Login(context.Background(), "alice@example.com", "wrong"); err == nil {
+	if _, err := svc.Login(context.Background(), "alice@example.com", "wrong", ports.ClientInfo{IP: "127.0.0.1"}); err == nil {
 		t.Fatal("expected login with wrong password to fail")
 	}
 }
 
 func TestCRUD(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewUserService(repo, "secret")
+	svc := NewUserService(repo, mockHasher{}, "secret")
 
-	user, err := svc.Register(context.Background(), "Bob", "bob@example.com", "p4ss")
+	user, err := svc.Register(context.Background(), "Bob", "bob@example.com", "p4ss", nil)
 	if err != nil {
 		t.Fatalf("register failed: %v", err)
 	}
@@ -126,7 +437,7 @@ func TestCRUD(t *testing.T) {
 		t.Fatalf("get user failed: %v", err)
 	}
 
-	updated, err := svc.UpdateUser(context.Background(), user.ID, "Bobby", "bobby@example.com")
+	updated, err := svc.UpdateUser(context.Background(), user.ID, "Bobby", "bobby@example.com", nil)
 	if err != nil {
 		t.Fatalf("update failed: %v", err)
 	}
@@ -134,12 +445,12 @@ func TestCRUD(t *testing.T) {
 		t.Fatalf("update returned wrong data: %+v", updated)
 	}
 
-	list, err := svc.ListUsers(context.Background())
+	list, err := svc.ListUsers(context.Background(), nil)
 	if err != nil || len(list) != 1 {
 		t.Fatalf("list failed: %v len=%d", err, len(list))
 	}
 
-	if err := svc.DeleteUser(context.Background(), user.ID); err != nil {
+	if err := svc.DeleteUser(context.Background(), user.ID, 0); err != nil {
 		t.Fatalf("delete failed: %v", err)
 	}
 
@@ -147,3 +458,152 @@ func TestCRUD(t *testing.T) {
 		t.Fatal("expected missing user after delete")
 	}
 }
+
+func TestPatchUser(t *testing.T) {
+	svc := NewUserService(newMockRepo(), mockHasher{}, "secret")
+	ctx := context.Background()
+	user, _ := svc.Register(ctx, "Fay", "fay@example.com", "password", nil)
+
+	name := "Faye"
+	patched, err := svc.PatchUser(ctx, user.ID, &model.UserFields{Name: &name})
+	if err != nil || patched.Name != "Faye" || patched.Email != "fay@example.com" {
+		t.Fatalf("patch name: %+v %v", patched, err)
+	}
+
+	blank, bad := " ", "Fay <fay@example.com>"
+	_, err = svc.PatchUser(ctx, user.ID, &model.UserFields{Name: &blank, Email: &bad})
+	var validationErr *ports.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 {
+		t.Fatalf("expected name and email violations, got %v", err)
+	}
+	if _, err := svc.UpdateUser(ctx, user.ID, "Fay", "", nil); !errors.As(err, &validationErr) {
+		t.Fatalf("expected update without email to be refused, got %v", err)
+	}
+	stale := &model.UserFields{Name: &name, Version: user.Version}
+	if _, err := svc.PatchUser(ctx, user.ID, stale); !errors.Is(err, ports.ErrVersionMismatch) {
+		t.Fatalf("expected a stale version to be refused, got %v", err)
+	}
+	if err := svc.DeleteUser(ctx, user.ID, user.Version); !errors.Is(err, ports.ErrVersionMismatch) {
+		t.Fatalf("expected delete at a stale version to be refused, got %v", err)
+	}
+	if err := svc.DeleteUser(ctx, user.ID, patched.Version); err != nil {
+		t.Fatalf("delete at the current version failed: %v", err)
+	}
+}
+
+func TestCreateAndDisableUser(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewUserService(repo, mockHasher{}, "secret")
+	ctx := context.Background()
+
+	user, err := svc.CreateUser(ctx, "Dana", "dana@example.com", "password", nil, false)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := svc.CreateUser(ctx, "Dana", "dana@example.com", "", nil, false); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Fatalf("expected email taken, got %v", err)
+	}
+	if _, err := svc.CreateUser(ctx, "Eve", "eve@example.com", "", nil, false); err != nil {
+		t.Fatalf("create without password failed: %v", err)
+	}
+
+	if _, err := svc.SetDisabled(ctx, user.ID, true); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if _, err := svc.Login(ctx, "dana@example.com", "password", ports.ClientInfo{}); !errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Fatalf("expected disabled user to be refused, got %v", err)
+	}
+
+	if _, err := svc.SetDisabled(ctx, user.ID, false); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if _, err := svc.Login(ctx, "dana@example.com", "password", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login after enable failed: %v", err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	acme := ports.WithTenant(context.Background(), "acme")
+	globex := ports.WithTenant(context.Background(), "globex")
+	repo := newMockRepo()
+	mail := &mockMailer{}
+	svc := NewUserService(repo, mockHasher{}, "secret", WithMailer(mail))
+
+	// The same address can sign up in each tenant.
+	a, err := svc.Register(acme, "Ann", "ann@example.com", "acme-password", nil)
+	if err != nil {
+		t.Fatalf("register in acme failed: %v", err)
+	}
+	g, err := svc.Register(globex, "Ann", "ann@example.com", "globex-password", nil)
+	if err != nil {
+		t.Fatalf("register in globex failed: %v", err)
+	}
+	if a.TenantID != "acme" || g.TenantID != "globex" {
+		t.Fatalf("unexpected tenants: %q, %q", a.TenantID, g.TenantID)
+	}
+
+	if _, err := svc.Login(acme, "ann@example.com", "globex-password", ports.ClientInfo{}); !errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Errorf("expected another tenant's password to fail, got %v", err)
+	}
+	token, err := svc.Login(acme, "ann@example.com", "acme-password", ports.ClientInfo{})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	if claims["tenant_id"] != "acme" || claims["user_id"] != a.ID {
+		t.Errorf("expected acme token, got %v", claims)
+	}
+
+	if _, err := svc.GetUser(acme, g.ID); err == nil {
+		t.Error("expected globex user to be invisible from acme")
+	}
+	if list, _ := svc.ListUsers(acme, nil); len(list) != 1 || list[0].ID != a.ID {
+		t.Errorf("expected only the acme user, got %+v", list)
+	}
+	if n, _ := svc.CountUsers(globex); n != 1 {
+		t.Errorf("expected 1 globex user, got %d", n)
+	}
+	if _, err := svc.UpdateUser(acme, g.ID, "Mallory", "m@example.com", nil); err == nil {
+		t.Error("expected cross-tenant update to fail")
+	}
+	if err := svc.DeleteUser(acme, g.ID, 0); err == nil {
+		t.Error("expected cross-tenant delete to fail")
+	}
+	if got, err := svc.GetUser(globex, g.ID); err != nil || got.Name != "Ann" {
+		t.Fatalf("expected globex user untouched, got %+v, %v", got, err)
+	}
+	if _, err := svc.GetUser(context.Background(), a.ID); err == nil {
+		t.Error("expected acme user to be invisible from the default tenant")
+	}
+}
+
+func TestResetLinkKeepsTenant(t *testing.T) {
+	acme := ports.WithTenant(context.Background(), "acme")
+	var token string
+	svc := NewUserService(newMockRepo(), mockHasher{}, "secret", WithMailer(mailerTo(func(to, body string) {
+		if _, rest, ok := strings.Cut(body, "token="); ok {
+			token, _, _ = strings.Cut(rest, "\n")
+		}
+	})))
+	user, _ := svc.Register(acme, "Ann", "ann@example.com", "password", nil)
+
+	if err := svc.RequestPasswordReset(acme, "ann@example.com"); err != nil || token == "" {
+		t.Fatalf("reset request failed: %v", err)
+	}
+	// The link is opened without the tenant's host or header.
+	if err := svc.ResetPassword(context.Background(), token, "new-password"); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if _, err := svc.Login(acme, user.Email, "new-password", ports.ClientInfo{}); err != nil {
+		t.Fatalf("login with new password failed: %v", err)
+	}
+}
+
+// mailerTo passes each mail's recipient and body to a test.
+type mailerTo func(to, body string)
+
+func (f mailerTo) Send(ctx context.Context, to, subject, body string) error {
+	f(to, body)
+	return nil
+}
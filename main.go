@@ -8,10 +8,19 @@ import (
 	"os"
 	"os/signal"
 	"register/adapter/api/handler"
+	"register/adapter/api/scim"
+	"register/adapter/breach"
+	"register/adapter/hasher"
+	"register/adapter/mailer"
+	"register/adapter/oidc"
 	"register/adapter/repository"
+	"register/adapter/signing"
 	"register/config"
+	"register/core/ports"
 	"register/core/services"
+	"register/model"
 	"register/pkg/middleware"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -20,6 +29,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// bodyLimit is the largest request body read into memory, Fiber's default.
+const bodyLimit = 4 * 1024 * 1024
+
 func main() {
 	var cfg config.Config
 	if err := config.ReadConfig("config/config.yml", &cfg); err != nil {
@@ -37,28 +49,414 @@ func main() {
 	}
 	db := client.Database(cfg.Mongo.DBName)
 
+	signer, err := signing.LoadOrCreateRSA(cfg.OAuth.SigningKeyFile)
+	if err != nil {
+		log.Fatal("Cannot load signing key:", err)
+	}
+
+	var auditSink ports.AuditSink = repository.NewMemoryAuditSink(cfg.Audit.MemoryLimit)
+	if cfg.Audit.Store == "mongo" {
+		mongoAudit := repository.NewMongoAuditSink(db)
+		if err := mongoAudit.EnsureIndexes(ctx); err != nil {
+			log.Fatal("Cannot create indexes:", err)
+		}
+		auditSink = mongoAudit
+	}
+	auditLog := services.NewAuditLog(auditSink, signer)
+
+	// "go run . audit-verify" checks the audit hash chain and exits. A
+	// memory store would be a new, empty one here, which always verifies.
+	if len(os.Args) > 1 && os.Args[1] == "audit-verify" {
+		if cfg.Audit.Store != "mongo" {
+			log.Println(`Cannot verify audit log: audit.store is not "mongo", and the memory store lives only in the server`)
+			os.Exit(2)
+		}
+		os.Exit(verifyAudit(auditLog))
+	}
+
+	var attemptStore ports.LoginAttemptStore = repository.NewMemoryLoginAttemptStore()
+	if cfg.App.LoginGuard.Store == "mongo" {
+		attemptStore = repository.NewMongoLoginAttemptStore(db)
+	}
+	guardCfg := cfg.App.LoginGuard
+	loginGuard := services.NewLoginGuard(attemptStore, services.LoginGuardPolicy{
+		MaxFailures:   guardCfg.MaxFailures,
+		MaxIPFailures: guardCfg.MaxIPFailures,
+		BaseDelay:     guardCfg.BaseDelay,
+		MaxDelay:      guardCfg.MaxDelay,
+		Lockout:       guardCfg.Lockout,
+	}, auditLog)
+
+	var mail ports.Mailer = mailer.NewLogMailer()
+	if cfg.Mail.Driver == "smtp" {
+		mail = mailer.NewSMTPMailer(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password, cfg.Mail.From)
+	}
+
+	var idempotencyStore ports.IdempotencyStore = repository.NewMemoryIdempotencyStore()
+	if cfg.App.Idempotency.Store == "mongo" {
+		mongoIdempotency := repository.NewMongoIdempotencyStore(db)
+		if err := mongoIdempotency.EnsureIndexes(ctx); err != nil {
+			log.Fatal("Cannot create indexes:", err)
+		}
+		idempotencyStore = mongoIdempotency
+	}
+	// idempotent is only for routes whose responses hold no secrets.
+	idempotent := middleware.Idempotency(idempotencyStore, cfg.App.JWTSecret, cfg.App.Idempotency.TTL)
+
+	hashCfg := cfg.Password.Hashing
+	bcryptAlg := hasher.NewBcrypt(hashCfg.BcryptCost)
+	argon2Alg := hasher.NewArgon2id(hasher.Argon2Params{
+		Memory:      hashCfg.Argon2.MemoryKiB,
+		Iterations:  hashCfg.Argon2.Iterations,
+		Parallelism: hashCfg.Argon2.Parallelism,
+	})
+	passwordHasher := hasher.New(argon2Alg, bcryptAlg)
+	if hashCfg.Algorithm == "bcrypt" {
+		passwordHasher = hasher.New(bcryptAlg, argon2Alg)
+	}
+
+	policyCfg := cfg.Password.Policy
+	var breached ports.BreachedPasswords
+	if policyCfg.BreachedList != "" {
+		list, err := breach.NewFileList(policyCfg.BreachedList)
+		if err != nil {
+			log.Fatal("Cannot load breached password list:", err)
+		}
+		breached = list
+	}
+	passwordPolicy := services.NewPasswordPolicy(services.PasswordRules{
+		MinLength:        policyCfg.MinLength,
+		RequireUpper:     policyCfg.RequireUpper,
+		RequireLower:     policyCfg.RequireLower,
+		RequireDigit:     policyCfg.RequireDigit,
+		RequireSymbol:    policyCfg.RequireSymbol,
+		DisallowUserInfo: policyCfg.DisallowUserInfo,
+	}, breached)
+
 	userRepo := repository.NewMongoRepository(db)
-	userService := services.NewUserService(userRepo, cfg.App.JWTSecret)
-	userHandler := handler.NewUserHandler(userService)
+	if err := userRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	sessionRepo := repository.NewMongoSessionRepository(db)
+	if err := sessionRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	sessionService := services.NewSessionService(sessionRepo, auditLog)
+
+	var sessionCookie *middleware.CookieConfig
+	var userHandlerOpts []handler.UserHandlerOption
+	apiAuthOpts := []middleware.AuthOption{middleware.WithSessions(sessionService)}
+	if cfg.App.Cookie.Enabled {
+		sessionCookie = &middleware.CookieConfig{
+			Name:     cfg.App.Cookie.Name,
+			CSRFName: cfg.App.Cookie.CSRFName,
+			Domain:   cfg.App.Cookie.Domain,
+			Secure:   cfg.App.Cookie.Secure,
+			SameSite: cfg.App.Cookie.SameSite,
+			MaxAge:   cfg.App.Cookie.MaxAge,
+		}
+		userHandlerOpts = append(userHandlerOpts, handler.WithSessionCookie(*sessionCookie))
+		apiAuthOpts = append(apiAuthOpts, middleware.WithCookie(*sessionCookie))
+	}
+	sessionHandler := handler.NewSessionHandler(sessionService, sessionCookie)
+
+	attributeRepo := repository.NewMongoAttributeRepository(db)
+	if err := attributeRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	attributeService := services.NewAttributeService(attributeRepo, userRepo, auditLog)
+	attributeHandler := handler.NewAttributeHandler(attributeService)
+
+	userOpts := []services.Option{
+		services.WithLoginGuard(loginGuard),
+		services.WithMailer(mail),
+		services.WithPasswordPolicy(passwordPolicy),
+		services.WithPublicURL(cfg.App.PublicURL),
+		services.WithSessions(sessionService),
+		services.WithAuditLog(auditLog),
+		services.WithAttributes(attributeService),
+	}
+	var authz ports.Authorizer
+	if rules := cfg.Authorization.Rules; len(rules) > 0 {
+		policyRules := make([]model.PolicyRule, 0, len(rules))
+		for _, r := range rules {
+			policyRules = append(policyRules, model.PolicyRule{Name: r.Name, Effect: r.Effect, Actions: r.Actions, Conditions: r.Conditions})
+		}
+		engine, err := services.NewPolicyEngine(policyRules)
+		if err != nil {
+			log.Fatal("Invalid authorization policy:", err)
+		}
+		authz = engine
+		userOpts = append(userOpts, services.WithAuthorizer(authz))
+	}
+	var jobRepo ports.JobRepository = repository.NewMemoryJobRepository()
+	var importBatches ports.ImportBatchRepository = repository.NewMemoryImportBatchRepository()
+	if cfg.Jobs.Store == "mongo" {
+		mongoJobs := repository.NewMongoJobRepository(db)
+		if err := mongoJobs.EnsureIndexes(ctx); err != nil {
+			log.Fatal("Cannot create indexes:", err)
+		}
+		jobRepo = mongoJobs
+		mongoImportBatches := repository.NewMongoImportBatchRepository(db)
+		if err := mongoImportBatches.EnsureIndexes(ctx); err != nil {
+			log.Fatal("Cannot create indexes:", err)
+		}
+		importBatches = mongoImportBatches
+	}
+	jobLimits := make(map[string]int)
+	for _, l := range cfg.Jobs.Limits {
+		jobLimits[l.Type] = l.Workers
+	}
+	jobRunner := services.NewJobRunner(jobRepo, services.JobSettings{
+		Workers:      cfg.Jobs.Workers,
+		Limits:       jobLimits,
+		PollInterval: cfg.Jobs.PollInterval,
+		Lease:        cfg.Jobs.Lease,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+		BaseBackoff:  cfg.Jobs.BaseBackoff,
+		MaxBackoff:   cfg.Jobs.MaxBackoff,
+		Retention:    cfg.Jobs.Retention,
+	})
+	jobHandler := handler.NewJobHandler(jobRunner)
+
+	userService := services.NewUserService(userRepo, passwordHasher, cfg.App.JWTSecret, userOpts...)
+	var policyHandler *handler.PolicyHandler
+	if authz != nil {
+		policyHandler = handler.NewPolicyHandler(authz, userService)
+	}
+	bulkHandler := handler.NewBulkHandler(userService, attributeService, services.NewImportService(userService, jobRunner, importBatches, cfg.App.JWTSecret))
+	userHandler := handler.NewUserHandler(userService, userHandlerOpts...)
+
+	apiKeyRepo := repository.NewMongoAPIKeyRepository(db)
+	if err := apiKeyRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, auditLog)
+	apiAuthOpts = append(apiAuthOpts, middleware.WithAPIKeys(apiKeyService))
+
+	groupRepo := repository.NewMongoGroupRepository(db)
+	if err := groupRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	groupService := services.NewGroupService(groupRepo, userRepo, auditLog)
+	apiAuthOpts = append(apiAuthOpts, middleware.WithGroups(groupService))
+	groupHandler := handler.NewGroupHandler(groupService)
+	scimHandler := scim.NewHandler(userService, groupService, attributeService, cfg.App.PublicURL+"/scim/v2")
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+
+	membershipRepo := repository.NewMongoMembershipRepository(db)
+	if err := membershipRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	invitationRepo := repository.NewMongoInvitationRepository(db)
+	if err := invitationRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	organizationHandler := handler.NewOrganizationHandler(services.NewOrganizationService(
+		repository.NewMongoOrganizationRepository(db),
+		membershipRepo,
+		invitationRepo,
+		userRepo,
+		userService,
+		mail,
+		cfg.App.JWTSecret,
+		services.OrganizationSettings{PublicURL: cfg.App.PublicURL, InviteTTL: cfg.App.InviteTTL},
+		auditLog,
+	))
+
+	authCodeRepo := repository.NewMongoAuthorizationCodeRepository(db)
+	consentRepo := repository.NewMongoConsentRepository(db)
+	if err := authCodeRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	if err := consentRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	oauthClientRepo := repository.NewMongoOAuthClientRepository(db)
+	if err := oauthClientRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatal("Cannot create indexes:", err)
+	}
+	oauthService := services.NewOAuthService(
+		oauthClientRepo,
+		authCodeRepo,
+		consentRepo,
+		userRepo,
+		signer,
+		cfg.App.JWTSecret,
+		services.OAuthSettings{
+			Issuer:         cfg.OAuth.Issuer,
+			AccessTokenTTL: cfg.OAuth.AccessTokenTTL,
+			IDTokenTTL:     cfg.OAuth.IDTokenTTL,
+			CodeTTL:        cfg.OAuth.CodeTTL,
+		},
+		auditLog,
+	)
+	oauthHandler := handler.NewOAuthHandler(oauthService, userService)
+	lockoutHandler := handler.NewLockoutHandler(loginGuard)
+	auditHandler := handler.NewAuditHandler(auditLog)
+	impersonationHandler := handler.NewImpersonationHandler(services.NewImpersonationService(userRepo, cfg.App.JWTSecret, cfg.App.ImpersonationTTL,
+		func(ctx context.Context, e services.ImpersonationEvent) {
+			auditLog.Record(ctx, &model.AuditEvent{
+				Action:     model.AuditImpersonationStart,
+				TargetType: "user",
+				TargetID:   e.TargetID,
+				Details:    map[string]string{"expires_at": e.ExpiresAt.Format(time.RFC3339)},
+			})
+		},
+	))
+
+	var identityProviders []ports.IdentityProvider
+	for _, p := range cfg.Federation.Providers {
+		identityProviders = append(identityProviders, oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil))
+	}
+	federationHandler := handler.NewFederationHandler(services.NewFederationService(userRepo, identityProviders, cfg.App.JWTSecret, sessionService, auditLog))
 
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: true,
+		BodyLimit:             bodyLimit,
+		// Imports read their bodies as they arrive; BodyLimit buffers
+		// everyone else's.
+		StreamRequestBody: true,
 	})
+	app.Use(middleware.BodyLimit(bodyLimit, "/api/admin/users/import"))
 	app.Use(middleware.Logger())
+	app.Use(middleware.RequestMeta())
+	app.Use(middleware.Tenant(middleware.TenantConfig{
+		Header:     cfg.Tenancy.Header,
+		BaseDomain: cfg.Tenancy.BaseDomain,
+		Tenants:    cfg.Tenancy.Tenants,
+	}))
+
+	// Every request made with an impersonation token is audited, on all
+	// the routes that accept one.
+	recordImpersonation := middleware.RecordImpersonation(func(c *fiber.Ctx, r middleware.ImpersonatedRequest) {
+		auditLog.Record(c.UserContext(), &model.AuditEvent{
+			Action:     model.AuditImpersonationRequest,
+			Time:       r.At,
+			TargetType: "user",
+			TargetID:   r.UserID,
+			Details: map[string]string{
+				"method": r.Method,
+				"path":   r.Path,
+				"status": strconv.Itoa(r.Status),
+			},
+		})
+	})
 
 	// Public Routes
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("ok")
 	})
-	app.Post("/register", userHandler.Register)
+	app.Post("/register", idempotent, userHandler.Register)
 	app.Post("/login", userHandler.Login)
+	app.Post("/password/forgot", userHandler.ForgotPassword)
+	app.Post("/password/reset", userHandler.ResetPassword)
+	app.Post("/invitations/accept", idempotent, organizationHandler.AcceptInvitation)
+
+	// Federated login through upstream identity providers
+	app.Get("/auth/:provider/login", federationHandler.Login)
+	app.Get("/auth/:provider/callback", federationHandler.Callback)
+
+	// OAuth 2.0 / OpenID Connect provider
+	app.Get("/.well-known/openid-configuration", oauthHandler.Discovery)
+	app.Get("/oauth/jwks", oauthHandler.JWKS)
+	app.Get("/oauth/authorize", oauthHandler.AuthorizeForm)
+	app.Post("/oauth/authorize", oauthHandler.Authorize)
+	app.Post("/oauth/token", oauthHandler.Token)
+	app.Get("/oauth/userinfo", middleware.Auth(cfg.App.JWTSecret, middleware.WithSessions(sessionService)), recordImpersonation, middleware.RequireUser(), oauthHandler.UserInfo)
+
+	// SCIM 2.0 provisioning; clients use an admin's API key with the scim scope
+	app.Get("/scim/v2/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+	app.Get("/scim/v2/ResourceTypes", scimHandler.ResourceTypes)
+	app.Get("/scim/v2/ResourceTypes/:id", scimHandler.ResourceType)
+	app.Get("/scim/v2/Schemas", scimHandler.Schemas)
+	app.Get("/scim/v2/Schemas/:id", scimHandler.Schema)
+	scimAPI := app.Group("/scim/v2",
+		middleware.Auth(cfg.App.JWTSecret, middleware.WithSessions(sessionService), middleware.WithAPIKeys(apiKeyService), middleware.WithGroups(groupService)),
+		recordImpersonation, middleware.RequireScope(model.ScopeSCIM), middleware.RequireRole(model.RoleAdmin))
+	scimAPI.Get("/Users", scimHandler.ListUsers)
+	scimAPI.Post("/Users", idempotent, scimHandler.CreateUser)
+	scimAPI.Get("/Users/:id", scimHandler.GetUser)
+	scimAPI.Put("/Users/:id", scimHandler.ReplaceUser)
+	scimAPI.Patch("/Users/:id", scimHandler.PatchUser)
+	scimAPI.Delete("/Users/:id", scimHandler.DeleteUser)
+	scimAPI.Get("/Groups", scimHandler.ListGroups)
+	scimAPI.Post("/Groups", idempotent, scimHandler.CreateGroup)
+	scimAPI.Get("/Groups/:id", scimHandler.GetGroup)
+	scimAPI.Put("/Groups/:id", scimHandler.ReplaceGroup)
+	scimAPI.Patch("/Groups/:id", scimHandler.PatchGroup)
+	scimAPI.Delete("/Groups/:id", scimHandler.DeleteGroup)
 
 	// Private Routes (Group & Middleware)
-	api := app.Group("/api", middleware.Auth(cfg.App.JWTSecret))
-	api.Get("/users", userHandler.List)
-	api.Get("/users/:id", userHandler.Get)
-	api.Put("/users/:id", userHandler.Update)
-	api.Delete("/users/:id", userHandler.Delete)
+	api := app.Group("/api", middleware.Auth(cfg.App.JWTSecret, apiAuthOpts...), recordImpersonation)
+	api.Get("/users", middleware.RequireScope(model.ScopeUsersRead), userHandler.List)
+	api.Get("/users/:id", middleware.RequireScope(model.ScopeUsersRead), userHandler.Get)
+	api.Put("/users/:id", middleware.RequireScope(model.ScopeUsersWrite), userHandler.Update)
+	api.Patch("/users/:id", middleware.RequireScope(model.ScopeUsersWrite), userHandler.Patch)
+	api.Put("/users/:id/password", middleware.RequireInteractive(), middleware.DenyImpersonation(), userHandler.ChangePassword)
+	api.Delete("/users/:id", middleware.RequireScope(model.ScopeUsersWrite), middleware.DenyImpersonation(), userHandler.Delete)
+	api.Get("/attributes", middleware.RequireScope(model.ScopeUsersRead), attributeHandler.List)
+	api.Get("/jobs/:id", middleware.RequireScope(model.ScopeUsersRead), jobHandler.Get)
+	api.Post("/jobs/:id/cancel", middleware.RequireScope(model.ScopeUsersWrite), jobHandler.Cancel)
+
+	api.Post("/logout", sessionHandler.Logout)
+
+	api.Post("/me/identities/:provider", middleware.RequireInteractive(), middleware.DenyImpersonation(), federationHandler.Link)
+
+	keys := api.Group("/me/keys", middleware.RequireInteractive())
+	keys.Post("/", middleware.DenyImpersonation(), apiKeyHandler.Create)
+	keys.Get("/", apiKeyHandler.List)
+	keys.Delete("/:id", middleware.DenyImpersonation(), apiKeyHandler.Revoke)
+
+	sessions := api.Group("/me/sessions", middleware.RequireInteractive())
+	sessions.Get("/", sessionHandler.List)
+	sessions.Delete("/:id", middleware.DenyImpersonation(), sessionHandler.Revoke)
+
+	orgs := api.Group("/orgs", middleware.RequireInteractive())
+	orgs.Post("/", idempotent, organizationHandler.Create)
+	orgs.Get("/", organizationHandler.List)
+	orgs.Get("/:id", organizationHandler.Get)
+	orgs.Get("/:id/members", organizationHandler.ListMembers)
+	orgs.Put("/:id/members/:userId", organizationHandler.UpdateMember)
+	orgs.Delete("/:id/members/:userId", organizationHandler.RemoveMember)
+	orgs.Post("/:id/invitations", idempotent, organizationHandler.Invite)
+
+	groups := api.Group("/groups", middleware.RequireAdmin())
+	groups.Post("/", idempotent, groupHandler.Create)
+	groups.Get("/", groupHandler.List)
+	groups.Get("/:id", groupHandler.Get)
+	groups.Put("/:id", groupHandler.Update)
+	groups.Delete("/:id", groupHandler.Delete)
+	groups.Get("/:id/members", groupHandler.ListMembers)
+	groups.Post("/:id/members", idempotent, groupHandler.AddMember)
+	groups.Delete("/:id/members/:type/:memberId", groupHandler.RemoveMember)
+
+	admin := api.Group("/admin", middleware.RequireAdmin())
+	admin.Delete("/lockouts/:email", lockoutHandler.Unlock)
+	admin.Post("/users/import", idempotent, bulkHandler.Import)
+	admin.Get("/users/import/:id", bulkHandler.ImportStatus)
+	admin.Get("/users/export", bulkHandler.Export)
+	admin.Put("/attributes/:name", attributeHandler.Define)
+	admin.Delete("/attributes/:name", attributeHandler.Delete)
+	admin.Get("/audit", auditHandler.List)
+	admin.Get("/audit/verify", auditHandler.Verify)
+	if policyHandler != nil {
+		admin.Post("/policy/explain", policyHandler.Explain)
+	}
+	// Impersonation mints an unscoped token, so keys can't ask for one.
+	admin.Post("/impersonate/:id", middleware.RequireInteractive(), impersonationHandler.Impersonate)
+	admin.Get("/users/:id/sessions", sessionHandler.ListForUser)
+	admin.Delete("/users/:id/sessions/:sid", sessionHandler.RevokeForUser)
+	admin.Post("/oauth/clients", oauthHandler.RegisterClient)
+	admin.Get("/oauth/clients", oauthHandler.ListClients)
+	admin.Delete("/oauth/clients/:id", oauthHandler.DeleteClient)
 
 	for _, routes := range app.Stack() {
 		for _, r := range routes {
@@ -66,6 +464,24 @@ func main() {
 		}
 	}
 
+	if cfg.Audit.CheckpointInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.Audit.CheckpointInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				cp, err := auditLog.Checkpoint(context.Background())
+				if err != nil {
+					logJSON("ERROR", fmt.Sprintf("[Audit] checkpoint: %v", err))
+				} else if cp != nil {
+					logJSON("INFO", fmt.Sprintf("[Audit] checkpoint seq=%d hash=%s", cp.Seq, cp.Hash))
+				}
+			}
+		}()
+	}
+
+	// Job handlers are all registered by now.
+	jobRunner.Start()
+
 	serverErr := make(chan error, 1)
 	go func() {
 		logJSON("INFO", fmt.Sprintf("[Server] Start on port: %s", cfg.Server.Port))
@@ -95,6 +511,14 @@ func main() {
 	default:
 	}
 
+	// Running jobs save their progress and go back to the queue, to be
+	// resumed by the next process.
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), cfg.Jobs.ShutdownTimeout)
+	if err := jobRunner.Shutdown(jobsCtx); err != nil {
+		log.Println("Jobs still running at shutdown, to be taken over when their leases expire:", err)
+	}
+	cancelJobs()
+
 	if err := client.Disconnect(context.Background()); err != nil {
 		log.Fatal("Error disconnecting from MongoDB:", err)
 	}
@@ -102,6 +526,24 @@ func main() {
 	log.Println("Server exited properly")
 }
 
+// verifyAudit prints the verification result as JSON and returns the exit
+// code: 0 if the chain is intact, 1 if it is broken, 2 on error.
+func verifyAudit(audit ports.AuditLog) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	res, err := audit.Verify(ctx)
+	if err != nil {
+		log.Println("Cannot verify audit log:", err)
+		return 2
+	}
+	out, _ := json.MarshalIndent(res, "", "  ")
+	fmt.Println(string(out))
+	if !res.Valid {
+		return 1
+	}
+	return 0
+}
+
 func logJSON(severity, message string) {
 	entry := map[string]string{
 		"timestamp": time.Now().Format(time.RFC3339Nano),
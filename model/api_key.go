@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a JWT.
+const APIKeyPrefix = "rk_"
+
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeSCIM       = "scim"  // /scim/v2 provisioning
+	ScopeAdmin      = "admin" // /api/admin and /api/groups, for admins' keys
+)
+
+// APIKeyScopes lists the scopes an API key may be granted.
+var APIKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeSCIM, ScopeAdmin}
+
+// APIKey is a long-lived credential for machine clients. Only a hash of the
+// secret is stored; Prefix identifies the key in listings and lookups.
+type APIKey struct {
+	ID         string     `json:"id" bson:"_id,omitempty"`
+	TenantID   string     `json:"-" bson:"tenant_id"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	Name       string     `json:"name" bson:"name"`
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	Hash       string     `json:"-" bson:"hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Custom attribute types.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+// AttributeDefinition declares a custom user attribute. Users carry the
+// values in User.Attributes; they are checked against the definitions of
+// their tenant whenever they are set.
+type AttributeDefinition struct {
+	TenantID    string `json:"-" bson:"tenant_id"`
+	Name        string `json:"name" bson:"name"`
+	Type        string `json:"type" bson:"type"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Required    bool   `json:"required" bson:"required"`
+	// Unique values may belong to one user per tenant.
+	Unique bool `json:"unique" bson:"unique"`
+	// Pattern is a regular expression string values must match; anchor it
+	// with ^ and $ to match the whole value.
+	Pattern string `json:"pattern,omitempty" bson:"pattern,omitempty"`
+	// Enum lists the allowed values of a string attribute.
+	Enum      []string  `json:"enum,omitempty" bson:"enum,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// Audit actions. Names are "<subject>.<verb>" so they can be filtered by prefix.
+const (
+	AuditUserRegister         = "user.register"
+	AuditUserCreate           = "user.create" // by federated login or provisioning
+	AuditUserUpdate           = "user.update"
+	AuditUserDelete           = "user.delete"
+	AuditUserDisable          = "user.disable"
+	AuditUserEnable           = "user.enable"
+	AuditIdentityLink         = "user.identity_link"
+	AuditLogin                = "auth.login"
+	AuditLoginFailed          = "auth.login_failed"
+	AuditLockout              = "auth.lockout"
+	AuditUnlock               = "auth.unlock"
+	AuditPasswordChange       = "password.change"
+	AuditPasswordResetRequest = "password.reset_request"
+	AuditPasswordReset        = "password.reset"
+	AuditAPIKeyCreate         = "api_key.create"
+	AuditAPIKeyRevoke         = "api_key.revoke"
+	AuditSessionRevoke        = "session.revoke"
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditOAuthClientRegister  = "oauth_client.register"
+	AuditOAuthClientDelete    = "oauth_client.delete"
+	AuditOrgCreate            = "org.create"
+	AuditOrgInvite            = "org.invite"
+	AuditOrgMemberAdd         = "org.member_add"
+	AuditOrgMemberUpdate      = "org.member_update"
+	AuditOrgMemberRemove      = "org.member_remove"
+	AuditGroupCreate          = "group.create"
+	AuditGroupUpdate          = "group.update"
+	AuditGroupDelete          = "group.delete"
+	AuditGroupMemberAdd       = "group.member_add"
+	AuditGroupMemberRemove    = "group.member_remove"
+	AuditAttributeDefine      = "attribute.define"
+	AuditAttributeDelete      = "attribute.delete"
+)
+
+// AuditEvent records one state change or authentication event. Events form
+// a hash chain: Hash covers the event including PrevHash, the Hash of the
+// event with the previous Seq, so editing or removing one breaks the chain.
+type AuditEvent struct {
+	ID  string `json:"id" bson:"_id,omitempty"`
+	Seq int64  `json:"seq" bson:"seq"`
+	// TenantID is empty on events recorded before multi-tenancy; they belong
+	// to DefaultTenant.
+	TenantID string    `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Time     time.Time `json:"time" bson:"time"`
+	Action   string    `json:"action" bson:"action"`
+	// ActorID is who did it; empty for anonymous requests such as Register.
+	ActorID   string `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorType string `json:"actor_type,omitempty" bson:"actor_type,omitempty"`
+	// ImpersonatorID is the admin behind ActorID when impersonating.
+	ImpersonatorID string                 `json:"impersonator_id,omitempty" bson:"impersonator_id,omitempty"`
+	TargetType     string                 `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID       string                 `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	Changes        map[string]AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	Details        map[string]string      `json:"details,omitempty" bson:"details,omitempty"`
+	IP             string                 `json:"ip,omitempty" bson:"ip,omitempty"`
+	RequestID      string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	PrevHash       string                 `json:"prev_hash" bson:"prev_hash"`
+	Hash           string                 `json:"hash" bson:"hash"`
+}
+
+// AuditCheckpoint pins the chain head at a point in time. Signature is a JWT
+// over Seq and Hash signed with the service's signing key, so the chain can't
+// be rewritten from scratch without the key.
+type AuditCheckpoint struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	Seq       int64     `json:"seq" bson:"seq"`
+	Hash      string    `json:"hash" bson:"hash"`
+	Time      time.Time `json:"time" bson:"time"`
+	Signature string    `json:"signature" bson:"signature"`
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After  interface{} `json:"after,omitempty" bson:"after,omitempty"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Group member kinds.
+const (
+	GroupMemberUser  = "user"
+	GroupMemberGroup = "group"
+)
+
+// Group collects users and other groups. Members of a nested group are
+// members of every group containing it, and get the Roles of all of them.
+type Group struct {
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	TenantID    string    `json:"-" bson:"tenant_id"`
+	Name        string    `json:"name" bson:"name"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Roles       []string  `json:"roles" bson:"roles"`
+	Users       []string  `json:"users" bson:"users"`
+	Groups      []string  `json:"groups" bson:"groups"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+// EffectiveGroups is what a user gets from direct and nested membership.
+type EffectiveGroups struct {
+	GroupIDs []string `json:"groups"`
+	Roles    []string `json:"roles"`
+}
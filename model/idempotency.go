@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// IdempotentRequest is the first request a caller made with an
+// Idempotency-Key and, once it has finished, the response replayed to
+// retries. Key includes the tenant and caller.
+type IdempotentRequest struct {
+	Key string `bson:"_id"`
+	// Fingerprint is a hash of the method, path and body, so a key reused
+	// for a different request can be refused.
+	Fingerprint string    `bson:"fingerprint"`
+	Done        bool      `bson:"done"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Location    string    `bson:"location,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// ExternalIdentity links a user to an account at an upstream identity provider.
+type ExternalIdentity struct {
+	Provider string `json:"provider" bson:"provider"`
+	Subject  string `json:"subject" bson:"subject"`
+}
+
+// ExternalClaims are the validated ID token claims from an upstream provider.
+type ExternalClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// ImportRow is one user read from a bulk import file. Password is hashed on
+// import; PasswordHash is an encoded hash from another system, taken as is.
+// Password is never stored: rows keep it encrypted in SealedPassword until
+// they are imported.
+type ImportRow struct {
+	Line           int                    `json:"line" bson:"line"`
+	Name           string                 `json:"name,omitempty" bson:"name,omitempty"`
+	Email          string                 `json:"email,omitempty" bson:"email,omitempty"`
+	Password       string                 `json:"password,omitempty" bson:"-"`
+	SealedPassword []byte                 `json:"-" bson:"sealed_password,omitempty"`
+	PasswordHash   string                 `json:"password_hash,omitempty" bson:"password_hash,omitempty"`
+	Attributes     map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	// Errors are set when the row couldn't be read, and fail it.
+	Errors []string `json:"errors,omitempty" bson:"errors,omitempty"`
+}
+
+const (
+	ImportCreated = "created"
+	ImportValid   = "valid" // passed a dry run
+	ImportFailed  = "failed"
+)
+
+// ImportResult is what happened to one row.
+type ImportResult struct {
+	Line   int      `json:"line" bson:"line"`
+	Email  string   `json:"email,omitempty" bson:"email,omitempty"`
+	Status string   `json:"status" bson:"status"`
+	UserID string   `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Errors []string `json:"errors,omitempty" bson:"errors,omitempty"`
+}
+
+// JobUserImport is the job type of bulk imports. Their rows are kept in
+// ImportBatches; their result is an ImportReport.
+const JobUserImport = "user.import"
+
+// ImportBatch is a run of an import's rows, in file order, and the results
+// of those imported so far. Seq numbers an import's batches from 0. Rows
+// are dropped once every one has a result.
+type ImportBatch struct {
+	ID        string         `bson:"_id"`
+	TenantID  string         `bson:"tenant_id"`
+	JobID     string         `bson:"job_id"`
+	Seq       int            `bson:"seq"`
+	Rows      []*ImportRow   `bson:"rows,omitempty"`
+	Results   []ImportResult `bson:"results,omitempty"`
+	ExpiresAt time.Time      `bson:"expires_at"`
+}
+
+// ImportReport counts what a bulk import has done so far. Per-row results
+// are in its batches.
+type ImportReport struct {
+	DryRun  bool `json:"dry_run"`
+	Created int  `json:"created"`
+	Failed  int  `json:"failed"`
+}
+
+const (
+	ImportRunning  = "running"
+	ImportFinished = "finished"
+)
+
+// ImportStatus is an import job as shown with its results at
+// /api/admin/users/import/:id. Status is running until the job has
+// finished, however it finished; JobStatus tells which way.
+type ImportStatus struct {
+	ID         string     `json:"id"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	DryRun     bool       `json:"dry_run"`
+	Status     string     `json:"status"`
+	JobStatus  string     `json:"job_status"`
+	Error      string     `json:"error,omitempty"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Created    int        `json:"created"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// JobProgress counts the units of work a job has done, out of Total if
+// known.
+type JobProgress struct {
+	Done  int `json:"done" bson:"done"`
+	Total int `json:"total" bson:"total"`
+}
+
+// JobOrigin is the request that enqueued a job. The job runs as its
+// principal, and its audit events carry the request's metadata.
+type JobOrigin struct {
+	Principal      *Principal `bson:"principal,omitempty"`
+	RequestID      string     `bson:"request_id,omitempty"`
+	IP             string     `bson:"ip,omitempty"`
+	UserAgent      string     `bson:"user_agent,omitempty"`
+	ActorID        string     `bson:"actor_id,omitempty"`
+	ActorType      string     `bson:"actor_type,omitempty"`
+	ImpersonatorID string     `bson:"impersonator_id,omitempty"`
+}
+
+// Job is a long-running operation run by the job workers outside any
+// request. Payload is its input and Result its output so far, both JSON in
+// a shape only the job's type knows. Result is saved with Progress, so a
+// job picked up again after a retry or a restart can carry on from there.
+type Job struct {
+	ID        string          `json:"id" bson:"_id"`
+	TenantID  string          `json:"-" bson:"tenant_id"`
+	Type      string          `json:"type" bson:"type"`
+	Status    string          `json:"status" bson:"status"`
+	CreatedBy string          `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	Origin    JobOrigin       `json:"-" bson:"origin"`
+	Payload   []byte          `json:"-" bson:"payload,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty" bson:"result,omitempty"`
+	Progress  JobProgress     `json:"progress" bson:"progress"`
+	// Attempts counts the times a worker has started the job, and Error is
+	// why the last attempt failed.
+	Attempts    int    `json:"attempts" bson:"attempts"`
+	MaxAttempts int    `json:"max_attempts" bson:"max_attempts"`
+	Error       string `json:"error,omitempty" bson:"error,omitempty"`
+	// CancelRequested stops a running job the next time its worker renews
+	// its lease.
+	CancelRequested bool `json:"cancel_requested,omitempty" bson:"cancel_requested"`
+	// RunAt is when a queued job may start; retries move it back.
+	RunAt time.Time `json:"run_at" bson:"run_at"`
+	// Owner is the worker running the job. It holds the job until
+	// LeaseUntil, after which another worker may take it over.
+	Owner      string     `json:"-" bson:"owner,omitempty"`
+	LeaseUntil time.Time  `json:"-" bson:"lease_until"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" bson:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	// ExpiresAt is when a finished job is deleted.
+	ExpiresAt *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// Finished reports whether the job has stopped for good.
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempt tracks failed logins for a single key (an account or a client IP).
+type LoginAttempt struct {
+	Key         string    `json:"key" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LastFailure time.Time `json:"last_failure" bson:"last_failure"`
+	LockedUntil time.Time `json:"locked_until" bson:"locked_until"`
+}
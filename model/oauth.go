@@ -0,0 +1,58 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthTokenType is the typ claim of access tokens issued to OAuth clients.
+// It sets them apart from the API's own tokens, which share the secret.
+const OAuthTokenType = "oauth-at+jwt"
+
+// OAuthClient is an application registered to sign users in through this
+// service. Public clients (SPAs, mobile apps) have no secret and rely on PKCE.
+type OAuthClient struct {
+	ID           string    `json:"client_id" bson:"_id"`
+	TenantID     string    `json:"tenant_id" bson:"tenant_id"`
+	Name         string    `json:"name" bson:"name"`
+	SecretHash   string    `json:"-" bson:"secret_hash,omitempty"`
+	Public       bool      `json:"public" bson:"public"`
+	RedirectURIs []string  `json:"redirect_uris" bson:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types" bson:"grant_types"`
+	Scopes       []string  `json:"scopes" bson:"scopes"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+func (c *OAuthClient) AllowsGrant(grant string) bool {
+	return slices.Contains(c.GrantTypes, grant)
+}
+
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthorizationCode is stored under a hash of the code handed to the client.
+type AuthorizationCode struct {
+	CodeHash      string    `bson:"_id"`
+	ClientID      string    `bson:"client_id"`
+	UserID        string    `bson:"user_id"`
+	RedirectURI   string    `bson:"redirect_uri"`
+	Scopes        []string  `bson:"scopes"`
+	Nonce         string    `bson:"nonce,omitempty"`
+	CodeChallenge string    `bson:"code_challenge"`
+	AuthTime      time.Time `bson:"auth_time"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
+
+// Consent records the scopes a user has granted to a client.
+type Consent struct {
+	UserID    string    `json:"user_id" bson:"user_id"`
+	ClientID  string    `json:"client_id" bson:"client_id"`
+	Scopes    []string  `json:"scopes" bson:"scopes"`
+	GrantedAt time.Time `json:"granted_at" bson:"granted_at"`
+}
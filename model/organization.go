@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// Organization roles apply within one organization and are separate from
+// the account-wide Role.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles lists the membership roles, most privileged first.
+var OrgRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember}
+
+type Organization struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	TenantID  string    `json:"-" bson:"tenant_id"`
+	Name      string    `json:"name" bson:"name"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// Role is the caller's role, filled in for listings.
+	Role string `json:"role,omitempty" bson:"-"`
+}
+
+type Membership struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	TenantID  string    `json:"-" bson:"tenant_id"`
+	OrgID     string    `json:"org_id" bson:"org_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Role      string    `json:"role" bson:"role"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// Name and Email of the member, filled in for listings.
+	Name  string `json:"name,omitempty" bson:"-"`
+	Email string `json:"email,omitempty" bson:"-"`
+}
+
+// Invitation is sent by email as a signed link naming it. The stored record
+// makes the link single-use.
+type Invitation struct {
+	ID         string     `json:"id" bson:"_id,omitempty"`
+	TenantID   string     `json:"-" bson:"tenant_id"`
+	OrgID      string     `json:"org_id" bson:"org_id"`
+	Email      string     `json:"email" bson:"email"`
+	Role       string     `json:"role" bson:"role"`
+	InvitedBy  string     `json:"invited_by" bson:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+}
@@ -0,0 +1,61 @@
+package model
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// Actions checked by the user service.
+const (
+	ActionUserCreate         = "user.create"
+	ActionUserRead           = "user.read"
+	ActionUserList           = "user.list"
+	ActionUserUpdate         = "user.update"
+	ActionUserDelete         = "user.delete"
+	ActionUserDisable        = "user.disable" // also re-enabling
+	ActionUserChangePassword = "user.change_password"
+)
+
+// PolicyRule allows or denies Actions when all Conditions hold. Actions may
+// end in "*" to match a prefix. Conditions have the form "<left> <op> <right>"
+// where each side is an attribute path (principal.roles, resource.id, action)
+// or a literal ("support", 3, true, ["a", "b"]), and op is one of ==, !=, in
+// or contains.
+type PolicyRule struct {
+	Name       string   `json:"name"`
+	Effect     string   `json:"effect"`
+	Actions    []string `json:"actions"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// AccessRequest is what a policy decides on. Attribute values are strings,
+// numbers, booleans, lists of those, or nested maps.
+type AccessRequest struct {
+	Principal map[string]interface{} `json:"principal"`
+	Action    string                 `json:"action"`
+	Resource  map[string]interface{} `json:"resource"`
+}
+
+// PolicyDecision is the outcome of evaluating a request, with the reasoning
+// for every rule so denials can be debugged.
+type PolicyDecision struct {
+	Allowed bool        `json:"allowed"`
+	Rule    string      `json:"rule,omitempty"` // the rule that decided, if any
+	Reason  string      `json:"reason"`
+	Trace   []RuleTrace `json:"trace"`
+}
+
+type RuleTrace struct {
+	Rule          string           `json:"rule"`
+	Effect        string           `json:"effect"`
+	ActionMatched bool             `json:"action_matched"`
+	Matched       bool             `json:"matched"`
+	Conditions    []ConditionTrace `json:"conditions,omitempty"`
+}
+
+type ConditionTrace struct {
+	Condition string      `json:"condition"`
+	Left      interface{} `json:"left"`
+	Right     interface{} `json:"right"`
+	Result    bool        `json:"result"`
+}
@@ -0,0 +1,86 @@
+package model
+
+import "slices"
+
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+	AuthMethodOAuth  = "oauth" // access token issued to an OAuth client
+)
+
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service" // a backend service acting as itself via client credentials
+)
+
+// Principal is the authenticated caller attached to a request by middleware.Auth.
+type Principal struct {
+	Type     string
+	TenantID string
+	UserID   string // empty for service principals
+	ClientID string // OAuth client the token was issued to, if any
+	Role     string
+	Method   string
+	// SessionID is the token family of the login session, if the token is
+	// tied to one.
+	SessionID string
+	// ActorID is the admin acting as UserID through impersonation.
+	ActorID string
+	// Groups are the IDs of the groups UserID is in, directly or nested, and
+	// Roles the roles they grant in addition to Role.
+	Groups []string
+	Roles  []string
+	// Scopes restricts what the caller may do. Nil means unrestricted, which
+	// is the case for interactive logins.
+	Scopes []string
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(RoleAdmin)
+}
+
+// HasRole reports whether the principal has role itself or through a group.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && (p.Role == role || slices.Contains(p.Roles, role))
+}
+
+func (p *Principal) IsService() bool {
+	return p != nil && p.Type == PrincipalService
+}
+
+func (p *Principal) IsImpersonated() bool {
+	return p != nil && p.ActorID != ""
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && (p.Scopes == nil || slices.Contains(p.Scopes, scope))
+}
+
+// Attributes describes the principal to authorization policies. roles holds
+// Role and the group roles together.
+func (p *Principal) Attributes() map[string]interface{} {
+	roles := []string{}
+	if p.Role != "" {
+		roles = append(roles, p.Role)
+	}
+	for _, r := range p.Roles {
+		if !slices.Contains(roles, r) {
+			roles = append(roles, r)
+		}
+	}
+	attrs := map[string]interface{}{
+		"type":         p.Type,
+		"id":           p.UserID,
+		"client_id":    p.ClientID,
+		"tenant":       p.TenantID,
+		"role":         p.Role,
+		"roles":        roles,
+		"groups":       append([]string{}, p.Groups...),
+		"method":       p.Method,
+		"impersonated": p.IsImpersonated(),
+	}
+	if p.Scopes != nil {
+		attrs["scopes"] = append([]string{}, p.Scopes...)
+	}
+	return attrs
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Session records a login. Family is embedded in every token issued for the
+// login as the "sid" claim, so revoking the session invalidates them all.
+type Session struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	TenantID   string    `json:"-" bson:"tenant_id"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Family     string    `json:"-" bson:"family"`
+	UserAgent  string    `json:"user_agent" bson:"user_agent"`
+	IP         string    `json:"ip" bson:"ip"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" bson:"expires_at"`
+	// Current marks the session of the caller in listings.
+	Current bool `json:"current" bson:"-"`
+}
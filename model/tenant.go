@@ -0,0 +1,15 @@
+package model
+
+import "regexp"
+
+// DefaultTenant owns requests that name no tenant and all data created
+// before multi-tenancy, so single-tenant deployments keep working unchanged.
+const DefaultTenant = "default"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidTenantID reports whether id can be used as a tenant ID. IDs double as
+// subdomain labels, so they follow the same rules.
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
@@ -2,10 +2,43 @@ package model
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID        string    `json:"id" bson:"_id,omitempty"`
+	TenantID  string    `json:"tenant_id" bson:"tenant_id"`
 	Name      string    `json:"name" bson:"name" validate:"required"`
 	Email     string    `json:"email" bson:"email" validate:"required,email"`
 	Password  string    `json:"-" bson:"password"`
+	Role      string    `json:"role" bson:"role"`
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// UpdatedAt is set by the repository on every write. It is the user's
+	// Last-Modified.
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// Disabled users can't sign in, and their sessions and API keys stop
+	// working. Provisioning clients disable users rather than delete them.
+	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	// Attributes holds the custom attributes defined for the tenant, keyed
+	// by AttributeDefinition.Name.
+	Attributes map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	// Identities are accounts at external providers that can sign in as this
+	// user. Users created through federation have no password.
+	Identities []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+	// Version starts at 1 and goes up with every write. It is the user's
+	// ETag, so clients can make updates conditional with If-Match.
+	Version int64 `json:"version" bson:"version"`
+}
+
+// UserFields is a partial update of a user. Nil fields are left as they
+// are. Attributes is the complete new set of custom attributes; an empty map
+// removes them all. A non-zero Version makes the update apply only if the
+// user is still at that version.
+type UserFields struct {
+	Name       *string
+	Email      *string
+	Attributes map[string]interface{}
+	Version    int64
 }
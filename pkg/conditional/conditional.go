@@ -0,0 +1,24 @@
+// Package conditional matches entity tags in the headers of conditional
+// requests (RFC 9110 section 13.1).
+package conditional
+
+import "strings"
+
+// Match reports whether header, "*" or a comma-separated list of entity
+// tags, names tag. Weak comparison, used for If-None-Match, ignores W/
+// prefixes. Strong comparison, used for If-Match, needs both tags to be
+// strong and the same.
+func Match(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		switch {
+		case candidate == "*":
+			return true
+		case weak && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/"):
+			return true
+		case !weak && candidate == tag && !strings.HasPrefix(tag, "W/"):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package conditional
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		header, tag string
+		weak, want  bool
+	}{
+		{`*`, `"1"`, false, true},
+		{`"1"`, `"1"`, false, true},
+		{`"1", "2"`, `"2"`, false, true},
+		{`"1","3"`, `"2"`, false, false},
+		{`W/"1"`, `"1"`, false, false},
+		{`W/"1"`, `W/"1"`, false, false},
+		{`W/"1"`, `"1"`, true, true},
+		{`"0", W/"1"`, `W/"1"`, true, true},
+		{``, `"1"`, true, false},
+	} {
+		if got := Match(tc.header, tc.tag, tc.weak); got != tc.want {
+			t.Errorf("Match(%q, %q, %v) = %v, want %v", tc.header, tc.tag, tc.weak, got, tc.want)
+		}
+	}
+}
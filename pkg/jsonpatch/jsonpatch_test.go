@@ -0,0 +1,99 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestMerge(t *testing.T) {
+	// Examples from RFC 7396 appendix A.
+	cases := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range cases {
+		doc := decode(t, tc.doc)
+		got := Merge(doc, decode(t, tc.patch))
+		if !reflect.DeepEqual(got, decode(t, tc.want)) {
+			t.Errorf("merge %s with %s = %v, want %s", tc.doc, tc.patch, got, tc.want)
+		}
+		if !reflect.DeepEqual(doc, decode(t, tc.doc)) {
+			t.Errorf("merge modified the document %s", tc.doc)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct{ doc, ops, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"baz"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`},
+		{`{"foo":{"bar":"baz"},"qux":{}}`, `[{"op":"move","from":"/foo/bar","path":"/qux/thud"}]`, `{"foo":{},"qux":{"thud":"baz"}}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"copy","from":"/a~1b","path":"/m~0n"}]`, `{"a/b":1,"m~n":1}`},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"remove","path":"/baz"}]`, `{}`},
+	}
+	for _, tc := range cases {
+		var ops []Operation
+		if err := json.Unmarshal([]byte(tc.ops), &ops); err != nil {
+			t.Fatalf("decode ops: %v", err)
+		}
+		doc := decode(t, tc.doc)
+		got, err := Apply(doc, ops)
+		if err != nil {
+			t.Fatalf("apply %s to %s: %v", tc.ops, tc.doc, err)
+		}
+		if !reflect.DeepEqual(got, decode(t, tc.want)) {
+			t.Errorf("apply %s to %s = %v, want %s", tc.ops, tc.doc, got, tc.want)
+		}
+		if !reflect.DeepEqual(doc, decode(t, tc.doc)) {
+			t.Errorf("apply modified the document %s", tc.doc)
+		}
+	}
+
+	failures := []string{
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"replace","path":"/missing","value":1}]`,
+		`[{"op":"add","path":"/a/b/c","value":1}]`,
+		`[{"op":"add","path":"/list/5","value":1}]`,
+		`[{"op":"add","path":"/list/01","value":1}]`,
+		`[{"op":"add","path":"/x"}]`,
+		`[{"op":"add","path":"x","value":1}]`,
+		`[{"op":"move","from":"/a","path":"/a/b"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+	}
+	for _, f := range failures {
+		var ops []Operation
+		json.Unmarshal([]byte(f), &ops)
+		if _, err := Apply(decode(t, `{"a":{},"list":[1]}`), ops); err == nil {
+			t.Errorf("expected %s to fail", f)
+		}
+	}
+
+	var ops []Operation
+	json.Unmarshal([]byte(`[{"op":"test","path":"/a","value":2}]`), &ops)
+	if _, err := Apply(decode(t, `{"a":1}`), ops); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected ErrTestFailed, got %v", err)
+	}
+}
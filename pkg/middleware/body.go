@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"io"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit reads request bodies of up to limit bytes into memory and
+// answers 413 to larger ones. It is for servers with StreamRequestBody on,
+// which hands bodies over the limit to handlers as streams: every route
+// then still sees its whole body, bounded as before, except the paths in
+// streamed, which read the stream themselves.
+func BodyLimit(limit int, streamed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := c.Request()
+		if !req.IsBodyStream() || slices.Contains(streamed, c.Path()) {
+			return c.Next()
+		}
+		if req.Header.ContentLength() > limit {
+			return tooLarge(c)
+		}
+		// Chunked bodies don't say their length up front.
+		body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if len(body) > limit {
+			return tooLarge(c)
+		}
+		req.SetBody(body)
+		return c.Next()
+	}
+}
+
+// tooLarge also closes the connection, since the rest of the body is left
+// unread on it.
+func tooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Request body is too large"})
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimit(t *testing.T) {
+	app := fiber.New(fiber.Config{BodyLimit: 16, StreamRequestBody: true})
+	app.Use(BodyLimit(16, "/stream"))
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	app.Post("/stream", func(c *fiber.Ctx) error {
+		n, err := io.Copy(io.Discard, c.Context().RequestBodyStream())
+		if err != nil {
+			return err
+		}
+		return c.JSON(n)
+	})
+	post := func(path, body string, chunked bool) (int, string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("post %s failed: %v", path, err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	if status, body := post("/echo", "small body", false); status != 200 || body != "small body" {
+		t.Fatalf("small body: %d %q", status, body)
+	}
+	if status, body := post("/echo", "small body", true); status != 200 || body != "small body" {
+		t.Fatalf("small chunked body: %d %q", status, body)
+	}
+	large := strings.Repeat("x", 100)
+	if status, _ := post("/echo", large, false); status != 413 {
+		t.Fatalf("large body: status=%d", status)
+	}
+	if status, _ := post("/echo", large, true); status != 413 {
+		t.Fatalf("large chunked body: status=%d", status)
+	}
+	if status, body := post("/stream", large, false); status != 200 || body != "100" {
+		t.Fatalf("streamed body: %d %q", status, body)
+	}
+}
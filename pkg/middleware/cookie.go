@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CSRFHeader must echo the CSRF cookie on state-changing requests that are
+// authenticated by the session cookie.
+const CSRFHeader = "X-CSRF-Token"
+
+// CookieConfig describes the session and CSRF cookies for browser clients.
+type CookieConfig struct {
+	Name     string // HttpOnly cookie holding the access token
+	CSRFName string // readable by scripts so they can echo it in CSRFHeader
+	Domain   string
+	Secure   bool
+	SameSite string // "Strict", "Lax" or "None"
+	MaxAge   time.Duration
+}
+
+// SetSessionCookies stores token in the session cookie alongside a fresh CSRF
+// token, which is returned so the client can use it right away.
+func SetSessionCookies(c *fiber.Ctx, cfg CookieConfig, token string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	csrf := base64.RawURLEncoding.EncodeToString(b)
+
+	c.Cookie(cfg.cookie(cfg.Name, token, true))
+	c.Cookie(cfg.cookie(cfg.CSRFName, csrf, false))
+	return csrf, nil
+}
+
+// ClearSessionCookies expires both cookies.
+func ClearSessionCookies(c *fiber.Ctx, cfg CookieConfig) {
+	for _, name := range []string{cfg.Name, cfg.CSRFName} {
+		cookie := cfg.cookie(name, "", name == cfg.Name)
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+		c.Cookie(cookie)
+	}
+}
+
+func (cfg CookieConfig) cookie(name, value string, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cfg.Domain,
+		MaxAge:   int(cfg.MaxAge.Seconds()),
+		Secure:   cfg.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: cfg.SameSite,
+	}
+}
+
+// checkCSRF implements the double-submit check: the header must match the
+// CSRF cookie, which another site can neither read nor set a matching header for.
+func checkCSRF(c *fiber.Ctx, cfg CookieConfig) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	cookie := c.Cookies(cfg.CSRFName)
+	header := c.Get(CSRFHeader)
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// IdempotencyKeyHeader names a POST so that retries of it are answered
+	// with the first response instead of running again.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on replayed responses.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// Idempotency stores the response to the first POST a caller makes with an
+// Idempotency-Key and replays it to retries for ttl, or a day if zero.
+// Requests are told apart by an HMAC of their body keyed with secret, so
+// the store can't be used to guess bodies such as passwords; streamed
+// bodies, which would have to be read whole, only by their type and length.
+// Keys are scoped to the tenant and the authenticated caller, or shared by
+// anonymous callers, so clients should use random values such as UUIDs.
+// Reusing a key for a different method, path or body answers 422, and
+// retrying while the first request is still running answers 409. Server
+// errors are not stored, so the request can be retried. Requests without
+// the header are unaffected.
+//
+// Responses are stored as sent, so don't use it on routes that return
+// secrets such as tokens or API keys.
+func Idempotency(store ports.IdempotencyStore, secret string, ttl time.Duration) fiber.Handler {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" || c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		ctx := c.UserContext()
+		sum := hmac.New(sha256.New, []byte(secret))
+		sum.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+		if c.Request().IsBodyStream() {
+			fmt.Fprintf(sum, "%s %d", c.Get(fiber.HeaderContentType), c.Request().Header.ContentLength())
+		} else {
+			sum.Write(c.Body())
+		}
+		req := &model.IdempotentRequest{
+			Key:         idempotencyScope(c) + key,
+			Fingerprint: hex.EncodeToString(sum.Sum(nil)),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		first, err := store.Reserve(ctx, req)
+		if err != nil {
+			return err
+		}
+		if first != nil {
+			switch {
+			case first.Fingerprint != req.Fingerprint:
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+			case !first.Done:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still in progress"})
+			}
+			c.Set(IdempotentReplayedHeader, "true")
+			if first.Location != "" {
+				c.Set(fiber.HeaderLocation, first.Location)
+			}
+			if first.ContentType != "" {
+				c.Set(fiber.HeaderContentType, first.ContentType)
+			}
+			return c.Status(first.Status).Send(first.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			store.Release(ctx, req.Key)
+			return err
+		}
+		res := c.Response()
+		if res.StatusCode() >= fiber.StatusInternalServerError {
+			return store.Release(ctx, req.Key)
+		}
+		req.Done = true
+		req.Status = res.StatusCode()
+		req.ContentType = string(res.Header.ContentType())
+		req.Location = string(res.Header.Peek(fiber.HeaderLocation))
+		req.Body = append([]byte(nil), res.Body()...)
+		if err := store.Complete(ctx, req); err != nil {
+			// Retries would otherwise see the request as running until
+			// the key expires.
+			store.Release(ctx, req.Key)
+		}
+		return nil
+	}
+}
+
+// idempotencyScope keeps callers from seeing each other's responses.
+// Impersonated requests are kept apart from the user's own.
+func idempotencyScope(c *fiber.Ctx) string {
+	parts := []string{ports.TenantFrom(c.UserContext()), "anonymous"}
+	if p := CurrentPrincipal(c); p != nil {
+		parts[1] = p.Type + ":" + p.UserID + ":" + p.ClientID + ":" + p.ActorID
+	}
+	return strings.Join(parts, "|") + "|"
+}
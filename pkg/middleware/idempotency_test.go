@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http/httptest"
+	"register/adapter/repository"
+	"register/core/ports"
+	"register/model"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Post("/things", Idempotency(repository.NewMemoryIdempotencyStore(), "secret", 0), func(c *fiber.Ctx) error {
+		calls++
+		if string(c.Body()) == "fail" {
+			return c.Status(fiber.StatusServiceUnavailable).SendString("try again")
+		}
+		c.Location("/things/1")
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"call": calls})
+	})
+	post := func(key, body string) (int, string, string) {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("post failed: %v", err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out), resp.Header.Get(IdempotentReplayedHeader)
+	}
+
+	status, first, _ := post("k1", "a")
+	if status != 201 || first != `{"call":1}` {
+		t.Fatalf("first request: %d %s", status, first)
+	}
+	status, body, replayed := post("k1", "a")
+	if status != 201 || body != first || replayed != "true" || calls != 1 {
+		t.Fatalf("retry: %d %s replayed=%q calls=%d", status, body, replayed, calls)
+	}
+	if status, _, _ := post("k1", "b"); status != 422 {
+		t.Fatalf("reused key with another body: status=%d", status)
+	}
+	if _, body, _ := post("", "a"); body != `{"call":2}` {
+		t.Fatalf("request without a key was not run: %s", body)
+	}
+
+	// Server errors aren't kept, so the retry runs.
+	post("k2", "fail")
+	if status, _, replayed := post("k2", "fail"); status != 503 || replayed != "" || calls != 4 {
+		t.Fatalf("retry after a server error: status=%d replayed=%q calls=%d", status, replayed, calls)
+	}
+}
+
+// recordingStore keeps what the middleware asked it to store.
+type recordingStore struct {
+	ports.IdempotencyStore
+	reserved []*model.IdempotentRequest
+}
+
+func (s *recordingStore) Reserve(ctx context.Context, req *model.IdempotentRequest) (*model.IdempotentRequest, error) {
+	cp := *req
+	s.reserved = append(s.reserved, &cp)
+	return s.IdempotencyStore.Reserve(ctx, req)
+}
+
+func TestIdempotencyFingerprintIsKeyed(t *testing.T) {
+	store := &recordingStore{IdempotencyStore: repository.NewMemoryIdempotencyStore()}
+	app := fiber.New()
+	app.Post("/register", Idempotency(store, "secret", 0), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	body := `{"email":"a@example.com","password":"hunter22"}`
+	req := httptest.NewRequest("POST", "/register", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+
+	if len(store.reserved) != 1 {
+		t.Fatalf("reserved %d requests", len(store.reserved))
+	}
+	stored := store.reserved[0]
+	plain := sha256.New()
+	plain.Write([]byte("POST /register\n" + body))
+	for _, unwanted := range []string{"hunter22", hex.EncodeToString(plain.Sum(nil))} {
+		if strings.Contains(stored.Fingerprint, unwanted) || strings.Contains(string(stored.Body), unwanted) {
+			t.Errorf("stored request holds %q: %+v", unwanted, stored)
+		}
+	}
+	bodyOnly := sha256.Sum256([]byte(body))
+	if stored.Fingerprint == hex.EncodeToString(bodyOnly[:]) || stored.Fingerprint == "" {
+		t.Errorf("fingerprint is a plain hash of the body: %s", stored.Fingerprint)
+	}
+}
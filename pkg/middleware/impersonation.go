@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImpersonatedRequest describes a request made with an impersonation token.
+type ImpersonatedRequest struct {
+	ActorID string
+	UserID  string
+	Method  string
+	Path    string
+	Status  int
+	IP      string
+	At      time.Time
+}
+
+// RecordImpersonation calls record after every request made while
+// impersonating, including rejected ones. It must run after Auth.
+func RecordImpersonation(record func(c *fiber.Ctx, r ImpersonatedRequest)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p := CurrentPrincipal(c)
+		if !p.IsImpersonated() {
+			return c.Next()
+		}
+
+		err := c.Next()
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		record(c, ImpersonatedRequest{
+			ActorID: p.ActorID,
+			UserID:  p.UserID,
+			Method:  c.Method(),
+			Path:    c.OriginalURL(),
+			Status:  status,
+			IP:      c.IP(),
+			At:      time.Now(),
+		})
+		return err
+	}
+}
@@ -1,23 +1,121 @@
 package middleware
 
 import (
+	"register/core/ports"
+	"register/model"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt"
 )
 
-func Auth(secret string) fiber.Handler {
+const principalKey = "principal"
+
+type authConfig struct {
+	apiKeys  ports.APIKeyService
+	sessions ports.SessionService
+	groups   ports.GroupService
+	cookie   *CookieConfig
+	noHeader bool
+}
+
+type AuthOption func(*authConfig)
+
+// WithAPIKeys lets Auth accept API keys, either as a Bearer token or in the
+// X-API-Key header, alongside JWTs.
+func WithAPIKeys(keys ports.APIKeyService) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.apiKeys = keys
+	}
+}
+
+// WithSessions rejects tokens whose login session was revoked and keeps the
+// session's last-seen time current.
+func WithSessions(sessions ports.SessionService) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.sessions = sessions
+	}
+}
+
+// WithGroups adds the caller's groups, including nested ones, and the roles
+// they grant to user principals. Impersonated principals get the groups but
+// not their roles, so impersonation can't pick up admin through a group.
+func WithGroups(groups ports.GroupService) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.groups = groups
+	}
+}
+
+// WithCookie lets Auth read the access token from the session cookie set by a
+// cookie-mode login. Such requests must pass the CSRF check unless they are
+// safe (GET, HEAD, OPTIONS).
+func WithCookie(cookie CookieConfig) AuthOption {
+	return func(cfg *authConfig) {
+		cfg.cookie = &cookie
+	}
+}
+
+// WithoutHeader stops Auth from reading the Authorization and X-API-Key
+// headers, for route groups meant only for browser sessions. Use it with
+// WithCookie.
+func WithoutHeader() AuthOption {
+	return func(cfg *authConfig) {
+		cfg.noHeader = true
+	}
+}
+
+func Auth(secret string, opts ...AuthOption) fiber.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+		var tokenStr string
+		if !cfg.noHeader {
+			tokenStr = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+			if key := c.Get("X-API-Key"); tokenStr == "" && key != "" {
+				tokenStr = key
+			}
+		}
+
+		// The header wins so API clients are never subject to the CSRF check.
+		fromCookie := false
+		if tokenStr == "" && cfg.cookie != nil {
+			tokenStr = c.Cookies(cfg.cookie.Name)
+			fromCookie = tokenStr != ""
+		}
 
 		if tokenStr == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
 		}
 
+		if fromCookie && !checkCSRF(c, *cfg.cookie) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Invalid CSRF token"})
+		}
+
+		if cfg.apiKeys != nil && !fromCookie && strings.HasPrefix(tokenStr, model.APIKeyPrefix) {
+			principal, err := cfg.apiKeys.Authenticate(c.UserContext(), tokenStr)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+			}
+			if !bindTenant(c, principal) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Credentials belong to another tenant"})
+			}
+			if err := addGroups(c, cfg.groups, principal); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not resolve groups"})
+			}
+			c.Locals(principalKey, principal)
+			c.SetUserContext(ports.WithPrincipal(c.UserContext(), principal))
+			setActor(c, principal)
+			return c.Next()
+		}
+
 		// Parse Token
 		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, jwt.ErrSignatureInvalid
+			}
 			return []byte(secret), nil
 		})
 
@@ -25,6 +123,151 @@ func Auth(secret string) fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 		}
 
+		claims, _ := token.Claims.(jwt.MapClaims)
+		// Single-purpose tokens (e.g. password reset) are signed with keys
+		// derived from the secret and fail above; refuse any that claim a
+		// purpose anyway.
+		if _, ok := claims["purpose"]; ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		// Tokens for OAuth clients must say so; older ones without typ still
+		// carry the user's role.
+		if _, ok := claims["client_id"]; ok && claims["typ"] != model.OAuthTokenType {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		principal := principalFromClaims(claims)
+		if !bindTenant(c, principal) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Credentials belong to another tenant"})
+		}
+		if cfg.sessions != nil && principal.SessionID != "" {
+			if err := cfg.sessions.Touch(c.UserContext(), principal.SessionID); err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session revoked"})
+			}
+		}
+		if err := addGroups(c, cfg.groups, principal); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not resolve groups"})
+		}
+		c.Locals(principalKey, principal)
+		c.SetUserContext(ports.WithPrincipal(c.UserContext(), principal))
+		setActor(c, principal)
+
+		return c.Next()
+	}
+}
+
+func principalFromClaims(claims jwt.MapClaims) *model.Principal {
+	userID, _ := claims["user_id"].(string)
+	role, _ := claims["role"].(string)
+	clientID, _ := claims["client_id"].(string)
+	p := &model.Principal{Type: model.PrincipalUser, UserID: userID, ClientID: clientID, Role: role, Method: model.AuthMethodJWT}
+	if claims["typ"] == model.OAuthTokenType {
+		// A client acting for a user gets its scopes, never the user's role.
+		p.Method = model.AuthMethodOAuth
+		p.Role = ""
+	}
+	if claims["principal_type"] == model.PrincipalService {
+		// Service tokens carry no user; the client is the principal.
+		p.Type = model.PrincipalService
+		p.UserID = ""
+		p.Role = ""
+	}
+	// Tokens issued before multi-tenancy have no tenant_id.
+	if p.TenantID, _ = claims["tenant_id"].(string); p.TenantID == "" {
+		p.TenantID = model.DefaultTenant
+	}
+	p.SessionID, _ = claims["sid"].(string)
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		p.ActorID, _ = act["sub"].(string)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	}
+	return p
+}
+
+func addGroups(c *fiber.Ctx, groups ports.GroupService, p *model.Principal) error {
+	if groups == nil || p.Type != model.PrincipalUser || p.UserID == "" {
+		return nil
+	}
+	eff, err := groups.Effective(c.UserContext(), p.UserID)
+	if err != nil {
+		return err
+	}
+	p.Groups = eff.GroupIDs
+	if !p.IsImpersonated() && p.Method != model.AuthMethodOAuth {
+		p.Roles = eff.Roles
+	}
+	return nil
+}
+
+// CurrentPrincipal returns the principal set by Auth, or nil on public routes.
+func CurrentPrincipal(c *fiber.Ctx) *model.Principal {
+	p, _ := c.Locals(principalKey).(*model.Principal)
+	return p
+}
+
+// RequireRole must run after Auth. Roles granted through groups count.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !CurrentPrincipal(c).HasRole(role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireAdmin must run after Auth. Admins, by role or through a group,
+// pass only if their credentials also carry the admin scope, so a scoped
+// API key of an admin can't reach admin routes unless it was granted it.
+// OAuth clients never pass.
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p := CurrentPrincipal(c); !p.IsAdmin() || !p.HasScope(model.ScopeAdmin) || p.Method == model.AuthMethodOAuth {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireScope must run after Auth. Principals without scope restrictions
+// always pass.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !CurrentPrincipal(c).HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient scope"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireUser rejects service principals, for routes that act on behalf of
+// the signed-in user.
+func RequireUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p := CurrentPrincipal(c); p == nil || p.Type != model.PrincipalUser {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireInteractive rejects machine credentials such as API keys, for
+// operations that should only be done by a signed-in user.
+func RequireInteractive() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p := CurrentPrincipal(c); p == nil || p.Method != model.AuthMethodJWT {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+// DenyImpersonation blocks impersonated tokens from sensitive operations.
+func DenyImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if CurrentPrincipal(c).IsImpersonated() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+		}
 		return c.Next()
 	}
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestAuthSources(t *testing.T) {
+	cookie := CookieConfig{Name: "session", CSRFName: "csrf_token"}
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/header", Auth("secret"), ok)
+	app.Get("/both", Auth("secret", WithCookie(cookie)), ok)
+	app.Get("/cookie", Auth("secret", WithCookie(cookie), WithoutHeader()), ok)
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "u1",
+		"role":    "user",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	send := func(path string, header, withCookie bool) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if header {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		path           string
+		header, cookie bool
+		want           int
+	}{
+		{"/header", true, false, 204},
+		{"/header", false, true, 401},
+		{"/both", true, false, 204},
+		{"/both", false, true, 204},
+		{"/cookie", false, true, 204},
+		{"/cookie", true, false, 401},
+	} {
+		if got := send(tc.path, tc.header, tc.cookie); got != tc.want {
+			t.Errorf("%s header=%v cookie=%v: status=%d, want %d", tc.path, tc.header, tc.cookie, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"register/core/ports"
+	"register/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDHeader carries the request ID; an incoming value is reused so IDs
+// can be correlated across services.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestMeta stores the request ID, client IP and user agent in the user
+// context, where services read them for audit events. Auth adds the caller.
+// Handlers must pass c.UserContext() to services for this to reach them.
+func RequestMeta() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 12)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(RequestIDHeader, id)
+
+		c.SetUserContext(ports.WithRequestMeta(c.UserContext(), &ports.RequestMeta{
+			RequestID: id,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+		}))
+		return c.Next()
+	}
+}
+
+// setActor records the authenticated principal in the request metadata.
+func setActor(c *fiber.Ctx, p *model.Principal) {
+	meta := ports.RequestMetaFrom(c.UserContext())
+	if meta == nil {
+		return
+	}
+	meta.ActorType = p.Type
+	meta.ActorID = p.UserID
+	if p.IsService() {
+		meta.ActorID = p.ClientID
+	}
+	meta.ImpersonatorID = p.ActorID
+}
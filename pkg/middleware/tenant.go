@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net"
+	"register/core/ports"
+	"register/model"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestedTenantKey holds the tenant the request named explicitly, if any.
+const requestedTenantKey = "requested_tenant"
+
+type TenantConfig struct {
+	// Header names the request header carrying the tenant ID; empty ignores headers.
+	Header string
+	// BaseDomain makes the first label of <tenant>.<BaseDomain> hosts the tenant.
+	BaseDomain string
+	// Tenants limits which tenant IDs are accepted; empty accepts any valid ID.
+	Tenants []string
+}
+
+// Tenant resolves the tenant from the configured header, then the subdomain,
+// and scopes the user context to it. Requests naming neither use
+// model.DefaultTenant. On authenticated routes the token's tenant_id claim
+// decides instead, and Auth rejects a token for a different tenant than the
+// one named.
+func Tenant(cfg TenantConfig) fiber.Handler {
+	base := strings.ToLower(strings.TrimPrefix(cfg.BaseDomain, "."))
+	return func(c *fiber.Ctx) error {
+		var id string
+		if cfg.Header != "" {
+			id = strings.ToLower(strings.TrimSpace(c.Get(cfg.Header)))
+		}
+		if id == "" && base != "" {
+			host := strings.ToLower(c.Hostname())
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			id, _ = strings.CutSuffix(host, "."+base)
+			if id == host {
+				id = ""
+			}
+		}
+		if id == "" {
+			c.SetUserContext(ports.WithTenant(c.UserContext(), model.DefaultTenant))
+			return c.Next()
+		}
+
+		if !model.ValidTenantID(id) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tenant"})
+		}
+		if len(cfg.Tenants) > 0 && !slices.Contains(cfg.Tenants, id) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown tenant"})
+		}
+		c.Locals(requestedTenantKey, id)
+		c.SetUserContext(ports.WithTenant(c.UserContext(), id))
+		return c.Next()
+	}
+}
+
+// bindTenant scopes the request to the principal's tenant. A request that
+// named another tenant is refused rather than silently switched.
+func bindTenant(c *fiber.Ctx, p *model.Principal) bool {
+	if requested, _ := c.Locals(requestedTenantKey).(string); requested != "" && requested != p.TenantID {
+		return false
+	}
+	c.SetUserContext(ports.WithTenant(c.UserContext(), p.TenantID))
+	return true
+}